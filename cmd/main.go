@@ -1,6 +1,10 @@
 package main
 
-import "github.com/Heatdog/Avito/internal/app"
+import (
+	_ "time/tzdata" // часовые пояса расписаний баннеров, в образе alpine нет zoneinfo
+
+	"github.com/Heatdog/Avito/internal/app"
+)
 
 func main() {
 	app.App()
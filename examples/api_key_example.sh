@@ -0,0 +1,55 @@
+# api key examples
+# секрет ключа администратора задается переменной BOOTSTRAP_KEY при запуске сервиса
+
+# ------------------------ Create ------------------------
+
+curl -X 'POST' \
+  'http://localhost:8080/api_key' \
+  -H 'accept: application/json' \
+  -H 'token: admin_token' \
+  -H 'Content-Type: application/json' \
+  -d '{
+  "name": "banner-client",
+  "role": "user",
+  "expires_at": "2030-01-01T00:00:00Z"
+}'
+
+# response 201
+:`
+{"key":"5d0f3c...","id":2}
+`
+
+# ------------------------ List ------------------------
+
+curl -X 'GET' \
+  'http://localhost:8080/api_key' \
+  -H 'accept: application/json' \
+  -H 'token: admin_token'
+
+# response 200
+:`
+[{"expires_at":null,"revoked_at":null,"created_at":"2024-04-10T14:22:46.636712Z","updated_at":"2024-04-10T14:22:46.636712Z",
+"name":"bootstrap","role":"admin","id":1},{"expires_at":"2030-01-01T00:00:00Z","revoked_at":null,
+"created_at":"2024-04-10T14:25:19.889336Z","updated_at":"2024-04-10T14:25:19.889336Z","name":"banner-client","role":"user","id":2}]
+`
+
+# ------------------------ Rotate ------------------------
+
+curl -X 'POST' \
+  'http://localhost:8080/api_key/2/rotate' \
+  -H 'accept: application/json' \
+  -H 'token: admin_token'
+
+# response 200
+:`
+{"key":"a81be2...","id":2}
+`
+
+# ------------------------ Revoke ------------------------
+
+curl -X 'DELETE' \
+  'http://localhost:8080/api_key/2' \
+  -H 'accept: */*' \
+  -H 'token: admin_token'
+
+# response 204
@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/Heatdog/Avito/docs" // docs
@@ -13,18 +18,39 @@ import (
 
 	"github.com/Heatdog/Avito/internal/config"
 	"github.com/Heatdog/Avito/internal/migrations"
+	apikey_model "github.com/Heatdog/Avito/internal/models/apikey"
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	apikey_postgre "github.com/Heatdog/Avito/internal/repository/apikey/postgre"
 	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
+	apikey_service "github.com/Heatdog/Avito/internal/service/apikeyservice"
 	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
+	apikeys_transport "github.com/Heatdog/Avito/internal/transport/apikeys"
 	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
 	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
+	probe_transport "github.com/Heatdog/Avito/internal/transport/probe"
+	"github.com/Heatdog/Avito/pkg/cache"
 	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
+	nopcache "github.com/Heatdog/Avito/pkg/cache/nop"
+	rediscache "github.com/Heatdog/Avito/pkg/cache/redis"
+	tieredcache "github.com/Heatdog/Avito/pkg/cache/tiered"
 	"github.com/Heatdog/Avito/pkg/client/postgre"
+	"github.com/Heatdog/Avito/pkg/clock"
+	"github.com/Heatdog/Avito/pkg/counter"
+	memorycounter "github.com/Heatdog/Avito/pkg/counter/memory"
+	rediscounter "github.com/Heatdog/Avito/pkg/counter/redis"
+	"github.com/Heatdog/Avito/pkg/geo"
+	filegeo "github.com/Heatdog/Avito/pkg/geo/file"
+	"github.com/Heatdog/Avito/pkg/token"
+	jwttoken "github.com/Heatdog/Avito/pkg/token/jwt_token"
 	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
+// shutdownTimeout ограничивает завершение запросов, которые сервер обрабатывает в момент остановки
+const shutdownTimeout = 15 * time.Second
+
 // swag init --pd -g internal/app/app.go
 
 // @title Сервис баннеров
@@ -44,12 +70,32 @@ func App() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
 	slog.SetDefault(logger)
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	logger.Info("reading server config files")
 
 	cfg := config.NewConfigStorage(logger)
 
+	probeHandler := probe_transport.NewProbeHandler(logger)
+	probeRouter := mux.NewRouter()
+	probeHandler.Register(probeRouter)
+
+	probeHost := fmt.Sprintf("%s:%d", cfg.Server.IP, cfg.Server.ProbePort)
+	logger.Info("listen probes", slog.String("host", probeHost))
+
+	probeServer := &http.Server{
+		Handler:           probeRouter,
+		Addr:              probeHost,
+		ReadHeaderTimeout: 3 * time.Second,
+	}
+
+	go func() {
+		if err := probeServer.ListenAndServe(); err != nil {
+			logger.Error(err.Error())
+		}
+	}()
+
 	logger.Info("connecting to DataBase")
 
 	dbClient, err := postgre.NewPostgreClient(ctx, cfg.Postgre)
@@ -66,13 +112,84 @@ func App() {
 		logger.Error(err.Error())
 	}
 
-	logger.Info("init cache")
+	logger.Info("init cache", slog.String("backend", cfg.Cache.Backend))
 
-	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](cfg.Cache.Size, nil,
+	var redisClient *redis.Client
+
+	if cfg.Cache.Backend == "redis" || cfg.Cache.Backend == "tiered" {
+		redisClient, err = rediscache.NewRedisClient(ctx, &cfg.Redis, cfg.Redis.Database)
+		if err != nil {
+			logger.Error("connection to Redis failed", slog.Any("error", err))
+			panic(err)
+		}
+
+		defer redisClient.Close()
+	}
+
+	cache := newBannerCache[*banner_model.Banner](cfg, logger, redisClient, "banner:",
 		time.Minute*time.Duration(cfg.Cache.TTL))
-	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
+	missingCache := newBannerCache[struct{}](cfg, logger, redisClient, "missing_banner:",
+		time.Second*time.Duration(cfg.Cache.MissingTTL))
+
+	logger.Info("listen cache invalidations", slog.String("channel", banner_postgre.NotifyChannel))
+
+	generation := banner_service.NewCacheGeneration()
+	invalidator := banner_service.NewCacheInvalidator(logger, cache, missingCache, generation)
+	listener := postgre.NewListener(logger, cfg.Postgre, banner_postgre.NotifyChannel)
 
-	tokenProvider := simpletoken.NewSimpleTokenProvider()
+	go listener.Listen(ctx, invalidator.HandleNotification, invalidator.Reset)
+
+	logger.Info("init token provider", slog.String("provider", cfg.Token.Provider))
+
+	apiKeyLRU := expirable.NewLRU[string, apikey_model.APIKey](cfg.Token.CacheSize, nil,
+		time.Second*time.Duration(cfg.Token.CacheTTL))
+	missingAPIKeyLRU := expirable.NewLRU[string, struct{}](cfg.Token.CacheSize, nil,
+		time.Second*time.Duration(cfg.Token.MissingTTL))
+	apiKeyCache := hashicorp_lru.NewLRU(logger, apiKeyLRU)
+	apiKeyRepo := apikey_postgre.NewAPIKeyRepository(logger, dbClient)
+	apiKeyService := apikey_service.NewAPIKeyService(logger, apiKeyRepo, apiKeyCache,
+		hashicorp_lru.NewLRU(logger, missingAPIKeyLRU))
+
+	var tokenProvider token.Provider
+
+	switch cfg.Token.Provider {
+	case "api_key":
+		if cfg.Token.BootstrapKey == "" {
+			logger.Error("bootstrap key is not set")
+			panic("bootstrap key is not set, use BOOTSTRAP_KEY")
+		}
+
+		if err = apiKeyService.Bootstrap(ctx, "bootstrap", cfg.Token.BootstrapKey); err != nil {
+			logger.Error("api key bootstrap failed", slog.Any("error", err))
+		}
+
+		logger.Info("listen api key invalidations", slog.String("channel", apikey_postgre.NotifyChannel))
+
+		apiKeyInvalidator := apikey_service.NewCacheInvalidator(logger, apiKeyCache)
+		apiKeyListener := postgre.NewListener(logger, cfg.Postgre, apikey_postgre.NotifyChannel)
+
+		go apiKeyListener.Listen(ctx, apiKeyInvalidator.HandleNotification, apiKeyInvalidator.Reset)
+
+		tokenProvider = apiKeyService
+	case "jwt":
+		tokenProvider, err = jwttoken.NewJWTTokenProvider(logger, cfg.PasswordKey, cfg.Token.RoleClaim)
+		if err != nil {
+			logger.Error("jwt token provider init failed", slog.Any("error", err))
+			panic("jwt signing key is not set or too short, use JWT_KEY")
+		}
+	case "simple":
+		if !cfg.Token.AllowDevTokens {
+			logger.Error("simple token provider is disabled")
+			panic("simple token provider is for development only, set token_settings.allow_dev_tokens")
+		}
+
+		logger.Warn("simple token provider accepts shared role tokens, do not use it outside development")
+
+		tokenProvider = simpletoken.NewSimpleTokenProvider()
+	default:
+		logger.Error("unknown token provider", slog.String("provider", cfg.Token.Provider))
+		panic(fmt.Sprintf("unknown token provider %q", cfg.Token.Provider))
+	}
 
 	logger.Debug("register middlewre")
 	middleware := middleware_transport.NewMiddleware(logger, tokenProvider)
@@ -80,12 +197,86 @@ func App() {
 	router := mux.NewRouter()
 	router.Use(middleware.Logging)
 
+	locator := middleware_transport.NewLocator(logger, newGeoDatabase(ctx, cfg, logger),
+		trustedProxies(cfg, logger))
+	router.Use(locator.Locate)
+
 	logger.Debug("register banners handler")
-	bannerRepo := banner_postgre.NewBannerRepository(logger, dbClient)
-	bannerService := banner_service.NewBannerService(logger, bannerRepo, cache, tokenProvider)
+
+	if cfg.Banner.VersionRetention < 0 {
+		logger.Error("negative version retention", slog.Int("retention", cfg.Banner.VersionRetention))
+		panic("version_retention must not be negative")
+	}
+
+	bannerRepo := banner_postgre.NewBannerRepository(logger, dbClient, cfg.Banner.VersionRetention)
+	eventRecorder := banner_service.NewEventRecorder(logger, bannerRepo, cfg.Events.BatchSize,
+		time.Millisecond*time.Duration(cfg.Events.FlushInterval))
+
+	// события принимаются, пока сервер завершает запросы, поэтому запись останавливается после сервера
+	recorderCtx, stopRecorder := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopRecorder()
+
+	recorderDone := make(chan struct{})
+
+	go func() {
+		eventRecorder.Run(recorderCtx)
+		close(recorderDone)
+	}()
+
+	impressions, closeCounter := newImpressionCounter(ctx, cfg, logger)
+	defer closeCounter()
+
+	logger.Info("load tag tree", slog.String("channel", banner_postgre.TagNotifyChannel))
+
+	// без дерева баннеры ищутся только по собственным тегам, пока оно не загрузится по уведомлению
+	tagTree := banner_service.NewTagTree(logger, bannerRepo)
+	if err := tagTree.Reload(ctx); err != nil {
+		logger.Warn("tag tree not loaded", slog.Any("error", err))
+	}
+
+	tagListener := postgre.NewListener(logger, cfg.Postgre, banner_postgre.TagNotifyChannel)
+
+	go tagListener.Listen(ctx, tagTree.HandleNotification, tagTree.Reset)
+
+	bannerService := banner_service.NewBannerService(banner_service.Deps{
+		Logger:      logger,
+		Repo:        bannerRepo,
+		Cache:       cache,
+		Missing:     missingCache,
+		Clock:       clock.NewRealClock(),
+		Events:      eventRecorder,
+		Impressions: impressions,
+		Tags:        tagTree,
+		Generation:  generation,
+	})
 	bannerHandler := banners_transport.NewBannersHandler(logger, bannerService, middleware)
 	bannerHandler.Register(router)
 
+	budgetKeeper := banner_service.NewBudgetKeeper(logger, bannerService,
+		time.Second*time.Duration(cfg.Budget.CheckInterval))
+
+	go budgetKeeper.Run(ctx)
+
+	if cfg.Cache.WarmUp > 0 {
+		logger.Info("warm up cache", slog.Int("limit", cfg.Cache.Size), slog.Int("timeout", cfg.Cache.WarmUp))
+
+		warmUpCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(cfg.Cache.WarmUp))
+		count, err := bannerService.WarmUp(warmUpCtx, cfg.Cache.Size)
+
+		cancel()
+
+		// по истечении времени сервис стартует с частично заполненным кэшем
+		if err != nil {
+			logger.Warn("cache warm up interrupted", slog.Any("error", err))
+		}
+
+		logger.Info("cache warmed up", slog.Int("count", count))
+	}
+
+	logger.Debug("register api keys handler")
+	apiKeyHandler := apikeys_transport.NewAPIKeysHandler(logger, apiKeyService, middleware)
+	apiKeyHandler.Register(router)
+
 	logger.Info("adding swagger documentation")
 
 	host := fmt.Sprintf("%s:%d", cfg.Server.IP, cfg.Server.Port)
@@ -104,8 +295,145 @@ func App() {
 		ReadHeaderTimeout: 3 * time.Second,
 	}
 
-	if err := server.ListenAndServe(); err != nil {
+	tcpListener, err := net.Listen("tcp", host)
+	if err != nil {
 		logger.Error(err.Error())
 		panic(err)
 	}
+
+	probeHandler.SetReady()
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- server.Serve(tcpListener)
+	}()
+
+	var failure error
+
+	select {
+	case failure = <-serveErr:
+		logger.Error(failure.Error())
+	case <-ctx.Done():
+		logger.Info("shutting down")
+	}
+
+	probeHandler.SetNotReady()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("server shutdown", slog.Any("error", err))
+	}
+
+	logger.Info("flush events")
+
+	stopRecorder()
+	<-recorderDone
+
+	if err := probeServer.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("probe server shutdown", slog.Any("error", err))
+	}
+
+	if failure != nil {
+		panic(failure)
+	}
+}
+
+// newBannerCache создает кэш выбранного в конфиге бэкенда. redisClient нужен
+// только для бэкендов redis и tiered
+func newBannerCache[V any](cfg *config.Settings, logger *slog.Logger, redisClient *redis.Client, prefix string,
+	ttl time.Duration) cache.Cache[banner_model.BannerKey, V] {
+	switch cfg.Cache.Backend {
+	case "none":
+		return nopcache.NewNopCache[banner_model.BannerKey, V]()
+	case "redis":
+		return rediscache.NewRedisCache[banner_model.BannerKey, V](logger, redisClient, prefix, ttl)
+	}
+
+	cacheLRU := expirable.NewLRU[banner_model.BannerKey, V](cfg.Cache.Size, nil, ttl)
+	local := hashicorp_lru.NewLRU(logger, cacheLRU)
+
+	if cfg.Cache.Backend != "tiered" {
+		return local
+	}
+
+	remote := rediscache.NewRedisCache[banner_model.BannerKey, V](logger, redisClient, prefix, ttl)
+
+	return tieredcache.NewTieredCache(logger, local, remote)
+}
+
+// newImpressionCounter создает счетчик показов для ограничения частоты. Для бэкенда redis
+// открывается отдельный клиент, который нужно закрыть возвращаемой функцией
+func newImpressionCounter(ctx context.Context, cfg *config.Settings, logger *slog.Logger) (counter.Counter, func()) {
+	logger.Info("init frequency counter", slog.String("backend", cfg.Frequency.Backend))
+
+	if cfg.Frequency.Backend != "redis" {
+		logger.Warn("frequency caps are counted per pod, use the redis backend with several replicas")
+		return memorycounter.NewMemoryCounter(clock.NewRealClock()), func() {}
+	}
+
+	client, err := rediscache.NewRedisClient(ctx, &cfg.Redis, cfg.Frequency.RedisDatabase)
+	if err != nil {
+		logger.Error("connection to Redis failed", slog.Any("error", err))
+		panic(err)
+	}
+
+	return rediscounter.NewRedisCounter(logger, client, "frequency:"), func() {
+		if err := client.Close(); err != nil {
+			logger.Warn(err.Error())
+		}
+	}
+}
+
+// newGeoDatabase загружает базу регионов и следит за изменениями ее файла.
+// Без пути в конфиге регион не определяется
+func newGeoDatabase(ctx context.Context, cfg *config.Settings, logger *slog.Logger) geo.Database {
+	if cfg.Geo.DatabasePath == "" {
+		logger.Info("geo database is not configured")
+		return nil
+	}
+
+	logger.Info("load geo database", slog.String("path", cfg.Geo.DatabasePath))
+
+	db, err := filegeo.NewFileDatabase(logger, cfg.Geo.DatabasePath,
+		time.Second*time.Duration(cfg.Geo.ReloadInterval))
+	if err != nil {
+		logger.Error("geo database loading failed", slog.Any("error", err))
+		panic(err)
+	}
+
+	go db.Run(ctx)
+
+	return db
+}
+
+// trustedProxies разбирает адреса и подсети доверенных прокси, одиночный адрес считается подсетью из одного адреса
+func trustedProxies(cfg *config.Settings, logger *slog.Logger) []netip.Prefix {
+	res := make([]netip.Prefix, 0, len(cfg.Geo.TrustedProxies))
+
+	for _, proxy := range cfg.Geo.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				logger.Error("bad trusted proxy", slog.String("proxy", proxy), slog.Any("error", err))
+				panic(err)
+			}
+
+			res = append(res, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			logger.Error("bad trusted proxy", slog.String("proxy", proxy), slog.Any("error", err))
+			panic(err)
+		}
+
+		res = append(res, prefix.Masked())
+	}
+
+	return res
 }
@@ -7,16 +7,23 @@ import (
 )
 
 type Settings struct {
-	Server      ServerListen    `mapstructure:"server_listen"`
-	Postgre     PostgreSettings `mapstructure:"postgre_settings"`
-	Cache       CacheSettings   `mapstructure:"cache_settings"`
-	Redis       RedisSettings   `mapstructure:"redis_settings"`
-	PasswordKey string          `mapstructure:"password_key"`
+	Server      ServerListen      `mapstructure:"server_listen"`
+	Postgre     PostgreSettings   `mapstructure:"postgre_settings"`
+	Cache       CacheSettings     `mapstructure:"cache_settings"`
+	Redis       RedisSettings     `mapstructure:"redis_settings"`
+	Token       TokenSettings     `mapstructure:"token_settings"`
+	Banner      BannerSettings    `mapstructure:"banner_settings"`
+	Events      EventSettings     `mapstructure:"events_settings"`
+	Frequency   FrequencySettings `mapstructure:"frequency_settings"`
+	Budget      BudgetSettings    `mapstructure:"budget_settings"`
+	Geo         GeoSettings       `mapstructure:"geo_settings"`
+	PasswordKey string            `mapstructure:"password_key"`
 }
 
 type ServerListen struct {
-	IP   string `mapstructure:"ip"`
-	Port int    `mapstructure:"port"`
+	IP        string `mapstructure:"ip"`
+	Port      int    `mapstructure:"port"`
+	ProbePort int    `mapstructure:"probe_port"`
 }
 
 type PostgreSettings struct {
@@ -31,22 +38,74 @@ type PostgreSettings struct {
 }
 
 type CacheSettings struct {
-	Size int `mapstructure:"host"`
-	TTL  int `mapstructure:"ttl_in_minutes"`
+	Backend    string `mapstructure:"backend"`
+	Size       int    `mapstructure:"size"`
+	TTL        int    `mapstructure:"ttl_in_minutes"`
+	MissingTTL int    `mapstructure:"missing_ttl_in_seconds"`
+	WarmUp     int    `mapstructure:"warm_up_timeout_in_seconds"`
 }
 
 type RedisSettings struct {
 	Host        string `mapstructure:"host"`
 	Password    string `mapstructure:"password"`
-	Database    string `mapstructure:"database"`
+	Database    int    `mapstructure:"database"`
 	Port        int    `mapstructure:"port"`
 	TimePrepare int    `mapstructure:"time_prepare"`
 }
 
+type BannerSettings struct {
+	VersionRetention int `mapstructure:"version_retention"`
+}
+
+type EventSettings struct {
+	BatchSize     int `mapstructure:"batch_size"`
+	FlushInterval int `mapstructure:"flush_interval_in_ms"`
+}
+
+// Backend - redis или memory. Счетчики в Redis хранятся в базе RedisDatabase,
+// отдельной от кэша, и общие для всех подов; memory подходит только для одного пода
+type FrequencySettings struct {
+	Backend       string `mapstructure:"backend"`
+	RedisDatabase int    `mapstructure:"redis_database"`
+}
+
+type BudgetSettings struct {
+	CheckInterval int `mapstructure:"check_interval_in_seconds"`
+}
+
+// DatabasePath - файл с сетями и регионами в формате CSV или MaxMind (.mmdb), пустой путь
+// отключает определение региона. TrustedProxies - адреса и подсети прокси, которым
+// доверяется заголовок X-Forwarded-For
+type GeoSettings struct {
+	DatabasePath   string   `mapstructure:"database_path"`
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	ReloadInterval int      `mapstructure:"reload_interval_in_seconds"`
+}
+
+// AllowDevTokens разрешает провайдер simple с общими токенами ролей, только для локальной разработки
+type TokenSettings struct {
+	Provider       string `mapstructure:"provider"`
+	RoleClaim      string `mapstructure:"role_claim"`
+	BootstrapKey   string `mapstructure:"bootstrap_key"`
+	CacheSize      int    `mapstructure:"cache_size"`
+	CacheTTL       int    `mapstructure:"cache_ttl_in_seconds"`
+	MissingTTL     int    `mapstructure:"missing_ttl_in_seconds"`
+	AllowDevTokens bool   `mapstructure:"allow_dev_tokens"`
+}
+
 func NewConfigStorage(logger *slog.Logger) *Settings {
 	logger.Debug("reading log file")
 	viper.SetConfigFile("config.yaml")
 
+	// секрет ключа администратора и ключ подписи JWT не хранятся в файле конфигурации
+	if err := viper.BindEnv("token_settings.bootstrap_key", "BOOTSTRAP_KEY"); err != nil {
+		logger.Error("binding env failed", slog.Any("error", err))
+	}
+
+	if err := viper.BindEnv("password_key", "JWT_KEY"); err != nil {
+		logger.Error("binding env failed", slog.Any("error", err))
+	}
+
 	if err := viper.ReadInConfig(); err != nil {
 		logger.Error("config file reading failed", slog.Any("error", err))
 	}
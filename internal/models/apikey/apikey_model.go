@@ -0,0 +1,25 @@
+package apikeymodel
+
+import "time"
+
+type APIKeyInsert struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty" validate:"omitnil"`
+	Name      string     `json:"name" validate:"required,max=255"`
+	Role      string     `json:"role" validate:"required,oneof=user viewer editor publisher admin tracker"`
+}
+
+type APIKey struct {
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	SecretHash string     `json:"-"`
+	ID         int        `json:"id"`
+}
+
+type APIKeyCreated struct {
+	Key string `json:"key"`
+	ID  int    `json:"id"`
+}
@@ -0,0 +1,47 @@
+package bannermodel
+
+// Strategy - способ распределения трафика между вариантами слота
+type Strategy string
+
+const (
+	// StrategyWeights - фиксированные веса, пользователь всегда видит один и тот же вариант
+	StrategyWeights Strategy = "weights"
+	// StrategyEpsilonGreedy - лучший по CTR вариант, с вероятностью Epsilon - случайный
+	StrategyEpsilonGreedy Strategy = "epsilon_greedy"
+	// StrategyThompson - сэмплирование Томпсона по кликам и показам
+	StrategyThompson Strategy = "thompson"
+)
+
+// SlotStrategy - параметры распределения трафика в слоте. Seed делает выбор
+// воспроизводимым, без него генератор инициализируется текущим временем
+type SlotStrategy struct {
+	Name    Strategy `json:"name" validate:"required,oneof=weights epsilon_greedy thompson"`
+	Epsilon float64  `json:"epsilon,omitempty" validate:"min=0,max=1"`
+	Seed    *int64   `json:"seed,omitempty"`
+}
+
+// Adaptive сообщает, распределяется ли трафик по кликам, а не по весам
+func (strategy *SlotStrategy) Adaptive() bool {
+	return strategy != nil && strategy.Name != StrategyWeights
+}
+
+// VariantStat - показы и клики баннера в слоте
+type VariantStat struct {
+	BannerID    int
+	Impressions int64
+	Clicks      int64
+}
+
+type VariantAllocation struct {
+	BannerID    int     `json:"banner_id"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+	Share       float64 `json:"share"`
+}
+
+// SlotAllocation - текущая доля трафика каждого варианта слота
+type SlotAllocation struct {
+	Strategy Strategy            `json:"strategy"`
+	Variants []VariantAllocation `json:"variants"`
+}
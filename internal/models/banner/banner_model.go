@@ -2,11 +2,19 @@ package bannermodel
 
 import (
 	"encoding/json"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 )
 
+var ErrBadWindow = errors.New("active_from must be before active_until")
+
+// ErrNoSlot - изменение слота баннера, который не привязан ни к одному слоту (например, только баннера
+// по умолчанию), без полного набора feature_id и tag_id
+var ErrNoSlot = errors.New("banner has no slots, both feature_id and tag_id are required")
+
 func ValidateJSON(fl validator.FieldLevel) bool {
 	data, err := json.Marshal(fl.Field().Interface())
 	if err != nil {
@@ -21,39 +29,140 @@ func ValidateJSON(fl validator.FieldLevel) bool {
 	return true
 }
 
+// Author заполняется из токена и становится автором первой версии.
+// ActiveFrom и ActiveUntil задают окно показа баннера, любая из границ может отсутствовать.
+// ImpressionBudget - сколько раз баннер может быть показан, после этого он выключается.
+// Баннер с Targeting показывается только запросам, подходящим под правило,
+// а баннер с Regions - только клиентам из разрешенных регионов.
+// Priority определяет, какой баннер выигрывает, если запросу подходят баннеры нескольких тегов
 type BannerInsert struct {
-	Content   interface{} `json:"content,omitempty" validate:"json,required" swaggertype:"object"`
-	TagsID    []int       `json:"tag_id,omitempty" validate:"required,min=1,dive,numeric"`
-	FeatureID int         `json:"feature_id,omitempty" validate:"required,numeric"`
-	IsActive  bool        `json:"is_active,omitempty" validate:"omitempty,boolean"`
+	Content          interface{}   `json:"content,omitempty" validate:"json,required" swaggertype:"object"`
+	ActiveFrom       *time.Time    `json:"active_from,omitempty"`
+	ActiveUntil      *time.Time    `json:"active_until,omitempty"`
+	Author           string        `json:"-"`
+	TagsID           []int         `json:"tag_id,omitempty" validate:"required,min=1,dive,numeric"`
+	FeatureID        int           `json:"feature_id,omitempty" validate:"required,numeric"`
+	Schedule         *Schedule     `json:"schedule,omitempty"`
+	FrequencyCap     *FrequencyCap `json:"frequency_cap,omitempty"`
+	ImpressionBudget *int64        `json:"impression_budget,omitempty" validate:"omitnil,min=1"`
+	Targeting        *Targeting    `json:"targeting,omitempty"`
+	Regions          *RegionFilter `json:"regions,omitempty"`
+	Priority         int           `json:"priority,omitempty"`
+	IsActive         bool          `json:"is_active,omitempty" validate:"omitempty,boolean"`
 }
 
+// Изменение Content создает черновик новой версии баннера от имени Author.
+// RolloutPercent вместе с Content делает черновик кандидатом на постепенную публикацию.
+// ClearActiveFrom и ClearActiveUntil выставляются, когда граница окна показа передана
+// явным null, и снимают ее. Отсутствующая граница не меняется
 type BannerUpdate struct {
-	Content   interface{} `json:"content,omitempty" validate:"omitnil,json" swaggertype:"object"`
-	TagsID    *[]int      `json:"tag_id,omitempty" validate:"omitnil,min=1,dive,numeric"`
-	ID        int         `json:"banner_id," validate:"numeric,required" swaggerignore:"true"`
-	FeatureID *int        `json:"feature_id,omitempty" validate:"omitnil,numeric"`
-	IsActive  *bool       `json:"is_active,omitempty" validate:"omitnil,boolean"`
+	Content          interface{}   `json:"content,omitempty" validate:"omitnil,json" swaggertype:"object"`
+	TagsID           *[]int        `json:"tag_id,omitempty" validate:"omitnil,min=1,dive,numeric"`
+	FeatureID        *int          `json:"feature_id,omitempty" validate:"omitnil,numeric"`
+	IsActive         *bool         `json:"is_active,omitempty" validate:"omitnil,boolean"`
+	ActiveFrom       *time.Time    `json:"active_from,omitempty"`
+	ActiveUntil      *time.Time    `json:"active_until,omitempty"`
+	Schedule         *Schedule     `json:"schedule,omitempty"`
+	FrequencyCap     *FrequencyCap `json:"frequency_cap,omitempty"`
+	ImpressionBudget *int64        `json:"impression_budget,omitempty" validate:"omitnil,min=1"`
+	Targeting        *Targeting    `json:"targeting,omitempty"`
+	Regions          *RegionFilter `json:"regions,omitempty"`
+	RolloutPercent   *int          `json:"rollout_percent,omitempty" validate:"omitnil,min=1,max=100"`
+	Priority         *int          `json:"priority,omitempty"`
+	Author           string        `json:"-"`
+	ID               int           `json:"banner_id," validate:"numeric,required" swaggerignore:"true"`
+	ClearActiveFrom  bool          `json:"-"`
+	ClearActiveUntil bool          `json:"-"`
 }
 
+// Banner содержит активную версию баннера. Variants и Strategy заполняются у записи слота
+// (тег, фича), в котором идет эксперимент, остальные поля у такой записи пустые.
+// Targeted у записи слота содержит баннеры слота с правилами таргетинга, сама запись -
+// баннер слота без правил или пустая запись, если такого баннера нет
 type Banner struct {
-	ContentV1 interface{} `json:"content_v1" swaggertype:"object"`
-	ContentV2 interface{} `json:"content_v2" swaggertype:"object"`
-	ContentV3 interface{} `json:"content_v3" swaggertype:"object"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
-	TagsID    []int       `json:"tag_ids"`
-	ID        int         `json:"banner_id"`
-	FeatureID int         `json:"feature_id"`
-	IsActive  bool        `json:"is_active"`
+	Content      interface{}   `json:"content" swaggertype:"object"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	ActiveFrom   *time.Time    `json:"active_from,omitempty"`
+	ActiveUntil  *time.Time    `json:"active_until,omitempty"`
+	Schedule     *Schedule     `json:"schedule,omitempty"`
+	FrequencyCap *FrequencyCap `json:"frequency_cap,omitempty"`
+	Targeting    *Targeting    `json:"targeting,omitempty"`
+	Regions      *RegionFilter `json:"regions,omitempty"`
+	TagsID       []int         `json:"tag_ids"`
+	Targeted     []Banner      `json:"targeted,omitempty"`
+	Variants     []Variant     `json:"variants,omitempty"`
+	Strategy     *SlotStrategy `json:"strategy,omitempty"`
+	Rollout      *Rollout      `json:"rollout,omitempty"`
+	ID           int           `json:"banner_id"`
+	Version      int           `json:"version"`
+	Priority     int           `json:"priority"`
+	FeatureID    int           `json:"feature_id"`
+	IsActive     bool          `json:"is_active"`
+}
+
+// IsLive сообщает, показывается ли баннер пользователям в момент now:
+// баннер включен, now попадает в окно [ActiveFrom, ActiveUntil) и в расписание, если оно задано
+func (banner *Banner) IsLive(now time.Time) bool {
+	if !banner.IsActive {
+		return false
+	}
+
+	if banner.ActiveFrom != nil && now.Before(*banner.ActiveFrom) {
+		return false
+	}
+
+	if banner.ActiveUntil != nil && !now.Before(*banner.ActiveUntil) {
+		return false
+	}
+
+	if banner.Schedule != nil && !banner.Schedule.Contains(now) {
+		return false
+	}
+
+	return true
+}
+
+// ValidWindow проверяет, что окно показа не пустое
+func ValidWindow(from, until *time.Time) error {
+	if from != nil && until != nil && !from.Before(*until) {
+		return ErrBadWindow
+	}
+
+	return nil
 }
 
 type BannerKey struct {
-	TagID     string
-	FeatureID string
+	TagID     string `json:"tag_id"`
+	FeatureID string `json:"feature_id"`
 }
 
+// BannerParams - слоты баннера. Defaults - фичи, для которых баннер задан баннером по умолчанию,
+// 0 означает общий баннер по умолчанию
 type BannerParams struct {
 	TagIDs    []int
+	Defaults  []int
 	FeatureID int
 }
+
+func (params BannerParams) Keys() []BannerKey {
+	res := make([]BannerKey, 0, len(params.TagIDs)+len(params.Defaults))
+
+	for _, tagID := range params.TagIDs {
+		res = append(res, BannerKey{
+			TagID:     strconv.Itoa(tagID),
+			FeatureID: strconv.Itoa(params.FeatureID),
+		})
+	}
+
+	for _, featureID := range params.Defaults {
+		if featureID == 0 {
+			res = append(res, DefaultKey(""))
+			continue
+		}
+
+		res = append(res, DefaultKey(strconv.Itoa(featureID)))
+	}
+
+	return res
+}
@@ -0,0 +1,10 @@
+package bannermodel
+
+// BannerBudget - бюджет показов баннера. Spent считается по сохраненным показам
+// с момента, когда бюджет был задан впервые. Когда Spent достигает Budget, баннер выключается
+type BannerBudget struct {
+	Budget    int64 `json:"budget"`
+	Spent     int64 `json:"spent"`
+	Remaining int64 `json:"remaining"`
+	IsActive  bool  `json:"is_active"`
+}
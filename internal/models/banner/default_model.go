@@ -0,0 +1,43 @@
+package bannermodel
+
+import (
+	"errors"
+	"strconv"
+)
+
+// MatchHeader - заголовок ответа /user_banner с уровнем, на котором нашелся показанный баннер
+const MatchHeader = "X-Banner-Match"
+
+var ErrUnknownDefault = errors.New("default banner or feature not found")
+
+// MatchLevel - уровень цепочки поиска баннера пользователя: слот тега,
+// баннер по умолчанию фичи или общий баннер по умолчанию
+type MatchLevel string
+
+const (
+	MatchTag     MatchLevel = "tag"
+	MatchFeature MatchLevel = "feature"
+	MatchGlobal  MatchLevel = "global"
+)
+
+// DefaultBanner - баннер, который показывается, когда в слотах тегов пользователя баннера не нашлось.
+// Без FeatureID баннер используется для всех фич, у которых нет своего баннера по умолчанию
+type DefaultBanner struct {
+	FeatureID *int `json:"feature_id,omitempty" validate:"omitempty,min=1" example:"1"`
+	BannerID  int  `json:"banner_id" validate:"required,min=1" example:"5"`
+}
+
+// DefaultKey - ключ кэша баннера по умолчанию фичи featureID, при пустом featureID - общего.
+// Ключи слотов всегда содержат тег, поэтому с ними он не пересекается
+func DefaultKey(featureID string) BannerKey {
+	return BannerKey{FeatureID: featureID}
+}
+
+// Key возвращает ключ кэша уровня, которому задан баннер по умолчанию
+func (def DefaultBanner) Key() BannerKey {
+	if def.FeatureID == nil {
+		return DefaultKey("")
+	}
+
+	return DefaultKey(strconv.Itoa(*def.FeatureID))
+}
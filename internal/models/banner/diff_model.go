@@ -0,0 +1,154 @@
+package bannermodel
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BannerVersion описывает сохраненную версию баннера без ее содержимого
+type BannerVersion struct {
+	CreatedAt time.Time     `json:"created_at"`
+	Author    string        `json:"author"`
+	Status    VersionStatus `json:"status"`
+	Version   int           `json:"version"`
+	IsActive  bool          `json:"is_active"`
+}
+
+// DiffValue - значение, добавленное или удаленное по пути Path
+type DiffValue struct {
+	Value interface{} `json:"value" swaggertype:"object"`
+	Path  string      `json:"path"`
+}
+
+// DiffChange - значение по пути Path, измененное между версиями
+type DiffChange struct {
+	From interface{} `json:"from" swaggertype:"object"`
+	To   interface{} `json:"to" swaggertype:"object"`
+	Path string      `json:"path"`
+}
+
+// BannerDiff - разница содержимого двух версий баннера.
+// Пути записываются в формате JSON Pointer (RFC 6901)
+type BannerDiff struct {
+	Added   []DiffValue  `json:"added"`
+	Removed []DiffValue  `json:"removed"`
+	Changed []DiffChange `json:"changed"`
+	ID      int          `json:"banner_id"`
+	From    int          `json:"from"`
+	To      int          `json:"to"`
+}
+
+// Diff сравнивает содержимое версий from и to одного баннера
+func Diff(from, to Banner) (BannerDiff, error) {
+	res := BannerDiff{
+		ID:      to.ID,
+		From:    from.Version,
+		To:      to.Version,
+		Added:   []DiffValue{},
+		Removed: []DiffValue{},
+		Changed: []DiffChange{},
+	}
+
+	fromContent, err := normalize(from.Content)
+	if err != nil {
+		return BannerDiff{}, err
+	}
+
+	toContent, err := normalize(to.Content)
+	if err != nil {
+		return BannerDiff{}, err
+	}
+
+	res.diff("", fromContent, toContent)
+
+	return res, nil
+}
+
+// normalize приводит содержимое к типам, которые дает encoding/json,
+// чтобы одинаковые значения из разных источников сравнивались как равные
+func normalize(content interface{}) (interface{}, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var res interface{}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (d *BannerDiff) diff(path string, from, to interface{}) {
+	switch fromVal := from.(type) {
+	case map[string]interface{}:
+		if toVal, ok := to.(map[string]interface{}); ok {
+			d.diffObjects(path, fromVal, toVal)
+			return
+		}
+	case []interface{}:
+		if toVal, ok := to.([]interface{}); ok {
+			d.diffArrays(path, fromVal, toVal)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		d.Changed = append(d.Changed, DiffChange{Path: path, From: from, To: to})
+	}
+}
+
+func (d *BannerDiff) diffObjects(path string, from, to map[string]interface{}) {
+	keys := make([]string, 0, len(from)+len(to))
+
+	for key := range from {
+		keys = append(keys, key)
+	}
+
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + escapePointer(key)
+		fromVal, inFrom := from[key]
+		toVal, inTo := to[key]
+
+		switch {
+		case !inFrom:
+			d.Added = append(d.Added, DiffValue{Path: keyPath, Value: toVal})
+		case !inTo:
+			d.Removed = append(d.Removed, DiffValue{Path: keyPath, Value: fromVal})
+		default:
+			d.diff(keyPath, fromVal, toVal)
+		}
+	}
+}
+
+func (d *BannerDiff) diffArrays(path string, from, to []interface{}) {
+	for i := 0; i < len(from) || i < len(to); i++ {
+		itemPath := path + "/" + strconv.Itoa(i)
+
+		switch {
+		case i >= len(from):
+			d.Added = append(d.Added, DiffValue{Path: itemPath, Value: to[i]})
+		case i >= len(to):
+			d.Removed = append(d.Removed, DiffValue{Path: itemPath, Value: from[i]})
+		default:
+			d.diff(itemPath, from[i], to[i])
+		}
+	}
+}
+
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,35 @@
+package bannermodel
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrEventsOverloaded = errors.New("event buffer is full, retry later")
+
+type EventType string
+
+const (
+	EventImpression EventType = "impression"
+	EventClick      EventType = "click"
+)
+
+// Event - показ или клик баннера BannerID версии Version в слоте (TagID, FeatureID).
+// CreatedAt заполняется сервисом при приеме события
+type Event struct {
+	Type      EventType `json:"type" validate:"required,oneof=impression click"`
+	BannerID  int       `json:"banner_id" validate:"required,min=1"`
+	Version   int       `json:"version" validate:"min=0"`
+	TagID     int       `json:"tag_id" validate:"required,min=1"`
+	FeatureID int       `json:"feature_id" validate:"required,min=1"`
+	UserID    string    `json:"user_id" validate:"max=255"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// BannerStat - число показов и кликов версии баннера за день (UTC) в формате YYYY-MM-DD
+type BannerStat struct {
+	Day         string `json:"day"`
+	Version     int    `json:"version"`
+	Impressions int64  `json:"impressions"`
+	Clicks      int64  `json:"clicks"`
+}
@@ -0,0 +1,24 @@
+package bannermodel
+
+import (
+	"strconv"
+	"time"
+)
+
+// FrequencyCap ограничивает число показов баннера одному пользователю: не больше Limit
+// за окно WindowSeconds, которое отсчитывается от первого показа. После исчерпания лимита
+// пользователь получает Fallback, а если он не задан - баннер не найден
+type FrequencyCap struct {
+	Fallback      interface{} `json:"fallback,omitempty" validate:"omitnil,json" swaggertype:"object"`
+	Limit         int         `json:"limit" validate:"required,min=1"`
+	WindowSeconds int         `json:"window_in_seconds" validate:"required,min=1" example:"86400"`
+}
+
+func (frequencyCap *FrequencyCap) Window() time.Duration {
+	return time.Duration(frequencyCap.WindowSeconds) * time.Second
+}
+
+// FrequencyKey - ключ счетчика показов баннера bannerID пользователю userID
+func FrequencyKey(bannerID int, userID string) string {
+	return strconv.Itoa(bannerID) + ":" + userID
+}
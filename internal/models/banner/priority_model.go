@@ -0,0 +1,14 @@
+package bannermodel
+
+// BannerIDHeader - заголовок ответа /user_banner с id показанного баннера
+const BannerIDHeader = "X-Banner-ID"
+
+// Outranks сообщает, выигрывает ли banner у other, когда запросу подходят баннеры нескольких тегов:
+// выигрывает баннер с большим Priority, при равенстве - измененный позже
+func (banner *Banner) Outranks(other *Banner) bool {
+	if banner.Priority != other.Priority {
+		return banner.Priority > other.Priority
+	}
+
+	return banner.UpdatedAt.After(other.UpdatedAt)
+}
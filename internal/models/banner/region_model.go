@@ -0,0 +1,61 @@
+package bannermodel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBadRegions = errors.New("bad region filter")
+
+// RegionFilter ограничивает показ баннера регионами, определенными по IP-адресу клиента.
+// Если задан Allow, баннер показывается только в перечисленных регионах, Deny исключает регионы.
+// Клиенту, регион которого не определен, баннер со списком Allow не показывается
+type RegionFilter struct {
+	Allow []string `json:"allow,omitempty" example:"RU-MOW"`
+	Deny  []string `json:"deny,omitempty" example:"RU-SPE"`
+}
+
+func (filter *RegionFilter) Validate() error {
+	if len(filter.Allow) == 0 && len(filter.Deny) == 0 {
+		return fmt.Errorf("%w: allow or deny is required", ErrBadRegions)
+	}
+
+	for _, regions := range [][]string{filter.Allow, filter.Deny} {
+		for _, region := range regions {
+			if strings.TrimSpace(region) == "" {
+				return fmt.Errorf("%w: region must not be empty", ErrBadRegions)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Allows сообщает, показывается ли баннер клиенту из региона region. Пустой region - регион
+// не определен. Баннер без ограничений показывается везде
+func (filter *RegionFilter) Allows(region string) bool {
+	if filter == nil {
+		return true
+	}
+
+	if containsRegion(filter.Deny, region) {
+		return false
+	}
+
+	return len(filter.Allow) == 0 || containsRegion(filter.Allow, region)
+}
+
+func containsRegion(regions []string, region string) bool {
+	if region == "" {
+		return false
+	}
+
+	for _, r := range regions {
+		if strings.EqualFold(r, region) {
+			return true
+		}
+	}
+
+	return false
+}
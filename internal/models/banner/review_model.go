@@ -0,0 +1,76 @@
+package bannermodel
+
+import (
+	"errors"
+	"time"
+)
+
+// VersionStatus - состояние версии баннера в процессе согласования.
+// Изменение содержимого создает черновик, который не виден пользователям,
+// пока не пройдет путь draft -> review -> approved -> published
+type VersionStatus string
+
+const (
+	StatusDraft     VersionStatus = "draft"
+	StatusReview    VersionStatus = "review"
+	StatusApproved  VersionStatus = "approved"
+	StatusPublished VersionStatus = "published"
+)
+
+type ReviewAction string
+
+const (
+	ActionSubmit  ReviewAction = "submit"
+	ActionApprove ReviewAction = "approve"
+	ActionPublish ReviewAction = "publish"
+)
+
+var (
+	ErrBadTransition   = errors.New("version status does not allow this action")
+	ErrSelfApproval    = errors.New("version can't be approved by its author or submitter")
+	ErrAnonymousReview = errors.New("review requires a token that identifies its owner")
+)
+
+var transitions = map[ReviewAction]struct {
+	from VersionStatus
+	to   VersionStatus
+}{
+	ActionSubmit:  {from: StatusDraft, to: StatusReview},
+	ActionApprove: {from: StatusReview, to: StatusApproved},
+	ActionPublish: {from: StatusApproved, to: StatusPublished},
+}
+
+// ReviewState - то, что нужно знать о версии, чтобы применить к ней действие
+type ReviewState struct {
+	Status    VersionStatus
+	Author    string
+	Submitter string
+}
+
+// Apply возвращает состояние версии после действия actor'а. Одобрить версию
+// может только тот, кто ее не писал и не отправлял на согласование, поэтому
+// действие без субъекта не применяется
+func (action ReviewAction) Apply(state ReviewState, actor string) (VersionStatus, error) {
+	if actor == "" {
+		return state.Status, ErrAnonymousReview
+	}
+
+	transition, ok := transitions[action]
+	if !ok || state.Status != transition.from {
+		return state.Status, ErrBadTransition
+	}
+
+	if action == ActionApprove && (actor == state.Author || actor == state.Submitter) {
+		return state.Status, ErrSelfApproval
+	}
+
+	return transition.to, nil
+}
+
+// BannerApproval - запись истории согласования баннера
+type BannerApproval struct {
+	CreatedAt time.Time    `json:"created_at"`
+	Action    ReviewAction `json:"action"`
+	Actor     string       `json:"actor"`
+	Version   int          `json:"version"`
+}
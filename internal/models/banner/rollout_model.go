@@ -0,0 +1,39 @@
+package bannermodel
+
+import (
+	"errors"
+	"strconv"
+)
+
+var (
+	ErrRolloutWithoutContent = errors.New("rollout_percent requires content")
+	ErrRolloutInProgress     = errors.New("banner already has a rollout in progress")
+)
+
+// Rollout - постепенная публикация версии Version: ее видят Percent процентов пользователей,
+// остальные продолжают видеть активную версию баннера
+type Rollout struct {
+	Content interface{} `json:"content" swaggertype:"object"`
+	Version int         `json:"version"`
+	Percent int         `json:"percent"`
+}
+
+type RolloutUpdate struct {
+	Percent int `json:"percent" validate:"required,min=1,max=100"`
+}
+
+// ForUser возвращает баннер с той версией, которую должен видеть пользователь userID.
+// Пользователь попадает в раскатку по хэшу от id баннера, поэтому во всех слотах баннера
+// он видит одну и ту же версию, а при увеличении процента не теряет новую версию
+func (banner *Banner) ForUser(userID string) *Banner {
+	if banner.Rollout == nil || bucket("banner:"+strconv.Itoa(banner.ID), userID, 100) >= banner.Rollout.Percent {
+		return banner
+	}
+
+	res := *banner
+	res.Content = banner.Rollout.Content
+	res.Version = banner.Rollout.Version
+	res.Rollout = nil
+
+	return &res
+}
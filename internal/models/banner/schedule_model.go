@@ -0,0 +1,159 @@
+package bannermodel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrBadSchedule = errors.New("bad schedule")
+
+// Schedule - повторяющееся расписание показа баннера. Days содержит дни недели
+// по ISO 8601 (1 - понедельник, 7 - воскресенье), пустой список означает все дни.
+// Время в Ranges задается в часовом поясе Timezone (имя из базы IANA)
+type Schedule struct {
+	Timezone string      `json:"timezone"`
+	Days     []int       `json:"days,omitempty"`
+	Ranges   []TimeRange `json:"ranges"`
+}
+
+// TimeRange - интервал [From, To) в формате HH:MM. Если To раньше From,
+// интервал переходит через полночь и относится к дню, в который начинается
+type TimeRange struct {
+	From string `json:"from" example:"09:00"`
+	To   string `json:"to" example:"18:00"`
+}
+
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		if res, ok := loc.(*time.Location); ok {
+			return res, nil
+		}
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations.Store(name, loc)
+
+	return loc, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q must be HH:MM", ErrBadSchedule, value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (schedule *Schedule) Validate() error {
+	if schedule.Timezone == "" {
+		return fmt.Errorf("%w: timezone is required", ErrBadSchedule)
+	}
+
+	if _, err := loadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrBadSchedule, schedule.Timezone)
+	}
+
+	for _, day := range schedule.Days {
+		if day < 1 || day > 7 {
+			return fmt.Errorf("%w: day %d must be from 1 to 7", ErrBadSchedule, day)
+		}
+	}
+
+	if len(schedule.Ranges) == 0 {
+		return fmt.Errorf("%w: at least one time range is required", ErrBadSchedule)
+	}
+
+	for _, r := range schedule.Ranges {
+		from, err := parseClock(r.From)
+		if err != nil {
+			return err
+		}
+
+		to, err := parseClock(r.To)
+		if err != nil {
+			return err
+		}
+
+		if from == to {
+			return fmt.Errorf("%w: empty time range %s-%s", ErrBadSchedule, r.From, r.To)
+		}
+	}
+
+	return nil
+}
+
+// Contains сообщает, попадает ли момент now в расписание.
+// Некорректное расписание не пропускает ни одного момента
+func (schedule *Schedule) Contains(now time.Time) bool {
+	loc, err := loadLocation(schedule.Timezone)
+	if err != nil {
+		return false
+	}
+
+	now = now.In(loc)
+	sinceMidnight := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second
+	today := isoWeekday(now.Weekday())
+	yesterday := isoWeekday(now.AddDate(0, 0, -1).Weekday())
+
+	for _, r := range schedule.Ranges {
+		from, err := parseClock(r.From)
+		if err != nil {
+			return false
+		}
+
+		to, err := parseClock(r.To)
+		if err != nil {
+			return false
+		}
+
+		if from < to {
+			if schedule.hasDay(today) && sinceMidnight >= from && sinceMidnight < to {
+				return true
+			}
+
+			continue
+		}
+
+		if schedule.hasDay(today) && sinceMidnight >= from {
+			return true
+		}
+
+		if schedule.hasDay(yesterday) && sinceMidnight < to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (schedule *Schedule) hasDay(day int) bool {
+	if len(schedule.Days) == 0 {
+		return true
+	}
+
+	for _, d := range schedule.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isoWeekday(day time.Weekday) int {
+	if day == time.Sunday {
+		return 7
+	}
+
+	return int(day)
+}
@@ -0,0 +1,142 @@
+package bannermodel
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrTagCycle      = errors.New("tag can not be an ancestor of itself")
+	ErrUnknownParent = errors.New("parent tag not found")
+)
+
+// Tag - тег вместе с родителем, ParentID = nil у корневых тегов
+type Tag struct {
+	ParentID *int
+	Name     string
+	ID       int
+}
+
+// TagParent - тело запроса на смену родителя тега
+type TagParent struct {
+	ParentID int `json:"parent_id" validate:"required,min=1" example:"1"`
+}
+
+// TagNode - узел дерева тегов в ответе администратору
+type TagNode struct {
+	Name     string    `json:"name" example:"moscow"`
+	Children []TagNode `json:"children,omitempty"`
+	ID       int       `json:"id" example:"5"`
+}
+
+// TagTree - неизменяемое дерево тегов. Связи, которые замкнули бы цикл, отбрасываются,
+// поэтому подъем по предкам всегда конечен
+type TagTree struct {
+	parents map[int]int
+	names   map[int]string
+	ids     []int
+}
+
+func NewTagTree(tags []Tag) *TagTree {
+	tree := &TagTree{
+		parents: make(map[int]int, len(tags)),
+		names:   make(map[int]string, len(tags)),
+		ids:     make([]int, 0, len(tags)),
+	}
+
+	for _, tag := range tags {
+		tree.names[tag.ID] = tag.Name
+		tree.ids = append(tree.ids, tag.ID)
+	}
+
+	sort.Ints(tree.ids)
+
+	links := make(map[int]int, len(tags))
+
+	for _, tag := range tags {
+		if tag.ParentID != nil {
+			links[tag.ID] = *tag.ParentID
+		}
+	}
+
+	for _, id := range tree.ids {
+		parent, ok := links[id]
+		if !ok {
+			continue
+		}
+
+		if _, known := tree.names[parent]; !known || tree.IsAncestor(id, parent) {
+			continue
+		}
+
+		tree.parents[id] = parent
+	}
+
+	return tree
+}
+
+// Parent возвращает родителя тега tagID. У пустого дерева родителей нет
+func (tree *TagTree) Parent(tagID string) (string, bool) {
+	if tree == nil {
+		return "", false
+	}
+
+	id, err := strconv.Atoi(tagID)
+	if err != nil {
+		return "", false
+	}
+
+	parent, ok := tree.parents[id]
+	if !ok {
+		return "", false
+	}
+
+	return strconv.Itoa(parent), true
+}
+
+// IsAncestor сообщает, совпадает ли ancestor с тегом id или с одним из его предков
+func (tree *TagTree) IsAncestor(ancestor, id int) bool {
+	for {
+		if id == ancestor {
+			return true
+		}
+
+		parent, ok := tree.parents[id]
+		if !ok {
+			return false
+		}
+
+		id = parent
+	}
+}
+
+// Nodes возвращает корневые теги с вложенными потомками, теги каждого уровня упорядочены по id
+func (tree *TagTree) Nodes() []TagNode {
+	children := make(map[int][]int, len(tree.parents))
+
+	var roots []int
+
+	for _, id := range tree.ids {
+		if parent, ok := tree.parents[id]; ok {
+			children[parent] = append(children[parent], id)
+			continue
+		}
+
+		roots = append(roots, id)
+	}
+
+	var build func(ids []int) []TagNode
+
+	build = func(ids []int) []TagNode {
+		res := make([]TagNode, 0, len(ids))
+
+		for _, id := range ids {
+			res = append(res, TagNode{ID: id, Name: tree.names[id], Children: build(children[id])})
+		}
+
+		return res
+	}
+
+	return build(roots)
+}
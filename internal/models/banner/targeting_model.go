@@ -0,0 +1,320 @@
+package bannermodel
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrBadTargeting = errors.New("bad targeting rule")
+	ErrSlotTaken    = errors.New("slot already has a banner without targeting")
+)
+
+// maxRuleNodes ограничивает размер правила, чтобы его проверка оставалась дешевой для каждого запроса
+const maxRuleNodes = 64
+
+// Attributes - атрибуты запроса пользователя, по которым проверяются правила таргетинга
+type Attributes struct {
+	Platform   string
+	AppVersion string
+	Region     string
+}
+
+// Rule - узел правила таргетинга. В узле задается ровно одно поле: All (И), Any (ИЛИ), Not (НЕ)
+// или условие на атрибут запроса. Platform и Region - списки допустимых значений без учета регистра,
+// AppVersion - диапазон версий приложения
+type Rule struct {
+	Not        *Rule         `json:"not,omitempty"`
+	AppVersion *VersionRange `json:"app_version,omitempty"`
+	All        []Rule        `json:"all,omitempty"`
+	Any        []Rule        `json:"any,omitempty"`
+	Platform   []string      `json:"platform,omitempty" example:"ios"`
+	Region     []string      `json:"region,omitempty" example:"RU-MOW"`
+}
+
+// VersionRange - диапазон версий [From, To), любая из границ может отсутствовать.
+// Версии сравниваются по числовым компонентам: 5.10 новее 5.9
+type VersionRange struct {
+	From string `json:"from,omitempty" example:"5.0"`
+	To   string `json:"to,omitempty" example:"6.0"`
+}
+
+// Targeting - правило таргетинга баннера вместе с его скомпилированной формой.
+// Правило компилируется один раз, поэтому баннер из кэша проверяется без повторного разбора
+type Targeting struct {
+	match func(attrs Attributes) bool
+	err   error
+	Rule
+	specificity int
+	once        sync.Once
+}
+
+// Compile проверяет правило и готовит его к проверке запросов
+func (targeting *Targeting) Compile() error {
+	targeting.once.Do(func() {
+		nodes := 0
+		targeting.match, targeting.specificity, targeting.err = compileRule(&targeting.Rule, &nodes)
+	})
+
+	return targeting.err
+}
+
+// Match сообщает, подходит ли запрос с атрибутами attrs под правило.
+// Некорректное правило не подходит ни одному запросу
+func (targeting *Targeting) Match(attrs Attributes) bool {
+	if targeting.Compile() != nil {
+		return false
+	}
+
+	return targeting.match(attrs)
+}
+
+// Specificity - число условий на атрибуты, которым обязан удовлетворять подходящий запрос:
+// условия внутри All складываются, из веток Any берется наименьшая
+func (targeting *Targeting) Specificity() int {
+	if targeting.Compile() != nil {
+		return 0
+	}
+
+	return targeting.specificity
+}
+
+// Target выбирает баннер слота для запроса с атрибутами attrs. Из баннеров с правилами, которые
+// можно показать по visible и под которые подходит запрос, выигрывает самый специфичный, при равенстве -
+// с меньшим id. Если ни одно правило не подошло, возвращается баннер слота без правил, а если
+// его нет - nil
+func (banner *Banner) Target(attrs Attributes, visible func(banner *Banner) bool) *Banner {
+	var (
+		best        *Banner
+		specificity int
+	)
+
+	for i := range banner.Targeted {
+		candidate := &banner.Targeted[i]
+		if !visible(candidate) || !candidate.Targeting.Match(attrs) {
+			continue
+		}
+
+		if best == nil || candidate.Targeting.Specificity() > specificity ||
+			candidate.Targeting.Specificity() == specificity && candidate.ID < best.ID {
+			best, specificity = candidate, candidate.Targeting.Specificity()
+		}
+	}
+
+	if best != nil {
+		return best
+	}
+
+	if banner.ID == 0 {
+		return nil
+	}
+
+	return banner
+}
+
+func compileRule(rule *Rule, nodes *int) (func(attrs Attributes) bool, int, error) {
+	if *nodes++; *nodes > maxRuleNodes {
+		return nil, 0, fmt.Errorf("%w: rule has more than %d nodes", ErrBadTargeting, maxRuleNodes)
+	}
+
+	set := 0
+	for _, ok := range []bool{rule.All != nil, rule.Any != nil, rule.Not != nil, rule.Platform != nil,
+		rule.Region != nil, rule.AppVersion != nil} {
+		if ok {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return nil, 0, fmt.Errorf("%w: node must have exactly one of all, any, not, platform, region, app_version",
+			ErrBadTargeting)
+	}
+
+	switch {
+	case rule.All != nil:
+		return compileAll(rule.All, nodes)
+	case rule.Any != nil:
+		return compileAny(rule.Any, nodes)
+	case rule.Not != nil:
+		match, specificity, err := compileRule(rule.Not, nodes)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return func(attrs Attributes) bool { return !match(attrs) }, specificity, nil
+	case rule.Platform != nil:
+		return compileValues("platform", rule.Platform, func(attrs Attributes) string { return attrs.Platform })
+	case rule.Region != nil:
+		return compileValues("region", rule.Region, func(attrs Attributes) string { return attrs.Region })
+	default:
+		return compileVersion(rule.AppVersion)
+	}
+}
+
+func compileAll(rules []Rule, nodes *int) (func(attrs Attributes) bool, int, error) {
+	if len(rules) == 0 {
+		return nil, 0, fmt.Errorf("%w: all must not be empty", ErrBadTargeting)
+	}
+
+	matches := make([]func(attrs Attributes) bool, 0, len(rules))
+	total := 0
+
+	for i := range rules {
+		match, specificity, err := compileRule(&rules[i], nodes)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		matches = append(matches, match)
+		total += specificity
+	}
+
+	return func(attrs Attributes) bool {
+		for _, match := range matches {
+			if !match(attrs) {
+				return false
+			}
+		}
+
+		return true
+	}, total, nil
+}
+
+func compileAny(rules []Rule, nodes *int) (func(attrs Attributes) bool, int, error) {
+	if len(rules) == 0 {
+		return nil, 0, fmt.Errorf("%w: any must not be empty", ErrBadTargeting)
+	}
+
+	matches := make([]func(attrs Attributes) bool, 0, len(rules))
+	least := 0
+
+	for i := range rules {
+		match, specificity, err := compileRule(&rules[i], nodes)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if i == 0 || specificity < least {
+			least = specificity
+		}
+
+		matches = append(matches, match)
+	}
+
+	return func(attrs Attributes) bool {
+		for _, match := range matches {
+			if match(attrs) {
+				return true
+			}
+		}
+
+		return false
+	}, least, nil
+}
+
+func compileValues(name string, values []string, attr func(attrs Attributes) string) (
+	func(attrs Attributes) bool, int, error) {
+	if len(values) == 0 {
+		return nil, 0, fmt.Errorf("%w: %s must not be empty", ErrBadTargeting, name)
+	}
+
+	allowed := make(map[string]struct{}, len(values))
+
+	for _, value := range values {
+		if value == "" {
+			return nil, 0, fmt.Errorf("%w: %s must not contain empty values", ErrBadTargeting, name)
+		}
+
+		allowed[strings.ToLower(value)] = struct{}{}
+	}
+
+	return func(attrs Attributes) bool {
+		_, ok := allowed[strings.ToLower(attr(attrs))]
+		return ok
+	}, 1, nil
+}
+
+func compileVersion(versions *VersionRange) (func(attrs Attributes) bool, int, error) {
+	if versions.From == "" && versions.To == "" {
+		return nil, 0, fmt.Errorf("%w: app_version needs from or to", ErrBadTargeting)
+	}
+
+	var from, to []int
+
+	for _, bound := range []struct {
+		value  string
+		parsed *[]int
+	}{{versions.From, &from}, {versions.To, &to}} {
+		if bound.value == "" {
+			continue
+		}
+
+		parsed, ok := parseVersion(bound.value)
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: version %q must look like 5.10.2", ErrBadTargeting, bound.value)
+		}
+
+		*bound.parsed = parsed
+	}
+
+	if from != nil && to != nil && compareVersions(from, to) >= 0 {
+		return nil, 0, fmt.Errorf("%w: app_version from must be below to", ErrBadTargeting)
+	}
+
+	return func(attrs Attributes) bool {
+		version, ok := parseVersion(attrs.AppVersion)
+		if !ok {
+			return false
+		}
+
+		return (from == nil || compareVersions(version, from) >= 0) &&
+			(to == nil || compareVersions(version, to) < 0)
+	}, 1, nil
+}
+
+func parseVersion(value string) ([]int, bool) {
+	if value == "" {
+		return nil, false
+	}
+
+	parts := strings.Split(value, ".")
+	res := make([]int, 0, len(parts))
+
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || strings.HasPrefix(part, "+") {
+			return nil, false
+		}
+
+		res = append(res, n)
+	}
+
+	return res, true
+}
+
+// compareVersions сравнивает версии покомпонентно, недостающие компоненты считаются нулями
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+
+		if i < len(b) {
+			y = b[i]
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
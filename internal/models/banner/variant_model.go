@@ -0,0 +1,107 @@
+package bannermodel
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// VariantHeader - заголовок ответа /user_banner с id баннера, выбранного в эксперименте
+const VariantHeader = "X-Banner-Variant"
+
+var ErrUnknownVariant = errors.New("variant banner not found")
+
+// Variant - баннер, участвующий в эксперименте слота (тег, фича).
+// Пользователь попадает в вариант с вероятностью Weight / сумма весов слота
+type Variant struct {
+	Banner
+	Weight int `json:"weight"`
+}
+
+type VariantWeight struct {
+	BannerID int `json:"banner_id" validate:"required,min=1"`
+	Weight   int `json:"weight" validate:"required,min=1"`
+}
+
+// SlotVariants - набор вариантов эксперимента слота (тег, фича).
+// Без Strategy трафик делится по весам
+type SlotVariants struct {
+	Variants []VariantWeight `json:"variants" validate:"required,min=1,unique=BannerID,dive"`
+	Strategy *SlotStrategy   `json:"strategy,omitempty"`
+}
+
+// UserBanner - баннер, выбранный для пользователя. Variant заполняется,
+// только если в слоте идет эксперимент, Match - уровень, на котором нашелся баннер
+type UserBanner struct {
+	Content interface{}
+	Variant string
+	Match   MatchLevel
+	ID      int
+}
+
+// Bucket возвращает стабильное для пользователя и слота число из [0, total).
+// Слот участвует в хэше, чтобы распределения пользователей в разных экспериментах не совпадали
+func Bucket(key BannerKey, userID string, total int) int {
+	return bucket(key.TagID+":"+key.FeatureID, userID, total)
+}
+
+func bucket(seed, userID string, total int) int {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(seed + ":" + userID))
+
+	return int(hash.Sum64() % uint64(total))
+}
+
+// LiveVariants возвращает запись слота только с теми вариантами, которые сейчас можно показать:
+// трафик скрытых вариантов делится между остальными по весам. Если показать нечего, возвращается nil
+func (banner *Banner) LiveVariants(visible func(banner *Banner) bool) *Banner {
+	variants := make([]Variant, 0, len(banner.Variants))
+
+	for i := range banner.Variants {
+		if visible(&banner.Variants[i].Banner) {
+			variants = append(variants, banner.Variants[i])
+		}
+	}
+
+	switch len(variants) {
+	case 0:
+		return nil
+	case len(banner.Variants):
+		return banner
+	}
+
+	res := *banner
+	res.Variants = variants
+
+	return &res
+}
+
+// PickVariant выбирает вариант слота key для пользователя userID. Пользователь без id попадает
+// в вариант random(сумма весов), иначе все анонимные запросы доставались бы одному варианту.
+// Если в слоте нет эксперимента, возвращается сам баннер и false
+func (banner *Banner) PickVariant(key BannerKey, userID string, random func(n int) int) (*Banner, bool) {
+	total := 0
+	for _, variant := range banner.Variants {
+		total += variant.Weight
+	}
+
+	if total <= 0 {
+		return banner, false
+	}
+
+	var bucket int
+	if userID == "" {
+		bucket = random(total)
+	} else {
+		bucket = Bucket(key, userID, total)
+	}
+
+	for i := range banner.Variants {
+		if bucket < banner.Variants[i].Weight {
+			return &banner.Variants[i].Banner, true
+		}
+
+		bucket -= banner.Variants[i].Weight
+	}
+
+	return &banner.Variants[len(banner.Variants)-1].Banner, true
+}
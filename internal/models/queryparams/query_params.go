@@ -1,28 +1,73 @@
 package queryparams
 
 import (
+	"fmt"
 	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/pkg/token"
 )
 
+// TagIDs - теги пользователя, из баннеров которых выбирается один с наибольшим приоритетом
 type BannerUserParams struct {
-	TagID            string `validate:"required,numeric"`
-	FeatureID        string `validate:"required,numeric"`
-	UseLastrRevision string `validate:"omitempty,boolean"`
-	Version          string `validate:"omitempty,numeric,min=1,max=3"`
-	Token            string
+	TagIDs           []string `validate:"required,max=20,dive,numeric"`
+	FeatureID        string   `validate:"required,numeric"`
+	UseLastrRevision string   `validate:"omitempty,boolean"`
+	Version          string   `validate:"omitempty,number"`
+	UserID           string   `validate:"max=255"`
+	Role             token.Role
+	Attributes       banner_model.Attributes
+	// Region - регион клиента, определенный по IP-адресу, пустой, если не определен
+	Region string
 }
 
+// Keys возвращает пары (тег, фича) запроса без повторов в порядке тегов
+func (params *BannerUserParams) Keys() []banner_model.BannerKey {
+	res := make([]banner_model.BannerKey, 0, len(params.TagIDs))
+	seen := make(map[string]struct{}, len(params.TagIDs))
+
+	for _, tagID := range params.TagIDs {
+		if _, ok := seen[tagID]; ok {
+			continue
+		}
+
+		seen[tagID] = struct{}{}
+
+		res = append(res, banner_model.BannerKey{
+			TagID:     tagID,
+			FeatureID: params.FeatureID,
+		})
+	}
+
+	return res
+}
+
+// Фильтры GET /banner по окну показа баннера
+const (
+	StatusLive     = "live"
+	StatusUpcoming = "upcoming"
+	StatusExpired  = "expired"
+)
+
 type BannerParams struct {
 	TagID     *int
 	FeatureID *int
 	Limit     *int
 	Offset    *int
+	Status    string
 }
 
 func ValidateBannersParams(tagStr, featureStr, limitStr,
-	offsetStr string) (BannerParams, error) {
+	offsetStr, statusStr string) (BannerParams, error) {
 	res := BannerParams{}
 
+	switch statusStr {
+	case "", StatusLive, StatusUpcoming, StatusExpired:
+		res.Status = statusStr
+	default:
+		return BannerParams{}, fmt.Errorf("unknown status %q", statusStr)
+	}
+
 	if tagStr != "" {
 		tag, err := strconv.Atoi(tagStr)
 		if err != nil {
@@ -0,0 +1,15 @@
+package apikeyrepository
+
+import (
+	"context"
+
+	apikey_model "github.com/Heatdog/Avito/internal/models/apikey"
+)
+
+type APIKeyRepository interface {
+	InsertAPIKey(ctx context.Context, key *apikey_model.APIKeyInsert, secretHash string) (int, error)
+	GetAPIKeys(ctx context.Context) ([]apikey_model.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, secretHash string) (apikey_model.APIKey, error)
+	RotateAPIKey(ctx context.Context, id int, secretHash string) (string, error)
+	RevokeAPIKey(ctx context.Context, id int) (string, error)
+}
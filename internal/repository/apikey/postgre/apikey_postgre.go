@@ -0,0 +1,153 @@
+package apikeypostgre
+
+import (
+	"context"
+	"log/slog"
+
+	apikey_model "github.com/Heatdog/Avito/internal/models/apikey"
+	apikey_repository "github.com/Heatdog/Avito/internal/repository/apikey"
+	"github.com/Heatdog/Avito/pkg/client"
+	"github.com/jackc/pgx/v5"
+)
+
+// NotifyChannel - канал PostgreSQL, в который публикуются хэши отозванных и перевыпущенных
+// секретов, чтобы все поды убрали их из кэша проверенных ключей
+const NotifyChannel = "api_key_cache"
+
+type apiKeyRepository struct {
+	logger   *slog.Logger
+	dbClient client.Client
+}
+
+func NewAPIKeyRepository(logger *slog.Logger, dbClient client.Client) apikey_repository.APIKeyRepository {
+	return &apiKeyRepository{
+		logger:   logger,
+		dbClient: dbClient,
+	}
+}
+
+func (repo *apiKeyRepository) InsertAPIKey(ctx context.Context, key *apikey_model.APIKeyInsert,
+	secretHash string) (int, error) {
+	q := `
+		INSERT INTO api_keys (name, secret_hash, role, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	var id int
+	if err := repo.dbClient.QueryRow(ctx, q, key.Name, secretHash, key.Role, key.ExpiresAt).Scan(&id); err != nil {
+		repo.logger.Warn(err.Error())
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (repo *apiKeyRepository) GetAPIKeys(ctx context.Context) ([]apikey_model.APIKey, error) {
+	q := `
+		SELECT id, name, role, expires_at, revoked_at, created_at, updated_at
+		FROM api_keys
+		ORDER BY id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []apikey_model.APIKey
+
+	for rows.Next() {
+		var key apikey_model.APIKey
+		if err = rows.Scan(&key.ID, &key.Name, &key.Role, &key.ExpiresAt, &key.RevokedAt, &key.CreatedAt,
+			&key.UpdatedAt); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
+		res = append(res, key)
+	}
+
+	return res, nil
+}
+
+func (repo *apiKeyRepository) GetAPIKeyByHash(ctx context.Context, secretHash string) (apikey_model.APIKey, error) {
+	q := `
+		SELECT id, name, role, expires_at, revoked_at, created_at, updated_at
+		FROM api_keys
+		WHERE secret_hash = $1
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	var key apikey_model.APIKey
+	if err := repo.dbClient.QueryRow(ctx, q, secretHash).Scan(&key.ID, &key.Name, &key.Role, &key.ExpiresAt,
+		&key.RevokedAt, &key.CreatedAt, &key.UpdatedAt); err != nil {
+		return apikey_model.APIKey{}, err
+	}
+
+	key.SecretHash = secretHash
+
+	return key, nil
+}
+
+// RotateAPIKey заменяет секрет ключа и возвращает хэш прежнего секрета
+func (repo *apiKeyRepository) RotateAPIKey(ctx context.Context, id int, secretHash string) (string, error) {
+	q := `
+		UPDATE api_keys k
+		SET secret_hash = $1, updated_at = now()
+		FROM (SELECT id, secret_hash FROM api_keys WHERE id = $2 AND revoked_at IS NULL FOR UPDATE) old
+		WHERE k.id = old.id
+		RETURNING old.secret_hash
+	`
+
+	return repo.replaceSecret(ctx, q, secretHash, id)
+}
+
+// RevokeAPIKey отзывает ключ и возвращает хэш его секрета
+func (repo *apiKeyRepository) RevokeAPIKey(ctx context.Context, id int) (string, error) {
+	q := `
+		UPDATE api_keys
+		SET revoked_at = now(), updated_at = now()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING secret_hash
+	`
+
+	return repo.replaceSecret(ctx, q, id)
+}
+
+// replaceSecret выполняет запрос q, возвращающий хэш секрета, который больше не действует,
+// и в той же транзакции рассылает этот хэш в NotifyChannel
+func (repo *apiKeyRepository) replaceSecret(ctx context.Context, q string, args ...interface{}) (string, error) {
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	var secretHash string
+	if err = tx.QueryRow(ctx, q, args...).Scan(&secretHash); err != nil {
+		return "", err
+	}
+
+	if _, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, NotifyChannel, secretHash); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	return secretHash, nil
+}
@@ -2,18 +2,71 @@ package bannerrepository
 
 import (
 	"context"
+	"time"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	"github.com/Heatdog/Avito/internal/models/queryparams"
 )
 
+// Методы, изменяющие баннеры, возвращают затронутые пары (тег, фича),
+// чтобы вызывающая сторона могла инвалидировать кэш
 type BannerRepository interface {
 	InsertBanner(ctx context.Context, banner *banner_model.BannerInsert) (int, error)
-	GetUserBanner(ctx context.Context, tagID, feautureID string) (banner_model.Banner, error)
+	// GetUserBanner возвращает версию version баннера, при version = 0 - активную версию.
+	// Если в слоте идет эксперимент, при version = 0 возвращается запись с вариантами слота.
+	// Баннеры слота с правилами таргетинга возвращаются в Targeted записи слота
+	GetUserBanner(ctx context.Context, tagID, feautureID string, version int) (banner_model.Banner, error)
+	// GetUserBanners возвращает активные записи слотов нескольких тегов фичи одним обращением к репозиторию.
+	// Слоты без баннеров в результат не попадают
+	GetUserBanners(ctx context.Context, tagIDs []string, featureID string) (
+		map[banner_model.BannerKey]banner_model.Banner, error)
+	// GetDefaultBanner возвращает баннер по умолчанию фичи featureID, при пустом featureID - общий
+	GetDefaultBanner(ctx context.Context, featureID string) (banner_model.Banner, error)
+	GetDefaultBanners(ctx context.Context) ([]banner_model.DefaultBanner, error)
+	SetDefaultBanner(ctx context.Context, def banner_model.DefaultBanner) ([]banner_model.BannerKey, error)
+	DeleteDefaultBanner(ctx context.Context, featureID *int) ([]banner_model.BannerKey, error)
 	GetBanners(ctx context.Context, params *queryparams.BannerParams) ([]banner_model.Banner, error)
 	GetBannerParams(ctx context.Context, id int) (banner_model.BannerParams, error)
-	DeleteBanner(ctx context.Context, id int) (bool, error)
-	UpdateBanner(ctx context.Context, banner *banner_model.BannerUpdate) error
-	DeleteBanners(ctx context.Context, params queryparams.DeleteBannerParams) error
-	UpdateBannerVersion(ctx context.Context, id, version int) error
+	DeleteBanner(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	UpdateBanner(ctx context.Context, banner *banner_model.BannerUpdate) ([]banner_model.BannerKey, error)
+	DeleteBanners(ctx context.Context, params queryparams.DeleteBannerParams) ([]banner_model.BannerKey, error)
+	UpdateBannerVersion(ctx context.Context, id, version int) ([]banner_model.BannerKey, error)
+	DeleteBannerSchedule(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	DeleteBannerFrequencyCap(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	DeleteBannerRegions(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	// DeleteBannerTargeting снимает правила таргетинга, баннер становится баннером слота по умолчанию
+	DeleteBannerTargeting(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	GetBannerBudget(ctx context.Context, id int) (banner_model.BannerBudget, error)
+	DeleteBannerBudget(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	// DeactivateSpentBanners выключает баннеры, исчерпавшие бюджет показов, и возвращает их пары (тег, фича)
+	DeactivateSpentBanners(ctx context.Context) ([]banner_model.BannerKey, error)
+	// ReviewBannerVersion применяет к версии действие согласования от имени actor.
+	// Ключи возвращаются только при публикации, когда меняется активная версия
+	ReviewBannerVersion(ctx context.Context, id, version int, action banner_model.ReviewAction,
+		actor string) ([]banner_model.BannerKey, error)
+	GetBannerApprovals(ctx context.Context, id int) ([]banner_model.BannerApproval, error)
+	// GetBannerVersions возвращает сохраненные версии баннера, начиная с новой
+	GetBannerVersions(ctx context.Context, id int) ([]banner_model.BannerVersion, error)
+	GetBannerVersion(ctx context.Context, id, version int) (banner_model.Banner, error)
+	GetSlotVariants(ctx context.Context, featureID, tagID int) (banner_model.SlotVariants, error)
+	SetSlotVariants(ctx context.Context, featureID, tagID int,
+		variants banner_model.SlotVariants) ([]banner_model.BannerKey, error)
+	DeleteSlotVariants(ctx context.Context, featureID, tagID int) ([]banner_model.BannerKey, error)
+	// InsertEvents записывает пачку показов и кликов одной командой COPY
+	InsertEvents(ctx context.Context, events []banner_model.Event) error
+	// GetSlotStats возвращает показы и клики баннеров слота, записанные до before
+	GetSlotStats(ctx context.Context, featureID, tagID string, before time.Time) ([]banner_model.VariantStat, error)
+	// GetBannerStats возвращает показы и клики баннера по дням и версиям, начиная с последнего дня
+	GetBannerStats(ctx context.Context, id int) ([]banner_model.BannerStat, error)
+	SetRolloutPercent(ctx context.Context, id, percent int) ([]banner_model.BannerKey, error)
+	CompleteRollout(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	AbortRollout(ctx context.Context, id int) ([]banner_model.BannerKey, error)
+	// GetTags возвращает все теги вместе с их родителями
+	GetTags(ctx context.Context) ([]banner_model.Tag, error)
+	// SetTagParent делает parentID родителем тега id, при nil тег становится корневым.
+	// Если тег id - предок parentID, возвращается banner_model.ErrTagCycle
+	SetTagParent(ctx context.Context, id int, parentID *int) error
+	// StreamActiveBanners передает в fn активные баннеры вместе с их парами (тег, фича),
+	// начиная с недавно измененных. Чтение прекращается, если fn вернула false
+	StreamActiveBanners(ctx context.Context, fn func(key banner_model.BannerKey, banner banner_model.Banner) bool) error
 }
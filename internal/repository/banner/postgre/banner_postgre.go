@@ -1,20 +1,75 @@
 package bannerpostgre
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	banner_repository "github.com/Heatdog/Avito/internal/repository/banner"
 	"github.com/Heatdog/Avito/pkg/client"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// foreignKeyViolation - код ошибки PostgreSQL при ссылке на несуществующую запись,
+// uniqueViolation - при нарушении уникального индекса, checkViolation - при нарушении CHECK
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+	checkViolation      = "23514"
+)
+
+// defaultBannerIndex оставляет в слоте не больше одного баннера без правил таргетинга
+const defaultBannerIndex = "features_tags_to_banners_default_idx"
+
+// slotTaken заменяет нарушение defaultBannerIndex на banner_model.ErrSlotTaken
+func slotTaken(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == defaultBannerIndex {
+		return banner_model.ErrSlotTaken
+	}
+
+	return err
+}
+
+// windowCheck требует, чтобы начало окна показа было раньше его конца
+const windowCheck = "banners_window_check"
+
+// badWindow заменяет нарушение windowCheck на banner_model.ErrBadWindow. Так проверяется окно,
+// собранное из сохраненной и измененной границ, когда в запросе передана только одна из них
+func badWindow(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == checkViolation && pgErr.ConstraintName == windowCheck {
+		return banner_model.ErrBadWindow
+	}
+
+	return err
+}
+
+// querier и execer - общая часть client.Client и pgx.Tx для запросов, которые
+// выполняются как в транзакции, так и вне ее
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// retention - сколько последних версий баннера хранится, 0 - без ограничения.
+// Активная версия не удаляется никогда
 type bannerRepository struct {
-	logger   *slog.Logger
-	dbClient client.Client
+	logger    *slog.Logger
+	dbClient  client.Client
+	retention int
 }
 
-func NewBannerRepository(logger *slog.Logger, dbClient client.Client) banner_repository.BannerRepository {
+func NewBannerRepository(logger *slog.Logger, dbClient client.Client,
+	retention int) banner_repository.BannerRepository {
 	return &bannerRepository{
-		logger:   logger,
-		dbClient: dbClient,
+		logger:    logger,
+		dbClient:  dbClient,
+		retention: retention,
 	}
 }
@@ -0,0 +1,132 @@
+package bannerpostgre
+
+import (
+	"context"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+)
+
+func (repo *bannerRepository) GetBannerBudget(ctx context.Context, id int) (banner_model.BannerBudget, error) {
+	repo.logger.Debug("get banner budget repository", slog.Int("id", id))
+
+	q := `
+		SELECT b.impression_budget, b.is_active, (
+			SELECT count(*) FROM banner_events e
+			WHERE e.banner_id = b.id AND e.type = 'impression' AND e.created_at >= b.budget_from
+		)
+		FROM banners b
+		WHERE b.id = $1 AND b.impression_budget IS NOT NULL
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	var res banner_model.BannerBudget
+
+	if err := repo.dbClient.QueryRow(ctx, q, id).Scan(&res.Budget, &res.IsActive, &res.Spent); err != nil {
+		return banner_model.BannerBudget{}, err
+	}
+
+	res.Remaining = max(res.Budget-res.Spent, 0)
+
+	return res, nil
+}
+
+func (repo *bannerRepository) DeleteBannerBudget(ctx context.Context, id int) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("delete banner budget", slog.Int("id", id))
+
+	return repo.resetBannerColumn(ctx, id, "impression_budget", "budget_from")
+}
+
+// budgetSweepLock - ключ транзакционной advisory-блокировки проверки бюджетов
+const budgetSweepLock = 7_010_001
+
+// DeactivateSpentBanners выключает включенные баннеры, показы которых достигли бюджета.
+// Уведомление об изменении слотов отправляется в той же транзакции, поэтому
+// выключенный баннер не может остаться в кэшах других подов. Проверку выполняет
+// только под, взявший блокировку budgetSweepLock, остальные пропускают ее до следующего тика
+func (repo *bannerRepository) DeactivateSpentBanners(ctx context.Context) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("deactivate spent banners repository")
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	var locked bool
+
+	lock := `SELECT pg_try_advisory_xact_lock($1)`
+	repo.logger.Debug("repo query", slog.String("query", lock))
+
+	if err = tx.QueryRow(ctx, lock, budgetSweepLock).Scan(&locked); err != nil {
+		return nil, err
+	}
+
+	if !locked {
+		repo.logger.Debug("budget sweep is running on another pod")
+		return nil, nil
+	}
+
+	q := `
+		UPDATE banners b
+		SET is_active = false, updated_at = now()
+		WHERE b.is_active AND b.impression_budget IS NOT NULL AND b.impression_budget <= (
+			SELECT count(*) FROM banner_events e
+			WHERE e.banner_id = b.id AND e.type = 'impression' AND e.created_at >= b.budget_from
+		)
+		RETURNING b.id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := tx.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys []banner_model.BannerKey
+
+	for _, id := range ids {
+		repo.logger.Info("banner budget is spent", slog.Int("id", id))
+
+		params, err := repo.getBannerParams(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, params.Keys()...)
+	}
+
+	if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
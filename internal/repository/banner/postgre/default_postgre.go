@@ -0,0 +1,201 @@
+package bannerpostgre
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// GetDefaultBanner возвращает активную версию баннера по умолчанию фичи featureID,
+// при пустом featureID - общего баннера по умолчанию. Баннер с правилами таргетинга
+// возвращается в Targeted записи, как в слоте без баннера по умолчанию
+func (repo *bannerRepository) GetDefaultBanner(ctx context.Context, featureID string) (banner_model.Banner,
+	error) {
+	repo.logger.Debug("get default banner repository", slog.String("feature", featureID))
+
+	var feature *string
+	if featureID != "" {
+		feature = &featureID
+	}
+
+	q := `
+		SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule,
+			r.version, r.content, b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at
+		FROM default_banners d
+		JOIN banners b ON b.id = d.banner_id
+		JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version AND v.status = 'published'
+		LEFT JOIN banner_versions r ON r.banner_id = b.id AND r.version = b.rollout_version
+			AND r.status = 'published'
+		WHERE d.feature_id IS NOT DISTINCT FROM $1
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, feature)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return banner_model.Banner{}, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			repo.logger.Warn(err.Error())
+			return banner_model.Banner{}, err
+		}
+
+		return banner_model.Banner{}, pgx.ErrNoRows
+	}
+
+	banner, err := scanSlotBanner(rows)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return banner_model.Banner{}, err
+	}
+
+	var slot banner_model.Banner
+	repo.addToSlot(&slot, banner)
+
+	return slot, nil
+}
+
+// GetDefaultBanners возвращает все баннеры по умолчанию, общий идет первым
+func (repo *bannerRepository) GetDefaultBanners(ctx context.Context) ([]banner_model.DefaultBanner, error) {
+	repo.logger.Debug("get default banners repository")
+
+	q := `
+		SELECT feature_id, banner_id
+		FROM default_banners
+		ORDER BY feature_id NULLS FIRST
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	res := []banner_model.DefaultBanner{}
+
+	for rows.Next() {
+		var def banner_model.DefaultBanner
+		if err = rows.Scan(&def.FeatureID, &def.BannerID); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
+		res = append(res, def)
+	}
+
+	if err = rows.Err(); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// SetDefaultBanner задает или заменяет баннер по умолчанию уровня def
+func (repo *bannerRepository) SetDefaultBanner(ctx context.Context, def banner_model.DefaultBanner) (
+	[]banner_model.BannerKey, error) {
+	repo.logger.Debug("set default banner repository", slog.Any("default", def))
+
+	q := `
+		INSERT INTO default_banners (feature_id, banner_id)
+		VALUES ($1, $2)
+		ON CONFLICT ((COALESCE(feature_id, 0))) DO UPDATE SET banner_id = EXCLUDED.banner_id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	if _, err = tx.Exec(ctx, q, def.FeatureID, def.BannerID); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			err = banner_model.ErrUnknownDefault
+		}
+
+		repo.logger.Warn(err.Error())
+
+		return nil, err
+	}
+
+	keys := []banner_model.BannerKey{def.Key()}
+
+	if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// DeleteDefaultBanner снимает баннер по умолчанию фичи featureID, при nil - общий
+func (repo *bannerRepository) DeleteDefaultBanner(ctx context.Context, featureID *int) (
+	[]banner_model.BannerKey, error) {
+	repo.logger.Debug("delete default banner repository", slog.Any("feature", featureID))
+
+	q := `
+		DELETE FROM default_banners
+		WHERE feature_id IS NOT DISTINCT FROM $1
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, q, featureID)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	keys := []banner_model.BannerKey{banner_model.DefaultBanner{FeatureID: featureID}.Key()}
+
+	if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -4,15 +4,16 @@ import (
 	"context"
 	"log/slog"
 
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	"github.com/Heatdog/Avito/internal/models/queryparams"
 	"github.com/jackc/pgx/v5"
 )
 
-func (repo *bannerRepository) DeleteBanner(ctx context.Context, id int) (bool, error) {
+func (repo *bannerRepository) DeleteBanner(ctx context.Context, id int) ([]banner_model.BannerKey, error) {
 	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		repo.logger.Warn(err.Error())
-		return false, err
+		return nil, err
 	}
 
 	defer func() {
@@ -21,25 +22,43 @@ func (repo *bannerRepository) DeleteBanner(ctx context.Context, id int) (bool, e
 		}
 	}()
 
+	params, err := repo.getBannerParams(ctx, tx, id)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
 	res, err := repo.deleteBanner(ctx, tx, id)
 	if err != nil {
 		repo.logger.Warn(err.Error())
-		return false, err
+		return nil, err
+	}
+
+	if res {
+		if err = repo.notifyKeys(ctx, tx, params.Keys()); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
 	}
 
 	if err = tx.Commit(ctx); err != nil {
 		repo.logger.Warn(err.Error())
-		return false, err
+		return nil, err
 	}
 
-	return res, nil
+	if !res {
+		return nil, pgx.ErrNoRows
+	}
+
+	return params.Keys(), nil
 }
 
-func (repo *bannerRepository) DeleteBanners(ctx context.Context, params queryparams.DeleteBannerParams) error {
+func (repo *bannerRepository) DeleteBanners(ctx context.Context,
+	params queryparams.DeleteBannerParams) ([]banner_model.BannerKey, error) {
 	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		repo.logger.Warn(err.Error())
-		return err
+		return nil, err
 	}
 
 	defer func() {
@@ -51,22 +70,37 @@ func (repo *bannerRepository) DeleteBanners(ctx context.Context, params querypar
 	bannersID, err := repo.getBannersID(ctx, tx, &params)
 	if err != nil {
 		repo.logger.Warn(err.Error())
-		return err
+		return nil, err
 	}
 
+	var keys []banner_model.BannerKey
+
 	for _, id := range bannersID {
+		bannerParams, err := repo.getBannerParams(ctx, tx, id)
+		if err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
 		if _, err := repo.deleteBanner(ctx, tx, id); err != nil {
 			repo.logger.Warn(err.Error())
-			return err
+			return nil, err
 		}
+
+		keys = append(keys, bannerParams.Keys()...)
+	}
+
+	if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
 	}
 
 	if err = tx.Commit(ctx); err != nil {
 		repo.logger.Warn(err.Error())
-		return err
+		return nil, err
 	}
 
-	return nil
+	return keys, nil
 }
 
 func (repo *bannerRepository) getBannersID(ctx context.Context, tx pgx.Tx,
@@ -84,7 +118,7 @@ func (repo *bannerRepository) getBannersID(ctx context.Context, tx pgx.Tx,
 			WHERE tag_id = $1 OR feature_id = $2
 			`
 
-		rows, err = tx.Query(ctx, q, params.TagID, params.FeatureID)
+		rows, err = tx.Query(ctx, q, *params.TagID, *params.FeatureID)
 
 		if err != nil {
 			return nil, err
@@ -96,7 +130,7 @@ func (repo *bannerRepository) getBannersID(ctx context.Context, tx pgx.Tx,
 			WHERE feature_id = $1
 			`
 
-		rows, err = tx.Query(ctx, q, params.FeatureID)
+		rows, err = tx.Query(ctx, q, *params.FeatureID)
 
 		if err != nil {
 			return nil, err
@@ -108,7 +142,7 @@ func (repo *bannerRepository) getBannersID(ctx context.Context, tx pgx.Tx,
 			WHERE tag_id = $1
 			`
 
-		rows, err = tx.Query(ctx, q, params.TagID)
+		rows, err = tx.Query(ctx, q, *params.TagID)
 
 		if err != nil {
 			return nil, err
@@ -117,6 +151,10 @@ func (repo *bannerRepository) getBannersID(ctx context.Context, tx pgx.Tx,
 		return res, nil
 	}
 
+	defer rows.Close()
+
+	seen := make(map[int]bool)
+
 	for rows.Next() {
 		var id int
 
@@ -124,6 +162,11 @@ func (repo *bannerRepository) getBannersID(ctx context.Context, tx pgx.Tx,
 			return res, err
 		}
 
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
 		res = append(res, id)
 	}
 
@@ -0,0 +1,105 @@
+package bannerpostgre
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+)
+
+var eventColumns = []string{"banner_id", "version", "tag_id", "feature_id", "user_id", "type", "created_at"}
+
+func (repo *bannerRepository) InsertEvents(ctx context.Context, events []banner_model.Event) error {
+	repo.logger.Debug("insert events repository", slog.Int("count", len(events)))
+
+	_, err := repo.dbClient.CopyFrom(ctx, pgx.Identifier{"banner_events"}, eventColumns,
+		pgx.CopyFromSlice(len(events), func(i int) ([]interface{}, error) {
+			event := events[i]
+
+			var userID interface{}
+			if event.UserID != "" {
+				userID = event.UserID
+			}
+
+			return []interface{}{event.BannerID, event.Version, event.TagID, event.FeatureID, userID,
+				string(event.Type), event.CreatedAt}, nil
+		}))
+
+	return err
+}
+
+func (repo *bannerRepository) GetSlotStats(ctx context.Context, featureID, tagID string,
+	before time.Time) ([]banner_model.VariantStat, error) {
+	repo.logger.Debug("get slot stats repository", slog.String("feature", featureID), slog.String("tag", tagID))
+
+	q := `
+		SELECT banner_id, count(*) FILTER (WHERE type = 'impression'), count(*) FILTER (WHERE type = 'click')
+		FROM banner_events
+		WHERE feature_id = $1 AND tag_id = $2 AND created_at < $3
+		GROUP BY banner_id
+		ORDER BY banner_id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, featureID, tagID, before)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []banner_model.VariantStat
+
+	for rows.Next() {
+		var stat banner_model.VariantStat
+
+		if err = rows.Scan(&stat.BannerID, &stat.Impressions, &stat.Clicks); err != nil {
+			return nil, err
+		}
+
+		res = append(res, stat)
+	}
+
+	return res, rows.Err()
+}
+
+func (repo *bannerRepository) GetBannerStats(ctx context.Context, id int) ([]banner_model.BannerStat, error) {
+	repo.logger.Debug("get banner stats repository", slog.Int("id", id))
+
+	q := `
+		SELECT (created_at AT TIME ZONE 'UTC')::date AS day, version,
+			count(*) FILTER (WHERE type = 'impression'), count(*) FILTER (WHERE type = 'click')
+		FROM banner_events
+		WHERE banner_id = $1
+		GROUP BY day, version
+		ORDER BY day DESC, version DESC
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	res := []banner_model.BannerStat{}
+
+	for rows.Next() {
+		var (
+			stat banner_model.BannerStat
+			day  time.Time
+		)
+
+		if err = rows.Scan(&day, &stat.Version, &stat.Impressions, &stat.Clicks); err != nil {
+			return nil, err
+		}
+
+		stat.Day = day.Format(time.DateOnly)
+		res = append(res, stat)
+	}
+
+	return res, rows.Err()
+}
@@ -5,34 +5,216 @@ import (
 	"fmt"
 	"log/slog"
 	"sort"
+	"strconv"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	"github.com/Heatdog/Avito/internal/models/queryparams"
 	"github.com/jackc/pgx/v5"
 )
 
-func (repo *bannerRepository) GetUserBanner(ctx context.Context, tagID, feautureID string) (banner_model.Banner, error) {
-	repo.logger.Debug("get user banner repository")
+func (repo *bannerRepository) GetUserBanner(ctx context.Context, tagID, feautureID string,
+	version int) (banner_model.Banner, error) {
+	repo.logger.Debug("get user banner repository", slog.Int("version", version))
 
+	// при запросе активной версии эксперимент в слоте важнее баннера, привязанного к слоту
+	if version == 0 {
+		variants, strategy, err := repo.getSlotVariants(ctx, tagID, feautureID)
+		if err != nil {
+			repo.logger.Warn(err.Error())
+			return banner_model.Banner{}, err
+		}
+
+		if len(variants) != 0 {
+			return banner_model.Banner{Variants: variants, Strategy: strategy}, nil
+		}
+	}
+
+	// опубликованная версия в раскатке нужна только вместе с активной версией.
+	// Баннер слота без правил таргетинга идет первым, баннеры с правилами собираются в Targeted
 	q := `
-		SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active
+		SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule,
+			r.version, r.content, b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at
 		FROM banners b
 		JOIN features_tags_to_banners ftb ON ftb.banner_id = b.id
+		JOIN banner_versions v ON v.banner_id = b.id AND v.version = COALESCE(NULLIF($3, 0), b.active_version)
+			AND v.status = 'published'
+		LEFT JOIN banner_versions r ON $3 = 0 AND r.banner_id = b.id AND r.version = b.rollout_version
+			AND r.status = 'published'
 		WHERE ftb.feature_id = $1 AND ftb.tag_id = $2
+		ORDER BY ftb.targeted, b.id
 	`
 	repo.logger.Debug("repo query", slog.String("query", q))
-	row := repo.dbClient.QueryRow(ctx, q, feautureID, tagID)
+	rows, err := repo.dbClient.Query(ctx, q, feautureID, tagID, version)
+
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return banner_model.Banner{}, err
+	}
+
+	defer rows.Close()
+
+	var (
+		slot  banner_model.Banner
+		found bool
+	)
+
+	for rows.Next() {
+		banner, err := scanSlotBanner(rows)
+		if err != nil {
+			repo.logger.Warn(err.Error())
+			return banner_model.Banner{}, err
+		}
+
+		found = true
+
+		repo.addToSlot(&slot, banner)
+	}
 
-	var banner banner_model.Banner
-	if err := row.Scan(&banner.ID, &banner.ContentV1, &banner.ContentV2, &banner.ContentV3,
-		&banner.IsActive); err != nil {
+	if err = rows.Err(); err != nil {
 		repo.logger.Warn(err.Error())
 		return banner_model.Banner{}, err
 	}
 
+	if !found {
+		return banner_model.Banner{}, pgx.ErrNoRows
+	}
+
+	return slot, nil
+}
+
+func (repo *bannerRepository) GetUserBanners(ctx context.Context, tagIDs []string,
+	featureID string) (map[banner_model.BannerKey]banner_model.Banner, error) {
+	repo.logger.Debug("get user banners repository", slog.Any("tags", tagIDs))
+
+	// теги проверены обработчиком, числа нужны для ANY, а исходные строки - для ключей кэша
+	tags := make([]int, 0, len(tagIDs))
+	keys := make(map[int]banner_model.BannerKey, len(tagIDs))
+
+	for _, tagID := range tagIDs {
+		tag, err := strconv.Atoi(tagID)
+		if err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+		keys[tag] = banner_model.BannerKey{TagID: tagID, FeatureID: featureID}
+	}
+
+	// слоты с экспериментом и обычные слоты читаются одним запросом: строки вариантов отличаются
+	// заполненным весом, а привязанные к слоту баннеры в слотах с экспериментом не выбираются
+	q := `
+		SELECT sv.tag_id, sv.weight, st.strategy, st.epsilon, st.seed,
+			b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule,
+			NULL, NULL, 0, b.frequency_cap, NULL, b.regions, b.priority, b.updated_at
+		FROM slot_variants sv
+		JOIN banners b ON b.id = sv.banner_id
+		JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+		LEFT JOIN slot_strategies st ON st.feature_id = sv.feature_id AND st.tag_id = sv.tag_id
+		WHERE sv.feature_id = $1 AND sv.tag_id = ANY($2)
+		UNION ALL
+		SELECT ftb.tag_id, NULL, NULL, NULL, NULL,
+			b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule,
+			r.version, r.content, b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at
+		FROM banners b
+		JOIN features_tags_to_banners ftb ON ftb.banner_id = b.id
+		JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version AND v.status = 'published'
+		LEFT JOIN banner_versions r ON r.banner_id = b.id AND r.version = b.rollout_version
+			AND r.status = 'published'
+		WHERE ftb.feature_id = $1 AND ftb.tag_id = ANY($2) AND NOT EXISTS (
+				SELECT 1 FROM slot_variants sv WHERE sv.feature_id = ftb.feature_id AND sv.tag_id = ftb.tag_id
+			)
+		ORDER BY tag_id, id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, featureID, tags)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	res := make(map[banner_model.BannerKey]banner_model.Banner, len(tags))
+
+	for rows.Next() {
+		var (
+			tag    int
+			weight *int
+			row    strategyRow
+		)
+
+		banner, err := scanSlotBanner(rows, &tag, &weight, &row.name, &row.epsilon, &row.seed)
+		if err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
+		slot := res[keys[tag]]
+
+		if weight != nil {
+			slot.Variants = append(slot.Variants, banner_model.Variant{Banner: banner, Weight: *weight})
+			slot.Strategy = row.strategy()
+		} else {
+			repo.addToSlot(&slot, banner)
+		}
+
+		res[keys[tag]] = slot
+	}
+
+	if err = rows.Err(); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// scanSlotBanner читает баннер слота, prefix - колонки строки перед колонками баннера
+func scanSlotBanner(rows pgx.Rows, prefix ...interface{}) (banner_model.Banner, error) {
+	var (
+		banner         banner_model.Banner
+		rolloutVersion *int
+		rollout        banner_model.Rollout
+	)
+
+	dest := append(prefix, &banner.ID, &banner.Version, &banner.Content, &banner.IsActive,
+		&banner.ActiveFrom, &banner.ActiveUntil, &banner.Schedule,
+		&rolloutVersion, &rollout.Content, &rollout.Percent, &banner.FrequencyCap,
+		&banner.Targeting, &banner.Regions, &banner.Priority, &banner.UpdatedAt)
+
+	if err := rows.Scan(dest...); err != nil {
+		return banner_model.Banner{}, err
+	}
+
+	if rolloutVersion != nil {
+		rollout.Version = *rolloutVersion
+		banner.Rollout = &rollout
+	}
+
 	return banner, nil
 }
 
+// addToSlot добавляет баннер в запись слота: баннер без правил таргетинга становится самой записью,
+// баннеры с правилами собираются в Targeted
+func (repo *bannerRepository) addToSlot(slot *banner_model.Banner, banner banner_model.Banner) {
+	if banner.Targeting == nil {
+		banner.Targeted = slot.Targeted
+		*slot = banner
+
+		return
+	}
+
+	// правило компилируется здесь, чтобы в кэш попала уже готовая к проверке форма
+	if err := banner.Targeting.Compile(); err != nil {
+		repo.logger.Warn(err.Error(), slog.Int("id", banner.ID))
+		return
+	}
+
+	slot.Targeted = append(slot.Targeted, banner)
+}
+
 func (repo *bannerRepository) GetBanners(ctx context.Context, params *queryparams.BannerParams) ([]banner_model.Banner,
 	error) {
 	repo.logger.Debug("get banners repository")
@@ -100,8 +282,9 @@ func (repo *bannerRepository) getOnlyBanners(ctx context.Context, params *queryp
 
 	for rows.Next() {
 		var banner banner_model.Banner
-		if err = rows.Scan(&banner.ID, &banner.ContentV1, &banner.ContentV2, &banner.ContentV3,
-			&banner.IsActive, &banner.CreatedAt, &banner.UpdatedAt); err != nil {
+		if err = rows.Scan(&banner.ID, &banner.Version, &banner.Content,
+			&banner.IsActive, &banner.CreatedAt, &banner.UpdatedAt, &banner.ActiveFrom, &banner.ActiveUntil,
+			&banner.Schedule, &banner.FrequencyCap, &banner.Targeting, &banner.Regions, &banner.Priority); err != nil {
 			return nil, err
 		}
 
@@ -113,8 +296,10 @@ func (repo *bannerRepository) getOnlyBanners(ctx context.Context, params *queryp
 
 func (repo *bannerRepository) makeQueryBanner(params *queryparams.BannerParams) string {
 	q := `
-		SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active, b.created_at, b.updated_at
+		SELECT b.id, v.version, v.content, b.is_active, b.created_at, b.updated_at, b.active_from, b.active_until,
+			b.schedule, b.frequency_cap, b.targeting, b.regions, b.priority
 		FROM banners b
+		JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
 	`
 	if params.FeatureID != nil {
 		q += "JOIN features_tags_to_banners ftb ON ftb.feature_id = $1 AND ftb.banner_id = b.id"
@@ -127,6 +312,16 @@ func (repo *bannerRepository) makeQueryBanner(params *queryparams.BannerParams)
 		}
 	}
 
+	switch params.Status {
+	case queryparams.StatusLive:
+		q += ` WHERE b.is_active AND (b.active_from IS NULL OR b.active_from <= now())
+			AND (b.active_until IS NULL OR b.active_until > now())`
+	case queryparams.StatusUpcoming:
+		q += " WHERE b.active_from > now()"
+	case queryparams.StatusExpired:
+		q += " WHERE b.active_until <= now()"
+	}
+
 	q += " ORDER BY b.updated_at DESC"
 	if params.Limit != nil {
 		q += fmt.Sprintf(` LIMIT %d`, *params.Limit)
@@ -143,13 +338,23 @@ func (repo *bannerRepository) makeQueryBanner(params *queryparams.BannerParams)
 
 func (repo *bannerRepository) GetBannerParams(ctx context.Context, bannerID int) (banner_model.BannerParams,
 	error) {
+	return repo.getBannerParams(ctx, repo.dbClient, bannerID)
+}
+
+func (repo *bannerRepository) getBannerParams(ctx context.Context, db querier, bannerID int) (
+	banner_model.BannerParams, error) {
+	// строки default_banners отмечены нулевым тегом, общий баннер по умолчанию - еще и нулевой фичей
 	q := `
 		SELECT feature_id, tag_id
 		FROM features_tags_to_banners
 		WHERE banner_id = $1
+		UNION ALL
+		SELECT COALESCE(feature_id, 0), 0
+		FROM default_banners
+		WHERE banner_id = $1
 	`
 	repo.logger.Debug("repo query", slog.String("query", q))
-	rows, err := repo.dbClient.Query(ctx, q, bannerID)
+	rows, err := db.Query(ctx, q, bannerID)
 
 	if err != nil {
 		return banner_model.BannerParams{}, err
@@ -160,11 +365,17 @@ func (repo *bannerRepository) GetBannerParams(ctx context.Context, bannerID int)
 	var banerKeys banner_model.BannerParams
 
 	for rows.Next() {
-		var tagID int
-		if err = rows.Scan(&banerKeys.FeatureID, &tagID); err != nil {
+		var featureID, tagID int
+		if err = rows.Scan(&featureID, &tagID); err != nil {
 			return banner_model.BannerParams{}, err
 		}
 
+		if tagID == 0 {
+			banerKeys.Defaults = append(banerKeys.Defaults, featureID)
+			continue
+		}
+
+		banerKeys.FeatureID = featureID
 		banerKeys.TagIDs = append(banerKeys.TagIDs, tagID)
 	}
 
@@ -34,11 +34,28 @@ func (repo *bannerRepository) InsertBanner(ctx context.Context, banner *banner_m
 		return 0, err
 	}
 
+	if _, err = repo.addVersion(ctx, transaction, id, banner.Content, banner.Author,
+		banner_model.StatusPublished); err != nil {
+		repo.logger.Warn(err.Error())
+		return 0, err
+	}
+
 	if err = repo.insertCrossTable(ctx, transaction, banner.FeatureID, id, banner.TagsID); err != nil {
 		repo.logger.Warn(err.Error())
 		return 0, err
 	}
 
+	// новые пары могли быть закэшированы как отсутствующие
+	params := banner_model.BannerParams{
+		TagIDs:    banner.TagsID,
+		FeatureID: banner.FeatureID,
+	}
+
+	if err = repo.notifyKeys(ctx, transaction, params.Keys()); err != nil {
+		repo.logger.Warn(err.Error())
+		return 0, err
+	}
+
 	if err = transaction.Commit(ctx); err != nil {
 		repo.logger.Warn(err.Error())
 		return 0, err
@@ -52,13 +69,16 @@ func (repo *bannerRepository) insertInBannerTable(ctx context.Context, transacti
 	repo.logger.Debug("insert into banners", slog.Any("banner", banner))
 
 	q := `
-		INSERT INTO banners (content_v1, is_active)
-		VALUES ($1, $2)
+		INSERT INTO banners (is_active, active_from, active_until, schedule, frequency_cap, impression_budget,
+			budget_from, targeting, regions, priority)
+		VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $6::BIGINT IS NULL THEN NULL ELSE now() END, $7, $8, $9)
 		RETURNING id
 	`
 
 	repo.logger.Debug("repo query", slog.String("query", q))
-	row := transaction.QueryRow(ctx, q, banner.Content, banner.IsActive)
+	row := transaction.QueryRow(ctx, q, banner.IsActive, banner.ActiveFrom, banner.ActiveUntil,
+		banner.Schedule, banner.FrequencyCap, banner.ImpressionBudget, banner.Targeting, banner.Regions,
+		banner.Priority)
 
 	var id int
 
@@ -74,16 +94,17 @@ func (repo *bannerRepository) insertCrossTable(ctx context.Context, transaction
 	repo.logger.Debug("insert into features_tags_to_banners table", slog.Any("tagIds", tagIDs),
 		slog.Int("bannerId", bannerID), slog.Int("feauterIds", featureID))
 
+	// в слоте может быть сколько угодно баннеров с правилами таргетинга и один баннер без них
 	q := `
-		INSERT INTO features_tags_to_banners (feature_id, tag_id, banner_id)
-		VALUES ($1, $2, $3)
+		INSERT INTO features_tags_to_banners (feature_id, tag_id, banner_id, targeted)
+		SELECT $1, $2, $3, targeting IS NOT NULL FROM banners WHERE id = $3
 	`
 	repo.logger.Debug("repo query", slog.String("query", q))
 
 	for _, tagID := range tagIDs {
 		tag, err := transaction.Exec(ctx, q, featureID, tagID, bannerID)
 		if err != nil {
-			return err
+			return slotTaken(err)
 		}
 
 		if tag.RowsAffected() != 1 {
@@ -0,0 +1,37 @@
+package bannerpostgre
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+)
+
+// NotifyChannel - канал PostgreSQL, в который публикуются пары (тег, фича),
+// затронутые изменением баннеров
+const NotifyChannel = "banner_cache"
+
+// Размер payload в NOTIFY ограничен 8000 байтами, поэтому ключи отправляются пачками
+const notifyBatchSize = 100
+
+func (repo *bannerRepository) notifyKeys(ctx context.Context, db execer, keys []banner_model.BannerKey) error {
+	q := `SELECT pg_notify($1, $2)`
+
+	for start := 0; start < len(keys); start += notifyBatchSize {
+		end := min(start+notifyBatchSize, len(keys))
+
+		payload, err := json.Marshal(keys[start:end])
+		if err != nil {
+			return err
+		}
+
+		repo.logger.Debug("notify", slog.String("channel", NotifyChannel), slog.String("payload", string(payload)))
+
+		if _, err = db.Exec(ctx, q, NotifyChannel, string(payload)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package bannerpostgre
+
+import (
+	"context"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+)
+
+func (repo *bannerRepository) ReviewBannerVersion(ctx context.Context, id, version int,
+	action banner_model.ReviewAction, actor string) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("review banner version", slog.Int("id", id), slog.Int("version", version),
+		slog.Any("action", action), slog.String("actor", actor))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	q := `
+		SELECT v.status, v.author, COALESCE((
+			SELECT a.actor FROM banner_approvals a
+			WHERE a.banner_id = v.banner_id AND a.version = v.version AND a.action = 'submit'
+			ORDER BY a.created_at DESC
+			LIMIT 1
+		), '')
+		FROM banner_versions v
+		WHERE v.banner_id = $1 AND v.version = $2
+		FOR UPDATE OF v
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	var state banner_model.ReviewState
+	if err = tx.QueryRow(ctx, q, id, version).Scan(&state.Status, &state.Author, &state.Submitter); err != nil {
+		repo.logger.Debug(err.Error())
+		return nil, err
+	}
+
+	status, err := action.Apply(state, actor)
+	if err != nil {
+		repo.logger.Debug(err.Error())
+		return nil, err
+	}
+
+	q = `
+		UPDATE banner_versions
+		SET status = $3
+		WHERE banner_id = $1 AND version = $2
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	if _, err = tx.Exec(ctx, q, id, version, status); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	q = `
+		INSERT INTO banner_approvals (banner_id, version, action, actor)
+		VALUES ($1, $2, $3, $4)
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	if _, err = tx.Exec(ctx, q, id, version, action, actor); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	var keys []banner_model.BannerKey
+
+	if status == banner_model.StatusPublished {
+		if err = repo.activateVersion(ctx, tx, id, version); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
+		var params banner_model.BannerParams
+
+		if params, err = repo.getBannerParams(ctx, tx, id); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
+		keys = params.Keys()
+
+		if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (repo *bannerRepository) GetBannerApprovals(ctx context.Context, id int) ([]banner_model.BannerApproval,
+	error) {
+	repo.logger.Debug("get banner approvals repository", slog.Int("id", id))
+
+	q := `
+		SELECT version, action, actor, created_at
+		FROM banner_approvals
+		WHERE banner_id = $1
+		ORDER BY created_at DESC
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	res := make([]banner_model.BannerApproval, 0)
+
+	for rows.Next() {
+		var approval banner_model.BannerApproval
+		if err = rows.Scan(&approval.Version, &approval.Action, &approval.Actor, &approval.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		res = append(res, approval)
+	}
+
+	return res, rows.Err()
+}
@@ -0,0 +1,74 @@
+package bannerpostgre
+
+import (
+	"context"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+)
+
+// startRollout делает версию кандидатом на постепенную публикацию. Пользователи увидят ее
+// только после публикации через согласование, до этого все получают активную версию.
+// Идущая раскатка не заменяется: ее нужно завершить или прервать
+func (repo *bannerRepository) startRollout(ctx context.Context, tx pgx.Tx, bannerID, version, percent int) error {
+	q := `
+		UPDATE banners
+		SET rollout_version = $2, rollout_percent = $3
+		WHERE id = $1 AND rollout_version IS NULL
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tag, err := tx.Exec(ctx, q, bannerID, version, percent)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return banner_model.ErrRolloutInProgress
+	}
+
+	return nil
+}
+
+func (repo *bannerRepository) SetRolloutPercent(ctx context.Context, id, percent int) ([]banner_model.BannerKey,
+	error) {
+	repo.logger.Debug("set rollout percent", slog.Int("id", id), slog.Int("percent", percent))
+
+	q := `
+		UPDATE banners
+		SET rollout_percent = $2, updated_at = now()
+		WHERE id = $1 AND rollout_version IS NOT NULL
+	`
+
+	return repo.updateBanner(ctx, q, id, percent)
+}
+
+// CompleteRollout делает опубликованную версию из раскатки активной для всех пользователей
+func (repo *bannerRepository) CompleteRollout(ctx context.Context, id int) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("complete rollout", slog.Int("id", id))
+
+	q := `
+		UPDATE banners
+		SET active_version = rollout_version, rollout_version = NULL, rollout_percent = 0, updated_at = now()
+		WHERE id = $1 AND EXISTS (
+			SELECT 1 FROM banner_versions
+			WHERE banner_id = $1 AND version = banners.rollout_version AND status = 'published'
+		)
+	`
+
+	return repo.updateBanner(ctx, q, id)
+}
+
+// AbortRollout прекращает раскатку, версия остается сохраненной, но не показывается
+func (repo *bannerRepository) AbortRollout(ctx context.Context, id int) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("abort rollout", slog.Int("id", id))
+
+	q := `
+		UPDATE banners
+		SET rollout_version = NULL, rollout_percent = 0, updated_at = now()
+		WHERE id = $1 AND rollout_version IS NOT NULL
+	`
+
+	return repo.updateBanner(ctx, q, id)
+}
@@ -0,0 +1,148 @@
+package bannerpostgre
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TagNotifyChannel - канал pg_notify, в который пишется id тега после смены его родителя
+const TagNotifyChannel = "tag_tree"
+
+func (repo *bannerRepository) GetTags(ctx context.Context) ([]banner_model.Tag, error) {
+	repo.logger.Debug("get tags repository")
+
+	q := `
+		SELECT id, COALESCE(name, ''), parent_id
+		FROM tags
+		ORDER BY id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []banner_model.Tag
+
+	for rows.Next() {
+		var tag banner_model.Tag
+		if err = rows.Scan(&tag.ID, &tag.Name, &tag.ParentID); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+
+		res = append(res, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// SetTagParent меняет родителя тега. Таблица тегов блокируется на запись до конца транзакции,
+// чтобы два одновременных изменения не замкнули цикл, который по отдельности не видит ни одно из них
+func (repo *bannerRepository) SetTagParent(ctx context.Context, id int, parentID *int) error {
+	repo.logger.Debug("set tag parent repository", slog.Int("id", id), slog.Any("parent", parentID))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	q := `LOCK TABLE tags IN SHARE ROW EXCLUSIVE MODE`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	if _, err = tx.Exec(ctx, q); err != nil {
+		repo.logger.Warn(err.Error())
+		return err
+	}
+
+	if parentID != nil {
+		if err = repo.checkTagCycle(ctx, tx, id, *parentID); err != nil {
+			repo.logger.Debug(err.Error())
+			return err
+		}
+	}
+
+	q = `
+		UPDATE tags
+		SET parent_id = $2
+		WHERE id = $1
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tag, err := tx.Exec(ctx, q, id, parentID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			err = banner_model.ErrUnknownParent
+		}
+
+		repo.logger.Warn(err.Error())
+
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	q = `SELECT pg_notify($1, $2)`
+	repo.logger.Debug("notify", slog.String("channel", TagNotifyChannel), slog.Int("id", id))
+
+	if _, err = tx.Exec(ctx, q, TagNotifyChannel, strconv.Itoa(id)); err != nil {
+		repo.logger.Warn(err.Error())
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// checkTagCycle возвращает banner_model.ErrTagCycle, если тег id совпадает с parentID или является его предком
+func (repo *bannerRepository) checkTagCycle(ctx context.Context, tx pgx.Tx, id, parentID int) error {
+	q := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM tags WHERE id = $2
+			UNION
+			SELECT t.id, t.parent_id FROM tags t JOIN ancestors a ON t.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	var cycle bool
+	if err := tx.QueryRow(ctx, q, id, parentID).Scan(&cycle); err != nil {
+		return err
+	}
+
+	if cycle {
+		return banner_model.ErrTagCycle
+	}
+
+	return nil
+}
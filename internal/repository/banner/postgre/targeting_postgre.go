@@ -0,0 +1,83 @@
+package bannerpostgre
+
+import (
+	"context"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+)
+
+func (repo *bannerRepository) DeleteBannerTargeting(ctx context.Context, id int) ([]banner_model.BannerKey,
+	error) {
+	repo.logger.Debug("delete banner targeting", slog.Int("id", id))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	q := `
+		UPDATE banners
+		SET targeting = NULL, updated_at = now()
+		WHERE id = $1
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tag, err := tx.Exec(ctx, q, id)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if tag.RowsAffected() != 1 {
+		return nil, pgx.ErrNoRows
+	}
+
+	if err = repo.markTargeted(ctx, tx, id, false); err != nil {
+		repo.logger.Debug(err.Error())
+		return nil, err
+	}
+
+	params, err := repo.getBannerParams(ctx, tx, id)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = repo.notifyKeys(ctx, tx, params.Keys()); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return params.Keys(), nil
+}
+
+// markTargeted переносит флаг наличия правил таргетинга в связи баннера со слотами.
+// Баннер без правил не может занять слот, в котором уже есть баннер без правил
+func (repo *bannerRepository) markTargeted(ctx context.Context, tx pgx.Tx, id int, targeted bool) error {
+	q := `
+		UPDATE features_tags_to_banners
+		SET targeted = $2
+		WHERE banner_id = $1
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	if _, err := tx.Exec(ctx, q, id, targeted); err != nil {
+		return slotTaken(err)
+	}
+
+	return nil
+}
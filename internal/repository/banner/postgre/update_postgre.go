@@ -4,19 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 )
 
-func (repo *bannerRepository) UpdateBanner(ctx context.Context, banner *banner_model.BannerUpdate) error {
+func (repo *bannerRepository) UpdateBanner(ctx context.Context,
+	banner *banner_model.BannerUpdate) ([]banner_model.BannerKey, error) {
 	repo.logger.Debug("update banner", slog.Int("id", banner.ID))
 
 	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		repo.logger.Warn(err.Error())
-		return err
+		return nil, err
 	}
 
 	defer func() {
@@ -28,116 +29,146 @@ func (repo *bannerRepository) UpdateBanner(ctx context.Context, banner *banner_m
 	err = repo.updateOnlyBanner(ctx, tx, banner)
 	if err != nil {
 		repo.logger.Warn(err.Error())
-		return err
+		return nil, err
 	}
 
-	if banner.FeatureID != nil || banner.TagsID != nil {
-		params, err := repo.GetBannerParams(ctx, banner.ID)
-		if err != nil {
-			repo.logger.Warn(err.Error())
-			return err
-		}
+	params, err := repo.getBannerParams(ctx, tx, banner.ID)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	keys := params.Keys()
 
+	if banner.FeatureID != nil || banner.TagsID != nil {
 		if err = repo.deleteCrossTable(ctx, tx, banner.ID); err != nil {
 			repo.logger.Warn(err.Error())
-			return err
+			return nil, err
 		}
 
-		var (
-			feauterID int
-			tagsIDs   []int
-		)
+		// ключи баннеров по умолчанию уже есть в keys
+		newParams := params
+		newParams.Defaults = nil
 
 		if banner.FeatureID != nil {
-			feauterID = *banner.FeatureID
-		} else {
-			feauterID = params.FeatureID
+			newParams.FeatureID = *banner.FeatureID
 		}
 
 		if banner.TagsID != nil {
-			tagsIDs = *banner.TagsID
-		} else {
-			tagsIDs = params.TagIDs
+			newParams.TagIDs = *banner.TagsID
 		}
 
-		if err = repo.insertCrossTable(ctx, tx, feauterID, banner.ID, tagsIDs); err != nil {
+		// у баннера без слотов нет сохраненной половины пары фича-теги
+		if newParams.FeatureID == 0 || len(newParams.TagIDs) == 0 {
+			return nil, banner_model.ErrNoSlot
+		}
+
+		if err = repo.insertCrossTable(ctx, tx, newParams.FeatureID, banner.ID, newParams.TagIDs); err != nil {
 			repo.logger.Warn(err.Error())
-			return err
+			return nil, err
 		}
+
+		keys = append(keys, newParams.Keys()...)
+	}
+
+	if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
 	}
 
 	if err = tx.Commit(ctx); err != nil {
 		repo.logger.Warn(err.Error())
-		return err
+		return nil, err
 	}
 
-	return nil
+	return keys, nil
 }
 
 func (repo *bannerRepository) updateOnlyBanner(ctx context.Context, tx pgx.Tx, banner *banner_model.BannerUpdate) error {
 	var (
-		tag pgconn.CommandTag
-		err error
+		set  []string
+		args []interface{}
 	)
 
-	check := func(tag pgconn.CommandTag, err error) error {
-		if err != nil {
-			return err
-		}
+	column := func(name string, value interface{}) {
+		args = append(args, value)
+		set = append(set, fmt.Sprintf("%s = $%d", name, len(args)))
+	}
 
-		if tag.RowsAffected() != 1 {
-			return pgx.ErrNoRows
-		}
+	if banner.IsActive != nil {
+		column("is_active", *banner.IsActive)
+	}
 
-		return nil
+	if banner.ClearActiveFrom {
+		set = append(set, "active_from = NULL")
+	} else if banner.ActiveFrom != nil {
+		column("active_from", *banner.ActiveFrom)
 	}
 
-	if banner.Content != nil && banner.IsActive != nil {
-		q := `UPDATE banners 
-			SET content_v1 = $1, content_v2 = content_v1, content_v3 = content_v2, 
-			is_active = $2, updated_at = now() 
-			WHERE id = $3
-			`
-		repo.logger.Debug(q)
-		tag, err = tx.Exec(ctx, q, banner.Content, *banner.IsActive, banner.ID)
+	if banner.ClearActiveUntil {
+		set = append(set, "active_until = NULL")
+	} else if banner.ActiveUntil != nil {
+		column("active_until", *banner.ActiveUntil)
+	}
 
-		return check(tag, err)
+	if banner.Schedule != nil {
+		column("schedule", banner.Schedule)
 	}
 
-	if banner.Content != nil && banner.IsActive == nil {
-		q := `UPDATE banners 
-			SET content_v1 = $1, content_v2 = content_v1, content_v3 = content_v2, updated_at = now() 
-			WHERE id = $2
-		`
-		repo.logger.Debug(q)
-		tag, err = tx.Exec(ctx, q, banner.Content, banner.ID)
+	if banner.FrequencyCap != nil {
+		column("frequency_cap", banner.FrequencyCap)
+	}
 
-		return check(tag, err)
+	if banner.Targeting != nil {
+		column("targeting", banner.Targeting)
 	}
 
-	if banner.Content == nil && banner.IsActive != nil {
-		q := `UPDATE banners 
-			SET is_active = $1, updated_at = now() 
-			WHERE id = $2
-		`
-		repo.logger.Debug(q)
-		tag, err = tx.Exec(ctx, q, *banner.IsActive, banner.ID)
+	if banner.Regions != nil {
+		column("regions", banner.Regions)
+	}
 
-		return check(tag, err)
+	if banner.Priority != nil {
+		column("priority", *banner.Priority)
 	}
 
-	if banner.Content == nil && banner.IsActive == nil {
-		q := `UPDATE banners 
-			SET updated_at = now() 
-			WHERE id = $1
-		`
-		repo.logger.Debug(q)
-		tag, err = tx.Exec(ctx, q, banner.ID)
+	// показы считаются с момента, когда бюджет был задан впервые
+	if banner.ImpressionBudget != nil {
+		column("impression_budget", *banner.ImpressionBudget)
+		set = append(set, "budget_from = COALESCE(budget_from, now())")
+	}
 
-		return check(tag, err)
+	args = append(args, banner.ID)
+	q := fmt.Sprintf(`UPDATE banners 
+		SET %s 
+		WHERE id = $%d
+	`, strings.Join(append(set, "updated_at = now()"), ", "), len(args))
+	repo.logger.Debug(q)
+
+	tag, err := tx.Exec(ctx, q, args...)
+	if err != nil {
+		return badWindow(err)
 	}
 
-	return nil
+	if tag.RowsAffected() != 1 {
+		return pgx.ErrNoRows
+	}
+
+	if banner.Targeting != nil {
+		if err = repo.markTargeted(ctx, tx, banner.ID, true); err != nil {
+			return err
+		}
+	}
+
+	if banner.Content == nil {
+		return nil
+	}
+
+	version, err := repo.addVersion(ctx, tx, banner.ID, banner.Content, banner.Author, banner_model.StatusDraft)
+	if err != nil || banner.RolloutPercent == nil {
+		return err
+	}
+
+	return repo.startRollout(ctx, tx, banner.ID, version, *banner.RolloutPercent)
 }
 
 func (repo *bannerRepository) deleteCrossTable(ctx context.Context, tx pgx.Tx, bannerID int) error {
@@ -155,24 +186,100 @@ func (repo *bannerRepository) deleteCrossTable(ctx context.Context, tx pgx.Tx, b
 	return nil
 }
 
-func (repo *bannerRepository) UpdateBannerVersion(ctx context.Context, id, version int) error {
+func (repo *bannerRepository) UpdateBannerVersion(ctx context.Context, id,
+	version int) ([]banner_model.BannerKey, error) {
 	repo.logger.Debug("update banner version", slog.Int("id", id), slog.Int("version", version))
 
-	q := fmt.Sprintf(`
+	q := `
 		UPDATE banners
-		SET content_v1 = content_v%d, content_v2 = content_v1, content_v3 = content_v2, updated_at = now()
-		WHERE id = $1
-	`, version)
-	repo.logger.Debug(q)
+		SET active_version = $2, updated_at = now()
+		WHERE id = $1 AND EXISTS (
+			SELECT 1 FROM banner_versions WHERE banner_id = $1 AND version = $2 AND status = 'published'
+		)
+	`
 
-	tag, err := repo.dbClient.Exec(ctx, q, id)
+	return repo.updateBanner(ctx, q, id, version)
+}
+
+// updateBanner изменяет баннер id запросом q и уведомляет другие поды о затронутых ключах
+// в той же транзакции: уведомление доставляется только после фиксации изменения
+func (repo *bannerRepository) updateBanner(ctx context.Context, q string, id int,
+	args ...interface{}) ([]banner_model.BannerKey, error) {
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
-		return err
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tag, err := tx.Exec(ctx, q, append([]interface{}{id}, args...)...)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
 	}
 
 	if tag.RowsAffected() != 1 {
-		return pgx.ErrNoRows
+		return nil, pgx.ErrNoRows
 	}
 
-	return nil
+	params, err := repo.getBannerParams(ctx, tx, id)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = repo.notifyKeys(ctx, tx, params.Keys()); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return params.Keys(), nil
+}
+
+func (repo *bannerRepository) DeleteBannerSchedule(ctx context.Context, id int) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("delete banner schedule", slog.Int("id", id))
+
+	return repo.resetBannerColumn(ctx, id, "schedule")
+}
+
+func (repo *bannerRepository) DeleteBannerRegions(ctx context.Context, id int) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("delete banner regions", slog.Int("id", id))
+
+	return repo.resetBannerColumn(ctx, id, "regions")
+}
+
+func (repo *bannerRepository) DeleteBannerFrequencyCap(ctx context.Context, id int) ([]banner_model.BannerKey,
+	error) {
+	repo.logger.Debug("delete banner frequency cap", slog.Int("id", id))
+
+	return repo.resetBannerColumn(ctx, id, "frequency_cap")
+}
+
+// resetBannerColumn сбрасывает необязательную настройку баннера в NULL
+func (repo *bannerRepository) resetBannerColumn(ctx context.Context, id int, columns ...string) (
+	[]banner_model.BannerKey, error) {
+	set := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		set = append(set, column+" = NULL")
+	}
+
+	q := fmt.Sprintf(`
+		UPDATE banners
+		SET %s
+		WHERE id = $1
+	`, strings.Join(append(set, "updated_at = now()"), ", "))
+
+	return repo.updateBanner(ctx, q, id)
 }
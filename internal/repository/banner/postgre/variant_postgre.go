@@ -0,0 +1,273 @@
+package bannerpostgre
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// getSlotVariants возвращает активные версии баннеров, участвующих в эксперименте слота,
+// и стратегию распределения трафика. Пустой результат означает, что эксперимента нет.
+// Запись слота кэшируется, поэтому выключенные и закрытые для региона варианты не отбрасываются
+// здесь, а пропускаются при выборе варианта для пользователя
+func (repo *bannerRepository) getSlotVariants(ctx context.Context, tagID, featureID string) (
+	[]banner_model.Variant, *banner_model.SlotStrategy, error) {
+	q := `
+		SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, sv.weight,
+			st.strategy, st.epsilon, st.seed, b.frequency_cap, b.regions, b.priority, b.updated_at
+		FROM slot_variants sv
+		JOIN banners b ON b.id = sv.banner_id
+		JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+		LEFT JOIN slot_strategies st ON st.feature_id = sv.feature_id AND st.tag_id = sv.tag_id
+		WHERE sv.feature_id = $1 AND sv.tag_id = $2
+		ORDER BY b.id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, featureID, tagID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	var (
+		res      []banner_model.Variant
+		strategy *banner_model.SlotStrategy
+	)
+
+	for rows.Next() {
+		variant, row, err := scanVariant(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res = append(res, variant)
+		strategy = row.strategy()
+	}
+
+	return res, strategy, rows.Err()
+}
+
+// scanVariant читает вариант эксперимента и стратегию его слота, prefix - колонки строки перед колонками варианта
+func scanVariant(rows pgx.Rows, prefix ...interface{}) (banner_model.Variant, strategyRow, error) {
+	var (
+		variant banner_model.Variant
+		row     strategyRow
+	)
+
+	dest := append(prefix, &variant.ID, &variant.Version, &variant.Content, &variant.IsActive,
+		&variant.ActiveFrom, &variant.ActiveUntil, &variant.Schedule, &variant.Weight,
+		&row.name, &row.epsilon, &row.seed, &variant.FrequencyCap, &variant.Regions, &variant.Priority,
+		&variant.UpdatedAt)
+
+	if err := rows.Scan(dest...); err != nil {
+		return banner_model.Variant{}, strategyRow{}, err
+	}
+
+	return variant, row, nil
+}
+
+func (repo *bannerRepository) GetSlotVariants(ctx context.Context, featureID, tagID int) (
+	banner_model.SlotVariants, error) {
+	repo.logger.Debug("get slot variants repository", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	q := `
+		SELECT sv.banner_id, sv.weight, st.strategy, st.epsilon, st.seed
+		FROM slot_variants sv
+		LEFT JOIN slot_strategies st ON st.feature_id = sv.feature_id AND st.tag_id = sv.tag_id
+		WHERE sv.feature_id = $1 AND sv.tag_id = $2
+		ORDER BY sv.banner_id
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, featureID, tagID)
+	if err != nil {
+		return banner_model.SlotVariants{}, err
+	}
+
+	defer rows.Close()
+
+	var res banner_model.SlotVariants
+
+	for rows.Next() {
+		var (
+			variant banner_model.VariantWeight
+			row     strategyRow
+		)
+
+		if err = rows.Scan(&variant.BannerID, &variant.Weight, &row.name, &row.epsilon, &row.seed); err != nil {
+			return banner_model.SlotVariants{}, err
+		}
+
+		res.Variants = append(res.Variants, variant)
+		res.Strategy = row.strategy()
+	}
+
+	if err = rows.Err(); err != nil {
+		return banner_model.SlotVariants{}, err
+	}
+
+	if len(res.Variants) == 0 {
+		return banner_model.SlotVariants{}, pgx.ErrNoRows
+	}
+
+	return res, nil
+}
+
+// strategyRow - колонки slot_strategies, которые после LEFT JOIN могут быть NULL
+type strategyRow struct {
+	name    *string
+	epsilon *float64
+	seed    *int64
+}
+
+func (row strategyRow) strategy() *banner_model.SlotStrategy {
+	if row.name == nil {
+		return nil
+	}
+
+	res := &banner_model.SlotStrategy{Name: banner_model.Strategy(*row.name), Seed: row.seed}
+	if row.epsilon != nil {
+		res.Epsilon = *row.epsilon
+	}
+
+	return res
+}
+
+// SetSlotVariants заменяет набор вариантов слота целиком
+func (repo *bannerRepository) SetSlotVariants(ctx context.Context, featureID, tagID int,
+	variants banner_model.SlotVariants) ([]banner_model.BannerKey, error) {
+	repo.logger.Debug("set slot variants repository", slog.Int("feature", featureID), slog.Int("tag", tagID),
+		slog.Any("variants", variants))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	if _, err = repo.deleteSlotVariants(ctx, tx, featureID, tagID); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	q := `
+		INSERT INTO slot_variants (feature_id, tag_id, banner_id, weight)
+		VALUES ($1, $2, $3, $4)
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	for _, variant := range variants.Variants {
+		if _, err = tx.Exec(ctx, q, featureID, tagID, variant.BannerID, variant.Weight); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+				err = banner_model.ErrUnknownVariant
+			}
+
+			repo.logger.Debug(err.Error())
+
+			return nil, err
+		}
+	}
+
+	if variants.Strategy.Adaptive() {
+		q = `
+			INSERT INTO slot_strategies (feature_id, tag_id, strategy, epsilon, seed)
+			VALUES ($1, $2, $3, $4, $5)
+		`
+		repo.logger.Debug("repo query", slog.String("query", q))
+
+		if _, err = tx.Exec(ctx, q, featureID, tagID, variants.Strategy.Name, variants.Strategy.Epsilon,
+			variants.Strategy.Seed); err != nil {
+			repo.logger.Warn(err.Error())
+			return nil, err
+		}
+	}
+
+	keys := banner_model.BannerParams{TagIDs: []int{tagID}, FeatureID: featureID}.Keys()
+
+	if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// DeleteSlotVariants завершает эксперимент, после чего слот снова показывает свой баннер
+func (repo *bannerRepository) DeleteSlotVariants(ctx context.Context, featureID, tagID int) (
+	[]banner_model.BannerKey, error) {
+	repo.logger.Debug("delete slot variants repository", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	tx, err := repo.dbClient.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			repo.logger.Debug(err.Error())
+		}
+	}()
+
+	deleted, err := repo.deleteSlotVariants(ctx, tx, featureID, tagID)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if deleted == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	keys := banner_model.BannerParams{TagIDs: []int{tagID}, FeatureID: featureID}.Keys()
+
+	if err = repo.notifyKeys(ctx, tx, keys); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		repo.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// deleteSlotVariants удаляет варианты слота вместе со стратегией и возвращает число удаленных вариантов
+func (repo *bannerRepository) deleteSlotVariants(ctx context.Context, db execer, featureID, tagID int) (int64,
+	error) {
+	q := `
+		WITH strategy AS (
+			DELETE FROM slot_strategies WHERE feature_id = $1 AND tag_id = $2
+		)
+		DELETE FROM slot_variants
+		WHERE feature_id = $1 AND tag_id = $2
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	tag, err := db.Exec(ctx, q, featureID, tagID)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,131 @@
+package bannerpostgre
+
+import (
+	"context"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+)
+
+// addVersion сохраняет новую версию содержимого баннера в состоянии status, делает
+// опубликованную версию активной и удаляет опубликованные версии, вышедшие за пределы retention.
+// Активная версия, версия в раскатке и неопубликованные версии вместе с их одобрениями не удаляются
+func (repo *bannerRepository) addVersion(ctx context.Context, tx pgx.Tx, bannerID int, content interface{},
+	author string, status banner_model.VersionStatus) (int, error) {
+	q := `
+		INSERT INTO banner_versions (banner_id, version, content, author, status)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4
+		FROM banner_versions
+		WHERE banner_id = $1
+		RETURNING version
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	var version int
+	if err := tx.QueryRow(ctx, q, bannerID, content, author, status).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	if status == banner_model.StatusPublished {
+		if err := repo.activateVersion(ctx, tx, bannerID, version); err != nil {
+			return 0, err
+		}
+	}
+
+	if repo.retention <= 0 {
+		return version, nil
+	}
+
+	q = `
+		DELETE FROM banner_versions
+		WHERE banner_id = $1 AND version <= $2 AND status = 'published'
+			AND NOT EXISTS (
+				SELECT 1 FROM banners WHERE id = $1 AND version IN (active_version, rollout_version)
+			)
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	if _, err := tx.Exec(ctx, q, bannerID, version-repo.retention); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// activateVersion делает версию активной. Версия в раскатке становится активной
+// только при завершении раскатки
+func (repo *bannerRepository) activateVersion(ctx context.Context, tx pgx.Tx, bannerID, version int) error {
+	q := `
+		UPDATE banners
+		SET active_version = $1, updated_at = now()
+		WHERE id = $2 AND rollout_version IS DISTINCT FROM $1
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	_, err := tx.Exec(ctx, q, version, bannerID)
+
+	return err
+}
+
+func (repo *bannerRepository) GetBannerVersions(ctx context.Context, id int) ([]banner_model.BannerVersion, error) {
+	repo.logger.Debug("get banner versions repository", slog.Int("id", id))
+
+	q := `
+		SELECT v.version, v.author, v.status, v.created_at, v.version = b.active_version
+		FROM banners b
+		JOIN banner_versions v ON v.banner_id = b.id
+		WHERE b.id = $1
+		ORDER BY v.version DESC
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []banner_model.BannerVersion
+
+	for rows.Next() {
+		var version banner_model.BannerVersion
+		if err = rows.Scan(&version.Version, &version.Author, &version.Status, &version.CreatedAt,
+			&version.IsActive); err != nil {
+			return nil, err
+		}
+
+		res = append(res, version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	return res, nil
+}
+
+func (repo *bannerRepository) GetBannerVersion(ctx context.Context, id, version int) (banner_model.Banner, error) {
+	repo.logger.Debug("get banner version repository", slog.Int("id", id), slog.Int("version", version))
+
+	q := `
+		SELECT b.id, v.version, v.content, b.is_active, v.created_at, b.updated_at
+		FROM banners b
+		JOIN banner_versions v ON v.banner_id = b.id
+		WHERE b.id = $1 AND v.version = $2
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	var banner banner_model.Banner
+	if err := repo.dbClient.QueryRow(ctx, q, id, version).Scan(&banner.ID, &banner.Version, &banner.Content,
+		&banner.IsActive, &banner.CreatedAt, &banner.UpdatedAt); err != nil {
+		return banner_model.Banner{}, err
+	}
+
+	return banner, nil
+}
@@ -0,0 +1,64 @@
+package bannerpostgre
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+)
+
+func (repo *bannerRepository) StreamActiveBanners(ctx context.Context,
+	fn func(key banner_model.BannerKey, banner banner_model.Banner) bool) error {
+	repo.logger.Debug("stream active banners repository")
+
+	// слоты с баннерами с правилами таргетинга загружаются обычным запросом, он собирает их целиком
+	q := `
+		SELECT ftb.tag_id, ftb.feature_id, b.id, v.version, v.content, b.is_active, b.active_from, b.active_until,
+			b.schedule, b.frequency_cap, b.regions, b.priority, b.updated_at
+		FROM banners b
+		JOIN features_tags_to_banners ftb ON ftb.banner_id = b.id
+		JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+		WHERE b.is_active AND (b.active_until IS NULL OR b.active_until > now()) AND b.rollout_version IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM slot_variants sv WHERE sv.feature_id = ftb.feature_id AND sv.tag_id = ftb.tag_id
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM features_tags_to_banners t
+				WHERE t.feature_id = ftb.feature_id AND t.tag_id = ftb.tag_id AND t.targeted
+			)
+		ORDER BY b.updated_at DESC
+	`
+	repo.logger.Debug("repo query", slog.String("query", q))
+
+	rows, err := repo.dbClient.Query(ctx, q)
+	if err != nil {
+		repo.logger.Warn(err.Error())
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			tagID, featureID int
+			banner           banner_model.Banner
+		)
+
+		if err = rows.Scan(&tagID, &featureID, &banner.ID, &banner.Version, &banner.Content,
+			&banner.IsActive, &banner.ActiveFrom, &banner.ActiveUntil,
+			&banner.Schedule, &banner.FrequencyCap, &banner.Regions, &banner.Priority,
+			&banner.UpdatedAt); err != nil {
+			repo.logger.Warn(err.Error())
+			return err
+		}
+
+		if !fn(banner_model.BannerKey{
+			TagID:     strconv.Itoa(tagID),
+			FeatureID: strconv.Itoa(featureID),
+		}, banner) {
+			return nil
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,227 @@
+package apikeyservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
+	"time"
+
+	apikey_model "github.com/Heatdog/Avito/internal/models/apikey"
+	apikey_repository "github.com/Heatdog/Avito/internal/repository/apikey"
+	"github.com/Heatdog/Avito/pkg/cache"
+	"github.com/Heatdog/Avito/pkg/token"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	secretLength  = 32
+	verifyTimeout = 3 * time.Second
+)
+
+type APIKeyService interface {
+	token.Provider
+	CreateAPIKey(ctx context.Context, key *apikey_model.APIKeyInsert) (apikey_model.APIKeyCreated, error)
+	GetAPIKeys(ctx context.Context) ([]apikey_model.APIKey, error)
+	RotateAPIKey(ctx context.Context, id int) (apikey_model.APIKeyCreated, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+	Bootstrap(ctx context.Context, name, secret string) error
+}
+
+type apiKeyService struct {
+	logger  *slog.Logger
+	repo    apikey_repository.APIKeyRepository
+	cache   cache.Cache[string, apikey_model.APIKey]
+	missing cache.Cache[string, struct{}]
+}
+
+// NewAPIKeyService создает сервис ключей. cache хранит проверенные ключи по хэшу секрета,
+// missing - хэши неизвестных секретов, чтобы повторные запросы с ними не доходили до базы
+func NewAPIKeyService(logger *slog.Logger, repo apikey_repository.APIKeyRepository,
+	cache cache.Cache[string, apikey_model.APIKey], missing cache.Cache[string, struct{}]) APIKeyService {
+	return &apiKeyService{
+		logger:  logger,
+		repo:    repo,
+		cache:   cache,
+		missing: missing,
+	}
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeySubject - субъект токенов ключа, по нему ключ записывается автором изменений
+func KeySubject(id int) string {
+	return "api_key:" + strconv.Itoa(id)
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, secretLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+func (service *apiKeyService) VerifyToken(tokenStr string) (token.Identity, bool) {
+	secretHash := hashSecret(tokenStr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	key, ok, err := service.cache.Get(ctx, secretHash)
+	if err != nil {
+		service.logger.Warn(err.Error())
+	}
+
+	if !ok {
+		if _, missing, err := service.missing.Get(ctx, secretHash); err != nil {
+			service.logger.Warn(err.Error())
+		} else if missing {
+			service.logger.Debug("api key not found in missing cache")
+			return token.Identity{}, false
+		}
+
+		key, err = service.repo.GetAPIKeyByHash(ctx, secretHash)
+		if err == pgx.ErrNoRows {
+			service.logger.Debug("api key not found")
+
+			if _, err = service.missing.Add(ctx, secretHash, struct{}{}); err != nil {
+				service.logger.Warn(err.Error())
+			}
+
+			return token.Identity{}, false
+		}
+
+		if err != nil {
+			service.logger.Warn(err.Error())
+			return token.Identity{}, false
+		}
+
+		if _, err = service.cache.Add(ctx, secretHash, key); err != nil {
+			service.logger.Warn(err.Error())
+		}
+	}
+
+	if key.RevokedAt != nil {
+		service.logger.Debug("api key revoked", slog.Int("id", key.ID))
+		return token.Identity{}, false
+	}
+
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		service.logger.Debug("api key expired", slog.Int("id", key.ID))
+		return token.Identity{}, false
+	}
+
+	role, ok := token.ParseRole(key.Role)
+
+	// имя ключа не уникально, поэтому субъектом служит его идентификатор
+	return token.Identity{
+		Subject: KeySubject(key.ID),
+		Role:    role,
+	}, ok
+}
+
+func (service *apiKeyService) CreateAPIKey(ctx context.Context,
+	key *apikey_model.APIKeyInsert) (apikey_model.APIKeyCreated, error) {
+	service.logger.Debug("create api key", slog.String("name", key.Name), slog.String("role", key.Role))
+
+	secret, err := generateSecret()
+	if err != nil {
+		service.logger.Error(err.Error())
+		return apikey_model.APIKeyCreated{}, err
+	}
+
+	id, err := service.repo.InsertAPIKey(ctx, key, hashSecret(secret))
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return apikey_model.APIKeyCreated{}, err
+	}
+
+	return apikey_model.APIKeyCreated{
+		ID:  id,
+		Key: secret,
+	}, nil
+}
+
+func (service *apiKeyService) GetAPIKeys(ctx context.Context) ([]apikey_model.APIKey, error) {
+	service.logger.Debug("get api keys")
+
+	return service.repo.GetAPIKeys(ctx)
+}
+
+func (service *apiKeyService) RotateAPIKey(ctx context.Context, id int) (apikey_model.APIKeyCreated, error) {
+	service.logger.Debug("rotate api key", slog.Int("id", id))
+
+	secret, err := generateSecret()
+	if err != nil {
+		service.logger.Error(err.Error())
+		return apikey_model.APIKeyCreated{}, err
+	}
+
+	oldHash, err := service.repo.RotateAPIKey(ctx, id, hashSecret(secret))
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return apikey_model.APIKeyCreated{}, err
+	}
+
+	if _, err = service.cache.Remove(ctx, oldHash); err != nil {
+		service.logger.Warn(err.Error())
+	}
+
+	return apikey_model.APIKeyCreated{
+		ID:  id,
+		Key: secret,
+	}, nil
+}
+
+func (service *apiKeyService) RevokeAPIKey(ctx context.Context, id int) error {
+	service.logger.Debug("revoke api key", slog.Int("id", id))
+
+	secretHash, err := service.repo.RevokeAPIKey(ctx, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	if _, err = service.cache.Remove(ctx, secretHash); err != nil {
+		service.logger.Warn(err.Error())
+	}
+
+	return nil
+}
+
+// Bootstrap создает ключ администратора с заданным секретом, если его еще нет,
+// чтобы после развертывания можно было выпустить остальные ключи
+func (service *apiKeyService) Bootstrap(ctx context.Context, name, secret string) error {
+	secretHash := hashSecret(secret)
+
+	_, err := service.repo.GetAPIKeyByHash(ctx, secretHash)
+	if err == nil {
+		return nil
+	}
+
+	if err != pgx.ErrNoRows {
+		return err
+	}
+
+	service.logger.Info("create bootstrap api key", slog.String("name", name))
+
+	if _, err = service.repo.InsertAPIKey(ctx, &apikey_model.APIKeyInsert{
+		Name: name,
+		Role: string(token.RoleAdmin),
+	}, secretHash); err != nil {
+		return err
+	}
+
+	if _, err = service.missing.Remove(ctx, secretHash); err != nil {
+		service.logger.Warn(err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package apikeyservice
+
+import (
+	"context"
+	"log/slog"
+
+	apikey_model "github.com/Heatdog/Avito/internal/models/apikey"
+	"github.com/Heatdog/Avito/pkg/cache"
+)
+
+// CacheInvalidator удаляет из локального кэша ключи, отозванные или перевыпущенные
+// другими экземплярами сервиса
+type CacheInvalidator struct {
+	logger *slog.Logger
+	cache  cache.Cache[string, apikey_model.APIKey]
+}
+
+// NewCacheInvalidator создает инвалидатор кэша ключей. cache должен быть общим с сервисом
+func NewCacheInvalidator(logger *slog.Logger, cache cache.Cache[string, apikey_model.APIKey]) *CacheInvalidator {
+	return &CacheInvalidator{
+		logger: logger,
+		cache:  cache,
+	}
+}
+
+// HandleNotification получает хэш секрета, который больше не действует
+func (invalidator *CacheInvalidator) HandleNotification(payload string) {
+	invalidator.logger.Debug("invalidate api key")
+
+	if _, err := invalidator.cache.Remove(context.Background(), payload); err != nil {
+		invalidator.logger.Warn(err.Error())
+	}
+}
+
+// Reset очищает кэш целиком, когда уведомления могли быть пропущены
+func (invalidator *CacheInvalidator) Reset() {
+	invalidator.logger.Info("purge api key cache after listener reconnect")
+
+	if err := invalidator.cache.Purge(context.Background()); err != nil {
+		invalidator.logger.Warn(err.Error())
+	}
+}
@@ -0,0 +1,293 @@
+package bannerservice
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/pkg/bandit"
+)
+
+const (
+	// allocationSamples - число выборов, по которым оценивается доля трафика вариантов
+	allocationSamples = 1000
+	// banditIdleTTL - время без выбора варианта, после которого статистика слота удаляется из памяти.
+	// Все события есть в базе, поэтому при следующем выборе статистика загрузится заново
+	banditIdleTTL = 30 * time.Minute
+	// seedRetryInterval - пауза перед повторной загрузкой статистики слота после ошибки базы
+	seedRetryInterval = 10 * time.Second
+)
+
+// slotBandit хранит статистику вариантов слота. События, принятые этим подом, учитываются
+// с момента since, а более ранние, в том числе принятые другими подами и до перезапуска,
+// загружаются из базы при первом выборе варианта. Пока идет загрузка (seeding), выбор
+// делается по статистике пода, после ошибки загрузка не повторяется до retryAt.
+// lastUsed защищен banditsMu сервиса, остальные поля - mu
+type slotBandit struct {
+	rng      *rand.Rand
+	arms     map[int]*bandit.Arm
+	strategy banner_model.SlotStrategy
+	since    time.Time
+	lastUsed time.Time
+	retryAt  time.Time
+	mu       sync.Mutex
+	seeded   bool
+	seeding  bool
+}
+
+func newRand(seed *int64, now int64) *rand.Rand {
+	if seed != nil {
+		return rand.New(rand.NewSource(*seed))
+	}
+
+	return rand.New(rand.NewSource(now))
+}
+
+func selector(strategy banner_model.SlotStrategy) bandit.Selector {
+	if strategy.Name == banner_model.StrategyThompson {
+		return bandit.NewThompson()
+	}
+
+	return bandit.NewEpsilonGreedy(strategy.Epsilon)
+}
+
+// slotArms возвращает статистику слота key и создает ее при первом выборе варианта.
+// Заодно удаляет слоты, в которых дольше banditIdleTTL не выбирался вариант
+func (service *bannerService) slotArms(key banner_model.BannerKey) *slotBandit {
+	service.banditsMu.Lock()
+	defer service.banditsMu.Unlock()
+
+	now := service.clock.Now()
+
+	if now.Sub(service.banditsSwept) >= banditIdleTTL {
+		for slotKey, slot := range service.bandits {
+			if now.Sub(slot.lastUsed) >= banditIdleTTL {
+				delete(service.bandits, slotKey)
+			}
+		}
+
+		service.banditsSwept = now
+	}
+
+	slot, ok := service.bandits[key]
+	if !ok {
+		slot = &slotBandit{arms: map[int]*bandit.Arm{}, since: now}
+		service.bandits[key] = slot
+	}
+
+	slot.lastUsed = now
+
+	return slot
+}
+
+// trackedArms возвращает статистику слота key, только если в нем уже выбирался вариант
+func (service *bannerService) trackedArms(key banner_model.BannerKey) (*slotBandit, bool) {
+	service.banditsMu.Lock()
+	defer service.banditsMu.Unlock()
+
+	slot, ok := service.bandits[key]
+
+	return slot, ok
+}
+
+// seed добавляет к статистике слота события из базы, записанные до since. Вызывается без slot.mu:
+// запрос к базе не держит блокировку, и одновременные выборы в слоте его не ждут. Загрузка идет
+// один раз, если база недоступна, повторяется не чаще seedRetryInterval
+func (service *bannerService) seed(ctx context.Context, key banner_model.BannerKey, slot *slotBandit) {
+	slot.mu.Lock()
+
+	if slot.seeded || slot.seeding || service.clock.Now().Before(slot.retryAt) {
+		slot.mu.Unlock()
+		return
+	}
+
+	slot.seeding = true
+	since := slot.since
+
+	slot.mu.Unlock()
+
+	stats, err := service.repo.GetSlotStats(ctx, key.FeatureID, key.TagID, since)
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	slot.seeding = false
+
+	if err != nil {
+		service.logger.Warn(err.Error())
+		slot.retryAt = service.clock.Now().Add(seedRetryInterval)
+
+		return
+	}
+
+	for _, stat := range stats {
+		arm := slot.arm(stat.BannerID)
+		arm.Impressions += stat.Impressions
+		arm.Clicks += stat.Clicks
+	}
+
+	slot.seeded = true
+}
+
+func (slot *slotBandit) arm(bannerID int) *bandit.Arm {
+	arm, ok := slot.arms[bannerID]
+	if !ok {
+		arm = &bandit.Arm{}
+		slot.arms[bannerID] = arm
+	}
+
+	return arm
+}
+
+func sameStrategy(a, b banner_model.SlotStrategy) bool {
+	if a.Name != b.Name || a.Epsilon != b.Epsilon || (a.Seed == nil) != (b.Seed == nil) {
+		return false
+	}
+
+	return a.Seed == nil || *a.Seed == *b.Seed
+}
+
+// pickAdaptive выбирает вариант слота по кликам и показам. При смене стратегии
+// генератор создается заново, а накопленная статистика сохраняется
+func (service *bannerService) pickAdaptive(ctx context.Context, key banner_model.BannerKey,
+	banner *banner_model.Banner) *banner_model.Banner {
+	slot := service.slotArms(key)
+
+	service.seed(ctx, key, slot)
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	if slot.rng == nil || !sameStrategy(slot.strategy, *banner.Strategy) {
+		slot.strategy = *banner.Strategy
+		slot.rng = newRand(slot.strategy.Seed, service.clock.Now().UnixNano())
+	}
+
+	i := selector(slot.strategy).Select(slot.rng, slot.armsOf(banner.Variants))
+
+	return &banner.Variants[i].Banner
+}
+
+// armsOf возвращает статистику вариантов в порядке variants
+func (slot *slotBandit) armsOf(variants []banner_model.Variant) []bandit.Arm {
+	res := make([]bandit.Arm, len(variants))
+
+	for i, variant := range variants {
+		if arm, ok := slot.arms[variant.ID]; ok {
+			res[i] = *arm
+		}
+	}
+
+	return res
+}
+
+// recordArm учитывает показ или клик в статистике слота. Статистика ведется только для слотов,
+// в которых под выбирал вариант по кликам: события остальных слотов есть в базе и загрузятся
+// при первом выборе, поэтому произвольные пары из POST /events не занимают память
+func (service *bannerService) recordArm(event banner_model.Event) {
+	key := banner_model.BannerKey{TagID: strconv.Itoa(event.TagID), FeatureID: strconv.Itoa(event.FeatureID)}
+
+	slot, ok := service.trackedArms(key)
+	if !ok {
+		return
+	}
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	arm := slot.arm(event.BannerID)
+
+	switch event.Type {
+	case banner_model.EventImpression:
+		arm.Impressions++
+	case banner_model.EventClick:
+		arm.Clicks++
+	}
+}
+
+// GetSlotAllocation возвращает статистику вариантов слота и долю трафика,
+// которую каждый из них получает сейчас
+func (service *bannerService) GetSlotAllocation(ctx context.Context, featureID, tagID int) (
+	banner_model.SlotAllocation, error) {
+	service.logger.Debug("get slot allocation", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	variants, err := service.repo.GetSlotVariants(ctx, featureID, tagID)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return banner_model.SlotAllocation{}, err
+	}
+
+	res := banner_model.SlotAllocation{
+		Strategy: banner_model.StrategyWeights,
+		Variants: make([]banner_model.VariantAllocation, len(variants.Variants)),
+	}
+
+	arms := make([]bandit.Arm, len(variants.Variants))
+
+	key := banner_model.BannerKey{TagID: strconv.Itoa(tagID), FeatureID: strconv.Itoa(featureID)}
+
+	if variants.Strategy.Adaptive() {
+		slot := service.slotArms(key)
+
+		service.seed(ctx, key, slot)
+
+		slot.mu.Lock()
+
+		for i, variant := range variants.Variants {
+			if arm, ok := slot.arms[variant.BannerID]; ok {
+				arms[i] = *arm
+			}
+		}
+		slot.mu.Unlock()
+	} else {
+		// статистика слотов с весами в памяти не ведется, ее целиком дает база
+		stats, err := service.repo.GetSlotStats(ctx, key.FeatureID, key.TagID, service.clock.Now())
+		if err != nil {
+			service.logger.Warn(err.Error())
+			return banner_model.SlotAllocation{}, err
+		}
+
+		byBanner := make(map[int]bandit.Arm, len(stats))
+		for _, stat := range stats {
+			byBanner[stat.BannerID] = bandit.Arm{Impressions: stat.Impressions, Clicks: stat.Clicks}
+		}
+
+		for i, variant := range variants.Variants {
+			arms[i] = byBanner[variant.BannerID]
+		}
+	}
+
+	var shares []float64
+
+	if variants.Strategy.Adaptive() {
+		res.Strategy = variants.Strategy.Name
+		// отдельный генератор, чтобы просмотр распределения не сдвигал выбор вариантов
+		shares = bandit.Shares(selector(*variants.Strategy), rand.New(rand.NewSource(1)), arms, allocationSamples)
+	} else {
+		total := 0
+		for _, variant := range variants.Variants {
+			total += variant.Weight
+		}
+
+		shares = make([]float64, len(variants.Variants))
+		for i, variant := range variants.Variants {
+			shares[i] = float64(variant.Weight) / float64(total)
+		}
+	}
+
+	for i, variant := range variants.Variants {
+		res.Variants[i] = banner_model.VariantAllocation{
+			BannerID:    variant.BannerID,
+			Impressions: arms[i].Impressions,
+			Clicks:      arms[i].Clicks,
+			CTR:         arms[i].CTR(),
+			Share:       shares[i],
+		}
+	}
+
+	return res, nil
+}
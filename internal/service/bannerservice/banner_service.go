@@ -2,109 +2,603 @@ package bannerservice
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	"github.com/Heatdog/Avito/internal/models/queryparams"
 	banner_repository "github.com/Heatdog/Avito/internal/repository/banner"
 	"github.com/Heatdog/Avito/pkg/cache"
+	nopcache "github.com/Heatdog/Avito/pkg/cache/nop"
+	"github.com/Heatdog/Avito/pkg/clock"
+	"github.com/Heatdog/Avito/pkg/counter"
+	memorycounter "github.com/Heatdog/Avito/pkg/counter/memory"
 	"github.com/Heatdog/Avito/pkg/token"
 	"github.com/jackc/pgx/v5"
+	"golang.org/x/sync/singleflight"
 )
 
 type BannerService interface {
 	InsertBanner(context context.Context, banner *banner_model.BannerInsert) (int, error)
-	GetUserBanner(context context.Context, params *queryparams.BannerUserParams) (interface{}, error)
+	GetUserBanner(context context.Context, params *queryparams.BannerUserParams) (banner_model.UserBanner, error)
 	GetBanners(context context.Context, params *queryparams.BannerParams) ([]banner_model.Banner, error)
+	GetDefaultBanners(context context.Context) ([]banner_model.DefaultBanner, error)
+	// SetDefaultBanner задает баннер, который GetUserBanner показывает, когда у тегов пользователя
+	// баннера не нашлось: сначала баннер по умолчанию фичи, затем общий
+	SetDefaultBanner(context context.Context, def banner_model.DefaultBanner) error
+	DeleteDefaultBanner(context context.Context, featureID *int) error
 	DeleteBanner(context context.Context, id int) (bool, error)
 	UpdateBanner(context context.Context, banner *banner_model.BannerUpdate) error
 	DeleteBanners(context context.Context, params queryparams.DeleteBannerParams)
 	UpdateBannerVersion(context context.Context, id, version int) error
+	DeleteBannerSchedule(context context.Context, id int) error
+	DeleteBannerFrequencyCap(context context.Context, id int) error
+	DeleteBannerRegions(context context.Context, id int) error
+	DeleteBannerTargeting(context context.Context, id int) error
+	// GetBannerBudget возвращает бюджет показов баннера и сколько из него израсходовано
+	GetBannerBudget(context context.Context, id int) (banner_model.BannerBudget, error)
+	DeleteBannerBudget(context context.Context, id int) error
+	// DeactivateSpentBanners выключает баннеры, исчерпавшие бюджет, и удаляет их слоты из кэша
+	DeactivateSpentBanners(context context.Context) error
+	ReviewBannerVersion(context context.Context, id, version int, action banner_model.ReviewAction, actor string) error
+	GetBannerApprovals(context context.Context, id int) ([]banner_model.BannerApproval, error)
+	GetBannerVersions(context context.Context, id int) ([]banner_model.BannerVersion, error)
+	GetSlotVariants(context context.Context, featureID, tagID int) (banner_model.SlotVariants, error)
+	SetSlotVariants(context context.Context, featureID, tagID int, variants banner_model.SlotVariants) error
+	DeleteSlotVariants(context context.Context, featureID, tagID int) error
+	// GetSlotAllocation возвращает статистику и текущую долю трафика вариантов слота на этом поде
+	GetSlotAllocation(context context.Context, featureID, tagID int) (banner_model.SlotAllocation, error)
+	// RecordEvent передает показ или клик в статистику вариантов слота и в буфер записи в базу
+	RecordEvent(context context.Context, event banner_model.Event) error
+	GetBannerStats(context context.Context, id int) ([]banner_model.BannerStat, error)
+	SetRolloutPercent(context context.Context, id, percent int) error
+	CompleteRollout(context context.Context, id int) error
+	AbortRollout(context context.Context, id int) error
+	DiffBannerVersions(context context.Context, id, from, to int) (banner_model.BannerDiff, error)
+	WarmUp(context context.Context, limit int) (int, error)
+	GetTagTree(context context.Context) ([]banner_model.TagNode, error)
+	// SetTagParent меняет родителя тега, nil делает тег корневым. Баннеры тега без собственного
+	// баннера ищутся у его предков
+	SetTagParent(context context.Context, id int, parentID *int) error
 }
 
+// missing хранит пары (тег, фича), для которых баннера нет, чтобы не обращаться
+// к базе на каждый запрос. Записи живут меньше, чем записи основного кэша.
+// bandits хранит статистику слотов, в которых варианты выбираются по кликам, banditsSwept -
+// время последней очистки bandits от неиспользуемых слотов,
+// events - буфер показов и кликов для записи в базу, impressions - счетчики показов
+// баннеров пользователям для ограничения частоты, tags - дерево тегов для поиска баннеров предков
 type bannerService struct {
-	logger        *slog.Logger
-	repo          banner_repository.BannerRepository
-	cache         cache.Cache[banner_model.BannerKey, *banner_model.Banner]
-	tokenProvider token.Provider
+	logger       *slog.Logger
+	repo         banner_repository.BannerRepository
+	cache        cache.Cache[banner_model.BannerKey, *banner_model.Banner]
+	missing      cache.Cache[banner_model.BannerKey, struct{}]
+	clock        clock.Clock
+	group        singleflight.Group
+	banditsMu    sync.Mutex
+	bandits      map[banner_model.BannerKey]*slotBandit
+	banditsSwept time.Time
+	events       *EventRecorder
+	impressions  counter.Counter
+	tags         *TagTree
+	generation   *CacheGeneration
+	loadTimeout  time.Duration
 }
 
-func NewBannerService(logger *slog.Logger, repo banner_repository.BannerRepository,
-	cache cache.Cache[banner_model.BannerKey, *banner_model.Banner], tokenProvider token.Provider) BannerService {
+// defaultLoadTimeout ограничивает загрузку баннера, если в Deps не задан LoadTimeout
+const defaultLoadTimeout = 5 * time.Second
+
+// Deps - зависимости сервиса баннеров. Logger, Repo и Events обязательны. Без Cache и Missing
+// баннеры не кэшируются, без Clock используется системное время, без Impressions показы
+// считаются в памяти пода, без Tags баннеры не наследуются от родительских тегов. LoadTimeout
+// ограничивает загрузку баннера из репозитория, общую для одновременных запросов. Generation
+// передается и в CacheInvalidator, без него кэш согласован только с изменениями через сервис
+type Deps struct {
+	Logger      *slog.Logger
+	Repo        banner_repository.BannerRepository
+	Cache       cache.Cache[banner_model.BannerKey, *banner_model.Banner]
+	Missing     cache.Cache[banner_model.BannerKey, struct{}]
+	Clock       clock.Clock
+	Events      *EventRecorder
+	Impressions counter.Counter
+	Tags        *TagTree
+	Generation  *CacheGeneration
+	LoadTimeout time.Duration
+}
+
+func NewBannerService(deps Deps) BannerService {
+	if deps.Cache == nil {
+		deps.Cache = nopcache.NewNopCache[banner_model.BannerKey, *banner_model.Banner]()
+	}
+
+	if deps.Missing == nil {
+		deps.Missing = nopcache.NewNopCache[banner_model.BannerKey, struct{}]()
+	}
+
+	if deps.Clock == nil {
+		deps.Clock = clock.NewRealClock()
+	}
+
+	if deps.Impressions == nil {
+		deps.Impressions = memorycounter.NewMemoryCounter(deps.Clock)
+	}
+
+	if deps.Generation == nil {
+		deps.Generation = NewCacheGeneration()
+	}
+
+	if deps.LoadTimeout <= 0 {
+		deps.LoadTimeout = defaultLoadTimeout
+	}
+
 	return &bannerService{
-		logger:        logger,
-		repo:          repo,
-		cache:         cache,
-		tokenProvider: tokenProvider,
+		logger:      deps.Logger,
+		repo:        deps.Repo,
+		cache:       deps.Cache,
+		missing:     deps.Missing,
+		clock:       deps.Clock,
+		bandits:     map[banner_model.BannerKey]*slotBandit{},
+		events:      deps.Events,
+		impressions: deps.Impressions,
+		tags:        deps.Tags,
+		generation:  deps.Generation,
+		loadTimeout: deps.LoadTimeout,
 	}
 }
 
 func (service *bannerService) InsertBanner(ctx context.Context, banner *banner_model.BannerInsert) (int, error) {
 	service.logger.Debug("insert banner serivce")
 
-	return service.repo.InsertBanner(ctx, banner)
+	id, err := service.repo.InsertBanner(ctx, banner)
+	if err != nil {
+		return 0, err
+	}
+
+	params := banner_model.BannerParams{
+		TagIDs:    banner.TagsID,
+		FeatureID: banner.FeatureID,
+	}
+	service.removeFromCache(ctx, params.Keys())
+
+	return id, nil
 }
 
+// GetUserBanner возвращает содержимое активной версии баннера или версии params.Version.
+// В кэше хранятся только активные версии. Окно показа и расписание проверяются при каждом запросе,
+// поэтому запись, попавшая в кэш до active_until, после него не отдается пользователям.
+// Если в слоте идет эксперимент, вариант выбирается по params.UserID или по кликам,
+// если так задано стратегией слота, а в кэше хранится весь слот. Баннер слота с правилами таргетинга
+// выбирается по params.Attributes, в слотах с экспериментом правила не проверяются.
+// Из баннеров, выбранных в слотах нескольких тегов, показывается баннер с наибольшим приоритетом.
+// Если в слотах тегов показать нечего, показывается баннер по умолчанию фичи или общий
 func (service *bannerService) GetUserBanner(ctx context.Context,
-	params *queryparams.BannerUserParams) (interface{}, error) {
+	params *queryparams.BannerUserParams) (banner_model.UserBanner, error) {
 	service.logger.Debug("get user banner service")
 
-	if params.UseLastrRevision == "false" {
-		banner, ok, err := service.cache.Get(ctx, banner_model.BannerKey{
-			TagID:     params.TagID,
-			FeatureID: params.FeatureID,
-		})
+	version := 0
+
+	if params.Version != "" {
+		var err error
+		if version, err = strconv.Atoi(params.Version); err != nil {
+			return banner_model.UserBanner{}, err
+		}
+	}
+
+	keys := params.Keys()
+
+	slots, err := service.resolveSlots(ctx, keys, params, version)
+	if err != nil {
+		return banner_model.UserBanner{}, err
+	}
+
+	var candidates []userCandidate
+
+	// теги с общим предком получают одну и ту же запись, баннер из нее выбирается один раз
+	picked := make(map[banner_model.BannerKey]struct{}, len(keys))
+
+	for _, key := range keys {
+		slot, ok := slots[key]
+		if _, dup := picked[slot.key]; !ok || dup {
+			continue
+		}
+
+		picked[slot.key] = struct{}{}
+
+		if candidate, ok := service.pickUserBanner(ctx, slot.banner, slot.key, params); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].banner.Outranks(candidates[j].banner)
+	})
+
+	// баннер, лимит показов которого пользователь исчерпал, уступает следующему по приоритету
+	for _, candidate := range candidates {
+		if res, ok := service.serveUserBanner(ctx, candidate, params); ok {
+			res.Match = banner_model.MatchTag
+			return res, nil
+		}
+	}
+
+	// конкретная версия запрашивается только у баннера слота
+	if version != 0 {
+		return banner_model.UserBanner{}, pgx.ErrNoRows
+	}
+
+	return service.defaultUserBanner(ctx, params)
+}
+
+// defaultUserBanner показывает баннер по умолчанию фичи, а если его нет или он не подходит - общий баннер
+// по умолчанию. Баннеры по умолчанию кэшируются под своими ключами, поэтому отсутствие баннера у тега,
+// запомненное в кэше отсутствующих, не мешает кэшировать баннер по умолчанию
+func (service *bannerService) defaultUserBanner(ctx context.Context,
+	params *queryparams.BannerUserParams) (banner_model.UserBanner, error) {
+	levels := []struct {
+		match banner_model.MatchLevel
+		key   banner_model.BannerKey
+	}{
+		{match: banner_model.MatchFeature, key: banner_model.DefaultKey(params.FeatureID)},
+		{match: banner_model.MatchGlobal, key: banner_model.DefaultKey("")},
+	}
+
+	for _, level := range levels {
+		slots, err := service.userSlots(ctx, []banner_model.BannerKey{level.key}, params, 0)
 		if err != nil {
-			return "", err
+			return banner_model.UserBanner{}, err
 		}
 
-		if ok {
-			if !banner.IsActive && !service.tokenProvider.VerifyOnAdmin(params.Token) {
-				return "", pgx.ErrNoRows
+		slot, ok := slots[level.key]
+		if !ok {
+			continue
+		}
+
+		candidate, ok := service.pickUserBanner(ctx, slot, level.key, params)
+		if !ok {
+			continue
+		}
+
+		if res, ok := service.serveUserBanner(ctx, candidate, params); ok {
+			res.Match = level.match
+			return res, nil
+		}
+	}
+
+	return banner_model.UserBanner{}, pgx.ErrNoRows
+}
+
+// userSlot - запись слота, из которой выбирается баннер для тега запроса: собственная или ближайшего предка.
+// key - ключ слота, которому принадлежит запись
+type userSlot struct {
+	banner *banner_model.Banner
+	key    banner_model.BannerKey
+}
+
+// resolveSlots сопоставляет ключам keys записи слотов. Тег без собственного баннера наследует запись
+// ближайшего предка, у которого она есть. Предки загружаются по уровням дерева и только для тегов,
+// записи которых еще не нашлось, поэтому запрос тега со своим баннером к предкам не обращается.
+// Номер версии относится к баннеру самого тега, поэтому запрос версии предков не ищет
+func (service *bannerService) resolveSlots(ctx context.Context, keys []banner_model.BannerKey,
+	params *queryparams.BannerUserParams, version int) (map[banner_model.BannerKey]userSlot, error) {
+	var tree *banner_model.TagTree
+	if version == 0 {
+		tree = service.tags.Tree()
+	}
+
+	res := make(map[banner_model.BannerKey]userSlot, len(keys))
+
+	// найденные записи слотов и слоты, которые уже проверялись: предок нескольких тегов запроса
+	// загружается один раз, даже если теги доходят до него на разных уровнях
+	found := make(map[banner_model.BannerKey]*banner_model.Banner, len(keys))
+	looked := make(map[banner_model.BannerKey]struct{}, len(keys))
+
+	// ключ запроса -> ключ слота, который проверяется для него на текущем уровне
+	pending := make(map[banner_model.BannerKey]banner_model.BannerKey, len(keys))
+	for _, key := range keys {
+		pending[key] = key
+	}
+
+	for len(pending) != 0 {
+		var lookup []banner_model.BannerKey
+
+		for _, key := range keys {
+			checked, ok := pending[key]
+			if _, done := looked[checked]; !ok || done {
+				continue
+			}
+
+			looked[checked] = struct{}{}
+			lookup = append(lookup, checked)
+		}
+
+		if len(lookup) != 0 {
+			slots, err := service.userSlots(ctx, lookup, params, version)
+			if err != nil {
+				return nil, err
+			}
+
+			for key, slot := range slots {
+				found[key] = slot
+			}
+		}
+
+		next := make(map[banner_model.BannerKey]banner_model.BannerKey, len(pending))
+
+		for key, checked := range pending {
+			if slot, ok := found[checked]; ok {
+				res[key] = userSlot{banner: slot, key: checked}
+				continue
 			}
 
-			switch params.Version {
-			case "1":
-				return banner.ContentV1, nil
-			case "2":
-				return banner.ContentV2, nil
-			case "3":
-				return banner.ContentV3, nil
-			default:
-				return "", pgx.ErrNoRows
+			if parent, ok := tree.Parent(checked.TagID); ok {
+				next[key] = banner_model.BannerKey{TagID: parent, FeatureID: checked.FeatureID}
+			}
+		}
+
+		pending = next
+	}
+
+	return res, nil
+}
+
+// userSlots возвращает записи слотов keys из кэша, а промахи загружает из репозитория и кэширует.
+// Слоты, для которых баннера нет, в результат не попадают
+func (service *bannerService) userSlots(ctx context.Context, keys []banner_model.BannerKey,
+	params *queryparams.BannerUserParams, version int) (map[banner_model.BannerKey]*banner_model.Banner, error) {
+	res := make(map[banner_model.BannerKey]*banner_model.Banner, len(keys))
+	missed := keys
+
+	if params.UseLastrRevision == "false" {
+		missed = nil
+
+		for _, key := range keys {
+			banner, ok, err := service.cache.Get(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok && (version == 0 || version == banner.Version) {
+				res[key] = banner
+				continue
+			}
+
+			if version == 0 {
+				_, missing, err := service.missing.Get(ctx, key)
+				if err != nil {
+					service.logger.Warn(err.Error())
+				}
+
+				if missing {
+					service.logger.Debug("banner is known to be missing", slog.Any("key", key))
+					continue
+				}
+			}
+
+			missed = append(missed, key)
+		}
+	}
+
+	if len(missed) == 0 {
+		return res, nil
+	}
+
+	loaded, gen, err := service.loadUserSlots(ctx, missed, params.UseLastrRevision == "false", version)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range missed {
+		if banner, ok := loaded[key]; ok {
+			res[key] = &banner
+		}
+	}
+
+	// слот кэшируется целиком, даже если выбранный для пользователя вариант сейчас не показывается
+	if version == 0 && !service.generation.Fill(gen, func() { service.fillCache(ctx, missed, loaded) }) {
+		service.logger.Debug("cache invalidated during load", slog.Any("keys", missed))
+	}
+
+	return res, nil
+}
+
+// fillCache кэширует загруженные слоты keys, а слоты без баннера запоминает как отсутствующие
+func (service *bannerService) fillCache(ctx context.Context, keys []banner_model.BannerKey,
+	loaded map[banner_model.BannerKey]banner_model.Banner) {
+	ctx = context.WithoutCancel(ctx)
+
+	for _, key := range keys {
+		banner, ok := loaded[key]
+		if !ok {
+			if _, err := service.missing.Add(ctx, key, struct{}{}); err != nil {
+				service.logger.Warn(err.Error())
 			}
+
+			continue
+		}
+
+		if _, err := service.cache.Add(ctx, key, &banner); err != nil {
+			service.logger.Warn(err.Error())
 		}
 	}
+}
+
+// loadUserSlots загружает слоты keys из репозитория. Промах по одному слоту объединяется
+// с одновременными промахами по нему же, промахи по нескольким слотам загружаются одним обращением.
+// Вместе со слотами возвращается поколение кэша, в котором началась загрузка
+func (service *bannerService) loadUserSlots(ctx context.Context, keys []banner_model.BannerKey, shared bool,
+	version int) (map[banner_model.BannerKey]banner_model.Banner, uint64, error) {
+	if len(keys) > 1 {
+		tagIDs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			tagIDs = append(tagIDs, key.TagID)
+		}
+
+		gen := service.generation.Current()
+		res, err := service.repo.GetUserBanners(ctx, tagIDs, keys[0].FeatureID)
+
+		return res, gen, err
+	}
 
-	banner, err := service.repo.GetUserBanner(ctx, params.TagID, params.FeatureID)
+	var (
+		banner banner_model.Banner
+		gen    uint64
+		err    error
+	)
+
+	if shared {
+		banner, gen, err = service.loadUserBanner(ctx, keys[0], version)
+	} else {
+		gen = service.generation.Current()
+		banner, err = service.fetchUserBanner(ctx, keys[0], version)
+	}
+
+	if err == pgx.ErrNoRows {
+		return nil, gen, nil
+	}
 
 	if err != nil {
-		return "", err
+		return nil, gen, err
+	}
+
+	return map[banner_model.BannerKey]banner_model.Banner{keys[0]: banner}, gen, nil
+}
+
+// userCandidate - баннер, выбранный для пользователя в одном из слотов запроса
+type userCandidate struct {
+	banner     *banner_model.Banner
+	experiment bool
+}
+
+// pickUserBanner выбирает баннер слота по правилам таргетинга, вариант слота и версию в раскатке для пользователя.
+// Баннер не выбирается, если он сейчас не показывается или закрыт для региона клиента, а варианты
+// с такими баннерами не участвуют в выборе. Пользователи с правом чтения баннеров видят баннер без этих проверок
+func (service *bannerService) pickUserBanner(ctx context.Context, banner *banner_model.Banner,
+	key banner_model.BannerKey, params *queryparams.BannerUserParams) (userCandidate, bool) {
+	now := service.clock.Now()
+	preview := params.Role.HasPermission(token.PermissionReadBanner)
+
+	visible := func(banner *banner_model.Banner) bool {
+		return preview || banner.IsLive(now) && banner.Regions.Allows(params.Region)
+	}
+
+	if len(banner.Variants) == 0 {
+		banner = banner.Target(params.Attributes, visible)
+	} else {
+		banner = banner.LiveVariants(visible)
 	}
 
-	if !banner.IsActive && !service.tokenProvider.VerifyOnAdmin(params.Token) {
-		return "", pgx.ErrNoRows
+	if banner == nil {
+		return userCandidate{}, false
 	}
 
-	go func(logger *slog.Logger, key banner_model.BannerKey, banner banner_model.Banner) {
-		if _, err := service.cache.Add(context.Background(), key, &banner); err != nil {
-			logger.Warn(err.Error())
+	chosen, experiment := banner.PickVariant(key, params.UserID, rand.Intn)
+	if experiment && banner.Strategy.Adaptive() {
+		chosen = service.pickAdaptive(ctx, key, banner)
+	}
+
+	chosen = chosen.ForUser(params.UserID)
+
+	if !visible(chosen) {
+		return userCandidate{}, false
+	}
+
+	return userCandidate{banner: chosen, experiment: experiment}, true
+}
+
+// serveUserBanner проверяет лимит показов баннера пользователю. Баннер не показывается,
+// если пользователь исчерпал лимит показов, а замена для этого случая не задана
+func (service *bannerService) serveUserBanner(ctx context.Context, candidate userCandidate,
+	params *queryparams.BannerUserParams) (banner_model.UserBanner, bool) {
+	res := banner_model.UserBanner{Content: candidate.banner.Content, ID: candidate.banner.ID}
+
+	if service.capped(ctx, candidate.banner, params) {
+		if candidate.banner.FrequencyCap.Fallback == nil {
+			return banner_model.UserBanner{}, false
 		}
-	}(service.logger, banner_model.BannerKey{
-		TagID:     params.TagID,
-		FeatureID: params.FeatureID,
-	}, banner)
 
-	switch params.Version {
-	case "1":
-		return banner.ContentV1, nil
-	case "2":
-		return banner.ContentV2, nil
-	case "3":
-		return banner.ContentV3, nil
-	default:
-		return "", pgx.ErrNoRows
+		res.Content = candidate.banner.FrequencyCap.Fallback
+	}
+
+	if candidate.experiment {
+		res.Variant = strconv.Itoa(candidate.banner.ID)
 	}
+
+	return res, true
+}
+
+// capped сообщает, исчерпал ли пользователь лимит показов баннера, и открывает окно лимита,
+// если его нет. Сами показы учитываются по событиям impression, а не по ответам /user_banner.
+// Запросы без пользователя и запросы редакторов не ограничиваются. Если счетчик недоступен,
+// баннер показывается без ограничения
+func (service *bannerService) capped(ctx context.Context, banner *banner_model.Banner,
+	params *queryparams.BannerUserParams) bool {
+	if banner.FrequencyCap == nil || params.UserID == "" || params.Role.HasPermission(token.PermissionReadBanner) {
+		return false
+	}
+
+	count, err := service.impressions.Start(ctx, banner_model.FrequencyKey(banner.ID, params.UserID),
+		banner.FrequencyCap.Window())
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return false
+	}
+
+	return count >= int64(banner.FrequencyCap.Limit)
+}
+
+// loadUserBanner объединяет одновременные промахи кэша по одной паре (тег, фича)
+// в один запрос к репозиторию. Запрос не зависит от контекста первого вызвавшего,
+// поэтому отмена одного клиента не прерывает загрузку для остальных. Вместо срока
+// вызвавшего загрузка ограничена loadTimeout, чтобы зависший запрос не держал всех ожидающих.
+// Поколение кэша запоминается в начале общей загрузки, а не при присоединении к ней
+func (service *bannerService) loadUserBanner(ctx context.Context, key banner_model.BannerKey,
+	version int) (banner_model.Banner, uint64, error) {
+	flight := fmt.Sprintf("%s:%s:%d", key.TagID, key.FeatureID, version)
+
+	ch := service.group.DoChan(flight, func() (interface{}, error) {
+		detached, cancel := context.WithTimeout(context.WithoutCancel(ctx), service.loadTimeout)
+		defer cancel()
+
+		loaded := loadedBanner{gen: service.generation.Current()}
+
+		var err error
+		loaded.banner, err = service.fetchUserBanner(detached, key, version)
+
+		return loaded, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return banner_model.Banner{}, 0, ctx.Err()
+	case res := <-ch:
+		loaded, ok := res.Val.(loadedBanner)
+		if !ok {
+			return banner_model.Banner{}, 0, pgx.ErrNoRows
+		}
+
+		return loaded.banner, loaded.gen, res.Err
+	}
+}
+
+// loadedBanner - результат общей загрузки баннера вместе с поколением кэша, в котором она началась
+type loadedBanner struct {
+	banner banner_model.Banner
+	gen    uint64
+}
+
+// fetchUserBanner загружает запись слота key, а для ключа уровня по умолчанию - баннер по умолчанию
+func (service *bannerService) fetchUserBanner(ctx context.Context, key banner_model.BannerKey,
+	version int) (banner_model.Banner, error) {
+	if key.TagID == "" {
+		return service.repo.GetDefaultBanner(ctx, key.FeatureID)
+	}
+
+	return service.repo.GetUserBanner(ctx, key.TagID, key.FeatureID, version)
 }
 
 func (service *bannerService) GetBanners(context context.Context, params *queryparams.BannerParams) ([]banner_model.Banner,
@@ -120,44 +614,409 @@ func (service *bannerService) GetBanners(context context.Context, params *queryp
 	return res, err
 }
 
+func (service *bannerService) GetDefaultBanners(context context.Context) ([]banner_model.DefaultBanner, error) {
+	service.logger.Debug("get default banners")
+
+	res, err := service.repo.GetDefaultBanners(context)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (service *bannerService) SetDefaultBanner(context context.Context, def banner_model.DefaultBanner) error {
+	service.logger.Debug("set default banner", slog.Any("default", def))
+
+	keys, err := service.repo.SetDefaultBanner(context, def)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) DeleteDefaultBanner(context context.Context, featureID *int) error {
+	service.logger.Debug("delete default banner", slog.Any("feature", featureID))
+
+	keys, err := service.repo.DeleteDefaultBanner(context, featureID)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+// GetTagTree читает дерево из базы, а не из памяти, чтобы администратор видел
+// изменения сразу, даже если уведомление до пода еще не дошло
+func (service *bannerService) GetTagTree(context context.Context) ([]banner_model.TagNode, error) {
+	service.logger.Debug("get tag tree")
+
+	tags, err := service.repo.GetTags(context)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return banner_model.NewTagTree(tags).Nodes(), nil
+}
+
+func (service *bannerService) SetTagParent(context context.Context, id int, parentID *int) error {
+	service.logger.Debug("set tag parent", slog.Int("id", id), slog.Any("parent", parentID))
+
+	if err := service.repo.SetTagParent(context, id, parentID); err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	// остальные поды перечитают дерево по уведомлению, этот - сразу
+	if service.tags != nil {
+		if err := service.tags.Reload(context); err != nil {
+			service.logger.Warn(err.Error())
+		}
+	}
+
+	return nil
+}
+
 func (service *bannerService) DeleteBanner(context context.Context, id int) (bool, error) {
 	service.logger.Debug("delete banner", slog.Int("id", id))
 
-	res, err := service.repo.DeleteBanner(context, id)
+	keys, err := service.repo.DeleteBanner(context, id)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+
 	if err != nil {
 		service.logger.Warn(err.Error())
 		return false, err
 	}
 
-	return res, err
+	service.removeFromCache(context, keys)
+
+	return true, nil
 }
 
 func (service *bannerService) UpdateBanner(context context.Context, banner *banner_model.BannerUpdate) error {
 	service.logger.Debug("update banner", slog.Int("id", banner.ID))
 
-	if err := service.repo.UpdateBanner(context, banner); err != nil {
+	keys, err := service.repo.UpdateBanner(context, banner)
+	if err != nil {
 		service.logger.Warn(err.Error())
 		return err
 	}
 
+	service.removeFromCache(context, keys)
+
 	return nil
 }
 
 func (service *bannerService) DeleteBanners(context context.Context, params queryparams.DeleteBannerParams) {
 	service.logger.Debug("delete banner params", slog.Any("params", params))
 
-	if err := service.repo.DeleteBanners(context, params); err != nil {
+	keys, err := service.repo.DeleteBanners(context, params)
+	if err != nil {
 		service.logger.Warn(err.Error())
+		return
 	}
+
+	service.removeFromCache(context, keys)
 }
 
 func (service *bannerService) UpdateBannerVersion(context context.Context, id, version int) error {
 	service.logger.Debug("update banner", slog.Int("id", id), slog.Int("version", version))
 
-	if err := service.repo.UpdateBannerVersion(context, id, version); err != nil {
+	keys, err := service.repo.UpdateBannerVersion(context, id, version)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) DeleteBannerSchedule(context context.Context, id int) error {
+	service.logger.Debug("delete banner schedule", slog.Int("id", id))
+
+	keys, err := service.repo.DeleteBannerSchedule(context, id)
+	if err != nil {
 		service.logger.Warn(err.Error())
 		return err
 	}
 
+	service.removeFromCache(context, keys)
+
 	return nil
 }
+
+func (service *bannerService) DeleteBannerFrequencyCap(context context.Context, id int) error {
+	service.logger.Debug("delete banner frequency cap", slog.Int("id", id))
+
+	keys, err := service.repo.DeleteBannerFrequencyCap(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) DeleteBannerRegions(context context.Context, id int) error {
+	service.logger.Debug("delete banner regions", slog.Int("id", id))
+
+	keys, err := service.repo.DeleteBannerRegions(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) DeleteBannerTargeting(context context.Context, id int) error {
+	service.logger.Debug("delete banner targeting", slog.Int("id", id))
+
+	keys, err := service.repo.DeleteBannerTargeting(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) ReviewBannerVersion(context context.Context, id, version int,
+	action banner_model.ReviewAction, actor string) error {
+	service.logger.Debug("review banner version", slog.Int("id", id), slog.Int("version", version),
+		slog.Any("action", action))
+
+	keys, err := service.repo.ReviewBannerVersion(context, id, version, action, actor)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) GetBannerApprovals(context context.Context, id int) ([]banner_model.BannerApproval,
+	error) {
+	service.logger.Debug("get banner approvals", slog.Int("id", id))
+
+	res, err := service.repo.GetBannerApprovals(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (service *bannerService) GetSlotVariants(context context.Context, featureID, tagID int) (
+	banner_model.SlotVariants, error) {
+	service.logger.Debug("get slot variants", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	res, err := service.repo.GetSlotVariants(context, featureID, tagID)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return banner_model.SlotVariants{}, err
+	}
+
+	return res, nil
+}
+
+func (service *bannerService) SetSlotVariants(context context.Context, featureID, tagID int,
+	variants banner_model.SlotVariants) error {
+	service.logger.Debug("set slot variants", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	keys, err := service.repo.SetSlotVariants(context, featureID, tagID, variants)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) DeleteSlotVariants(context context.Context, featureID, tagID int) error {
+	service.logger.Debug("delete slot variants", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	keys, err := service.repo.DeleteSlotVariants(context, featureID, tagID)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+// RecordEvent не ждет записи в базу: событие попадает в буфер EventRecorder. При переполненном
+// буфере событие отбрасывается и не учитывается в статистике вариантов, чтобы клиент мог его повторить
+func (service *bannerService) RecordEvent(context context.Context, event banner_model.Event) error {
+	service.logger.Debug("record event", slog.Any("event", event))
+
+	event.CreatedAt = service.clock.Now()
+
+	if !service.events.Record(event) {
+		service.logger.Warn("event buffer is full, event dropped", slog.Int("banner", event.BannerID))
+		return banner_model.ErrEventsOverloaded
+	}
+
+	service.recordArm(event)
+
+	// окно лимита открывается при выдаче баннера с ограничением, для остальных баннеров показ не считается
+	if event.Type == banner_model.EventImpression && event.UserID != "" {
+		if _, err := service.impressions.Incr(context, banner_model.FrequencyKey(event.BannerID,
+			event.UserID)); err != nil {
+			service.logger.Warn(err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (service *bannerService) GetBannerStats(context context.Context, id int) ([]banner_model.BannerStat, error) {
+	service.logger.Debug("get banner stats", slog.Int("id", id))
+
+	res, err := service.repo.GetBannerStats(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (service *bannerService) SetRolloutPercent(context context.Context, id, percent int) error {
+	service.logger.Debug("set rollout percent", slog.Int("id", id), slog.Int("percent", percent))
+
+	keys, err := service.repo.SetRolloutPercent(context, id, percent)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) CompleteRollout(context context.Context, id int) error {
+	service.logger.Debug("complete rollout", slog.Int("id", id))
+
+	keys, err := service.repo.CompleteRollout(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) AbortRollout(context context.Context, id int) error {
+	service.logger.Debug("abort rollout", slog.Int("id", id))
+
+	keys, err := service.repo.AbortRollout(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(context, keys)
+
+	return nil
+}
+
+func (service *bannerService) GetBannerVersions(context context.Context, id int) ([]banner_model.BannerVersion,
+	error) {
+	service.logger.Debug("get banner versions", slog.Int("id", id))
+
+	res, err := service.repo.GetBannerVersions(context, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (service *bannerService) DiffBannerVersions(context context.Context, id, from,
+	to int) (banner_model.BannerDiff, error) {
+	service.logger.Debug("diff banner versions", slog.Int("id", id), slog.Int("from", from), slog.Int("to", to))
+
+	fromBanner, err := service.repo.GetBannerVersion(context, id, from)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return banner_model.BannerDiff{}, err
+	}
+
+	toBanner, err := service.repo.GetBannerVersion(context, id, to)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return banner_model.BannerDiff{}, err
+	}
+
+	return banner_model.Diff(fromBanner, toBanner)
+}
+
+func (service *bannerService) removeFromCache(ctx context.Context, keys []banner_model.BannerKey) {
+	service.generation.Invalidate(func() {
+		for _, key := range keys {
+			if _, err := service.cache.Remove(ctx, key); err != nil {
+				service.logger.Warn(err.Error(), slog.Any("key", key))
+			}
+
+			if _, err := service.missing.Remove(ctx, key); err != nil {
+				service.logger.Warn(err.Error(), slog.Any("key", key))
+			}
+		}
+	})
+}
+
+// WarmUp заполняет кэш активными баннерами, но не более limit пар (тег, фича).
+// При limit <= 0 загружаются все активные баннеры
+func (service *bannerService) WarmUp(ctx context.Context, limit int) (int, error) {
+	service.logger.Debug("warm up cache", slog.Int("limit", limit))
+
+	count := 0
+
+	err := service.repo.StreamActiveBanners(ctx, func(key banner_model.BannerKey, banner banner_model.Banner) bool {
+		if _, err := service.cache.Add(ctx, key, &banner); err != nil {
+			service.logger.Warn(err.Error())
+			return true
+		}
+
+		count++
+
+		return limit <= 0 || count < limit
+	})
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return count, err
+	}
+
+	return count, nil
+}
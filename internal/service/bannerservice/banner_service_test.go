@@ -0,0 +1,264 @@
+package bannerservice_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/models/queryparams"
+	banner_repository "github.com/Heatdog/Avito/internal/repository/banner"
+	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
+	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepo имитирует задержку базы данных и считает обращения к ней. Если задан release,
+// GetUserBanner сообщает о начале загрузки в started и ждет release вместо latency
+type countingRepo struct {
+	banner_repository.BannerRepository
+	started chan struct{}
+	release chan struct{}
+	calls   atomic.Int64
+	latency time.Duration
+}
+
+func (repo *countingRepo) GetUserBanner(ctx context.Context, _, _ string, _ int) (banner_model.Banner, error) {
+	repo.calls.Add(1)
+
+	wait := time.After(repo.latency)
+
+	if repo.release != nil {
+		repo.started <- struct{}{}
+		wait = nil
+	}
+
+	select {
+	case <-wait:
+	case <-repo.release:
+	case <-ctx.Done():
+		return banner_model.Banner{}, ctx.Err()
+	}
+
+	return banner_model.Banner{
+		ID:       1,
+		Content:  map[string]interface{}{"title": "banner"},
+		Version:  1,
+		IsActive: true,
+	}, nil
+}
+
+// GetUserBanners возвращает баннеры всех тегов, кроме "0", с приоритетом, равным номеру тега
+func (repo *countingRepo) GetUserBanners(_ context.Context, tagIDs []string,
+	featureID string) (map[banner_model.BannerKey]banner_model.Banner, error) {
+	repo.calls.Add(1)
+
+	res := make(map[banner_model.BannerKey]banner_model.Banner, len(tagIDs))
+
+	for _, tagID := range tagIDs {
+		priority, err := strconv.Atoi(tagID)
+		if err != nil {
+			return nil, err
+		}
+
+		if priority == 0 {
+			continue
+		}
+
+		res[banner_model.BannerKey{TagID: tagID, FeatureID: featureID}] = banner_model.Banner{
+			ID:       priority,
+			Content:  map[string]interface{}{"tag": tagID},
+			IsActive: true,
+			Priority: priority,
+		}
+	}
+
+	return res, nil
+}
+
+// GetDefaultBanner возвращает только общий баннер по умолчанию
+func (repo *countingRepo) GetDefaultBanner(_ context.Context, featureID string) (banner_model.Banner, error) {
+	repo.calls.Add(1)
+
+	if featureID != "" {
+		return banner_model.Banner{}, pgx.ErrNoRows
+	}
+
+	return banner_model.Banner{
+		ID:       100,
+		Content:  map[string]interface{}{"title": "default"},
+		IsActive: true,
+	}, nil
+}
+
+func newService(repo *countingRepo) banner_service.BannerService {
+	return newServiceWithTimeout(repo, 0)
+}
+
+func newServiceWithTimeout(repo *countingRepo, loadTimeout time.Duration) banner_service.BannerService {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	return banner_service.NewBannerService(banner_service.Deps{
+		Logger:      logger,
+		Repo:        repo,
+		Events:      banner_service.NewEventRecorder(logger, repo, 1, time.Second),
+		LoadTimeout: loadTimeout,
+	})
+}
+
+// waitingCtx сообщает в waiting, когда запрос начинает ждать результат загрузки
+type waitingCtx struct {
+	context.Context
+	waiting chan struct{}
+	once    sync.Once
+}
+
+func (ctx *waitingCtx) Done() <-chan struct{} {
+	ctx.once.Do(func() { close(ctx.waiting) })
+	return ctx.Context.Done()
+}
+
+func userParams() *queryparams.BannerUserParams {
+	return &queryparams.BannerUserParams{
+		TagIDs:           []string{"1"},
+		FeatureID:        "1",
+		UseLastrRevision: "false",
+		Version:          "1",
+	}
+}
+
+func TestGetUserBannerCancel(t *testing.T) {
+	repo := &countingRepo{started: make(chan struct{}, 1), release: make(chan struct{})}
+	service := newService(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+
+	go func() {
+		_, err := service.GetUserBanner(ctx, userParams())
+		first <- err
+	}()
+
+	<-repo.started
+
+	// второй запрос присоединяется к уже начатой загрузке
+	joined := &waitingCtx{Context: context.Background(), waiting: make(chan struct{})}
+	second := make(chan banner_model.UserBanner)
+
+	go func() {
+		banner, err := service.GetUserBanner(joined, userParams())
+		assert.NoError(t, err)
+		second <- banner
+	}()
+
+	<-joined.waiting
+
+	// отмена первого клиента не прерывает загрузку для второго
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+
+	close(repo.release)
+	require.Equal(t, map[string]interface{}{"title": "banner"}, (<-second).Content)
+
+	require.Equal(t, int64(1), repo.calls.Load())
+}
+
+func TestGetUserBannerLoadTimeout(t *testing.T) {
+	repo := &countingRepo{started: make(chan struct{}, 1), release: make(chan struct{})}
+	service := newServiceWithTimeout(repo, 10*time.Millisecond)
+
+	// отвязанная от клиента загрузка не ждет базу дольше LoadTimeout
+	_, err := service.GetUserBanner(context.Background(), userParams())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int64(1), repo.calls.Load())
+}
+
+func TestGetUserBannerInvalidatedDuringLoad(t *testing.T) {
+	repo := &countingRepo{started: make(chan struct{}, 1), release: make(chan struct{})}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil, time.Minute)
+	generation := banner_service.NewCacheGeneration()
+
+	service := banner_service.NewBannerService(banner_service.Deps{
+		Logger:     logger,
+		Repo:       repo,
+		Cache:      hashicorp_lru.NewLRU(logger, cacheLRU),
+		Events:     banner_service.NewEventRecorder(logger, repo, 1, time.Second),
+		Generation: generation,
+	})
+
+	params := userParams()
+	params.Version = ""
+
+	loaded := make(chan error)
+
+	go func() {
+		_, err := service.GetUserBanner(context.Background(), params)
+		loaded <- err
+	}()
+
+	// баннер изменился, пока загружалась его прошлая версия
+	<-repo.started
+	generation.Invalidate(func() {})
+	close(repo.release)
+
+	require.NoError(t, <-loaded)
+	require.Equal(t, 0, cacheLRU.Len())
+
+	// следующая загрузка идет уже в новом поколении и кэшируется
+	_, err := service.GetUserBanner(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, 1, cacheLRU.Len())
+	require.Equal(t, int64(2), repo.calls.Load())
+}
+
+func TestGetUserBannerManyTags(t *testing.T) {
+	repo := &countingRepo{}
+	service := newService(repo)
+
+	params := userParams()
+	params.TagIDs = []string{"0", "3", "7", "3", "5"}
+	params.Version = ""
+
+	banner, err := service.GetUserBanner(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, 7, banner.ID)
+	require.Equal(t, map[string]interface{}{"tag": "7"}, banner.Content)
+	require.Equal(t, banner_model.MatchTag, banner.Match)
+	require.Equal(t, int64(1), repo.calls.Load())
+
+	// у тегов баннеров нет, у фичи нет баннера по умолчанию, показывается общий
+	params.TagIDs = []string{"0", "00"}
+
+	banner, err = service.GetUserBanner(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, 100, banner.ID)
+	require.Equal(t, banner_model.MatchGlobal, banner.Match)
+	require.Equal(t, int64(4), repo.calls.Load())
+}
+
+func BenchmarkGetUserBannerColdCache(b *testing.B) {
+	repo := &countingRepo{latency: time.Millisecond}
+	service := newService(repo)
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := service.GetUserBanner(context.Background(), userParams()); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+
+	b.ReportMetric(float64(repo.calls.Load())/float64(b.N), "db-calls/op")
+}
@@ -0,0 +1,48 @@
+package bannerservice
+
+import (
+	"context"
+	"log/slog"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+)
+
+func (service *bannerService) GetBannerBudget(ctx context.Context, id int) (banner_model.BannerBudget, error) {
+	service.logger.Debug("get banner budget", slog.Int("id", id))
+
+	res, err := service.repo.GetBannerBudget(ctx, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return banner_model.BannerBudget{}, err
+	}
+
+	return res, nil
+}
+
+func (service *bannerService) DeleteBannerBudget(ctx context.Context, id int) error {
+	service.logger.Debug("delete banner budget", slog.Int("id", id))
+
+	keys, err := service.repo.DeleteBannerBudget(ctx, id)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(ctx, keys)
+
+	return nil
+}
+
+func (service *bannerService) DeactivateSpentBanners(ctx context.Context) error {
+	service.logger.Debug("deactivate spent banners")
+
+	keys, err := service.repo.DeactivateSpentBanners(ctx)
+	if err != nil {
+		service.logger.Warn(err.Error())
+		return err
+	}
+
+	service.removeFromCache(ctx, keys)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package bannerservice
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// budgetCheckTimeout ограничивает одну проверку бюджетов
+const budgetCheckTimeout = 30 * time.Second
+
+// BudgetKeeper раз в interval выключает баннеры, исчерпавшие бюджет показов.
+// Показы и бюджеты хранятся только в базе, поэтому после перезапуска пода
+// первая же проверка учитывает все показы, сохраненные до него
+type BudgetKeeper struct {
+	logger   *slog.Logger
+	service  BannerService
+	interval time.Duration
+}
+
+func NewBudgetKeeper(logger *slog.Logger, service BannerService, interval time.Duration) *BudgetKeeper {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &BudgetKeeper{
+		logger:   logger,
+		service:  service,
+		interval: interval,
+	}
+}
+
+// Run проверяет бюджеты сразу после запуска и затем по таймеру, пока не отменен ctx
+func (keeper *BudgetKeeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(keeper.interval)
+	defer ticker.Stop()
+
+	for {
+		keeper.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (keeper *BudgetKeeper) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, budgetCheckTimeout)
+	defer cancel()
+
+	// ошибка уже записана в лог сервисом, следующая проверка повторит попытку
+	if err := keeper.service.DeactivateSpentBanners(ctx); err != nil {
+		keeper.logger.Debug("budget check failed", slog.Any("error", err))
+	}
+}
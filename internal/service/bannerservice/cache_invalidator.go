@@ -0,0 +1,115 @@
+package bannerservice
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/pkg/cache"
+)
+
+// CacheGeneration согласует заполнение кэша с его инвалидацией. Каждая инвалидация начинает
+// новое поколение, и баннер, загруженный в прошлом поколении, в кэш уже не попадает
+type CacheGeneration struct {
+	mu  sync.RWMutex
+	gen uint64
+}
+
+func NewCacheGeneration() *CacheGeneration {
+	return &CacheGeneration{}
+}
+
+// Current возвращает поколение, которое запоминается перед загрузкой из репозитория
+func (generation *CacheGeneration) Current() uint64 {
+	generation.mu.RLock()
+	defer generation.mu.RUnlock()
+
+	return generation.gen
+}
+
+// Fill вызывает add, только если с поколения gen кэш не инвалидировался. Инвалидация ждет
+// завершения add, поэтому не может проскочить между проверкой и записью
+func (generation *CacheGeneration) Fill(gen uint64, add func()) bool {
+	generation.mu.RLock()
+	defer generation.mu.RUnlock()
+
+	if generation.gen != gen {
+		return false
+	}
+
+	add()
+
+	return true
+}
+
+// Invalidate начинает новое поколение и вызывает remove, пока заполнение кэша приостановлено
+func (generation *CacheGeneration) Invalidate(remove func()) {
+	generation.mu.Lock()
+	defer generation.mu.Unlock()
+
+	generation.gen++
+
+	remove()
+}
+
+// CacheInvalidator удаляет из локальных кэшей пары (тег, фича), измененные
+// другими экземплярами сервиса
+type CacheInvalidator struct {
+	logger     *slog.Logger
+	cache      cache.Cache[banner_model.BannerKey, *banner_model.Banner]
+	missing    cache.Cache[banner_model.BannerKey, struct{}]
+	generation *CacheGeneration
+}
+
+// NewCacheInvalidator создает инвалидатор кэшей сервиса. generation должен быть общим с сервисом,
+// чтобы загрузки, начатые до уведомления, не вернули в кэш устаревший баннер
+func NewCacheInvalidator(logger *slog.Logger, cache cache.Cache[banner_model.BannerKey, *banner_model.Banner],
+	missing cache.Cache[banner_model.BannerKey, struct{}], generation *CacheGeneration) *CacheInvalidator {
+	return &CacheInvalidator{
+		logger:     logger,
+		cache:      cache,
+		missing:    missing,
+		generation: generation,
+	}
+}
+
+func (invalidator *CacheInvalidator) HandleNotification(payload string) {
+	var keys []banner_model.BannerKey
+	if err := json.Unmarshal([]byte(payload), &keys); err != nil {
+		invalidator.logger.Warn("bad invalidation payload", slog.String("payload", payload),
+			slog.Any("error", err))
+
+		return
+	}
+
+	invalidator.logger.Debug("invalidate keys", slog.Any("keys", keys))
+
+	invalidator.generation.Invalidate(func() {
+		for _, key := range keys {
+			if _, err := invalidator.cache.Remove(context.Background(), key); err != nil {
+				invalidator.logger.Warn(err.Error(), slog.Any("key", key))
+			}
+
+			if _, err := invalidator.missing.Remove(context.Background(), key); err != nil {
+				invalidator.logger.Warn(err.Error(), slog.Any("key", key))
+			}
+		}
+	})
+}
+
+// Reset очищает кэш целиком, когда уведомления могли быть пропущены
+func (invalidator *CacheInvalidator) Reset() {
+	invalidator.logger.Info("purge cache after listener reconnect")
+
+	invalidator.generation.Invalidate(func() {
+		if err := invalidator.cache.Purge(context.Background()); err != nil {
+			invalidator.logger.Warn(err.Error())
+		}
+
+		if err := invalidator.missing.Purge(context.Background()); err != nil {
+			invalidator.logger.Warn(err.Error())
+		}
+	})
+}
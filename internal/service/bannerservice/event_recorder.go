@@ -0,0 +1,101 @@
+package bannerservice
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	banner_repository "github.com/Heatdog/Avito/internal/repository/banner"
+)
+
+const (
+	// bufferedBatches - сколько пачек событий помещается в буфер до того, как события начнут отбрасываться
+	bufferedBatches = 10
+	flushTimeout    = 10 * time.Second
+)
+
+// EventRecorder накапливает показы и клики в памяти и записывает их в базу пачками
+// по batchSize событий, но не реже раза в interval. Record не блокируется:
+// при переполненном буфере событие отбрасывается
+type EventRecorder struct {
+	logger    *slog.Logger
+	repo      banner_repository.BannerRepository
+	events    chan banner_model.Event
+	batchSize int
+	interval  time.Duration
+}
+
+func NewEventRecorder(logger *slog.Logger, repo banner_repository.BannerRepository, batchSize int,
+	interval time.Duration) *EventRecorder {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &EventRecorder{
+		logger:    logger,
+		repo:      repo,
+		events:    make(chan banner_model.Event, batchSize*bufferedBatches),
+		batchSize: batchSize,
+		interval:  interval,
+	}
+}
+
+// Record добавляет событие в буфер и сообщает, поместилось ли оно
+func (recorder *EventRecorder) Record(event banner_model.Event) bool {
+	select {
+	case recorder.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run записывает события, пока не отменен ctx. После отмены оставшиеся в буфере события записываются
+func (recorder *EventRecorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(recorder.interval)
+	defer ticker.Stop()
+
+	batch := make([]banner_model.Event, 0, recorder.batchSize)
+
+	for {
+		select {
+		case event := <-recorder.events:
+			batch = append(batch, event)
+			if len(batch) >= recorder.batchSize {
+				batch = recorder.flush(batch)
+			}
+		case <-ticker.C:
+			batch = recorder.flush(batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-recorder.events:
+					batch = append(batch, event)
+				default:
+					recorder.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (recorder *EventRecorder) flush(batch []banner_model.Event) []banner_model.Event {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := recorder.repo.InsertEvents(ctx, batch); err != nil {
+		recorder.logger.Warn("events lost", slog.Int("count", len(batch)), slog.Any("error", err))
+	}
+
+	return batch[:0]
+}
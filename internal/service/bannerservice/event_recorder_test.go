@@ -0,0 +1,89 @@
+package bannerservice_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	banner_repository "github.com/Heatdog/Avito/internal/repository/banner"
+	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
+	"github.com/stretchr/testify/require"
+)
+
+// eventRepo запоминает пачки событий, записанные в базу
+type eventRepo struct {
+	banner_repository.BannerRepository
+	mu      sync.Mutex
+	batches [][]banner_model.Event
+}
+
+func (repo *eventRepo) InsertEvents(_ context.Context, events []banner_model.Event) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.batches = append(repo.batches, append([]banner_model.Event(nil), events...))
+
+	return nil
+}
+
+func (repo *eventRepo) sizes() []int {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	res := make([]int, len(repo.batches))
+	for i, batch := range repo.batches {
+		res[i] = len(batch)
+	}
+
+	return res
+}
+
+func TestEventRecorder(t *testing.T) {
+	repo := &eventRepo{}
+	recorder := banner_service.NewEventRecorder(slog.New(slog.NewJSONHandler(io.Discard, nil)), repo, 3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		recorder.Run(ctx)
+		close(done)
+	}()
+
+	for i := 1; i <= 7; i++ {
+		require.True(t, recorder.Record(banner_model.Event{Type: banner_model.EventImpression, BannerID: i}))
+	}
+
+	// полные пачки записываются сразу, не дожидаясь интервала
+	require.Eventually(t, func() bool {
+		return len(repo.sizes()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// остаток записывается при остановке
+	cancel()
+	<-done
+
+	require.Equal(t, []int{3, 3, 1}, repo.sizes())
+	require.Equal(t, 7, repo.batches[2][0].BannerID)
+}
+
+func TestEventRecorderFullBuffer(t *testing.T) {
+	recorder := banner_service.NewEventRecorder(slog.New(slog.NewJSONHandler(io.Discard, nil)), &eventRepo{}, 1,
+		time.Hour)
+
+	accepted := 0
+
+	for i := 0; i < 100; i++ {
+		if recorder.Record(banner_model.Event{Type: banner_model.EventClick, BannerID: 1}) {
+			accepted++
+		}
+	}
+
+	// без записи в базу буфер вмещает ограниченное число событий, а Record не блокируется
+	require.Less(t, accepted, 100)
+	require.NotZero(t, accepted)
+}
@@ -0,0 +1,63 @@
+package bannerservice
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	banner_repository "github.com/Heatdog/Avito/internal/repository/banner"
+)
+
+// TagTree хранит в памяти дерево тегов, по которому GetUserBanner ищет баннеры предков.
+// Дерево перечитывается из базы целиком после изменений на любом из подов;
+// пока оно перечитывается, запросы используют предыдущую версию
+type TagTree struct {
+	logger *slog.Logger
+	repo   banner_repository.BannerRepository
+	tree   atomic.Pointer[banner_model.TagTree]
+}
+
+func NewTagTree(logger *slog.Logger, repo banner_repository.BannerRepository) *TagTree {
+	return &TagTree{
+		logger: logger,
+		repo:   repo,
+	}
+}
+
+// Reload загружает дерево из базы. При ошибке остается предыдущая версия
+func (tags *TagTree) Reload(ctx context.Context) error {
+	res, err := tags.repo.GetTags(ctx)
+	if err != nil {
+		tags.logger.Warn(err.Error())
+		return err
+	}
+
+	tags.tree.Store(banner_model.NewTagTree(res))
+	tags.logger.Debug("tag tree loaded", slog.Int("tags", len(res)))
+
+	return nil
+}
+
+// HandleNotification перечитывает дерево после смены родителя тега
+func (tags *TagTree) HandleNotification(payload string) {
+	tags.logger.Debug("tag tree changed", slog.String("tag", payload))
+
+	if err := tags.Reload(context.Background()); err != nil {
+		tags.logger.Debug("tag tree reload failed", slog.Any("error", err))
+	}
+}
+
+// Reset перечитывает дерево, когда уведомления могли быть пропущены
+func (tags *TagTree) Reset() {
+	tags.HandleNotification("")
+}
+
+// Tree возвращает текущую версию дерева, nil - если дерево не загружено или не используется
+func (tags *TagTree) Tree() *banner_model.TagTree {
+	if tags == nil {
+		return nil
+	}
+
+	return tags.tree.Load()
+}
@@ -0,0 +1,48 @@
+package apikeystransport
+
+import (
+	"log/slog"
+	"net/http"
+
+	apikey_service "github.com/Heatdog/Avito/internal/service/apikeyservice"
+	"github.com/Heatdog/Avito/internal/transport"
+	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
+	"github.com/Heatdog/Avito/pkg/token"
+	"github.com/gorilla/mux"
+)
+
+type apiKeysHandler struct {
+	logger     *slog.Logger
+	service    apikey_service.APIKeyService
+	middleware *middleware_transport.Middleware
+}
+
+func NewAPIKeysHandler(logger *slog.Logger, service apikey_service.APIKeyService,
+	mid *middleware_transport.Middleware) transport.Handler {
+	return &apiKeysHandler{
+		logger:     logger,
+		service:    service,
+		middleware: mid,
+	}
+}
+
+const (
+	apiKey       = "/api_key"
+	apiKeyID     = "/api_key/{id}"
+	apiKeyRotate = "/api_key/{id}/rotate"
+)
+
+func (handler *apiKeysHandler) Register(router *mux.Router) {
+	router.HandleFunc(apiKey, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionManageAPIKeys, handler.createAPIKey))).
+		Methods(http.MethodPost)
+	router.HandleFunc(apiKey, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionManageAPIKeys, handler.getAPIKeys))).
+		Methods(http.MethodGet)
+	router.HandleFunc(apiKeyRotate, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionManageAPIKeys, handler.rotateAPIKey))).
+		Methods(http.MethodPost)
+	router.HandleFunc(apiKeyID, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionManageAPIKeys, handler.revokeAPIKey))).
+		Methods(http.MethodDelete)
+}
@@ -0,0 +1,55 @@
+package apikeystransport
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Отзыв API ключа
+// @Summary RevokeAPIKey
+// @Security ApiKeyAuth
+// @Description Отзыв API ключа
+// @ID revoke-api-key
+// @Tags api_key
+// @Produce json
+// @Param id path integer true "id"
+// @Success 204 {object} nil Ключ отозван
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Ключ не найден или уже отозван
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /api_key/{id} [delete]
+func (handler *apiKeysHandler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("revoke api key handler", slog.Int("id", id))
+
+	err = handler.service.RevokeAPIKey(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,34 @@
+package apikeystransport
+
+import (
+	"net/http"
+
+	_ "github.com/Heatdog/Avito/internal/models/apikey" // docs
+	"github.com/Heatdog/Avito/internal/transport"
+)
+
+// Получение списка API ключей
+// @Summary GetAPIKeys
+// @Security ApiKeyAuth
+// @Description Получение списка API ключей без секретов
+// @ID get-api-keys
+// @Tags api_key
+// @Produce json
+// @Success 200 {object} []apikey_model.APIKey Список ключей
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /api_key [get]
+func (handler *apiKeysHandler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	handler.logger.Debug("get api keys handler")
+
+	keys, err := handler.service.GetAPIKeys(r.Context())
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, keys, handler.logger)
+}
@@ -0,0 +1,70 @@
+package apikeystransport
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	apikey_model "github.com/Heatdog/Avito/internal/models/apikey"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/go-playground/validator/v10"
+)
+
+// Выпуск нового API ключа
+// @Summary CreateAPIKey
+// @Security ApiKeyAuth
+// @Description Выпуск нового API ключа. Секрет возвращается только один раз
+// @ID create-api-key
+// @Tags api_key
+// @Accept json
+// @Produce json
+// @Param input body apikey_model.APIKeyInsert true "api key info"
+// @Success 201 {object} apikey_model.APIKeyCreated Выпущенный ключ
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /api_key [post]
+func (handler *apiKeysHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	handler.logger.Debug("create api key handler")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	defer r.Body.Close()
+
+	var key apikey_model.APIKeyInsert
+
+	if err := json.Unmarshal(body, &key); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("validate request body", slog.String("name", key.Name), slog.String("role", key.Role))
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err = validate.Struct(key); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	created, err := handler.service.CreateAPIKey(r.Context(), &key)
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusCreated, created, handler.logger)
+}
@@ -0,0 +1,381 @@
+package apikeys_handler_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	apikey_model "github.com/Heatdog/Avito/internal/models/apikey"
+	apikey_postgre "github.com/Heatdog/Avito/internal/repository/apikey/postgre"
+	apikey_service "github.com/Heatdog/Avito/internal/service/apikeyservice"
+	apikeys_transport "github.com/Heatdog/Avito/internal/transport/apikeys"
+	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
+	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func Time(t time.Time) *time.Time { return &t }
+
+func TestAPIKeys(t *testing.T) {
+	dbMock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbMock.Close()
+
+	opt := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelError,
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
+	slog.SetDefault(logger)
+
+	cacheLRU := expirable.NewLRU[string, apikey_model.APIKey](0, nil, time.Second*time.Duration(30))
+	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
+	missingLRU := expirable.NewLRU[string, struct{}](0, nil, time.Second*time.Duration(5))
+	missing := hashicorp_lru.NewLRU(logger, missingLRU)
+
+	apiKeyRepo := apikey_postgre.NewAPIKeyRepository(logger, dbMock)
+	apiKeyService := apikey_service.NewAPIKeyService(logger, apiKeyRepo, cache, missing)
+
+	middleware := middleware_transport.NewMiddleware(logger, apiKeyService)
+
+	apiKeyHandler := apikeys_transport.NewAPIKeysHandler(logger, apiKeyService, middleware)
+	router := mux.NewRouter()
+
+	apiKeyHandler.Register(router)
+
+	keyColumns := []string{"id", "name", "role", "expires_at", "revoked_at", "created_at", "updated_at"}
+
+	expectKey := func(secret string, key apikey_model.APIKey) {
+		row := pgxmock.NewRows(keyColumns)
+		row.AddRow(key.ID, key.Name, key.Role, key.ExpiresAt, key.RevokedAt, key.CreatedAt, key.UpdatedAt)
+
+		dbMock.ExpectQuery("SELECT id, name, role, expires_at, revoked_at, created_at, updated_at FROM api_keys").
+			WithArgs(hash(secret)).
+			WillReturnRows(row)
+	}
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+
+		statusCode int
+		err        error
+
+		mockFunc func()
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/api_key",
+			token:  "admin_secret",
+			body: apikey_model.APIKeyInsert{
+				Name: "banner-client",
+				Role: "user",
+			},
+
+			statusCode: http.StatusCreated,
+
+			mockFunc: func() {
+				expectKey("admin_secret", apikey_model.APIKey{ID: 1, Name: "admin", Role: "admin"})
+
+				row := pgxmock.NewRows([]string{"id"})
+				row.AddRow(2)
+
+				dbMock.ExpectQuery("INSERT INTO api_keys").
+					WithArgs("banner-client", pgxmock.AnyArg(), "user", (*time.Time)(nil)).
+					WillReturnRows(row)
+			},
+		},
+		{
+			name:   "cached key",
+			method: http.MethodGet,
+			path:   "/api_key",
+			token:  "admin_secret",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				row := pgxmock.NewRows(keyColumns)
+				row.AddRow(1, "admin", "admin", nil, nil, time.Now(), time.Now())
+
+				dbMock.ExpectQuery("SELECT id, name, role, expires_at, revoked_at, created_at, updated_at FROM api_keys ORDER BY id").
+					WillReturnRows(row)
+			},
+		},
+		{
+			name:   "validation error",
+			method: http.MethodPost,
+			path:   "/api_key",
+			token:  "admin_secret",
+			body: apikey_model.APIKeyInsert{
+				Name: "banner-client",
+				Role: "root",
+			},
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf("Key: 'APIKeyInsert.Role' Error:Field validation for 'Role' failed on the 'oneof' tag"),
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "rotate",
+			method: http.MethodPost,
+			path:   "/api_key/2/rotate",
+			token:  "admin_secret",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				row := pgxmock.NewRows([]string{"secret_hash"})
+				row.AddRow(hash("old_secret"))
+
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("UPDATE api_keys k").
+					WithArgs(pgxmock.AnyArg(), 2).
+					WillReturnRows(row)
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs(apikey_postgre.NotifyChannel, hash("old_secret")).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "revoke not found",
+			method: http.MethodDelete,
+			path:   "/api_key/3",
+			token:  "admin_secret",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("UPDATE api_keys").
+					WithArgs(3).
+					WillReturnError(pgx.ErrNoRows)
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "Forbidden",
+			method: http.MethodGet,
+			path:   "/api_key",
+			token:  "user_secret",
+
+			statusCode: http.StatusForbidden,
+
+			mockFunc: func() {
+				expectKey("user_secret", apikey_model.APIKey{ID: 2, Name: "banner-client", Role: "user"})
+			},
+		},
+		{
+			name:   "revoke",
+			method: http.MethodDelete,
+			path:   "/api_key/2",
+			token:  "admin_secret",
+
+			statusCode: http.StatusNoContent,
+
+			mockFunc: func() {
+				row := pgxmock.NewRows([]string{"secret_hash"})
+				row.AddRow(hash("user_secret"))
+
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("UPDATE api_keys").
+					WithArgs(2).
+					WillReturnRows(row)
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs(apikey_postgre.NotifyChannel, hash("user_secret")).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "revoked key is evicted from cache",
+			method: http.MethodGet,
+			path:   "/api_key",
+			token:  "user_secret",
+
+			statusCode: http.StatusUnauthorized,
+
+			mockFunc: func() {
+				expectKey("user_secret", apikey_model.APIKey{
+					ID:        2,
+					Name:      "banner-client",
+					Role:      "user",
+					RevokedAt: Time(time.Now()),
+				})
+			},
+		},
+		{
+			name:   "expired key",
+			method: http.MethodGet,
+			path:   "/api_key",
+			token:  "expired_secret",
+
+			statusCode: http.StatusUnauthorized,
+
+			mockFunc: func() {
+				expectKey("expired_secret", apikey_model.APIKey{
+					ID:        4,
+					Name:      "old",
+					Role:      "admin",
+					ExpiresAt: Time(time.Now().Add(-time.Hour)),
+				})
+			},
+		},
+		{
+			name:   "revoked key",
+			method: http.MethodGet,
+			path:   "/api_key",
+			token:  "revoked_secret",
+
+			statusCode: http.StatusUnauthorized,
+
+			mockFunc: func() {
+				expectKey("revoked_secret", apikey_model.APIKey{
+					ID:        5,
+					Name:      "revoked",
+					Role:      "admin",
+					RevokedAt: Time(time.Now().Add(-time.Hour)),
+				})
+			},
+		},
+		{
+			name:   "Unauthorized",
+			method: http.MethodGet,
+			path:   "/api_key",
+			token:  "unknown_secret",
+
+			statusCode: http.StatusUnauthorized,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT id, name, role, expires_at, revoked_at, created_at, updated_at FROM api_keys").
+					WithArgs(hash("unknown_secret")).
+					WillReturnError(pgx.ErrNoRows)
+			},
+		},
+		{
+			name:   "unknown secret is cached",
+			method: http.MethodGet,
+			path:   "/api_key",
+			token:  "unknown_secret",
+
+			statusCode: http.StatusUnauthorized,
+
+			mockFunc: func() {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var body []byte
+
+			if testCase.body != nil {
+				body, err = json.Marshal(testCase.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+
+			r.Header.Set("token", testCase.token)
+
+			testCase.mockFunc()
+
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+
+			if testCase.err != nil {
+				expected, err := json.Marshal(struct {
+					Err string `json:"error"`
+				}{
+					Err: testCase.err.Error(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				require.Equal(t, string(expected), string(data))
+			}
+
+			if testCase.statusCode == http.StatusCreated {
+				var created apikey_model.APIKeyCreated
+				if err := json.Unmarshal(data, &created); err != nil {
+					t.Fatal(err)
+				}
+
+				require.Equal(t, 2, created.ID)
+				require.Len(t, created.Key, 64)
+			}
+
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAPIKeyCacheInvalidator(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cacheLRU := expirable.NewLRU[string, apikey_model.APIKey](0, nil, time.Second*time.Duration(30))
+	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
+	invalidator := apikey_service.NewCacheInvalidator(logger, cache)
+
+	ctx := context.Background()
+
+	for _, secret := range []string{"first_secret", "second_secret"} {
+		_, err := cache.Add(ctx, hash(secret), apikey_model.APIKey{Name: secret})
+		require.NoError(t, err)
+	}
+
+	invalidator.HandleNotification(hash("first_secret"))
+
+	_, ok, err := cache.Get(ctx, hash("first_secret"))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, ok, err = cache.Get(ctx, hash("second_secret"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	invalidator.Reset()
+
+	_, ok, err = cache.Get(ctx, hash("second_secret"))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
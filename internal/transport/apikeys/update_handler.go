@@ -0,0 +1,55 @@
+package apikeystransport
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Замена секрета API ключа
+// @Summary RotateAPIKey
+// @Security ApiKeyAuth
+// @Description Замена секрета API ключа. Прежний секрет перестает действовать
+// @ID rotate-api-key
+// @Tags api_key
+// @Produce json
+// @Param id path integer true "id"
+// @Success 200 {object} apikey_model.APIKeyCreated Новый секрет ключа
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Ключ не найден или отозван
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /api_key/{id}/rotate [post]
+func (handler *apiKeysHandler) rotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("rotate api key handler", slog.Int("id", id))
+
+	created, err := handler.service.RotateAPIKey(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, created, handler.logger)
+}
@@ -7,6 +7,7 @@ import (
 	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
 	"github.com/Heatdog/Avito/internal/transport"
 	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
+	"github.com/Heatdog/Avito/pkg/token"
 	"github.com/gorilla/mux"
 )
 
@@ -26,25 +27,143 @@ func NewBannersHandler(logger *slog.Logger, service banner_service.BannerService
 }
 
 const (
-	banner        = "/banner"
-	userBanner    = "/user_banner"
-	bannerID      = "/banner/{id}"
-	bannerVersion = "/banner/{id}/{version}"
+	banner         = "/banner"
+	userBanner     = "/user_banner"
+	bannerID       = "/banner/{id}"
+	bannerVersion  = "/banner/{id}/{version}"
+	bannerHistory  = "/banner/{id}/versions"
+	bannerDiff     = "/banner/{id}/diff"
+	bannerSchedule = "/banner/{id}/schedule"
+	bannerCap      = "/banner/{id}/frequency_cap"
+	bannerBudget   = "/banner/{id}/budget"
+	bannerTarget   = "/banner/{id}/targeting"
+	bannerRegions  = "/banner/{id}/regions"
+	bannerSubmit   = "/banner/{id}/versions/{version}/submit"
+	bannerApprove  = "/banner/{id}/versions/{version}/approve"
+	bannerPublish  = "/banner/{id}/versions/{version}/publish"
+	bannerApproval = "/banner/{id}/approvals"
+	slotVariants   = "/variants"
+	slotAllocation = "/variants/allocation"
+	events         = "/events"
+	bannerStats    = "/banner/{id}/stats"
+	bannerRollout  = "/banner/{id}/rollout"
+	rolloutDone    = "/banner/{id}/rollout/complete"
+	defaultBanner  = "/default_banner"
+	tagTree        = "/tag/tree"
+	tagParent      = "/tag/{id}/parent"
 )
 
 func (handler *bannersHandler) Register(router *mux.Router) {
-	router.HandleFunc(banner, handler.middleware.Auth(handler.middleware.AdminAuth(handler.createBanner))).
+	router.HandleFunc(banner, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.createBanner))).
 		Methods(http.MethodPost)
 	router.HandleFunc(userBanner, handler.middleware.Auth(handler.getUserBanner)).
 		Methods(http.MethodGet)
-	router.HandleFunc(banner, handler.middleware.Auth(handler.middleware.AdminAuth(handler.getBanners))).
+	router.HandleFunc(banner, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getBanners))).
 		Methods(http.MethodGet)
-	router.HandleFunc(bannerID, handler.middleware.Auth(handler.middleware.AdminAuth(handler.deleteBanner))).
+	router.HandleFunc(bannerID, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionDeleteBanner, handler.deleteBanner))).
 		Methods(http.MethodDelete)
-	router.HandleFunc(bannerID, handler.middleware.Auth(handler.middleware.AdminAuth(handler.updateBanner))).
+	router.HandleFunc(bannerID, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.updateBanner))).
 		Methods(http.MethodPatch)
-	router.HandleFunc(banner, handler.middleware.Auth(handler.middleware.AdminAuth(handler.deleteBannerOnTagOrFeature))).
+	router.HandleFunc(banner, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionDeleteBanner, handler.deleteBannerOnTagOrFeature))).
 		Methods(http.MethodDelete)
-	router.HandleFunc(bannerVersion, handler.middleware.Auth(handler.middleware.AdminAuth(handler.updateBannerVersion))).
+	// раскатка регистрируется раньше bannerVersion, иначе "rollout" будет разобран как номер версии
+	router.HandleFunc(bannerRollout, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionSwitchVersion, handler.setRolloutPercent))).
 		Methods(http.MethodPatch)
+	router.HandleFunc(bannerRollout, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionSwitchVersion, handler.abortRollout))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(rolloutDone, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionSwitchVersion, handler.completeRollout))).
+		Methods(http.MethodPost)
+	router.HandleFunc(bannerVersion, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionSwitchVersion, handler.updateBannerVersion))).
+		Methods(http.MethodPatch)
+	router.HandleFunc(bannerHistory, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getBannerVersions))).
+		Methods(http.MethodGet)
+	router.HandleFunc(bannerDiff, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.diffBannerVersions))).
+		Methods(http.MethodGet)
+	router.HandleFunc(bannerSchedule, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteBannerSchedule))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(bannerCap, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteBannerFrequencyCap))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(bannerRegions, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteBannerRegions))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(bannerTarget, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteBannerTargeting))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(bannerBudget, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getBannerBudget))).
+		Methods(http.MethodGet)
+	router.HandleFunc(bannerBudget, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteBannerBudget))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(bannerSubmit, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.submitBannerVersion))).
+		Methods(http.MethodPost)
+	router.HandleFunc(bannerApprove, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionApproveBanner, handler.approveBannerVersion))).
+		Methods(http.MethodPost)
+	router.HandleFunc(bannerPublish, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionSwitchVersion, handler.publishBannerVersion))).
+		Methods(http.MethodPost)
+	router.HandleFunc(bannerApproval, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getBannerApprovals))).
+		Methods(http.MethodGet)
+	router.HandleFunc(slotVariants, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getSlotVariants))).
+		Methods(http.MethodGet)
+	router.HandleFunc(slotVariants, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.setSlotVariants))).
+		Methods(http.MethodPut)
+	router.HandleFunc(slotVariants, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteSlotVariants))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(slotAllocation, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getSlotAllocation))).
+		Methods(http.MethodGet)
+	router.HandleFunc(defaultBanner, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getDefaultBanners))).
+		Methods(http.MethodGet)
+	router.HandleFunc(defaultBanner, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.setDefaultBanner))).
+		Methods(http.MethodPut)
+	router.HandleFunc(defaultBanner, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteDefaultBanner))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(tagTree, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getTagTree))).
+		Methods(http.MethodGet)
+	router.HandleFunc(tagParent, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.setTagParent))).
+		Methods(http.MethodPut)
+	router.HandleFunc(tagParent, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionEditBanner, handler.deleteTagParent))).
+		Methods(http.MethodDelete)
+	router.HandleFunc(events, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionRecordEvent, handler.postEvent))).
+		Methods(http.MethodPost)
+	router.HandleFunc(bannerStats, handler.middleware.Auth(
+		handler.middleware.Permission(token.PermissionReadBanner, handler.getBannerStats))).
+		Methods(http.MethodGet)
+}
+
+// subject возвращает владельца токена, проверенного middleware.Auth
+func subject(r *http.Request) string {
+	sub, ok := r.Context().Value(middleware_transport.ContextKey{Key: "subject"}).(string)
+	if !ok {
+		return ""
+	}
+
+	return sub
 }
@@ -0,0 +1,101 @@
+package bannerstransport
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Бюджет показов баннера
+// @Summary GetBannerBudget
+// @Security ApiKeyAuth
+// @Description Бюджет показов баннера, число сохраненных показов с момента, когда бюджет был задан, и остаток
+// @ID get-banner-budget
+// @Tags banner
+// @Produce json
+// @Param id path integer true "id"
+// @Success 200 {object} banner_model.BannerBudget Бюджет
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер не найден или бюджет не задан
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/budget [get]
+func (handler *bannersHandler) getBannerBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("get banner budget handler", slog.Int("id", id))
+
+	var budget banner_model.BannerBudget
+
+	budget, err = handler.service.GetBannerBudget(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, budget, handler.logger)
+}
+
+// Удаление бюджета показов баннера
+// @Summary DeleteBannerBudget
+// @Security ApiKeyAuth
+// @Description Удаляет бюджет показов. Баннер, выключенный из-за исчерпания бюджета, нужно включить отдельно
+// @ID delete-banner-budget
+// @Tags banner
+// @Param id path integer true "id"
+// @Success 204 {object} nil Бюджет удален
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер не найден
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/budget [delete]
+func (handler *bannersHandler) deleteBannerBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("delete banner budget handler", slog.Int("id", id))
+
+	err = handler.service.DeleteBannerBudget(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package bannerstransport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+)
+
+// Получение баннеров по умолчанию
+// @Summary GetDefaultBanners
+// @Security ApiKeyAuth
+// @Description Баннеры по умолчанию фич и общий баннер по умолчанию, у которого нет feature_id
+// @ID get-default-banners
+// @Tags default
+// @Produce json
+// @Success 200 {object} []banner_model.DefaultBanner Баннеры по умолчанию
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /default_banner [get]
+func (handler *bannersHandler) getDefaultBanners(w http.ResponseWriter, r *http.Request) {
+	handler.logger.Debug("get default banners handler")
+
+	defaults, err := handler.service.GetDefaultBanners(r.Context())
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, defaults, handler.logger)
+}
+
+// Назначение баннера по умолчанию
+// @Summary SetDefaultBanner
+// @Security ApiKeyAuth
+// @Description Задает или заменяет баннер, который /user_banner показывает, когда у тегов пользователя
+// @Description баннера нет: с feature_id - баннер по умолчанию фичи, без него - общий баннер по умолчанию
+// @ID set-default-banner
+// @Tags default
+// @Accept json
+// @Param input body banner_model.DefaultBanner true "default banner"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные, несуществующий баннер или фича
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /default_banner [put]
+func (handler *bannersHandler) setDefaultBanner(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var def banner_model.DefaultBanner
+
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("set default banner handler", slog.Any("default", def))
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(def); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	err := handler.service.SetDefaultBanner(r.Context(), def)
+	if errors.Is(err, banner_model.ErrUnknownDefault) {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Снятие баннера по умолчанию
+// @Summary DeleteDefaultBanner
+// @Security ApiKeyAuth
+// @Description Снимает баннер по умолчанию фичи feature_id, без feature_id - общий баннер по умолчанию
+// @ID delete-default-banner
+// @Tags default
+// @Param feature_id query integer false "feature_id"
+// @Success 204 {object} nil Баннер по умолчанию снят
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер по умолчанию не задан
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /default_banner [delete]
+func (handler *bannersHandler) deleteDefaultBanner(w http.ResponseWriter, r *http.Request) {
+	var featureID *int
+
+	if value := r.URL.Query().Get("feature_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err == nil && id < 1 {
+			err = fmt.Errorf("feature_id must be positive")
+		}
+
+		if err != nil {
+			handler.logger.Debug(err.Error())
+			transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+			return
+		}
+
+		featureID = &id
+	}
+
+	handler.logger.Debug("delete default banner handler", slog.Any("feature", featureID))
+
+	err := handler.service.DeleteDefaultBanner(r.Context(), featureID)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package bannerstransport
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+// Регистрация показа или клика баннера
+// @Summary PostEvent
+// @Security ApiKeyAuth
+// @Description Событие сохраняется асинхронно: оно попадает в буфер и записывается в базу пачкой.
+// @Description Показы и клики также используются для выбора вариантов в слотах со стратегией по кликам
+// @ID post-event
+// @Tags events
+// @Accept json
+// @Param input body banner_model.Event true "event"
+// @Success 202 {object} nil Событие принято
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Failure 503 {object} transport.RespWriterError Буфер событий переполнен, событие не принято
+// @Router /events [post]
+func (handler *bannersHandler) postEvent(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var event banner_model.Event
+
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("post event handler", slog.Any("event", event))
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(event); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	err := handler.service.RecordEvent(r.Context(), event)
+	if errors.Is(err, banner_model.ErrEventsOverloaded) {
+		handler.logger.Debug(err.Error())
+		w.Header().Set("Retry-After", "1")
+		transport.ResponseWriteError(w, http.StatusServiceUnavailable, err.Error(), handler.logger)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Статистика показов и кликов баннера
+// @Summary GetBannerStats
+// @Security ApiKeyAuth
+// @Description Число показов и кликов баннера по дням (UTC) и версиям, начиная с последнего дня
+// @ID get-banner-stats
+// @Tags events
+// @Produce json
+// @Param id path integer true "id"
+// @Success 200 {array} banner_model.BannerStat Статистика
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/stats [get]
+func (handler *bannersHandler) getBannerStats(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("get banner stats handler", slog.Int("id", id))
+
+	stats, err := handler.service.GetBannerStats(r.Context(), id)
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, stats, handler.logger)
+}
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
-	_ "github.com/Heatdog/Avito/internal/models/banner" // docs
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	"github.com/Heatdog/Avito/internal/models/queryparams"
 	"github.com/Heatdog/Avito/internal/transport"
 	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
+	"github.com/Heatdog/Avito/pkg/token"
 	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5"
 )
@@ -17,15 +20,23 @@ import (
 // Получение баннера для пользователя
 // @Summary GetUserBanner
 // @Security ApiKeyAuth
-// @Description Получение баннера для пользователя
+// @Description Получение баннера для пользователя. Если у тегов пользователя баннера нет,
+// @Description показывается баннер по умолчанию фичи, а если нет и его - общий баннер по умолчанию
 // @ID get-user-banner
 // @Tags banner
 // @Produce json
-// @Param tag_id query integer true "tag_id"
+// @Param tag_id query []integer true "теги пользователя, можно повторить параметр или перечислить через запятую" collectionFormat(multi)
 // @Param feature_id query integer true "feature_id"
 // @Param use_last_revision query boolean false "use_last_revision"
-// @Param version query integer false "version"
+// @Param version query integer false "номер версии, по умолчанию активная"
+// @Param user_id query string false "идентификатор пользователя для выбора варианта эксперимента"
+// @Param platform query string false "платформа для правил таргетинга, по умолчанию из заголовка X-Platform"
+// @Param app_version query string false "версия приложения для правил таргетинга, по умолчанию из заголовка X-App-Version"
+// @Param region query string false "регион для правил таргетинга, по умолчанию из заголовка X-Region или по IP-адресу"
 // @Success 200 {object} object JSON-отображение баннера
+// @Header 200 {string} X-Banner-ID "id показанного баннера"
+// @Header 200 {string} X-Banner-Match "уровень, на котором нашелся баннер: tag, feature или global"
+// @Header 200 {string} X-Banner-Variant "id баннера, выбранного в эксперименте слота"
 // @Failure 400 {object} transport.RespWriterError Некорректные данные
 // @Failure 401 {object} nil Пользователь не авторизован
 // @Failure 403 {object} nil Пользователь не имеет доступа
@@ -35,43 +46,41 @@ import (
 func (handler *bannersHandler) getUserBanner(w http.ResponseWriter, r *http.Request) {
 	handler.logger.Debug("get user banner handler")
 
-	var token string
-
-	tokenIn := r.Context().Value(middleware_transport.ContextKey{Key: "token"})
-
-	if tokenIn != nil {
-		tokenStr, ok := tokenIn.(string)
-		if !ok {
-			err := fmt.Errorf("token in context error")
-			handler.logger.Warn(err.Error())
-			transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
-
-			return
-		}
-
-		token = tokenStr
-	} else {
-		err := fmt.Errorf("token in context error")
+	role, ok := r.Context().Value(middleware_transport.ContextKey{Key: "role"}).(token.Role)
+	if !ok {
+		err := fmt.Errorf("role in context error")
 		handler.logger.Warn(err.Error())
 		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
 
 		return
 	}
 
-	handler.logger.Debug("token header", slog.String("token", token))
+	handler.logger.Debug("token role", slog.Any("role", role))
 
 	params := queryparams.BannerUserParams{
-		TagID:            r.URL.Query().Get("tag_id"),
-		FeatureID:        r.URL.Query().Get("feature_id"),
+		TagIDs:           tagIDs(r),
+		FeatureID:        normalizeID(r.URL.Query().Get("feature_id")),
 		UseLastrRevision: r.URL.Query().Get("use_last_revision"),
-		Token:            token,
+		Version:          r.URL.Query().Get("version"),
+		UserID:           r.URL.Query().Get("user_id"),
+		Role:             role,
+		Attributes: banner_model.Attributes{
+			Platform:   attribute(r, "platform", "X-Platform"),
+			AppVersion: attribute(r, "app_version", "X-App-Version"),
+			Region:     attribute(r, "region", "X-Region"),
+		},
 	}
-	if params.UseLastrRevision == "" {
-		params.UseLastrRevision = "false"
+
+	// регион по IP-адресу закрывает баннеры для других регионов и заменяет атрибут region, если он не передан
+	if region, ok := r.Context().Value(middleware_transport.ContextKey{Key: "region"}).(string); ok {
+		params.Region = region
+		if params.Attributes.Region == "" {
+			params.Attributes.Region = region
+		}
 	}
 
-	if params.Version == "" {
-		params.Version = "1"
+	if params.UseLastrRevision == "" {
+		params.UseLastrRevision = "false"
 	}
 
 	handler.logger.Debug("validate request params", slog.Any("params", params))
@@ -84,9 +93,18 @@ func (handler *bannersHandler) getUserBanner(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// версия баннера имеет смысл только для одного слота
+	if params.Version != "" && len(params.Keys()) > 1 {
+		err := fmt.Errorf("version requires a single tag_id")
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
 	handler.logger.Debug("valid successful")
 
-	content, err := handler.service.GetUserBanner(r.Context(), &params)
+	banner, err := handler.service.GetUserBanner(r.Context(), &params)
 	if err == pgx.ErrNoRows {
 		handler.logger.Debug(err.Error())
 		w.WriteHeader(http.StatusNotFound)
@@ -101,7 +119,7 @@ func (handler *bannersHandler) getUserBanner(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	resp, err := json.Marshal(content)
+	resp, err := json.Marshal(banner.Content)
 	if err != nil {
 		handler.logger.Warn(err.Error())
 		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
@@ -109,6 +127,13 @@ func (handler *bannersHandler) getUserBanner(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	w.Header().Set(banner_model.BannerIDHeader, strconv.Itoa(banner.ID))
+	w.Header().Set(banner_model.MatchHeader, string(banner.Match))
+
+	if banner.Variant != "" {
+		w.Header().Set(banner_model.VariantHeader, banner.Variant)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Header().Add("content-type", "application/json")
 
@@ -122,6 +147,50 @@ func (handler *bannersHandler) getUserBanner(w http.ResponseWriter, r *http.Requ
 	handler.logger.Debug(string(resp))
 }
 
+// tagIDs читает теги запроса: параметр tag_id можно повторить или перечислить теги через запятую.
+// Теги приводятся к каноническому виду и не повторяются, чтобы "01" и "1" давали один слот
+func tagIDs(r *http.Request) []string {
+	var res []string
+
+	seen := map[string]struct{}{}
+
+	for _, value := range r.URL.Query()["tag_id"] {
+		for _, tagID := range strings.Split(value, ",") {
+			tagID = normalizeID(strings.TrimSpace(tagID))
+
+			if _, ok := seen[tagID]; ok {
+				continue
+			}
+
+			seen[tagID] = struct{}{}
+
+			res = append(res, tagID)
+		}
+	}
+
+	return res
+}
+
+// normalizeID убирает ведущие нули и знак плюс из числового идентификатора, по которому
+// строится ключ кэша. Нечисловое значение возвращается как есть и отклоняется при валидации
+func normalizeID(id string) string {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return id
+	}
+
+	return strconv.Itoa(n)
+}
+
+// attribute читает атрибут запроса для правил таргетинга: параметр запроса важнее заголовка
+func attribute(r *http.Request, param, header string) string {
+	if value := r.URL.Query().Get(param); value != "" {
+		return value
+	}
+
+	return r.Header.Get(header)
+}
+
 // Получение всех баннеров c фильтрацией по фиче и/или тегу
 // @Summary GetBanners
 // @Security ApiKeyAuth
@@ -133,7 +202,9 @@ func (handler *bannersHandler) getUserBanner(w http.ResponseWriter, r *http.Requ
 // @Param feature_id query integer false "feature_id"
 // @Param limit query integer false "limit"
 // @Param offset query integer false "offset"
+// @Param status query string false "окно показа: live - показываются сейчас, upcoming - еще не начались, expired - закончились" Enums(live, upcoming, expired)
 // @Success 200 {object} []banner_model.Banner Список баннеров
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
 // @Failure 401 {object} nil Пользователь не авторизован
 // @Failure 403 {object} nil Пользователь не имеет доступа
 // @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
@@ -147,8 +218,9 @@ func (handler *bannersHandler) getBanners(w http.ResponseWriter, r *http.Request
 	featureIDStr := r.URL.Query().Get("feature_id")
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
+	statusStr := r.URL.Query().Get("status")
 
-	params, err := queryparams.ValidateBannersParams(tagIDStr, featureIDStr, limitStr, offsetStr)
+	params, err := queryparams.ValidateBannersParams(tagIDStr, featureIDStr, limitStr, offsetStr, statusStr)
 	if err != nil {
 		handler.logger.Debug(err.Error())
 		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
@@ -2,6 +2,7 @@ package bannerstransport
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -24,6 +25,7 @@ import (
 // @Failure 400 {object} transport.RespWriterError Некорректные данные
 // @Failure 401 {object} nil Пользователь не авторизован
 // @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 409 {object} transport.RespWriterError В слоте уже есть баннер без правил таргетинга
 // @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
 // @Router /banner [post]
 func (handler *bannersHandler) createBanner(w http.ResponseWriter, r *http.Request) {
@@ -73,9 +75,52 @@ func (handler *bannersHandler) createBanner(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if err = banner_model.ValidWindow(banner.ActiveFrom, banner.ActiveUntil); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	if banner.Schedule != nil {
+		if err = banner.Schedule.Validate(); err != nil {
+			handler.logger.Debug(err.Error())
+			transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+			return
+		}
+	}
+
+	if banner.Targeting != nil {
+		if err = banner.Targeting.Compile(); err != nil {
+			handler.logger.Debug(err.Error())
+			transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+			return
+		}
+	}
+
+	if banner.Regions != nil {
+		if err = banner.Regions.Validate(); err != nil {
+			handler.logger.Debug(err.Error())
+			transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+			return
+		}
+	}
+
 	handler.logger.Debug("valid successful")
 
+	banner.Author = subject(r)
+
 	id, err := handler.service.InsertBanner(r.Context(), &banner)
+	if errors.Is(err, banner_model.ErrSlotTaken) {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusConflict, err.Error(), handler.logger)
+
+		return
+	}
+
 	if err != nil {
 		handler.logger.Warn(err.Error())
 		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
@@ -0,0 +1,159 @@
+package bannerstransport
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Отправка черновика баннера на согласование
+// @Summary SubmitBannerVersion
+// @Security ApiKeyAuth
+// @Description Переводит черновик версии баннера в состояние review
+// @ID submit-banner-version
+// @Tags review
+// @Param id path integer true "id"
+// @Param version path integer true "version"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Версия не найдена
+// @Failure 409 {object} transport.RespWriterError Версия не в состоянии draft
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/versions/{version}/submit [post]
+func (handler *bannersHandler) submitBannerVersion(w http.ResponseWriter, r *http.Request) {
+	handler.reviewBannerVersion(w, r, banner_model.ActionSubmit)
+}
+
+// Одобрение версии баннера
+// @Summary ApproveBannerVersion
+// @Security ApiKeyAuth
+// @Description Одобряет версию в состоянии review. Автор версии и отправивший ее на согласование одобрить ее не могут
+// @ID approve-banner-version
+// @Tags review
+// @Param id path integer true "id"
+// @Param version path integer true "version"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} transport.RespWriterError Пользователь не имеет доступа или одобряет свою версию
+// @Failure 404 {object} nil Версия не найдена
+// @Failure 409 {object} transport.RespWriterError Версия не в состоянии review
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/versions/{version}/approve [post]
+func (handler *bannersHandler) approveBannerVersion(w http.ResponseWriter, r *http.Request) {
+	handler.reviewBannerVersion(w, r, banner_model.ActionApprove)
+}
+
+// Публикация одобренной версии баннера
+// @Summary PublishBannerVersion
+// @Security ApiKeyAuth
+// @Description Делает одобренную версию активной, после чего ее видят пользователи
+// @ID publish-banner-version
+// @Tags review
+// @Param id path integer true "id"
+// @Param version path integer true "version"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Версия не найдена
+// @Failure 409 {object} transport.RespWriterError Версия не в состоянии approved
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/versions/{version}/publish [post]
+func (handler *bannersHandler) publishBannerVersion(w http.ResponseWriter, r *http.Request) {
+	handler.reviewBannerVersion(w, r, banner_model.ActionPublish)
+}
+
+func (handler *bannersHandler) reviewBannerVersion(w http.ResponseWriter, r *http.Request,
+	action banner_model.ReviewAction) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("review banner version handler", slog.Int("id", id), slog.Int("version", version),
+		slog.Any("action", action))
+
+	actor := subject(r)
+	if actor == "" {
+		err = banner_model.ErrAnonymousReview
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusForbidden, err.Error(), handler.logger)
+
+		return
+	}
+
+	err = handler.service.ReviewBannerVersion(r.Context(), id, version, action, actor)
+
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case err == pgx.ErrNoRows:
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, banner_model.ErrSelfApproval):
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusForbidden, err.Error(), handler.logger)
+	case errors.Is(err, banner_model.ErrBadTransition):
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusConflict, err.Error(), handler.logger)
+	default:
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+	}
+}
+
+// Получение истории согласования баннера
+// @Summary GetBannerApprovals
+// @Security ApiKeyAuth
+// @Description Получение истории согласования версий баннера, начиная с последних действий
+// @ID get-banner-approvals
+// @Tags review
+// @Produce json
+// @Param id path integer true "id"
+// @Success 200 {object} []banner_model.BannerApproval История согласования
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/approvals [get]
+func (handler *bannersHandler) getBannerApprovals(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("get banner approvals handler", slog.Int("id", id))
+
+	approvals, err := handler.service.GetBannerApprovals(r.Context(), id)
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, approvals, handler.logger)
+}
@@ -0,0 +1,137 @@
+package bannerstransport
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Изменение процента раскатки новой версии баннера
+// @Summary SetRolloutPercent
+// @Security ApiKeyAuth
+// @Description Изменяет долю пользователей, которые видят версию в раскатке
+// @ID set-rollout-percent
+// @Tags rollout
+// @Param id path integer true "id"
+// @Param input body banner_model.RolloutUpdate true "percent"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil У баннера нет раскатки
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/rollout [patch]
+func (handler *bannersHandler) setRolloutPercent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	defer r.Body.Close()
+
+	var rollout banner_model.RolloutUpdate
+
+	if err = json.NewDecoder(r.Body).Decode(&rollout); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("set rollout percent handler", slog.Int("id", id), slog.Int("percent", rollout.Percent))
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err = validate.Struct(rollout); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.writeRolloutResult(w, handler.service.SetRolloutPercent(r.Context(), id, rollout.Percent),
+		http.StatusOK)
+}
+
+// Завершение раскатки новой версии баннера
+// @Summary CompleteRollout
+// @Security ApiKeyAuth
+// @Description Делает опубликованную версию из раскатки активной для всех пользователей
+// @ID complete-rollout
+// @Tags rollout
+// @Param id path integer true "id"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil У баннера нет опубликованной раскатки
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/rollout/complete [post]
+func (handler *bannersHandler) completeRollout(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("complete rollout handler", slog.Int("id", id))
+
+	handler.writeRolloutResult(w, handler.service.CompleteRollout(r.Context(), id), http.StatusOK)
+}
+
+// Отмена раскатки новой версии баннера
+// @Summary AbortRollout
+// @Security ApiKeyAuth
+// @Description Прекращает раскатку, все пользователи снова видят активную версию
+// @ID abort-rollout
+// @Tags rollout
+// @Param id path integer true "id"
+// @Success 204 {object} nil Раскатка отменена
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil У баннера нет раскатки
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/rollout [delete]
+func (handler *bannersHandler) abortRollout(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("abort rollout handler", slog.Int("id", id))
+
+	handler.writeRolloutResult(w, handler.service.AbortRollout(r.Context(), id), http.StatusNoContent)
+}
+
+func (handler *bannersHandler) writeRolloutResult(w http.ResponseWriter, err error, status int) {
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(status)
+}
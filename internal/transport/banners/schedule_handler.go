@@ -0,0 +1,97 @@
+package bannerstransport
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Удаление расписания показа баннера
+// @Summary DeleteBannerSchedule
+// @Security ApiKeyAuth
+// @Description Удаляет повторяющееся расписание, после чего баннер показывается в любое время своего окна показа
+// @ID delete-banner-schedule
+// @Tags banner
+// @Param id path integer true "id"
+// @Success 204 {object} nil Расписание удалено
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер не найден
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/schedule [delete]
+func (handler *bannersHandler) deleteBannerSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("delete banner schedule handler", slog.Int("id", id))
+
+	err = handler.service.DeleteBannerSchedule(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Удаление ограничения частоты показа баннера
+// @Summary DeleteBannerFrequencyCap
+// @Security ApiKeyAuth
+// @Description Удаляет ограничение числа показов баннера одному пользователю
+// @ID delete-banner-frequency-cap
+// @Tags banner
+// @Param id path integer true "id"
+// @Success 204 {object} nil Ограничение удалено
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер не найден
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/frequency_cap [delete]
+func (handler *bannersHandler) deleteBannerFrequencyCap(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("delete banner frequency cap handler", slog.Int("id", id))
+
+	err = handler.service.DeleteBannerFrequencyCap(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package bannerstransport
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Получение дерева тегов
+// @Summary GetTagTree
+// @Security ApiKeyAuth
+// @Description Теги с вложенными потомками. Тег без собственного баннера получает баннер ближайшего предка
+// @ID get-tag-tree
+// @Tags tag
+// @Produce json
+// @Success 200 {object} []banner_model.TagNode Корневые теги
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /tag/tree [get]
+func (handler *bannersHandler) getTagTree(w http.ResponseWriter, r *http.Request) {
+	handler.logger.Debug("get tag tree handler")
+
+	tree, err := handler.service.GetTagTree(r.Context())
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, tree, handler.logger)
+}
+
+// Назначение родителя тега
+// @Summary SetTagParent
+// @Security ApiKeyAuth
+// @Description Делает тег потомком parent_id. Тег не может стать потомком самого себя или своего потомка
+// @ID set-tag-parent
+// @Tags tag
+// @Accept json
+// @Param id path integer true "id"
+// @Param input body banner_model.TagParent true "parent"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные или несуществующий родитель
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Тег не найден
+// @Failure 409 {object} transport.RespWriterError Назначение замкнуло бы цикл
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /tag/{id}/parent [put]
+func (handler *bannersHandler) setTagParent(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	var parent banner_model.TagParent
+
+	if err = json.NewDecoder(r.Body).Decode(&parent); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("set tag parent handler", slog.Int("id", id), slog.Int("parent", parent.ParentID))
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err = validate.Struct(parent); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.writeTagParentResult(w, handler.service.SetTagParent(r.Context(), id, &parent.ParentID),
+		http.StatusOK)
+}
+
+// Снятие родителя тега
+// @Summary DeleteTagParent
+// @Security ApiKeyAuth
+// @Description Делает тег корневым, баннеры предков на него больше не распространяются
+// @ID delete-tag-parent
+// @Tags tag
+// @Param id path integer true "id"
+// @Success 204 {object} nil Тег стал корневым
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Тег не найден
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /tag/{id}/parent [delete]
+func (handler *bannersHandler) deleteTagParent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("delete tag parent handler", slog.Int("id", id))
+
+	handler.writeTagParentResult(w, handler.service.SetTagParent(r.Context(), id, nil), http.StatusNoContent)
+}
+
+func (handler *bannersHandler) writeTagParentResult(w http.ResponseWriter, err error, status int) {
+	switch {
+	case err == nil:
+		w.WriteHeader(status)
+	case err == pgx.ErrNoRows:
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, banner_model.ErrUnknownParent):
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+	case errors.Is(err, banner_model.ErrTagCycle):
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusConflict, err.Error(), handler.logger)
+	default:
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+	}
+}
@@ -0,0 +1,107 @@
+package bannerstransport
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Удаление правил таргетинга баннера
+// @Summary DeleteBannerTargeting
+// @Security ApiKeyAuth
+// @Description Удаляет правила таргетинга, после чего баннер показывается всем запросам слота, которым не подошел баннер с правилами
+// @ID delete-banner-targeting
+// @Tags banner
+// @Param id path integer true "id"
+// @Success 204 {object} nil Правила удалены
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер не найден
+// @Failure 409 {object} transport.RespWriterError В слоте уже есть баннер без правил таргетинга
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/targeting [delete]
+func (handler *bannersHandler) deleteBannerTargeting(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("delete banner targeting handler", slog.Int("id", id))
+
+	err = handler.service.DeleteBannerTargeting(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if errors.Is(err, banner_model.ErrSlotTaken) {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusConflict, err.Error(), handler.logger)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Удаление ограничения баннера по регионам
+// @Summary DeleteBannerRegions
+// @Security ApiKeyAuth
+// @Description Удаляет списки разрешенных и запрещенных регионов, после чего баннер показывается в любом регионе
+// @ID delete-banner-regions
+// @Tags banner
+// @Param id path integer true "id"
+// @Success 204 {object} nil Ограничение удалено
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер не найден
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/regions [delete]
+func (handler *bannersHandler) deleteBannerRegions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("delete banner regions handler", slog.Int("id", id))
+
+	err = handler.service.DeleteBannerRegions(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
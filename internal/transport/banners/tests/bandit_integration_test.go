@@ -0,0 +1,418 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func Int64(i int64) *int64     { return &i }
+func Float(f float64) *float64 { return &f }
+func String(s string) *string  { return &s }
+
+func TestSlotStrategy(t *testing.T) {
+	f := newFixture(t)
+	dbMock, router := f.dbMock, f.router
+
+	testTable := []struct {
+		name     string
+		body     banner_model.SlotVariants
+		status   int
+		mockFunc func()
+	}{
+		{
+			name: "thompson with seed",
+			body: banner_model.SlotVariants{
+				Variants: []banner_model.VariantWeight{{BannerID: 2, Weight: 1}, {BannerID: 3, Weight: 1}},
+				Strategy: &banner_model.SlotStrategy{Name: banner_model.StrategyThompson, Seed: Int64(7)},
+			},
+			status: http.StatusOK,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM slot_variants").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectExec("INSERT INTO slot_variants").
+					WithArgs(1, 1, 2, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("INSERT INTO slot_variants").
+					WithArgs(1, 1, 3, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("INSERT INTO slot_strategies").
+					WithArgs(1, 1, banner_model.StrategyThompson, 0.0, Int64(7)).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", `[{"tag_id":"1","feature_id":"1"}]`).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name: "weights strategy is not stored",
+			body: banner_model.SlotVariants{
+				Variants: []banner_model.VariantWeight{{BannerID: 2, Weight: 1}},
+				Strategy: &banner_model.SlotStrategy{Name: banner_model.StrategyWeights},
+			},
+			status: http.StatusOK,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM slot_variants").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				dbMock.ExpectExec("INSERT INTO slot_variants").
+					WithArgs(1, 1, 2, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", `[{"tag_id":"1","feature_id":"1"}]`).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name: "unknown strategy",
+			body: banner_model.SlotVariants{
+				Variants: []banner_model.VariantWeight{{BannerID: 2, Weight: 1}},
+				Strategy: &banner_model.SlotStrategy{Name: "random"},
+			},
+			status:   http.StatusBadRequest,
+			mockFunc: func() {},
+		},
+		{
+			name: "epsilon out of range",
+			body: banner_model.SlotVariants{
+				Variants: []banner_model.VariantWeight{{BannerID: 2, Weight: 1}},
+				Strategy: &banner_model.SlotStrategy{Name: banner_model.StrategyEpsilonGreedy, Epsilon: 1.5},
+			},
+			status:   http.StatusBadRequest,
+			mockFunc: func() {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			body, err := json.Marshal(testCase.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPut, "/variants?tag_id=1&feature_id=1", bytes.NewBuffer(body))
+			r.Header.Set("token", "editor_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.status, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserBannerBandit(t *testing.T) {
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+
+	expectSlot := func(dbMock pgxmock.PgxPoolIface, strategy banner_model.Strategy, epsilon float64) {
+		row := pgxmock.NewRows(variantColumns)
+		row.AddRow(2, 1, map[string]interface{}{"variant": "2"}, true, nil, nil, nil, 1, String(string(strategy)),
+			Float(epsilon), Int64(1), nil, nil, 0, nil)
+		row.AddRow(3, 1, map[string]interface{}{"variant": "3"}, true, nil, nil, nil, 1, String(string(strategy)),
+			Float(epsilon), Int64(1), nil, nil, 0, nil)
+
+		dbMock.ExpectQuery("FROM slot_variants sv").
+			WithArgs(key.FeatureID, key.TagID).
+			WillReturnRows(row)
+	}
+
+	statColumns := []string{"banner_id", "impressions", "clicks"}
+
+	expectStats := func(dbMock pgxmock.PgxPoolIface, rows *pgxmock.Rows) {
+		dbMock.ExpectQuery("FROM banner_events WHERE feature_id = \\$1 AND tag_id = \\$2 AND created_at < \\$3").
+			WithArgs(key.FeatureID, key.TagID, pgxmock.AnyArg()).
+			WillReturnRows(rows)
+	}
+
+	get := func(t *testing.T, router *mux.Router) string {
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=1&feature_id=1", nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		return w.Header().Get(banner_model.VariantHeader)
+	}
+
+	post := func(t *testing.T, router *mux.Router, event banner_model.Event, times int) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < times; i++ {
+			r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBuffer(body))
+			r.Header.Set("token", "tracker_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusAccepted, w.Code)
+		}
+	}
+
+	// запись событий в базу не запускается, буфер fixture вмещает все события теста
+	feed := func(t *testing.T, router *mux.Router, bannerID, impressions, clicks int) {
+		event := banner_model.Event{Type: banner_model.EventImpression, BannerID: bannerID, Version: 1,
+			TagID: 1, FeatureID: 1}
+		post(t, router, event, impressions)
+
+		event.Type = banner_model.EventClick
+		post(t, router, event, clicks)
+	}
+
+	t.Run("epsilon greedy follows click-through", func(t *testing.T) {
+		f := newFixture(t, withEvents(100, time.Hour))
+		dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+		expectSlot(dbMock, banner_model.StrategyEpsilonGreedy, 0)
+		expectStats(dbMock, pgxmock.NewRows(statColumns))
+
+		// варианты без показов выбираются первыми
+		require.Equal(t, "2", get(t, router))
+		require.Eventually(t, func() bool {
+			return cacheLRU.Contains(key)
+		}, time.Second, 5*time.Millisecond)
+
+		feed(t, router, 2, 10, 1)
+		require.Equal(t, "3", get(t, router))
+
+		feed(t, router, 3, 10, 5)
+
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "3", get(t, router))
+		}
+
+		require.NoError(t, dbMock.ExpectationsWereMet())
+
+		dbMock.ExpectQuery("SELECT sv.banner_id, sv.weight, st.strategy, st.epsilon, st.seed FROM slot_variants").
+			WithArgs(1, 1).
+			WillReturnRows(pgxmock.NewRows(slotVariantColumns).
+				AddRow(2, 1, String(string(banner_model.StrategyEpsilonGreedy)), Float(0), Int64(1)).
+				AddRow(3, 1, String(string(banner_model.StrategyEpsilonGreedy)), Float(0), Int64(1)))
+
+		r := httptest.NewRequest(http.MethodGet, "/variants/allocation?tag_id=1&feature_id=1", nil)
+		r.Header.Set("token", "viewer_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+
+		var allocation banner_model.SlotAllocation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &allocation))
+
+		require.Equal(t, banner_model.SlotAllocation{
+			Strategy: banner_model.StrategyEpsilonGreedy,
+			Variants: []banner_model.VariantAllocation{
+				{BannerID: 2, Impressions: 10, Clicks: 1, CTR: 0.1, Share: 0},
+				{BannerID: 3, Impressions: 10, Clicks: 5, CTR: 0.5, Share: 1},
+			},
+		}, allocation)
+	})
+
+	t.Run("thompson with seed is reproducible", func(t *testing.T) {
+		run := func() []string {
+			f := newFixture(t, withEvents(100, time.Hour))
+			dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+			expectSlot(dbMock, banner_model.StrategyThompson, 0)
+			expectStats(dbMock, pgxmock.NewRows(statColumns))
+
+			get(t, router)
+			require.Eventually(t, func() bool {
+				return cacheLRU.Contains(key)
+			}, time.Second, 5*time.Millisecond)
+
+			feed(t, router, 2, 50, 2)
+			feed(t, router, 3, 50, 20)
+
+			var res []string
+			for i := 0; i < 30; i++ {
+				res = append(res, get(t, router))
+			}
+
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			return res
+		}
+
+		first := run()
+		require.Equal(t, first, run())
+
+		better := 0
+
+		for _, variant := range first {
+			if variant == "3" {
+				better++
+			}
+		}
+
+		require.Greater(t, better, len(first)/2)
+	})
+
+	t.Run("stored events survive restart", func(t *testing.T) {
+		f := newFixture(t, withEvents(100, time.Hour))
+		dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+		// до первого выбора под не ведет статистику слота: события учитываются, когда попадут в базу
+		feed(t, router, 2, 5, 0)
+
+		expectSlot(dbMock, banner_model.StrategyEpsilonGreedy, 0)
+		expectStats(dbMock, pgxmock.NewRows(statColumns).AddRow(2, int64(5), int64(4)).AddRow(3, int64(10), int64(1)))
+
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "2", get(t, router))
+			require.Eventually(t, func() bool {
+				return cacheLRU.Contains(key)
+			}, time.Second, 5*time.Millisecond)
+		}
+
+		require.NoError(t, dbMock.ExpectationsWereMet())
+
+		dbMock.ExpectQuery("SELECT sv.banner_id, sv.weight, st.strategy, st.epsilon, st.seed FROM slot_variants").
+			WithArgs(1, 1).
+			WillReturnRows(pgxmock.NewRows(slotVariantColumns).
+				AddRow(2, 1, String(string(banner_model.StrategyEpsilonGreedy)), Float(0), Int64(1)).
+				AddRow(3, 1, String(string(banner_model.StrategyEpsilonGreedy)), Float(0), Int64(1)))
+
+		r := httptest.NewRequest(http.MethodGet, "/variants/allocation?tag_id=1&feature_id=1", nil)
+		r.Header.Set("token", "viewer_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+
+		var allocation banner_model.SlotAllocation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &allocation))
+
+		require.Equal(t, []banner_model.VariantAllocation{
+			{BannerID: 2, Impressions: 5, Clicks: 4, CTR: 0.8, Share: 1},
+			{BannerID: 3, Impressions: 10, Clicks: 1, CTR: 0.1, Share: 0},
+		}, allocation.Variants)
+	})
+
+	t.Run("idle slot is reloaded from database", func(t *testing.T) {
+		clock := &fakeClock{now: time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)}
+		f := newFixture(t, withEvents(100, time.Hour), withClock(clock))
+		dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+		expectSlot(dbMock, banner_model.StrategyEpsilonGreedy, 0)
+		expectStats(dbMock, pgxmock.NewRows(statColumns).AddRow(2, int64(10), int64(1)))
+
+		require.Equal(t, "3", get(t, router))
+		require.Eventually(t, func() bool {
+			return cacheLRU.Contains(key)
+		}, time.Second, 5*time.Millisecond)
+
+		clock.now = clock.now.Add(time.Hour)
+
+		// статистика слота удалена из памяти и загружается заново вместе с событиями за прошедший час
+		expectStats(dbMock, pgxmock.NewRows(statColumns).AddRow(2, int64(10), int64(1)).
+			AddRow(3, int64(10), int64(5)))
+
+		require.Equal(t, "3", get(t, router))
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("failed stats load is retried after pause", func(t *testing.T) {
+		clock := &fakeClock{now: time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)}
+		f := newFixture(t, withEvents(100, time.Hour), withClock(clock))
+		dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+		expectSlot(dbMock, banner_model.StrategyEpsilonGreedy, 0)
+		dbMock.ExpectQuery("FROM banner_events WHERE feature_id = \\$1 AND tag_id = \\$2 AND created_at < \\$3").
+			WithArgs(key.FeatureID, key.TagID, pgxmock.AnyArg()).
+			WillReturnError(fmt.Errorf("connection refused"))
+
+		// без статистики из базы вариант выбирается по событиям пода
+		require.Equal(t, "2", get(t, router))
+		require.Eventually(t, func() bool {
+			return cacheLRU.Contains(key)
+		}, time.Second, 5*time.Millisecond)
+
+		clock.now = clock.now.Add(time.Second)
+		require.Equal(t, "2", get(t, router))
+		require.NoError(t, dbMock.ExpectationsWereMet())
+
+		clock.now = clock.now.Add(10 * time.Second)
+		expectStats(dbMock, pgxmock.NewRows(statColumns).AddRow(2, int64(10), int64(1)))
+
+		require.Equal(t, "3", get(t, router))
+		require.Equal(t, "3", get(t, router))
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("weights allocation is read from database", func(t *testing.T) {
+		f := newFixture(t)
+		dbMock, router := f.dbMock, f.router
+
+		dbMock.ExpectQuery("SELECT sv.banner_id, sv.weight, st.strategy, st.epsilon, st.seed FROM slot_variants").
+			WithArgs(1, 1).
+			WillReturnRows(pgxmock.NewRows(slotVariantColumns).
+				AddRow(2, 3, nil, nil, nil).
+				AddRow(3, 1, nil, nil, nil))
+		expectStats(dbMock, pgxmock.NewRows(statColumns).AddRow(2, int64(10), int64(1)))
+
+		r := httptest.NewRequest(http.MethodGet, "/variants/allocation?tag_id=1&feature_id=1", nil)
+		r.Header.Set("token", "viewer_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+
+		var allocation banner_model.SlotAllocation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &allocation))
+
+		require.Equal(t, banner_model.SlotAllocation{
+			Strategy: banner_model.StrategyWeights,
+			Variants: []banner_model.VariantAllocation{
+				{BannerID: 2, Impressions: 10, Clicks: 1, CTR: 0.1, Share: 0.75},
+				{BannerID: 3, Share: 0.25},
+			},
+		}, allocation)
+	})
+
+	t.Run("invalid event", func(t *testing.T) {
+		f := newFixture(t)
+		router := f.router
+
+		body, err := json.Marshal(banner_model.Event{Type: "view", BannerID: 2, TagID: 1, FeatureID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBuffer(body))
+		r.Header.Set("token", "tracker_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,268 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBannerBudget(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{}))
+	dbMock, router := f.dbMock, f.router
+
+	content := map[string]interface{}{"title": "paid"}
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       interface{}
+		statusCode int
+		resp       *banner_model.BannerBudget
+		mockFunc   func()
+	}{
+		{
+			name:   "insert with budget",
+			method: http.MethodPost,
+			path:   "/banner",
+			token:  "admin_token",
+			body: banner_model.BannerInsert{
+				Content:          content,
+				TagsID:           []int{1},
+				FeatureID:        1,
+				ImpressionBudget: Int64(1000),
+				IsActive:         true,
+			},
+			statusCode: http.StatusCreated,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery(`INSERT INTO banners \(is_active, active_from, active_until, schedule, frequency_cap,
+					impression_budget, budget_from, targeting, regions, priority\)`).
+					WithArgs(true, (*time.Time)(nil), (*time.Time)(nil), (*banner_model.Schedule)(nil),
+						(*banner_model.FrequencyCap)(nil), Int64(1000),
+						(*banner_model.Targeting)(nil), (*banner_model.RegionFilter)(nil), 0).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(1, 1, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "insert with zero budget",
+			method: http.MethodPost,
+			path:   "/banner",
+			token:  "admin_token",
+			body: banner_model.BannerInsert{
+				Content:          content,
+				TagsID:           []int{1},
+				FeatureID:        1,
+				ImpressionBudget: Int64(0),
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "raise budget",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body: banner_model.BannerUpdate{
+				ImpressionBudget: Int64(2000),
+			},
+			statusCode: http.StatusOK,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET impression_budget = \$1,
+					budget_from = COALESCE\(budget_from, now\(\)\), updated_at = now\(\) WHERE id = \$2`).
+					WithArgs(int64(2000), 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:       "remaining budget",
+			method:     http.MethodGet,
+			path:       "/banner/1/budget",
+			token:      "viewer_token",
+			statusCode: http.StatusOK,
+			resp:       &banner_model.BannerBudget{Budget: 1000, Spent: 250, Remaining: 750, IsActive: true},
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT b.impression_budget, b.is_active").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"impression_budget", "is_active", "count"}).
+						AddRow(int64(1000), true, int64(250)))
+			},
+		},
+		{
+			name:       "spent budget",
+			method:     http.MethodGet,
+			path:       "/banner/1/budget",
+			token:      "admin_token",
+			statusCode: http.StatusOK,
+			resp:       &banner_model.BannerBudget{Budget: 1000, Spent: 1003, Remaining: 0, IsActive: false},
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT b.impression_budget, b.is_active").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"impression_budget", "is_active", "count"}).
+						AddRow(int64(1000), false, int64(1003)))
+			},
+		},
+		{
+			name:       "no budget",
+			method:     http.MethodGet,
+			path:       "/banner/2/budget",
+			token:      "admin_token",
+			statusCode: http.StatusNotFound,
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT b.impression_budget, b.is_active").
+					WithArgs(2).
+					WillReturnError(pgx.ErrNoRows)
+			},
+		},
+		{
+			name:       "budget is hidden from users",
+			method:     http.MethodGet,
+			path:       "/banner/1/budget",
+			token:      "user_token",
+			statusCode: http.StatusForbidden,
+			mockFunc:   func() {},
+		},
+		{
+			name:       "delete budget",
+			method:     http.MethodDelete,
+			path:       "/banner/1/budget",
+			token:      "editor_token",
+			statusCode: http.StatusNoContent,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET impression_budget = NULL, budget_from = NULL,
+					updated_at = now\(\) WHERE id = \$1`).
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			var body bytes.Buffer
+			if testCase.body != nil {
+				if err := json.NewEncoder(&body).Encode(testCase.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, &body)
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			if testCase.resp == nil {
+				return
+			}
+
+			expected, err := json.Marshal(testCase.resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.JSONEq(t, string(expected), w.Body.String())
+		})
+	}
+}
+
+func TestBudgetKeeper(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, logger, bannerService := f.dbMock, f.cacheLRU, f.logger, f.service
+
+	cacheLRU.Add(banner_model.BannerKey{TagID: "1", FeatureID: "1"}, &banner_model.Banner{ID: 1, IsActive: true})
+	cacheLRU.Add(banner_model.BannerKey{TagID: "2", FeatureID: "1"}, &banner_model.Banner{ID: 1, IsActive: true})
+	cacheLRU.Add(banner_model.BannerKey{TagID: "3", FeatureID: "1"}, &banner_model.Banner{ID: 2, IsActive: true})
+
+	// первая проверка не удалась, вторую выполняет другой под, третья выключает баннер
+	dbMock.ExpectBeginTx(pgx.TxOptions{})
+	dbMock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+	dbMock.ExpectQuery("UPDATE banners b SET is_active = false").
+		WillReturnError(errors.New("connection reset"))
+	dbMock.ExpectRollback()
+
+	dbMock.ExpectBeginTx(pgx.TxOptions{})
+	dbMock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(false))
+	dbMock.ExpectRollback()
+
+	dbMock.ExpectBeginTx(pgx.TxOptions{})
+	dbMock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+	dbMock.ExpectQuery(`UPDATE banners b SET is_active = false, updated_at = now\(\) WHERE b.is_active
+		AND b.impression_budget IS NOT NULL AND b.impression_budget <=`).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
+	dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+		WithArgs(1).
+		WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1).AddRow(1, 2))
+	dbMock.ExpectExec("SELECT pg_notify").
+		WithArgs("banner_cache", `[{"tag_id":"1","feature_id":"1"},{"tag_id":"2","feature_id":"1"}]`).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	dbMock.ExpectCommit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go banner_service.NewBudgetKeeper(logger, bannerService, 10*time.Millisecond).Run(ctx)
+
+	require.Eventually(t, func() bool {
+		return dbMock.ExpectationsWereMet() == nil
+	}, time.Second, 5*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		return !cacheLRU.Contains(banner_model.BannerKey{TagID: "1", FeatureID: "1"}) &&
+			!cacheLRU.Contains(banner_model.BannerKey{TagID: "2", FeatureID: "1"})
+	}, time.Second, 5*time.Millisecond)
+
+	require.True(t, cacheLRU.Contains(banner_model.BannerKey{TagID: "3", FeatureID: "1"}))
+}
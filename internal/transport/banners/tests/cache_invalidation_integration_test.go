@@ -0,0 +1,306 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheInvalidation(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cache, router := f.dbMock, f.cache, f.router
+
+	staleContent := map[string]interface{}{"title": "stale"}
+	freshContent := map[string]interface{}{"title": "fresh"}
+	publishedContent := map[string]interface{}{"title": "published"}
+
+	expectParams := func(id, featureID int, tagIDs ...int) {
+		row := pgxmock.NewRows([]string{"feature_id", "tag_id"})
+		for _, tagID := range tagIDs {
+			row.AddRow(featureID, tagID)
+		}
+
+		dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+			WithArgs(id).
+			WillReturnRows(row)
+	}
+
+	expectNotify := func() {
+		dbMock.ExpectExec("SELECT pg_notify").
+			WithArgs("banner_cache", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	}
+
+	expectUserBanner := func(key banner_model.BannerKey, content interface{}) {
+		row := pgxmock.NewRows(userBannerColumns)
+		row.AddRow(1, 1, content, true, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
+
+		ExpectNoVariants(dbMock, key.FeatureID, key.TagID)
+		dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+			b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+			WithArgs(key.FeatureID, key.TagID, 0).
+			WillReturnRows(row)
+	}
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+
+		cached  []banner_model.BannerKey
+		readKey banner_model.BannerKey
+
+		writeStatus int
+		readStatus  int
+		readContent interface{}
+
+		mockFunc func()
+	}{
+		{
+			name:   "update content creates draft",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body:   banner_model.BannerUpdate{Content: freshContent},
+
+			cached:  []banner_model.BannerKey{{TagID: "1", FeatureID: "1"}},
+			readKey: banner_model.BannerKey{TagID: "1", FeatureID: "1"},
+
+			writeStatus: http.StatusOK,
+			readStatus:  http.StatusOK,
+			readContent: publishedContent,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, freshContent, "admin", banner_model.StatusDraft).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(2))
+				expectParams(1, 1, 1)
+				expectNotify()
+				dbMock.ExpectCommit()
+
+				expectUserBanner(banner_model.BannerKey{TagID: "1", FeatureID: "1"}, publishedContent)
+			},
+		},
+		{
+			name:   "update moves tags and feature",
+			method: http.MethodPatch,
+			path:   "/banner/2",
+			body: banner_model.BannerUpdate{
+				TagsID:    &[]int{4},
+				FeatureID: Int(3),
+			},
+
+			cached: []banner_model.BannerKey{
+				{TagID: "2", FeatureID: "2"},
+				{TagID: "4", FeatureID: "3"},
+			},
+			readKey: banner_model.BannerKey{TagID: "4", FeatureID: "3"},
+
+			writeStatus: http.StatusOK,
+			readStatus:  http.StatusOK,
+			readContent: freshContent,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners").
+					WithArgs(2).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectParams(2, 2, 2)
+				dbMock.ExpectExec("DELETE FROM features_tags_to_banners").
+					WithArgs(2).
+					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(3, 4, 2).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectNotify()
+				dbMock.ExpectCommit()
+
+				expectUserBanner(banner_model.BannerKey{TagID: "4", FeatureID: "3"}, freshContent)
+			},
+		},
+		{
+			name:   "switch version",
+			method: http.MethodPatch,
+			path:   "/banner/3/2",
+
+			cached:  []banner_model.BannerKey{{TagID: "5", FeatureID: "5"}},
+			readKey: banner_model.BannerKey{TagID: "5", FeatureID: "5"},
+
+			writeStatus: http.StatusOK,
+			readStatus:  http.StatusOK,
+			readContent: freshContent,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners").
+					WithArgs(3, 2).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectParams(3, 5, 5)
+				expectNotify()
+				dbMock.ExpectCommit()
+
+				expectUserBanner(banner_model.BannerKey{TagID: "5", FeatureID: "5"}, freshContent)
+			},
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete,
+			path:   "/banner/4",
+
+			cached:  []banner_model.BannerKey{{TagID: "6", FeatureID: "6"}},
+			readKey: banner_model.BannerKey{TagID: "6", FeatureID: "6"},
+
+			writeStatus: http.StatusNoContent,
+			readStatus:  http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				expectParams(4, 6, 6)
+				dbMock.ExpectExec("DELETE FROM banners").
+					WithArgs(4).
+					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				expectNotify()
+				dbMock.ExpectCommit()
+
+				ExpectNoVariants(dbMock, "6", "6")
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs("6", "6", 0).
+					WillReturnError(pgx.ErrNoRows)
+				ExpectNoDefaults(dbMock, "6")
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			for _, key := range testCase.cached {
+				if _, err := cache.Add(context.Background(), key, &banner_model.Banner{
+					ID:       1,
+					Content:  staleContent,
+					IsActive: true,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			testCase.mockFunc()
+
+			var body []byte
+			if testCase.body != nil {
+				var err error
+				body, err = json.Marshal(testCase.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", "admin_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.writeStatus, w.Code)
+
+			for _, key := range testCase.cached {
+				_, ok, err := cache.Get(context.Background(), key)
+				require.NoError(t, err)
+				require.False(t, ok)
+			}
+
+			r = httptest.NewRequest(http.MethodGet, "/user_banner?tag_id="+testCase.readKey.TagID+
+				"&feature_id="+testCase.readKey.FeatureID, nil)
+			r.Header.Set("token", "user_token")
+
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.readStatus, w.Code)
+
+			if testCase.readContent != nil {
+				expected, err := json.Marshal(testCase.readContent)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				require.Equal(t, string(expected), string(data))
+			}
+
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCacheInvalidationDeleteByTag(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cache, router := f.dbMock, f.cache, f.router
+
+	keys := []banner_model.BannerKey{
+		{TagID: "1", FeatureID: "1"},
+		{TagID: "2", FeatureID: "1"},
+	}
+
+	for _, key := range keys {
+		if _, err := cache.Add(context.Background(), key, &banner_model.Banner{ID: 1, IsActive: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbMock.ExpectBeginTx(pgx.TxOptions{})
+	dbMock.ExpectQuery("SELECT banner_id FROM features_tags_to_banners").
+		WithArgs(1).
+		WillReturnRows(pgxmock.NewRows([]string{"banner_id"}).AddRow(1))
+	dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+		WithArgs(1).
+		WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1).AddRow(1, 2))
+	dbMock.ExpectExec("DELETE FROM banners").
+		WithArgs(1).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	dbMock.ExpectExec("SELECT pg_notify").
+		WithArgs("banner_cache", `[{"tag_id":"1","feature_id":"1"},{"tag_id":"2","feature_id":"1"}]`).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	dbMock.ExpectCommit()
+
+	r := httptest.NewRequest(http.MethodDelete, "/banner?tag_id=1", nil)
+	r.Header.Set("token", "admin_token")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	require.Eventually(t, func() bool {
+		for _, key := range keys {
+			if _, ok, _ := cache.Get(context.Background(), key); ok {
+				return false
+			}
+		}
+
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, dbMock.ExpectationsWereMet())
+}
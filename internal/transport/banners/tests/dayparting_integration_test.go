@@ -0,0 +1,339 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func TestBannerDayparting(t *testing.T) {
+	clock := &fakeClock{}
+	f := newFixture(t, withClock(clock))
+	dbMock, cacheLRU, cache, router := f.dbMock, f.cacheLRU, f.cache, f.router
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := map[string]interface{}{"title": "daypart"}
+	workHours := &banner_model.Schedule{
+		Timezone: "Europe/Moscow",
+		Days:     []int{1, 2, 3, 4, 5},
+		Ranges:   []banner_model.TimeRange{{From: "09:00", To: "18:00"}},
+	}
+	fridayNight := &banner_model.Schedule{
+		Timezone: "Europe/Moscow",
+		Days:     []int{5},
+		Ranges:   []banner_model.TimeRange{{From: "22:00", To: "02:00"}},
+	}
+
+	workKey := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+	nightKey := banner_model.BannerKey{TagID: "2", FeatureID: "2"}
+
+	// 2024-04-15 - понедельник
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2024, 4, 15, hour, minute, 0, 0, moscow)
+	}
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+		now    time.Time
+
+		statusCode int
+		err        error
+
+		mockFunc func()
+	}{
+		{
+			name:   "inside working hours",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1",
+			token:  "user_token",
+			now:    monday(10, 0),
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "before working hours",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1",
+			token:  "user_token",
+			now:    monday(8, 59),
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				ExpectNoDefaults(dbMock, "1")
+			},
+		},
+		{
+			name:   "end of range is excluded",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1",
+			token:  "user_token",
+			now:    monday(18, 0),
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				ExpectNoDefaults(dbMock, "1")
+			},
+		},
+		{
+			name:   "timezone is applied",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1",
+			token:  "user_token",
+			now:    time.Date(2024, 4, 15, 6, 30, 0, 0, time.UTC),
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "weekend",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1",
+			token:  "user_token",
+			now:    monday(10, 0).AddDate(0, 0, 5),
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				ExpectNoDefaults(dbMock, "1")
+			},
+		},
+		{
+			name:   "weekend for admin",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1",
+			token:  "admin_token",
+			now:    monday(10, 0).AddDate(0, 0, 5),
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "overnight range after midnight",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=2&feature_id=2",
+			token:  "user_token",
+			now:    monday(1, 0).AddDate(0, 0, 5),
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "overnight range on wrong day",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=2&feature_id=2",
+			token:  "user_token",
+			now:    monday(23, 0).AddDate(0, 0, 5),
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				ExpectNoDefaults(dbMock, "2")
+			},
+		},
+		{
+			name:   "insert with unknown timezone",
+			method: http.MethodPost,
+			path:   "/banner",
+			token:  "admin_token",
+			body: banner_model.BannerInsert{
+				TagsID:    []int{3},
+				FeatureID: 3,
+				Content:   content,
+				Schedule: &banner_model.Schedule{
+					Timezone: "Mars/Olympus",
+					Ranges:   []banner_model.TimeRange{{From: "09:00", To: "18:00"}},
+				},
+			},
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf(`bad schedule: unknown timezone "Mars/Olympus"`),
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "update with bad day",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body: banner_model.BannerUpdate{
+				Schedule: &banner_model.Schedule{
+					Timezone: "Europe/Moscow",
+					Days:     []int{0},
+					Ranges:   []banner_model.TimeRange{{From: "09:00", To: "18:00"}},
+				},
+			},
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf("bad schedule: day 0 must be from 1 to 7"),
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "set schedule",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body:   banner_model.BannerUpdate{Schedule: workHours},
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET schedule = \$1, updated_at = now\(\) WHERE id = \$2`).
+					WithArgs(workHours, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "clear schedule",
+			method: http.MethodDelete,
+			path:   "/banner/1/schedule",
+			token:  "admin_token",
+
+			statusCode: http.StatusNoContent,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET schedule = NULL").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "clear schedule not found",
+			method: http.MethodDelete,
+			path:   "/banner/9/schedule",
+			token:  "admin_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET schedule = NULL").
+					WithArgs(9).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "clear schedule forbidden",
+			method: http.MethodDelete,
+			path:   "/banner/1/schedule",
+			token:  "user_token",
+
+			statusCode: http.StatusForbidden,
+
+			mockFunc: func() {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheLRU.Purge()
+
+			for key, schedule := range map[banner_model.BannerKey]*banner_model.Schedule{
+				workKey:  workHours,
+				nightKey: fridayNight,
+			} {
+				if _, err := cache.Add(context.Background(), key, &banner_model.Banner{
+					ID:       1,
+					Content:  content,
+					IsActive: true,
+					Schedule: schedule,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			clock.now = testCase.now
+
+			testCase.mockFunc()
+
+			var body []byte
+			if testCase.body != nil {
+				body, err = json.Marshal(testCase.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			if testCase.err != nil {
+				expected, err := json.Marshal(struct {
+					Err string `json:"error"`
+				}{
+					Err: testCase.err.Error(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				require.Equal(t, string(expected), string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// ExpectNoDefaults ожидает поиск баннера по умолчанию фичи featureID и общего баннера по умолчанию,
+// которых нет
+func ExpectNoDefaults(dbMock pgxmock.PgxPoolIface, featureID string) {
+	dbMock.ExpectQuery("FROM default_banners d").
+		WithArgs(&featureID).
+		WillReturnRows(pgxmock.NewRows(userBannerColumns))
+	dbMock.ExpectQuery("FROM default_banners d").
+		WithArgs((*string)(nil)).
+		WillReturnRows(pgxmock.NewRows(userBannerColumns))
+}
+
+func TestDefaultBannerFallback(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}),
+		withMissingCache(time.Minute))
+	dbMock, cacheLRU, missingLRU, router := f.dbMock, f.cacheLRU, f.missingLRU, f.router
+
+	bannerRow := func(id int, isActive bool) *pgxmock.Rows {
+		return pgxmock.NewRows(userBannerColumns).AddRow(id, 1, map[string]interface{}{"id": id}, isActive, nil, nil,
+			nil, nil, nil, 0, nil, nil, nil, 0, nil)
+	}
+
+	expectSlot := func(featureID, tagID string, rows *pgxmock.Rows) {
+		ExpectNoVariants(dbMock, featureID, tagID)
+		dbMock.ExpectQuery("FROM banners b JOIN features_tags_to_banners ftb").
+			WithArgs(featureID, tagID, 0).
+			WillReturnRows(rows)
+	}
+
+	expectDefault := func(featureID *string, rows *pgxmock.Rows) {
+		dbMock.ExpectQuery(`FROM default_banners d .* WHERE d.feature_id IS NOT DISTINCT FROM \$1`).
+			WithArgs(featureID).
+			WillReturnRows(rows)
+	}
+
+	get := func(query string) (int, string, string) {
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?"+query, nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w.Code, w.Header().Get(banner_model.MatchHeader), w.Header().Get(banner_model.BannerIDHeader)
+	}
+
+	// у тега нет баннера, показывается баннер по умолчанию фичи
+	expectSlot("1", "1", pgxmock.NewRows(userBannerColumns))
+	expectDefault(String("1"), bannerRow(5, true))
+
+	status, match, id := get("tag_id=1&feature_id=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "feature", match)
+	require.Equal(t, "5", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// отсутствие баннера у тега запоминается, но баннер по умолчанию все равно кэшируется
+	require.Eventually(t, func() bool {
+		return missingLRU.Contains(banner_model.BannerKey{TagID: "1", FeatureID: "1"}) &&
+			cacheLRU.Contains(banner_model.DefaultKey("1"))
+	}, time.Second, 5*time.Millisecond)
+
+	status, match, id = get("tag_id=1&feature_id=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "feature", match)
+	require.Equal(t, "5", id)
+
+	// баннер по умолчанию фичи общий для всех ее тегов
+	expectSlot("1", "2", pgxmock.NewRows(userBannerColumns))
+
+	status, match, id = get("tag_id=2&feature_id=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "feature", match)
+	require.Equal(t, "5", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// у фичи нет баннера по умолчанию, показывается общий
+	expectSlot("2", "1", pgxmock.NewRows(userBannerColumns))
+	expectDefault(String("2"), pgxmock.NewRows(userBannerColumns))
+	expectDefault(nil, bannerRow(9, true))
+
+	status, match, id = get("tag_id=1&feature_id=2")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "global", match)
+	require.Equal(t, "9", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	require.Eventually(t, func() bool {
+		return cacheLRU.Contains(banner_model.DefaultKey(""))
+	}, time.Second, 5*time.Millisecond)
+
+	// выключенный баннер по умолчанию фичи уступает общему
+	expectSlot("3", "1", pgxmock.NewRows(userBannerColumns))
+	expectDefault(String("3"), bannerRow(6, false))
+
+	status, match, id = get("tag_id=1&feature_id=3")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "global", match)
+	require.Equal(t, "9", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// баннер тега важнее баннеров по умолчанию
+	expectSlot("1", "3", bannerRow(3, true))
+
+	status, match, id = get("tag_id=3&feature_id=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "tag", match)
+	require.Equal(t, "3", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// конкретная версия баннеры по умолчанию не ищет
+	dbMock.ExpectQuery("FROM banners b JOIN features_tags_to_banners ftb").
+		WithArgs("4", "1", 1).
+		WillReturnRows(pgxmock.NewRows(userBannerColumns))
+
+	status, _, _ = get("tag_id=1&feature_id=4&version=1")
+	require.Equal(t, http.StatusNotFound, status)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDefaultBanners(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}),
+		withMissingCache(time.Minute))
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	expectNotify := func(payload string) {
+		dbMock.ExpectExec("SELECT pg_notify").
+			WithArgs("banner_cache", payload).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	}
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       interface{}
+		statusCode int
+		response   string
+		cached     banner_model.BannerKey
+		mockFunc   func()
+	}{
+		{
+			name:   "set feature default",
+			method: http.MethodPut,
+			path:   "/default_banner",
+			token:  "admin_token",
+			body:   banner_model.DefaultBanner{FeatureID: Int(1), BannerID: 5},
+
+			statusCode: http.StatusOK,
+			cached:     banner_model.DefaultKey("1"),
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("INSERT INTO default_banners").
+					WithArgs(Int(1), 5).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectNotify(`[{"tag_id":"","feature_id":"1"}]`)
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "set global default",
+			method: http.MethodPut,
+			path:   "/default_banner",
+			token:  "editor_token",
+			body:   banner_model.DefaultBanner{BannerID: 9},
+
+			statusCode: http.StatusOK,
+			cached:     banner_model.DefaultKey(""),
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("INSERT INTO default_banners").
+					WithArgs((*int)(nil), 9).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectNotify(`[{"tag_id":"","feature_id":""}]`)
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "unknown banner",
+			method: http.MethodPut,
+			path:   "/default_banner",
+			token:  "admin_token",
+			body:   banner_model.DefaultBanner{FeatureID: Int(1), BannerID: 100},
+
+			statusCode: http.StatusBadRequest,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("INSERT INTO default_banners").
+					WithArgs(Int(1), 100).
+					WillReturnError(&pgconn.PgError{Code: "23503"})
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "bad feature",
+			method: http.MethodPut,
+			path:   "/default_banner",
+			token:  "admin_token",
+			body:   banner_model.DefaultBanner{FeatureID: Int(0), BannerID: 5},
+
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "viewer can not set default",
+			method: http.MethodPut,
+			path:   "/default_banner",
+			token:  "viewer_token",
+			body:   banner_model.DefaultBanner{BannerID: 5},
+
+			statusCode: http.StatusForbidden,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "get defaults",
+			method: http.MethodGet,
+			path:   "/default_banner",
+			token:  "viewer_token",
+
+			statusCode: http.StatusOK,
+			response:   `[{"banner_id": 9}, {"feature_id": 1, "banner_id": 5}]`,
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT feature_id, banner_id FROM default_banners").
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "banner_id"}).
+						AddRow(nil, 9).
+						AddRow(Int(1), 5))
+			},
+		},
+		{
+			name:   "delete feature default",
+			method: http.MethodDelete,
+			path:   "/default_banner?feature_id=1",
+			token:  "admin_token",
+
+			statusCode: http.StatusNoContent,
+			cached:     banner_model.DefaultKey("1"),
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM default_banners").
+					WithArgs(Int(1)).
+					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				expectNotify(`[{"tag_id":"","feature_id":"1"}]`)
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "delete missing global default",
+			method: http.MethodDelete,
+			path:   "/default_banner",
+			token:  "admin_token",
+
+			statusCode: http.StatusNotFound,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM default_banners").
+					WithArgs((*int)(nil)).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "delete bad feature",
+			method: http.MethodDelete,
+			path:   "/default_banner?feature_id=-1",
+			token:  "admin_token",
+
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "update of default banner drops fallback",
+			method: http.MethodPatch,
+			path:   "/banner/5",
+			token:  "admin_token",
+			body:   banner_model.BannerUpdate{Priority: Int(1)},
+
+			statusCode: http.StatusOK,
+			cached:     banner_model.DefaultKey("1"),
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET priority").
+					WithArgs(1, 5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners .* FROM default_banners").
+					WithArgs(5).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).
+						AddRow(1, 2).
+						AddRow(1, 0).
+						AddRow(0, 0))
+				expectNotify(`[{"tag_id":"2","feature_id":"1"},{"tag_id":"","feature_id":"1"},` +
+					`{"tag_id":"","feature_id":""}]`)
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "tags of default-only banner without feature",
+			method: http.MethodPatch,
+			path:   "/banner/5",
+			token:  "admin_token",
+			body:   banner_model.BannerUpdate{TagsID: &[]int{2}},
+
+			statusCode: http.StatusBadRequest,
+			cached:     banner_model.DefaultKey("1"),
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET updated_at").
+					WithArgs(5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners .* FROM default_banners").
+					WithArgs(5).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 0))
+				dbMock.ExpectExec("DELETE FROM features_tags_to_banners").
+					WithArgs(5).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "feature of default-only banner without tags",
+			method: http.MethodPatch,
+			path:   "/banner/5",
+			token:  "admin_token",
+			body:   banner_model.BannerUpdate{FeatureID: Int(2)},
+
+			statusCode: http.StatusBadRequest,
+			cached:     banner_model.DefaultKey("1"),
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET updated_at").
+					WithArgs(5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners .* FROM default_banners").
+					WithArgs(5).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 0))
+				dbMock.ExpectExec("DELETE FROM features_tags_to_banners").
+					WithArgs(5).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "default-only banner gets a slot",
+			method: http.MethodPatch,
+			path:   "/banner/5",
+			token:  "admin_token",
+			body:   banner_model.BannerUpdate{FeatureID: Int(2), TagsID: &[]int{3}},
+
+			statusCode: http.StatusOK,
+			cached:     banner_model.DefaultKey("1"),
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET updated_at").
+					WithArgs(5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners .* FROM default_banners").
+					WithArgs(5).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 0))
+				dbMock.ExpectExec("DELETE FROM features_tags_to_banners").
+					WithArgs(5).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(2, 3, 5).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectNotify(`[{"tag_id":"","feature_id":"1"},{"tag_id":"3","feature_id":"2"}]`)
+				dbMock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.method != http.MethodGet {
+				cacheLRU.Add(testCase.cached, &banner_model.Banner{ID: 1})
+			}
+
+			testCase.mockFunc()
+
+			var body bytes.Buffer
+			if testCase.body != nil {
+				if err := json.NewEncoder(&body).Encode(testCase.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, &body)
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			if testCase.response != "" {
+				require.JSONEq(t, testCase.response, w.Body.String())
+			}
+
+			if testCase.method != http.MethodGet && w.Code < http.StatusBadRequest {
+				require.False(t, cacheLRU.Contains(testCase.cached))
+			}
+		})
+	}
+}
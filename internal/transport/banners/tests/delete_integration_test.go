@@ -4,56 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
-	"time"
-
-	banner_model "github.com/Heatdog/Avito/internal/models/banner"
-	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
-	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
-	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
-	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
-	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
-	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
-	"github.com/gorilla/mux"
-	"github.com/hashicorp/golang-lru/v2/expirable"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/require"
 )
 
 func TestDeleteBanner(t *testing.T) {
-	dbMock, err := pgxmock.NewPool()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbMock.Close()
-
-	opt := &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelError,
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
-	slog.SetDefault(logger)
-
-	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil,
-		time.Minute*time.Duration(5))
-	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
-
-	tokenProvider := simpletoken.NewSimpleTokenProvider()
-
-	logger.Debug("register middlewre")
-	middleware := middleware_transport.NewMiddleware(logger, tokenProvider)
-
-	bannerRepo := banner_postgre.NewBannerRepository(logger, dbMock)
-	bannerService := banner_service.NewBannerService(logger, bannerRepo, cache, tokenProvider)
-	bannerHandler := banners_transport.NewBannersHandler(logger, bannerService, middleware)
-	router := mux.NewRouter()
-
-	bannerHandler.Register(router)
+	f := newFixture(t)
+	dbMock, router := f.dbMock, f.router
 
 	type mockBehavior func(id int, err error)
 
@@ -82,9 +44,20 @@ func TestDeleteBanner(t *testing.T) {
 				dbMock.ExpectBeginTx(pgx.TxOptions{})
 				defer dbMock.ExpectCommit()
 
+				row := pgxmock.NewRows([]string{"feature_id", "tag_id"})
+				row.AddRow(1, 2)
+
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(id).
+					WillReturnRows(row)
+
 				dbMock.ExpectExec("DELETE FROM banners").
 					WithArgs(id).
 					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
 			},
 		},
 		{
@@ -122,6 +95,10 @@ func TestDeleteBanner(t *testing.T) {
 				dbMock.ExpectBeginTx(pgx.TxOptions{})
 				defer dbMock.ExpectCommit()
 
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(id).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}))
+
 				dbMock.ExpectExec("DELETE FROM banners").
 					WithArgs(id).
 					WillReturnResult(pgxmock.NewResult("DELETE", 0))
@@ -140,6 +117,10 @@ func TestDeleteBanner(t *testing.T) {
 				dbMock.ExpectBeginTx(pgx.TxOptions{})
 				defer dbMock.ExpectRollback()
 
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(id).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 2))
+
 				dbMock.ExpectExec("DELETE FROM banners").
 					WithArgs(id).
 					WillReturnError(err)
@@ -0,0 +1,172 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBannerEvents(t *testing.T) {
+	f := newFixture(t, withEvents(2, time.Hour))
+	dbMock, router, recorder := f.dbMock, f.router, f.events
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go recorder.Run(ctx)
+
+	post := func(t *testing.T, token string, event banner_model.Event) int {
+		body, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBuffer(body))
+		r.Header.Set("token", token)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	event := banner_model.Event{Type: banner_model.EventImpression, BannerID: 1, Version: 2, TagID: 1,
+		FeatureID: 1, UserID: "u1"}
+
+	t.Run("events are written in batches", func(t *testing.T) {
+		dbMock.ExpectCopyFrom(pgx.Identifier{"banner_events"},
+			[]string{"banner_id", "version", "tag_id", "feature_id", "user_id", "type", "created_at"}).
+			WillReturnResult(2)
+
+		require.Equal(t, http.StatusAccepted, post(t, "tracker_token", event))
+
+		event.Type = banner_model.EventClick
+		require.Equal(t, http.StatusAccepted, post(t, "tracker_token", event))
+
+		require.Eventually(t, func() bool {
+			return dbMock.ExpectationsWereMet() == nil
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("invalid events", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, post(t, "tracker_token", banner_model.Event{Type: "view", BannerID: 1,
+			TagID: 1, FeatureID: 1}))
+		require.Equal(t, http.StatusBadRequest, post(t, "tracker_token", banner_model.Event{
+			Type: banner_model.EventClick, TagID: 1, FeatureID: 1}))
+		require.Equal(t, http.StatusUnauthorized, post(t, "", event))
+		require.Equal(t, http.StatusForbidden, post(t, "user_token", event))
+	})
+
+	t.Run("full buffer", func(t *testing.T) {
+		// запись в базу не запущена, поэтому буфер заполняется и следующее событие не принимается
+		f := newFixture(t, withEvents(1, time.Hour))
+
+		post := func() *httptest.ResponseRecorder {
+			body, err := json.Marshal(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBuffer(body))
+			r.Header.Set("token", "tracker_token")
+
+			w := httptest.NewRecorder()
+			f.router.ServeHTTP(w, r)
+
+			return w
+		}
+
+		for {
+			w := post()
+			if w.Code == http.StatusAccepted {
+				continue
+			}
+
+			require.Equal(t, http.StatusServiceUnavailable, w.Code)
+			require.Equal(t, "1", w.Header().Get("Retry-After"))
+
+			break
+		}
+	})
+
+	testTable := []struct {
+		name       string
+		token      string
+		statusCode int
+		resp       []banner_model.BannerStat
+		mockFunc   func()
+	}{
+		{
+			name:       "stats by day and version",
+			token:      "viewer_token",
+			statusCode: http.StatusOK,
+			resp: []banner_model.BannerStat{
+				{Day: "2024-05-02", Version: 2, Impressions: 10, Clicks: 3},
+				{Day: "2024-05-01", Version: 2, Impressions: 4, Clicks: 0},
+				{Day: "2024-05-01", Version: 1, Impressions: 7, Clicks: 1},
+			},
+			mockFunc: func() {
+				rows := pgxmock.NewRows([]string{"day", "version", "impressions", "clicks"}).
+					AddRow(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), 2, int64(10), int64(3)).
+					AddRow(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), 2, int64(4), int64(0)).
+					AddRow(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), 1, int64(7), int64(1))
+
+				dbMock.ExpectQuery("FROM banner_events WHERE banner_id = \\$1 GROUP BY day, version").
+					WithArgs(1).
+					WillReturnRows(rows)
+			},
+		},
+		{
+			name:       "no events",
+			token:      "admin_token",
+			statusCode: http.StatusOK,
+			resp:       []banner_model.BannerStat{},
+			mockFunc: func() {
+				dbMock.ExpectQuery("FROM banner_events").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"day", "version", "impressions", "clicks"}))
+			},
+		},
+		{
+			name:       "forbidden",
+			token:      "user_token",
+			statusCode: http.StatusForbidden,
+			mockFunc:   func() {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			r := httptest.NewRequest(http.MethodGet, "/banner/1/stats", nil)
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			if testCase.resp == nil {
+				return
+			}
+
+			expected, err := json.Marshal(testCase.resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, string(expected), w.Body.String())
+		})
+	}
+}
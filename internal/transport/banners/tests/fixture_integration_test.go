@@ -0,0 +1,216 @@
+package banner_handler_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	banner_repository "github.com/Heatdog/Avito/internal/repository/banner"
+	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
+	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
+	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
+	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
+	"github.com/Heatdog/Avito/pkg/cache"
+	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
+	nopcache "github.com/Heatdog/Avito/pkg/cache/nop"
+	"github.com/Heatdog/Avito/pkg/clock"
+	"github.com/Heatdog/Avito/pkg/counter"
+	"github.com/Heatdog/Avito/pkg/token"
+	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// fixture - роутер сервиса баннеров поверх pgxmock. По умолчанию баннеры кэшируются в cacheLRU,
+// отсутствующие баннеры не запоминаются, время системное, авторизация простыми токенами
+// с именем роли в качестве субъекта
+type fixture struct {
+	dbMock     pgxmock.PgxPoolIface
+	logger     *slog.Logger
+	repo       banner_repository.BannerRepository
+	cacheLRU   *expirable.LRU[banner_model.BannerKey, *banner_model.Banner]
+	missingLRU *expirable.LRU[banner_model.BannerKey, struct{}]
+	cache      cache.Cache[banner_model.BannerKey, *banner_model.Banner]
+	missing    cache.Cache[banner_model.BannerKey, struct{}]
+	events     *banner_service.EventRecorder
+	tags       *banner_service.TagTree
+	generation *banner_service.CacheGeneration
+	service    banner_service.BannerService
+	router     *mux.Router
+}
+
+type fixtureConfig struct {
+	dbMock      pgxmock.PgxPoolIface
+	cache       cache.Cache[banner_model.BannerKey, *banner_model.Banner]
+	clock       clock.Clock
+	impressions counter.Counter
+	provider    token.Provider
+	tagRows     *pgxmock.Rows
+	missingTTL  time.Duration
+	batchSize   int
+	flush       time.Duration
+	retention   int
+}
+
+type fixtureOption func(cfg *fixtureConfig)
+
+// withDB подключает сервис к базе другого фикстура, например, чтобы получить второй под
+func withDB(dbMock pgxmock.PgxPoolIface) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.dbMock = dbMock
+	}
+}
+
+// withCache заменяет кэш баннеров, cacheLRU при этом не используется
+func withCache(cache cache.Cache[banner_model.BannerKey, *banner_model.Banner]) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.cache = cache
+	}
+}
+
+// withMissingCache запоминает отсутствующие баннеры в missingLRU на ttl
+func withMissingCache(ttl time.Duration) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.missingTTL = ttl
+	}
+}
+
+func withClock(clock clock.Clock) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.clock = clock
+	}
+}
+
+func withTokenProvider(provider token.Provider) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.provider = provider
+	}
+}
+
+// withEvents задает размер пачки и период записи событий в базу
+func withEvents(batchSize int, flush time.Duration) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.batchSize = batchSize
+		cfg.flush = flush
+	}
+}
+
+func withRetention(retention int) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.retention = retention
+	}
+}
+
+// withTagTree загружает дерево тегов из rows до создания сервиса
+func withTagTree(rows *pgxmock.Rows) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.tagRows = rows
+	}
+}
+
+// withImpressions задает счетчик показов, по умолчанию показы считаются в памяти по часам фикстура
+func withImpressions(impressions counter.Counter) fixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.impressions = impressions
+	}
+}
+
+// personalTokens - простые токены, у каждого из которых есть владелец: субъект совпадает с именем роли
+type personalTokens struct {
+	token.Provider
+}
+
+func (provider personalTokens) VerifyToken(tokenStr string) (token.Identity, bool) {
+	identity, ok := provider.Provider.VerifyToken(tokenStr)
+	identity.Subject = string(identity.Role)
+
+	return identity, ok
+}
+
+func newFixture(t *testing.T, opts ...fixtureOption) *fixture {
+	t.Helper()
+
+	cfg := fixtureConfig{
+		clock:     clock.NewRealClock(),
+		provider:  personalTokens{Provider: simpletoken.NewSimpleTokenProvider()},
+		batchSize: 1,
+		flush:     time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	res := &fixture{dbMock: cfg.dbMock}
+
+	if res.dbMock == nil {
+		dbMock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(dbMock.Close)
+
+		res.dbMock = dbMock
+	}
+
+	opt := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelError,
+	}
+	res.logger = slog.New(slog.NewJSONHandler(os.Stdout, opt))
+	slog.SetDefault(res.logger)
+
+	res.cacheLRU = expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil, 5*time.Minute)
+	res.missingLRU = expirable.NewLRU[banner_model.BannerKey, struct{}](0, nil, cfg.missingTTL)
+
+	res.repo = banner_postgre.NewBannerRepository(res.logger, res.dbMock, cfg.retention)
+	res.events = banner_service.NewEventRecorder(res.logger, res.repo, cfg.batchSize, cfg.flush)
+	res.generation = banner_service.NewCacheGeneration()
+
+	if cfg.tagRows != nil {
+		res.dbMock.ExpectQuery("SELECT id, COALESCE\\(name, ''\\), parent_id FROM tags").
+			WillReturnRows(cfg.tagRows)
+
+		res.tags = banner_service.NewTagTree(res.logger, res.repo)
+		require.NoError(t, res.tags.Reload(context.Background()))
+		require.NoError(t, res.dbMock.ExpectationsWereMet())
+	}
+
+	deps := banner_service.Deps{
+		Logger:      res.logger,
+		Repo:        res.repo,
+		Cache:       cfg.cache,
+		Clock:       cfg.clock,
+		Events:      res.events,
+		Impressions: cfg.impressions,
+		Tags:        res.tags,
+		Generation:  res.generation,
+	}
+
+	if deps.Cache == nil {
+		deps.Cache = hashicorp_lru.NewLRU(res.logger, res.cacheLRU)
+	}
+
+	if cfg.missingTTL > 0 {
+		deps.Missing = hashicorp_lru.NewLRU(res.logger, res.missingLRU)
+	} else {
+		deps.Missing = nopcache.NewNopCache[banner_model.BannerKey, struct{}]()
+	}
+
+	res.cache, res.missing = deps.Cache, deps.Missing
+
+	res.service = banner_service.NewBannerService(deps)
+
+	middleware := middleware_transport.NewMiddleware(res.logger, cfg.provider)
+	res.router = mux.NewRouter()
+
+	banners_transport.NewBannersHandler(res.logger, res.service, middleware).Register(res.router)
+
+	return res
+}
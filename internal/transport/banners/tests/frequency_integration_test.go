@@ -0,0 +1,290 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	rediscounter "github.com/Heatdog/Avito/pkg/counter/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func getCappedBanner(t *testing.T, router *mux.Router, token, userID string) (int, string) {
+	r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=1&feature_id=1&user_id="+userID, nil)
+	r.Header.Set("token", token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	return w.Code, w.Body.String()
+}
+
+// postImpression сообщает о показе баннера bannerID пользователю userID
+func postImpression(t *testing.T, router *mux.Router, bannerID int, userID string) {
+	body, err := json.Marshal(banner_model.Event{Type: banner_model.EventImpression, BannerID: bannerID, Version: 1,
+		TagID: 1, FeatureID: 1, UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBuffer(body))
+	r.Header.Set("token", "tracker_token")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusAccepted, w.Code)
+}
+
+func TestFrequencyCap(t *testing.T) {
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+	content := map[string]interface{}{"title": "promo"}
+	fallback := map[string]interface{}{"title": "regular"}
+
+	t.Run("cap is counted per user and window", func(t *testing.T) {
+		clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+		f := newFixture(t, withClock(clock), withEvents(100, time.Hour))
+		dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+		cacheLRU.Add(key, &banner_model.Banner{ID: 1, Content: content, IsActive: true,
+			FrequencyCap: &banner_model.FrequencyCap{Limit: 2, WindowSeconds: 3600}})
+
+		// shown - клиент показал полученный баннер и сообщил об этом событием impression
+		steps := []struct {
+			name    string
+			token   string
+			userID  string
+			advance time.Duration
+			status  int
+			shown   bool
+		}{
+			{name: "first impression", token: "user_token", userID: "u1", status: http.StatusOK, shown: true},
+			{name: "banner not shown", token: "user_token", userID: "u1", status: http.StatusOK},
+			{name: "second impression", token: "user_token", userID: "u1", status: http.StatusOK, shown: true},
+			{name: "cap reached", token: "user_token", userID: "u1", status: http.StatusNotFound},
+			{name: "other user", token: "user_token", userID: "u2", status: http.StatusOK, shown: true},
+			{name: "anonymous request", token: "user_token", status: http.StatusOK},
+			{name: "admin is not capped", token: "admin_token", userID: "u1", status: http.StatusOK},
+			{name: "still capped", token: "user_token", userID: "u1", advance: 59 * time.Minute,
+				status: http.StatusNotFound},
+			{name: "window expired", token: "user_token", userID: "u1", advance: time.Minute,
+				status: http.StatusOK},
+		}
+
+		for _, step := range steps {
+			clock.now = clock.now.Add(step.advance)
+
+			if step.status == http.StatusNotFound {
+				ExpectNoDefaults(dbMock, key.FeatureID)
+			}
+
+			status, _ := getCappedBanner(t, router, step.token, step.userID)
+			require.Equal(t, step.status, status, step.name)
+
+			if step.shown {
+				postImpression(t, router, 1, step.userID)
+			}
+		}
+
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("fallback after cap", func(t *testing.T) {
+		clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+		f := newFixture(t, withClock(clock), withEvents(100, time.Hour))
+		cacheLRU, router := f.cacheLRU, f.router
+
+		cacheLRU.Add(key, &banner_model.Banner{ID: 1, Content: content, IsActive: true,
+			FrequencyCap: &banner_model.FrequencyCap{Limit: 1, WindowSeconds: 60, Fallback: fallback}})
+
+		expected, err := json.Marshal(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectedFallback, err := json.Marshal(fallback)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		status, body := getCappedBanner(t, router, "user_token", "u1")
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, string(expected), body)
+
+		postImpression(t, router, 1, "u1")
+
+		status, body = getCappedBanner(t, router, "user_token", "u1")
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, string(expectedFallback), body)
+	})
+
+	t.Run("redis counter", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+
+		redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+		defer redisClient.Close()
+
+		clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+		f := newFixture(t, withClock(clock), withEvents(100, time.Hour),
+			withImpressions(rediscounter.NewRedisCounter(slog.Default(), redisClient, "frequency:")))
+		dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+		cacheLRU.Add(key, &banner_model.Banner{ID: 1, Content: content, IsActive: true,
+			FrequencyCap: &banner_model.FrequencyCap{Limit: 1, WindowSeconds: 60}})
+
+		// показ баннера без ограничения не создает счетчик
+		postImpression(t, router, 1, "u2")
+		require.False(t, redisServer.Exists("frequency:1:u2"))
+
+		status, _ := getCappedBanner(t, router, "user_token", "u1")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, time.Minute, redisServer.TTL("frequency:1:u1"))
+
+		// повторная выдача без показа не расходует лимит
+		status, _ = getCappedBanner(t, router, "user_token", "u1")
+		require.Equal(t, http.StatusOK, status)
+
+		redisServer.FastForward(30 * time.Second)
+		postImpression(t, router, 1, "u1")
+		require.Equal(t, 30*time.Second, redisServer.TTL("frequency:1:u1"))
+
+		ExpectNoDefaults(dbMock, key.FeatureID)
+
+		status, _ = getCappedBanner(t, router, "user_token", "u1")
+		require.Equal(t, http.StatusNotFound, status)
+		require.Equal(t, 30*time.Second, redisServer.TTL("frequency:1:u1"))
+
+		redisServer.FastForward(30 * time.Second)
+
+		status, _ = getCappedBanner(t, router, "user_token", "u1")
+		require.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("counter unavailable", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+
+		redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+		defer redisClient.Close()
+
+		f := newFixture(t, withClock(&fakeClock{}), withEvents(100, time.Hour),
+			withImpressions(rediscounter.NewRedisCounter(slog.Default(), redisClient, "frequency:")))
+		cacheLRU, router := f.cacheLRU, f.router
+
+		cacheLRU.Add(key, &banner_model.Banner{ID: 1, Content: content, IsActive: true,
+			FrequencyCap: &banner_model.FrequencyCap{Limit: 1, WindowSeconds: 60}})
+
+		redisServer.SetError("LOADING")
+
+		for i := 0; i < 2; i++ {
+			status, _ := getCappedBanner(t, router, "user_token", "u1")
+			require.Equal(t, http.StatusOK, status)
+
+			postImpression(t, router, 1, "u1")
+		}
+	})
+}
+
+func TestFrequencyCapSettings(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{}))
+	dbMock, router := f.dbMock, f.router
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		statusCode int
+		mockFunc   func()
+	}{
+		{
+			name:   "insert with zero limit",
+			method: http.MethodPost,
+			path:   "/banner",
+			body: banner_model.BannerInsert{
+				Content:      map[string]interface{}{"title": "promo"},
+				TagsID:       []int{1},
+				FeatureID:    1,
+				FrequencyCap: &banner_model.FrequencyCap{WindowSeconds: 60},
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "update with bad fallback",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body: map[string]interface{}{
+				"frequency_cap": map[string]interface{}{"limit": 1, "window_in_seconds": 60, "fallback": "text"},
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:       "delete cap",
+			method:     http.MethodDelete,
+			path:       "/banner/1/frequency_cap",
+			statusCode: http.StatusNoContent,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET frequency_cap = NULL, updated_at = now\(\) WHERE id = \$1`).
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:       "delete cap of unknown banner",
+			method:     http.MethodDelete,
+			path:       "/banner/2/frequency_cap",
+			statusCode: http.StatusNotFound,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET frequency_cap = NULL").
+					WithArgs(2).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			var body bytes.Buffer
+			if testCase.body != nil {
+				if err := json.NewEncoder(&body).Encode(testCase.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, &body)
+			r.Header.Set("token", "admin_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
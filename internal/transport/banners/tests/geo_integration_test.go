@@ -0,0 +1,325 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
+	filegeo "github.com/Heatdog/Avito/pkg/geo/file"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+const geoCSV = `network,region
+# Санкт-Петербург целиком, кроме выделенной московской сети
+10.0.0.0/8,RU-SPE
+10.1.0.0/16,RU-MOW
+2001:db8::/32,DE
+`
+
+func writeGeoFile(t *testing.T, path, content string, modTime time.Time) {
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeoUserBanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regions.csv")
+	writeGeoFile(t, path, geoCSV, time.Now())
+
+	geoDB, err := filegeo.NewFileDatabase(slog.Default(), path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	f := newFixture(t, withClock(clock))
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	locator := middleware_transport.NewLocator(slog.Default(), geoDB,
+		[]netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")})
+	router.Use(locator.Locate)
+
+	cacheLRU.Add(banner_model.BannerKey{TagID: "1", FeatureID: "1"}, &banner_model.Banner{ID: 1,
+		Content: map[string]interface{}{"title": "moscow"}, IsActive: true,
+		Regions: &banner_model.RegionFilter{Allow: []string{"ru-mow"}}})
+	cacheLRU.Add(banner_model.BannerKey{TagID: "2", FeatureID: "1"}, &banner_model.Banner{ID: 1,
+		Content: map[string]interface{}{"title": "default"}, IsActive: true,
+		Targeted: []banner_model.Banner{
+			{ID: 2, Content: map[string]interface{}{"title": "spb"}, IsActive: true,
+				Targeting: &banner_model.Targeting{Rule: banner_model.Rule{Region: []string{"RU-SPE"}}}},
+			{ID: 3, Content: map[string]interface{}{"title": "ios"}, IsActive: true,
+				Targeting: &banner_model.Targeting{Rule: banner_model.Rule{Platform: []string{"ios"}}},
+				Regions:   &banner_model.RegionFilter{Deny: []string{"RU-SPE"}}},
+		}})
+
+	testTable := []struct {
+		name       string
+		tagID      string
+		query      string
+		remoteAddr string
+		forwarded  string
+		token      string
+		statusCode int
+		title      string
+	}{
+		{name: "allowed region", tagID: "1", remoteAddr: "10.1.2.3:1234", token: "user_token",
+			statusCode: http.StatusOK, title: "moscow"},
+		{name: "other region", tagID: "1", remoteAddr: "10.2.0.1:1234", token: "user_token",
+			statusCode: http.StatusNotFound},
+		{name: "unknown region", tagID: "1", remoteAddr: "192.0.2.1:1234", token: "user_token",
+			statusCode: http.StatusNotFound},
+		{name: "ipv6 network", tagID: "1", remoteAddr: "[2001:db8::1]:1234", token: "user_token",
+			statusCode: http.StatusNotFound},
+		{name: "client behind trusted proxy", tagID: "1", remoteAddr: "192.168.1.1:1234", forwarded: "10.1.0.5",
+			token: "user_token", statusCode: http.StatusOK, title: "moscow"},
+		{name: "chain of trusted proxies", tagID: "1", remoteAddr: "192.168.1.1:1234",
+			forwarded: "10.1.0.5, 192.168.1.2", token: "user_token", statusCode: http.StatusOK, title: "moscow"},
+		{name: "spoofed address before client", tagID: "1", remoteAddr: "192.168.1.1:1234",
+			forwarded: "10.1.0.5, 10.2.0.1", token: "user_token", statusCode: http.StatusNotFound},
+		{name: "header from untrusted peer", tagID: "1", remoteAddr: "10.2.0.1:1234", forwarded: "10.1.0.5",
+			token: "user_token", statusCode: http.StatusNotFound},
+		{name: "admin ignores regions", tagID: "1", remoteAddr: "10.2.0.1:1234", token: "admin_token",
+			statusCode: http.StatusOK, title: "moscow"},
+		{name: "region attribute from ip", tagID: "2", remoteAddr: "10.2.0.1:1234", token: "user_token",
+			statusCode: http.StatusOK, title: "spb"},
+		{name: "targeted banner outside denied region", tagID: "2", query: "&platform=ios",
+			remoteAddr: "10.1.0.1:1234", token: "user_token", statusCode: http.StatusOK, title: "ios"},
+		{name: "denied region falls back to default", tagID: "2", query: "&platform=ios&region=RU-MOW",
+			remoteAddr: "10.2.0.1:1234", token: "user_token", statusCode: http.StatusOK, title: "default"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet,
+				"/user_banner?feature_id=1&tag_id="+testCase.tagID+testCase.query, nil)
+			r.RemoteAddr = testCase.remoteAddr
+			r.Header.Set("token", testCase.token)
+
+			if testCase.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", testCase.forwarded)
+			}
+
+			if testCase.statusCode == http.StatusNotFound {
+				ExpectNoDefaults(dbMock, "1")
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+
+			if testCase.title != "" {
+				require.JSONEq(t, `{"title": "`+testCase.title+`"}`, w.Body.String())
+			}
+		})
+	}
+
+	require.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestGeoDatabaseReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regions.csv")
+	modTime := time.Now().Add(-time.Hour)
+	writeGeoFile(t, path, geoCSV, modTime)
+
+	geoDB, err := filegeo.NewFileDatabase(slog.Default(), path, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go geoDB.Run(ctx)
+
+	addr := netip.MustParseAddr("10.1.0.1")
+
+	region, ok := geoDB.Region(addr)
+	require.True(t, ok)
+	require.Equal(t, "RU-MOW", region)
+
+	// битый файл не заменяет загруженную базу
+	writeGeoFile(t, path, "network,region\n10.1.0.0/33,RU-MOW\n", modTime.Add(time.Minute))
+	time.Sleep(20 * time.Millisecond)
+
+	region, ok = geoDB.Region(addr)
+	require.True(t, ok)
+	require.Equal(t, "RU-MOW", region)
+
+	writeGeoFile(t, path, "10.0.0.0/8,RU-KDA\n", modTime.Add(2*time.Minute))
+
+	require.Eventually(t, func() bool {
+		region, ok := geoDB.Region(addr)
+		return ok && region == "RU-KDA"
+	}, time.Second, 5*time.Millisecond)
+
+	_, err = filegeo.NewFileDatabase(slog.Default(), filepath.Join(t.TempDir(), "missing.csv"), time.Minute)
+	require.Error(t, err)
+}
+
+func TestBannerRegions(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{}))
+	dbMock, router := f.dbMock, f.router
+
+	content := map[string]interface{}{"title": "promo"}
+	regions := &banner_model.RegionFilter{Allow: []string{"RU-MOW"}, Deny: []string{"RU-SPE"}}
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		statusCode int
+		mockFunc   func()
+	}{
+		{
+			name:   "insert with regions",
+			method: http.MethodPost,
+			path:   "/banner",
+			body: banner_model.BannerInsert{
+				Content:   content,
+				TagsID:    []int{1},
+				FeatureID: 1,
+				Regions:   regions,
+			},
+			statusCode: http.StatusCreated,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery(`INSERT INTO banners \(is_active, active_from, active_until, schedule, frequency_cap,
+					impression_budget, budget_from, targeting, regions, priority\)`).
+					WithArgs(false, (*time.Time)(nil), (*time.Time)(nil), (*banner_model.Schedule)(nil),
+						(*banner_model.FrequencyCap)(nil), (*int64)(nil), (*banner_model.Targeting)(nil), regions, 0).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(2, content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, 2).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(1, 1, 2).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "insert without allow and deny",
+			method: http.MethodPost,
+			path:   "/banner",
+			body: banner_model.BannerInsert{
+				Content:   content,
+				TagsID:    []int{1},
+				FeatureID: 1,
+				Regions:   &banner_model.RegionFilter{},
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "update with empty region",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body: map[string]interface{}{
+				"regions": map[string]interface{}{"deny": []string{" "}},
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "update regions",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body: banner_model.BannerUpdate{
+				Regions: regions,
+			},
+			statusCode: http.StatusOK,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET regions = \$1, updated_at = now\(\) WHERE id = \$2`).
+					WithArgs(regions, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:       "delete regions",
+			method:     http.MethodDelete,
+			path:       "/banner/1/regions",
+			statusCode: http.StatusNoContent,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET regions = NULL, updated_at = now\(\) WHERE id = \$1`).
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:       "delete regions of unknown banner",
+			method:     http.MethodDelete,
+			path:       "/banner/2/regions",
+			statusCode: http.StatusNotFound,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET regions = NULL").
+					WithArgs(2).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			var body bytes.Buffer
+			if testCase.body != nil {
+				if err := json.NewEncoder(&body).Encode(testCase.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, &body)
+			r.Header.Set("token", "admin_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -4,22 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
-	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
-	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
-	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
-	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
-	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
-	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
-	"github.com/gorilla/mux"
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/require"
 )
@@ -28,34 +18,8 @@ func Int(i int) *int    { return &i }
 func Bool(b bool) *bool { return &b }
 
 func TestGetBanners(t *testing.T) {
-	dbMock, err := pgxmock.NewPool()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbMock.Close()
-
-	opt := &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelError,
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
-	slog.SetDefault(logger)
-
-	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil,
-		time.Minute*time.Duration(5))
-	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
-
-	tokenProvider := simpletoken.NewSimpleTokenProvider()
-
-	logger.Debug("register middlewre")
-	middleware := middleware_transport.NewMiddleware(logger, tokenProvider)
-
-	bannerRepo := banner_postgre.NewBannerRepository(logger, dbMock)
-	bannerService := banner_service.NewBannerService(logger, bannerRepo, cache, tokenProvider)
-	bannerHandler := banners_transport.NewBannersHandler(logger, bannerService, middleware)
-	router := mux.NewRouter()
-
-	bannerHandler.Register(router)
+	f := newFixture(t)
+	dbMock, router := f.dbMock, f.router
 
 	type queryParams struct {
 		TagID     *int
@@ -87,9 +51,8 @@ func TestGetBanners(t *testing.T) {
 					ID:        1,
 					TagsID:    []int{1, 2, 3},
 					FeatureID: 4,
-					ContentV1: `{"title":"good_title3"}`,
-					ContentV2: nil,
-					ContentV3: nil,
+					Content:   `{"title":"good_title3"}`,
+					Version:   1,
 					IsActive:  true,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.UnixMilli(200),
@@ -98,9 +61,8 @@ func TestGetBanners(t *testing.T) {
 					ID:        2,
 					TagsID:    []int{4},
 					FeatureID: 5,
-					ContentV1: `{"title":"good_title1"}`,
-					ContentV2: `{"title":"good_title2"}`,
-					ContentV3: `{"title":"good_title3"}`,
+					Content:   `{"title":"good_title1"}`,
+					Version:   3,
 					IsActive:  false,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.UnixMilli(120),
@@ -110,15 +72,17 @@ func TestGetBanners(t *testing.T) {
 			err:        nil,
 
 			mockFunc: func(banners []banner_model.Banner, _ queryParams, _ error) {
-				rows := pgxmock.NewRows([]string{"id", "content_v1", "content_v2", "content_v3", "is_active",
-					"created_at", "updated_at"})
+				rows := pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+					"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions",
+					"priority"})
 				for _, banner := range banners {
-					rows.AddRow(banner.ID, banner.ContentV1, banner.ContentV2, banner.ContentV3, banner.IsActive,
-						banner.CreatedAt, banner.UpdatedAt)
+					rows.AddRow(banner.ID, banner.Version, banner.Content, banner.IsActive,
+						banner.CreatedAt, banner.UpdatedAt, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.Targeting, banner.Regions, banner.Priority)
 				}
 
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active, b.created_at, 
-				b.updated_at FROM banners b`).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.created_at, 
+				b.updated_at, b.active_from, b.active_until, b.schedule, b.frequency_cap, b.targeting, b.regions, b.priority FROM banners b`).
 					WillReturnRows(rows)
 
 				for _, banner := range banners {
@@ -146,9 +110,8 @@ func TestGetBanners(t *testing.T) {
 					ID:        1,
 					TagsID:    []int{1},
 					FeatureID: 1,
-					ContentV1: `{"title":"good_title3"}`,
-					ContentV2: nil,
-					ContentV3: nil,
+					Content:   `{"title":"good_title3"}`,
+					Version:   1,
 					IsActive:  true,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.Now(),
@@ -158,15 +121,18 @@ func TestGetBanners(t *testing.T) {
 			err:        nil,
 
 			mockFunc: func(banners []banner_model.Banner, params queryParams, _ error) {
-				rows := pgxmock.NewRows([]string{"id", "content_v1", "content_v2", "content_v3", "is_active",
-					"created_at", "updated_at"})
+				rows := pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+					"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions",
+					"priority"})
 				for _, banner := range banners {
-					rows.AddRow(banner.ID, banner.ContentV1, banner.ContentV2, banner.ContentV3, banner.IsActive,
-						banner.CreatedAt, banner.UpdatedAt)
+					rows.AddRow(banner.ID, banner.Version, banner.Content, banner.IsActive,
+						banner.CreatedAt, banner.UpdatedAt, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.Targeting, banner.Regions, banner.Priority)
 				}
 
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active, b.created_at, 
-				b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.created_at, 
+				b.updated_at, b.active_from, b.active_until, b.schedule, b.frequency_cap, b.targeting, b.regions, b.priority FROM banners b JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+				JOIN features_tags_to_banners ftb`).
 					WithArgs(&params.FeatureID, &params.TagID).
 					WillReturnRows(rows)
 
@@ -199,9 +165,8 @@ func TestGetBanners(t *testing.T) {
 					ID:        1,
 					TagsID:    []int{1},
 					FeatureID: 1,
-					ContentV1: `{"title":"good_title3"}`,
-					ContentV2: nil,
-					ContentV3: nil,
+					Content:   `{"title":"good_title3"}`,
+					Version:   1,
 					IsActive:  true,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.Now(),
@@ -211,15 +176,18 @@ func TestGetBanners(t *testing.T) {
 			err:        nil,
 
 			mockFunc: func(banners []banner_model.Banner, params queryParams, _ error) {
-				rows := pgxmock.NewRows([]string{"id", "content_v1", "content_v2", "content_v3", "is_active",
-					"created_at", "updated_at"})
+				rows := pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+					"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions",
+					"priority"})
 				for _, banner := range banners {
-					rows.AddRow(banner.ID, banner.ContentV1, banner.ContentV2, banner.ContentV3, banner.IsActive,
-						banner.CreatedAt, banner.UpdatedAt)
+					rows.AddRow(banner.ID, banner.Version, banner.Content, banner.IsActive,
+						banner.CreatedAt, banner.UpdatedAt, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.Targeting, banner.Regions, banner.Priority)
 				}
 
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active, b.created_at, 
-				b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.created_at, 
+				b.updated_at, b.active_from, b.active_until, b.schedule, b.frequency_cap, b.targeting, b.regions, b.priority FROM banners b JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+				JOIN features_tags_to_banners ftb`).
 					WithArgs(&params.FeatureID).
 					WillReturnRows(rows)
 
@@ -250,9 +218,8 @@ func TestGetBanners(t *testing.T) {
 					ID:        1,
 					TagsID:    []int{1},
 					FeatureID: 1,
-					ContentV1: `{"title":"good_title3"}`,
-					ContentV2: nil,
-					ContentV3: nil,
+					Content:   `{"title":"good_title3"}`,
+					Version:   1,
 					IsActive:  true,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.Now(),
@@ -262,15 +229,17 @@ func TestGetBanners(t *testing.T) {
 			err:        nil,
 
 			mockFunc: func(banners []banner_model.Banner, _ queryParams, _ error) {
-				rows := pgxmock.NewRows([]string{"id", "content_v1", "content_v2", "content_v3", "is_active",
-					"created_at", "updated_at"})
+				rows := pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+					"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions",
+					"priority"})
 				for _, banner := range banners {
-					rows.AddRow(banner.ID, banner.ContentV1, banner.ContentV2, banner.ContentV3, banner.IsActive,
-						banner.CreatedAt, banner.UpdatedAt)
+					rows.AddRow(banner.ID, banner.Version, banner.Content, banner.IsActive,
+						banner.CreatedAt, banner.UpdatedAt, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.Targeting, banner.Regions, banner.Priority)
 				}
 
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active, b.created_at, 
-				b.updated_at FROM banners b`).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.created_at, 
+				b.updated_at, b.active_from, b.active_until, b.schedule, b.frequency_cap, b.targeting, b.regions, b.priority FROM banners b`).
 					WillReturnRows(rows)
 
 				var tagFeature []*pgxmock.Rows
@@ -302,9 +271,8 @@ func TestGetBanners(t *testing.T) {
 					ID:        1,
 					TagsID:    []int{1},
 					FeatureID: 1,
-					ContentV1: `{"title":"good_title3"}`,
-					ContentV2: nil,
-					ContentV3: nil,
+					Content:   `{"title":"good_title3"}`,
+					Version:   1,
 					IsActive:  true,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.Now(),
@@ -314,15 +282,18 @@ func TestGetBanners(t *testing.T) {
 			err:        nil,
 
 			mockFunc: func(banners []banner_model.Banner, params queryParams, _ error) {
-				rows := pgxmock.NewRows([]string{"id", "content_v1", "content_v2", "content_v3", "is_active",
-					"created_at", "updated_at"})
+				rows := pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+					"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions",
+					"priority"})
 				for _, banner := range banners {
-					rows.AddRow(banner.ID, banner.ContentV1, banner.ContentV2, banner.ContentV3, banner.IsActive,
-						banner.CreatedAt, banner.UpdatedAt)
+					rows.AddRow(banner.ID, banner.Version, banner.Content, banner.IsActive,
+						banner.CreatedAt, banner.UpdatedAt, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.Targeting, banner.Regions, banner.Priority)
 				}
 
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active, b.created_at, 
-				b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.created_at, 
+				b.updated_at, b.active_from, b.active_until, b.schedule, b.frequency_cap, b.targeting, b.regions, b.priority FROM banners b JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+				JOIN features_tags_to_banners ftb`).
 					WithArgs(&params.TagID).
 					WillReturnRows(rows)
 
@@ -355,8 +326,9 @@ func TestGetBanners(t *testing.T) {
 			err:         fmt.Errorf("internal error"),
 
 			mockFunc: func(_ []banner_model.Banner, params queryParams, err error) {
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active, b.created_at, 
-				b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.created_at, 
+				b.updated_at, b.active_from, b.active_until, b.schedule, b.frequency_cap, b.targeting, b.regions, b.priority FROM banners b JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+				JOIN features_tags_to_banners ftb`).
 					WithArgs(&params.TagID).
 					WillReturnError(err)
 			},
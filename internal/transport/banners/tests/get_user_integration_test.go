@@ -5,58 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strconv"
 	"testing"
 	"time"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
 	"github.com/Heatdog/Avito/internal/models/queryparams"
-	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
-	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
-	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
-	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
-	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
-	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
-	"github.com/gorilla/mux"
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/require"
 )
 
-func TestGetUserBanner(t *testing.T) {
-	dbMock, err := pgxmock.NewPool()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbMock.Close()
-
-	opt := &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelError,
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
-	slog.SetDefault(logger)
+// userBannerColumns - колонки запроса баннера для пользователя
+var userBannerColumns = []string{"id", "version", "content", "is_active", "active_from", "active_until", "schedule",
+	"rollout_version", "rollout_content", "rollout_percent", "frequency_cap", "targeting", "regions", "priority", "updated_at"}
 
-	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil,
-		time.Minute*time.Duration(5))
-	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
+// userSlotsColumns - колонки запроса слотов нескольких тегов: вес и стратегия заполнены только у вариантов эксперимента
+var userSlotsColumns = append([]string{"tag_id", "weight", "strategy", "epsilon", "seed"}, userBannerColumns...)
 
-	tokenProvider := simpletoken.NewSimpleTokenProvider()
-
-	logger.Debug("register middlewre")
-	middleware := middleware_transport.NewMiddleware(logger, tokenProvider)
-
-	bannerRepo := banner_postgre.NewBannerRepository(logger, dbMock)
-	bannerService := banner_service.NewBannerService(logger, bannerRepo, cache, tokenProvider)
-	bannerHandler := banners_transport.NewBannersHandler(logger, bannerService, middleware)
-	router := mux.NewRouter()
-
-	bannerHandler.Register(router)
+func TestGetUserBanner(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cache, router := f.dbMock, f.cache, f.router
 
 	type mockBehavior func(banners *banner_model.Banner, params queryparams.BannerUserParams, err error)
 
@@ -77,20 +48,18 @@ func TestGetUserBanner(t *testing.T) {
 			path:  "/user_banner?tag_id=1&feature_id=1&use_last_revision=true&version=1",
 			token: "user_token",
 			params: queryparams.BannerUserParams{
-				TagID:            "1",
+				TagIDs:           []string{"1"},
 				FeatureID:        "1",
 				UseLastrRevision: "true",
 				Version:          "1",
-				Token:            "user_token",
 			},
 
 			respBanners: &banner_model.Banner{
 				ID:        1,
 				TagsID:    []int{1, 2, 3},
 				FeatureID: 4,
-				ContentV1: `{"title":"good_title3"}`,
-				ContentV2: nil,
-				ContentV3: nil,
+				Content:   `{"title":"good_title3"}`,
+				Version:   1,
 				IsActive:  true,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
@@ -99,12 +68,12 @@ func TestGetUserBanner(t *testing.T) {
 			err:        nil,
 
 			mockFunc: func(banner *banner_model.Banner, params queryparams.BannerUserParams, _ error) {
-				row := pgxmock.NewRows([]string{"id", "content_v1", "content_v2", "content_v3", "is_active"})
-				row.AddRow(banner.ID, banner.ContentV1, banner.ContentV2, banner.ContentV3, banner.IsActive)
+				row := pgxmock.NewRows(userBannerColumns)
+				row.AddRow(banner.ID, banner.Version, banner.Content, banner.IsActive, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
 
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active
-					FROM banners b JOIN features_tags_to_banners ftb`).
-					WithArgs(params.FeatureID, params.TagID).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs(params.FeatureID, params.TagIDs[0], 1).
 					WillReturnRows(row)
 			},
 		},
@@ -113,20 +82,18 @@ func TestGetUserBanner(t *testing.T) {
 			path:  "/user_banner?tag_id=1&feature_id=1&use_last_revision=true&version=1",
 			token: "admin_token",
 			params: queryparams.BannerUserParams{
-				TagID:            "1",
+				TagIDs:           []string{"1"},
 				FeatureID:        "1",
 				UseLastrRevision: "true",
 				Version:          "1",
-				Token:            "user_token",
 			},
 
 			respBanners: &banner_model.Banner{
 				ID:        1,
 				TagsID:    []int{1, 2, 3},
 				FeatureID: 4,
-				ContentV1: `{"title":"good_title3"}`,
-				ContentV2: nil,
-				ContentV3: nil,
+				Content:   `{"title":"good_title3"}`,
+				Version:   1,
 				IsActive:  true,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
@@ -135,12 +102,12 @@ func TestGetUserBanner(t *testing.T) {
 			err:        nil,
 
 			mockFunc: func(banner *banner_model.Banner, params queryparams.BannerUserParams, _ error) {
-				row := pgxmock.NewRows([]string{"id", "content_v1", "content_v2", "content_v3", "is_active"})
-				row.AddRow(banner.ID, banner.ContentV1, banner.ContentV2, banner.ContentV3, banner.IsActive)
+				row := pgxmock.NewRows(userBannerColumns)
+				row.AddRow(banner.ID, banner.Version, banner.Content, banner.IsActive, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
 
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active
-					FROM banners b JOIN features_tags_to_banners ftb`).
-					WithArgs(params.FeatureID, params.TagID).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs(params.FeatureID, params.TagIDs[0], 1).
 					WillReturnRows(row)
 			},
 		},
@@ -149,11 +116,10 @@ func TestGetUserBanner(t *testing.T) {
 			path:  "/user_banner?tag_id=5&feature_id=5&use_last_revision=false&version=1",
 			token: "user_token",
 			params: queryparams.BannerUserParams{
-				TagID:            "5",
+				TagIDs:           []string{"5"},
 				FeatureID:        "5",
 				UseLastrRevision: "true",
 				Version:          "1",
-				Token:            "user_token",
 			},
 
 			respBanners: nil,
@@ -161,31 +127,29 @@ func TestGetUserBanner(t *testing.T) {
 			err:         nil,
 
 			mockFunc: func(_ *banner_model.Banner, params queryparams.BannerUserParams, _ error) {
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active
-					FROM banners b JOIN features_tags_to_banners ftb`).
-					WithArgs(params.FeatureID, params.TagID).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs(params.FeatureID, params.TagIDs[0], 1).
 					WillReturnError(pgx.ErrNoRows)
 			},
 		},
 		{
 			name:  "use cache",
-			path:  "/user_banner?tag_id=1&feature_id=1&use_last_revision=false&version=1",
+			path:  "/user_banner?tag_id=1&feature_id=4&use_last_revision=false&version=1",
 			token: "admin_token",
 			params: queryparams.BannerUserParams{
-				TagID:            "1",
+				TagIDs:           []string{"1"},
 				FeatureID:        "1",
 				UseLastrRevision: "false",
 				Version:          "1",
-				Token:            "user_token",
 			},
 
 			respBanners: &banner_model.Banner{
 				ID:        1,
 				TagsID:    []int{1, 2, 3},
 				FeatureID: 4,
-				ContentV1: `{"title":"good_title3"}`,
-				ContentV2: nil,
-				ContentV3: nil,
+				Content:   `{"title":"good_title3"}`,
+				Version:   1,
 				IsActive:  true,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
@@ -209,11 +173,10 @@ func TestGetUserBanner(t *testing.T) {
 			path:  "/user_banner?tag_id=1&feature_id=1&use_last_revision=true&version=1",
 			token: "admin_token",
 			params: queryparams.BannerUserParams{
-				TagID:            "1",
+				TagIDs:           []string{"1"},
 				FeatureID:        "1",
 				UseLastrRevision: "true",
 				Version:          "1",
-				Token:            "user_token",
 			},
 
 			respBanners: nil,
@@ -221,9 +184,9 @@ func TestGetUserBanner(t *testing.T) {
 			err:         fmt.Errorf("internal error"),
 
 			mockFunc: func(_ *banner_model.Banner, params queryparams.BannerUserParams, err error) {
-				dbMock.ExpectQuery(`SELECT b.id, b.content_v1, b.content_v2, b.content_v3, b.is_active
-					FROM banners b JOIN features_tags_to_banners ftb`).
-					WithArgs(params.FeatureID, params.TagID).
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs(params.FeatureID, params.TagIDs[0], 1).
 					WillReturnError(err)
 			},
 		},
@@ -235,7 +198,7 @@ func TestGetUserBanner(t *testing.T) {
 
 			respBanners: nil,
 			statusCode:  http.StatusBadRequest,
-			err:         fmt.Errorf("Key: 'BannerUserParams.TagID' Error:Field validation for 'TagID' failed on the 'required' tag\nKey: 'BannerUserParams.FeatureID' Error:Field validation for 'FeatureID' failed on the 'required' tag"),
+			err:         fmt.Errorf("Key: 'BannerUserParams.TagIDs' Error:Field validation for 'TagIDs' failed on the 'required' tag\nKey: 'BannerUserParams.FeatureID' Error:Field validation for 'FeatureID' failed on the 'required' tag"),
 
 			mockFunc: func(_ *banner_model.Banner, _ queryparams.BannerUserParams, _ error) {},
 		},
@@ -275,7 +238,7 @@ func TestGetUserBanner(t *testing.T) {
 
 			var expected []byte
 			if testCase.respBanners != nil {
-				expected, err = json.Marshal(testCase.respBanners.ContentV1)
+				expected, err = json.Marshal(testCase.respBanners.Content)
 				if err != nil {
 					t.Fatal(err)
 				}
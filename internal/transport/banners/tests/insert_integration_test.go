@@ -5,56 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
-	"time"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
-	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
-	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
-	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
-	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
-	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
-	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
-	"github.com/gorilla/mux"
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/require"
 )
 
 func TestInsertBanner(t *testing.T) {
-	dbMock, err := pgxmock.NewPool()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbMock.Close()
-
-	opt := &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelError,
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
-	slog.SetDefault(logger)
-
-	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil,
-		time.Minute*time.Duration(5))
-	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
-
-	tokenProvider := simpletoken.NewSimpleTokenProvider()
-
-	logger.Debug("register middlewre")
-	middleware := middleware_transport.NewMiddleware(logger, tokenProvider)
-
-	bannerRepo := banner_postgre.NewBannerRepository(logger, dbMock)
-	bannerService := banner_service.NewBannerService(logger, bannerRepo, cache, tokenProvider)
-	bannerHandler := banners_transport.NewBannersHandler(logger, bannerService, middleware)
-	router := mux.NewRouter()
-
-	bannerHandler.Register(router)
+	f := newFixture(t)
+	dbMock, router := f.dbMock, f.router
 
 	type RespID struct {
 		ID int `json:"banner_id"`
@@ -104,14 +67,26 @@ func TestInsertBanner(t *testing.T) {
 				row.AddRow(id)
 
 				dbMock.ExpectQuery("INSERT INTO banners").
-					WithArgs(banner.Content, banner.IsActive).
+					WithArgs(banner.IsActive, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.ImpressionBudget, banner.Targeting, banner.Regions, banner.Priority).
 					WillReturnRows(row)
 
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(id, banner.Content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, id).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
 				for _, tag := range banner.TagsID {
 					dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
 						WithArgs(banner.FeatureID, tag, id).
 						WillReturnResult(pgxmock.NewResult("INSERT", 1))
 				}
+
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
 			},
 		},
 		{
@@ -182,9 +157,17 @@ func TestInsertBanner(t *testing.T) {
 				row.AddRow(id)
 
 				dbMock.ExpectQuery("INSERT INTO banners").
-					WithArgs(banner.Content, banner.IsActive).
+					WithArgs(banner.IsActive, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.ImpressionBudget, banner.Targeting, banner.Regions, banner.Priority).
 					WillReturnRows(row)
 
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(id, banner.Content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, id).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
 				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
 					WithArgs(banner.FeatureID, banner.TagsID[0], id).
 					WillReturnError(err)
@@ -216,7 +199,8 @@ func TestInsertBanner(t *testing.T) {
 				defer dbMock.ExpectRollback()
 
 				dbMock.ExpectQuery("INSERT INTO banners").
-					WithArgs(banner.Content, banner.IsActive).
+					WithArgs(banner.IsActive, banner.ActiveFrom, banner.ActiveUntil, banner.Schedule, banner.FrequencyCap,
+						banner.ImpressionBudget, banner.Targeting, banner.Regions, banner.Priority).
 					WillReturnError(err)
 			},
 		},
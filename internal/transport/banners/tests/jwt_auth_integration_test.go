@@ -0,0 +1,176 @@
+package banner_handler_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwttoken "github.com/Heatdog/Avito/pkg/token/jwt_token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+const jwtKey = "test-signing-key-of-thirty-two-bytes"
+
+func signJWT(t *testing.T, method jwt.SigningMethod, key string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	tokenStr, err := jwt.NewWithClaims(method, claims).SignedString([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokenStr
+}
+
+func TestJWTAuth(t *testing.T) {
+	tokenProvider, err := jwttoken.NewJWTTokenProvider(slog.Default(), jwtKey, "role")
+	require.NoError(t, err)
+
+	f := newFixture(t, withTokenProvider(tokenProvider))
+	router := f.router
+
+	now := time.Now()
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		statusCode int
+	}{
+		{
+			name:   "user token",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"sub":  "user-1",
+				"role": "user",
+				"exp":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "user token on admin route",
+			method: http.MethodPost,
+			path:   "/banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"sub":  "user-1",
+				"role": "user",
+				"exp":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "admin token on admin route",
+			method: http.MethodPost,
+			path:   "/banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"sub":  "admin-1",
+				"role": "admin",
+				"exp":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "no subject",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"role": "admin",
+				"exp":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "expired token",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"role": "admin",
+				"exp":  now.Add(-time.Hour).Unix(),
+			}),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "not valid yet",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"role": "admin",
+				"exp":  now.Add(2 * time.Hour).Unix(),
+				"nbf":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "no exp",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"role": "admin",
+			}),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong key",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS256, "other-signing-key-of-thirty-two-bytes", jwt.MapClaims{
+				"role": "admin",
+				"exp":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong algorithm",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS512, jwtKey, jwt.MapClaims{
+				"role": "admin",
+				"exp":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown role",
+			method: http.MethodGet,
+			path:   "/user_banner",
+			token: signJWT(t, jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+				"role": "root",
+				"exp":  now.Add(time.Hour).Unix(),
+			}),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "simple token",
+			method:     http.MethodGet,
+			path:       "/user_banner",
+			token:      "admin_token",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest(testCase.method, testCase.path, nil)
+
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code)
+		})
+	}
+}
+
+func TestJWTWeakKey(t *testing.T) {
+	for _, key := range []string{"", "123", jwtKey[:jwttoken.MinKeyLength-1]} {
+		_, err := jwttoken.NewJWTTokenProvider(slog.Default(), key, "role")
+		require.ErrorIs(t, err, jwttoken.ErrWeakKey)
+	}
+}
@@ -0,0 +1,198 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingBannerCache(t *testing.T) {
+	f := newFixture(t, withMissingCache(100*time.Millisecond))
+	dbMock, missingLRU, router := f.dbMock, f.missingLRU, f.router
+
+	invalidator := banner_service.NewCacheInvalidator(f.logger, f.cache, f.missing, f.generation)
+
+	key := banner_model.BannerKey{TagID: "7", FeatureID: "7"}
+	content := map[string]interface{}{"title": "banner"}
+
+	expectMissing := func() {
+		ExpectNoVariants(dbMock, key.FeatureID, key.TagID)
+		dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+			b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+			WithArgs(key.FeatureID, key.TagID, 0).
+			WillReturnError(pgx.ErrNoRows)
+		ExpectNoDefaults(dbMock, key.FeatureID)
+	}
+
+	// вместе со слотом запоминается отсутствие баннеров по умолчанию фичи и общего
+	keys := []banner_model.BannerKey{key, banner_model.DefaultKey(key.FeatureID), banner_model.DefaultKey("")}
+
+	waitMissing := func(t *testing.T) {
+		t.Helper()
+
+		for _, key := range keys {
+			require.Eventually(t, func() bool {
+				return missingLRU.Contains(key)
+			}, time.Second, 5*time.Millisecond)
+		}
+	}
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+
+		statusCode int
+
+		mockFunc func(t *testing.T)
+		check    func(t *testing.T)
+	}{
+		{
+			name:   "miss is cached",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=7&feature_id=7",
+			token:  "user_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func(_ *testing.T) {
+				expectMissing()
+			},
+			check: waitMissing,
+		},
+		{
+			name:   "known missing",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=7&feature_id=7",
+			token:  "user_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func(_ *testing.T) {},
+			check:    func(_ *testing.T) {},
+		},
+		{
+			name:   "entry expires",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=7&feature_id=7",
+			token:  "user_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func(t *testing.T) {
+				for _, key := range keys {
+					require.Eventually(t, func() bool {
+						return !missingLRU.Contains(key)
+					}, time.Second, 5*time.Millisecond)
+				}
+
+				expectMissing()
+			},
+			check: waitMissing,
+		},
+		{
+			name:   "insert clears entry",
+			method: http.MethodPost,
+			path:   "/banner",
+			token:  "admin_token",
+			body: banner_model.BannerInsert{
+				TagsID:    []int{7},
+				FeatureID: 7,
+				Content:   content,
+				IsActive:  true,
+			},
+
+			statusCode: http.StatusCreated,
+
+			mockFunc: func(_ *testing.T) {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("INSERT INTO banners").
+					WithArgs(true, (*time.Time)(nil), (*time.Time)(nil), (*banner_model.Schedule)(nil),
+						(*banner_model.FrequencyCap)(nil), (*int64)(nil),
+						(*banner_model.Targeting)(nil), (*banner_model.RegionFilter)(nil), 0).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(7, 7, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", `[{"tag_id":"7","feature_id":"7"}]`).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+			check: func(t *testing.T) {
+				require.False(t, missingLRU.Contains(key))
+			},
+		},
+		{
+			name:   "banner is served after insert",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=7&feature_id=7",
+			token:  "user_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func(_ *testing.T) {
+				row := pgxmock.NewRows(userBannerColumns)
+				row.AddRow(1, 1, content, true, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
+
+				ExpectNoVariants(dbMock, key.FeatureID, key.TagID)
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs(key.FeatureID, key.TagID, 0).
+					WillReturnRows(row)
+			},
+			check: func(_ *testing.T) {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc(t)
+
+			var body []byte
+			if testCase.body != nil {
+				var err error
+				body, err = json.Marshal(testCase.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			testCase.check(t)
+		})
+	}
+
+	t.Run("notification clears entry", func(t *testing.T) {
+		missingLRU.Add(banner_model.BannerKey{TagID: "8", FeatureID: "8"}, struct{}{})
+
+		invalidator.HandleNotification(`[{"tag_id":"8","feature_id":"8"}]`)
+
+		require.False(t, missingLRU.Contains(banner_model.BannerKey{TagID: "8", FeatureID: "8"}))
+	})
+}
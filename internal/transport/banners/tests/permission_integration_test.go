@@ -0,0 +1,95 @@
+package banner_handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissions(t *testing.T) {
+	f := newFixture(t)
+	router := f.router
+
+	// Запросы без тела и с некорректными параметрами: если право есть,
+	// обработчик отвечает 400, не обращаясь к БД
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		statusCode int
+	}{
+		{
+			name:       "viewer create",
+			method:     http.MethodPost,
+			path:       "/banner",
+			token:      "viewer_token",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "editor create",
+			method:     http.MethodPost,
+			path:       "/banner",
+			token:      "editor_token",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "user list",
+			method:     http.MethodGet,
+			path:       "/banner?limit=abc",
+			token:      "user_token",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "viewer list",
+			method:     http.MethodGet,
+			path:       "/banner?limit=abc",
+			token:      "viewer_token",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "editor switch version",
+			method:     http.MethodPatch,
+			path:       "/banner/1/5",
+			token:      "editor_token",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "publisher switch version",
+			method:     http.MethodPatch,
+			path:       "/banner/1/0",
+			token:      "publisher_token",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "publisher delete",
+			method:     http.MethodDelete,
+			path:       "/banner/abc",
+			token:      "publisher_token",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "admin delete",
+			method:     http.MethodDelete,
+			path:       "/banner/abc",
+			token:      "admin_token",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest(testCase.method, testCase.path, nil)
+
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code)
+		})
+	}
+}
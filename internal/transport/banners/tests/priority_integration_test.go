@@ -0,0 +1,255 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiTagUserBanner(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	updated := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	f := newFixture(t, withClock(clock), withEvents(100, time.Hour))
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	banner := func(id, priority int, updatedAt time.Time) *banner_model.Banner {
+		return &banner_model.Banner{ID: id, Version: 1, Content: map[string]interface{}{"id": id}, IsActive: true,
+			Priority: priority, UpdatedAt: updatedAt}
+	}
+
+	cacheLRU.Add(banner_model.BannerKey{TagID: "1", FeatureID: "1"}, banner(1, 1, updated))
+	cacheLRU.Add(banner_model.BannerKey{TagID: "2", FeatureID: "1"}, banner(2, 5, updated))
+	cacheLRU.Add(banner_model.BannerKey{TagID: "3", FeatureID: "1"}, banner(3, 5, updated.Add(time.Hour)))
+
+	inactive := banner(4, 10, updated)
+	inactive.IsActive = false
+	cacheLRU.Add(banner_model.BannerKey{TagID: "4", FeatureID: "1"}, inactive)
+
+	capped := banner(5, 20, updated)
+	capped.FrequencyCap = &banner_model.FrequencyCap{Limit: 1, WindowSeconds: 60}
+	cacheLRU.Add(banner_model.BannerKey{TagID: "5", FeatureID: "1"}, capped)
+
+	testTable := []struct {
+		name       string
+		query      string
+		token      string
+		statusCode int
+		id         string
+		shown      bool
+	}{
+		{name: "single tag", query: "tag_id=1", token: "user_token", statusCode: http.StatusOK, id: "1"},
+		{name: "higher priority wins", query: "tag_id=1&tag_id=2", token: "user_token",
+			statusCode: http.StatusOK, id: "2"},
+		{name: "tie goes to recently updated", query: "tag_id=2,3&tag_id=1", token: "user_token",
+			statusCode: http.StatusOK, id: "3"},
+		{name: "inactive banner is skipped", query: "tag_id=1,4", token: "user_token",
+			statusCode: http.StatusOK, id: "1"},
+		{name: "admin sees inactive banner", query: "tag_id=1,4", token: "admin_token",
+			statusCode: http.StatusOK, id: "4"},
+		{name: "first impression under cap", query: "tag_id=1,5&user_id=u1", token: "user_token",
+			statusCode: http.StatusOK, id: "5", shown: true},
+		{name: "capped banner yields to next", query: "tag_id=1,5&user_id=u1", token: "user_token",
+			statusCode: http.StatusOK, id: "1"},
+		{name: "version with several tags", query: "tag_id=1,2&version=1", token: "user_token",
+			statusCode: http.StatusBadRequest},
+		{name: "duplicate tag is not several tags", query: "tag_id=1,1&version=1", token: "user_token",
+			statusCode: http.StatusOK, id: "1"},
+		{name: "leading zero is the same tag", query: "tag_id=01,1&version=1", token: "user_token",
+			statusCode: http.StatusOK, id: "1"},
+		{name: "bad tag", query: "tag_id=1,a", token: "user_token", statusCode: http.StatusBadRequest},
+		{name: "too many tags", query: "tag_id=1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21",
+			token: "user_token", statusCode: http.StatusBadRequest},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/user_banner?feature_id=1&"+testCase.query, nil)
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+
+			if testCase.id != "" {
+				require.Equal(t, testCase.id, w.Header().Get(banner_model.BannerIDHeader))
+				require.JSONEq(t, `{"id": `+testCase.id+`}`, w.Body.String())
+			}
+
+			if testCase.shown {
+				id, err := strconv.Atoi(testCase.id)
+				require.NoError(t, err)
+
+				postImpression(t, router, id, "u1")
+			}
+		})
+	}
+
+	require.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestMultiTagUserBannerLoad(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	updated := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	f := newFixture(t, withClock(clock))
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	cacheLRU.Add(banner_model.BannerKey{TagID: "1", FeatureID: "1"}, &banner_model.Banner{ID: 1,
+		Content: map[string]interface{}{"title": "cached"}, IsActive: true, Priority: 1})
+
+	// промахи по трем тегам загружаются одним обращением к репозиторию, тег 4 без баннера
+	slots := pgxmock.NewRows(userSlotsColumns)
+	slots.AddRow(2, nil, nil, nil, nil, 2, 1, map[string]interface{}{"title": "default"}, true, nil, nil, nil,
+		nil, nil, 0, nil, nil, nil, 7, updated)
+	slots.AddRow(2, nil, nil, nil, nil, 6, 1, map[string]interface{}{"title": "ios"}, true, nil, nil, nil,
+		nil, nil, 0, nil, &banner_model.Targeting{Rule: banner_model.Rule{Platform: []string{"ios"}}}, nil, 3, updated)
+	slots.AddRow(3, Int(1), nil, nil, nil, 5, 1, map[string]interface{}{"title": "variant"}, true, nil, nil, nil,
+		nil, nil, 0, nil, nil, nil, 9, updated)
+
+	dbMock.ExpectQuery(`FROM slot_variants sv .* WHERE sv.feature_id = \$1 AND sv.tag_id = ANY\(\$2\) UNION ALL
+		.* WHERE ftb.feature_id = \$1 AND ftb.tag_id = ANY\(\$2\) AND NOT EXISTS`).
+		WithArgs("1", []int{2, 3, 4}).
+		WillReturnRows(slots)
+
+	get := func(query string) (int, string, string) {
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?feature_id=1&"+query, nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w.Code, w.Header().Get(banner_model.BannerIDHeader), w.Body.String()
+	}
+
+	status, id, body := get("tag_id=1,2,3,4&user_id=u1")
+	require.Equal(t, http.StatusOK, status, body)
+	require.Equal(t, "5", id)
+	require.JSONEq(t, `{"title": "variant"}`, body)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	for _, tagID := range []string{"2", "3"} {
+		require.Eventually(t, func() bool {
+			return cacheLRU.Contains(banner_model.BannerKey{TagID: tagID, FeatureID: "1"})
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	// слоты берутся из кэша, правила таргетинга проверяются по закэшированному слоту
+	cached, ok := cacheLRU.Get(banner_model.BannerKey{TagID: "3", FeatureID: "1"})
+	require.True(t, ok)
+	cached.Variants[0].Priority = 0
+
+	status, id, body = get("tag_id=1,2,3")
+	require.Equal(t, http.StatusOK, status, body)
+	require.Equal(t, "2", id)
+	require.JSONEq(t, `{"title": "default"}`, body)
+
+	status, id, body = get("tag_id=1,2,3&platform=ios")
+	require.Equal(t, http.StatusOK, status, body)
+	require.Equal(t, "6", id)
+	require.JSONEq(t, `{"title": "ios"}`, body)
+}
+
+func TestBannerPriority(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{}))
+	dbMock, router := f.dbMock, f.router
+
+	content := map[string]interface{}{"title": "promo"}
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		statusCode int
+		mockFunc   func()
+	}{
+		{
+			name:   "insert with priority",
+			method: http.MethodPost,
+			path:   "/banner",
+			body: banner_model.BannerInsert{
+				Content:   content,
+				TagsID:    []int{1},
+				FeatureID: 1,
+				Priority:  10,
+				IsActive:  true,
+			},
+			statusCode: http.StatusCreated,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery(`INSERT INTO banners \(is_active, active_from, active_until, schedule, frequency_cap,
+					impression_budget, budget_from, targeting, regions, priority\)`).
+					WithArgs(true, (*time.Time)(nil), (*time.Time)(nil), (*banner_model.Schedule)(nil),
+						(*banner_model.FrequencyCap)(nil), (*int64)(nil), (*banner_model.Targeting)(nil),
+						(*banner_model.RegionFilter)(nil), 10).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(1, 1, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "update priority",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body: banner_model.BannerUpdate{
+				Priority: Int(-1),
+			},
+			statusCode: http.StatusOK,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET priority = \$1, updated_at = now\(\) WHERE id = \$2`).
+					WithArgs(-1, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			var body bytes.Buffer
+			if err := json.NewEncoder(&body).Encode(testCase.body); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, &body)
+			r.Header.Set("token", "admin_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
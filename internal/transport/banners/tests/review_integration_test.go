@@ -0,0 +1,372 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBannerReview(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, cache, router := f.dbMock, f.cacheLRU, f.cache, f.router
+
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+	draftContent := map[string]interface{}{"title": "draft"}
+	created := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	expectState := func(id, version int, status banner_model.VersionStatus, author, submitter string) {
+		dbMock.ExpectBeginTx(pgx.TxOptions{})
+		dbMock.ExpectQuery("SELECT v.status, v.author").
+			WithArgs(id, version).
+			WillReturnRows(pgxmock.NewRows([]string{"status", "author", "submitter"}).
+				AddRow(status, author, submitter))
+	}
+
+	expectTransition := func(id, version int, status banner_model.VersionStatus, action banner_model.ReviewAction,
+		actor string) {
+		dbMock.ExpectExec("UPDATE banner_versions SET status").
+			WithArgs(id, version, status).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		dbMock.ExpectExec("INSERT INTO banner_approvals").
+			WithArgs(id, version, action, actor).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+
+		statusCode int
+		resp       interface{}
+		err        error
+
+		mockFunc func()
+		check    func(t *testing.T)
+	}{
+		{
+			name:   "edit creates draft",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "editor_token",
+			body:   banner_model.BannerUpdate{Content: draftContent},
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, draftContent, "editor", banner_model.StatusDraft).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(2))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "submit draft",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/2/submit",
+			token:  "editor_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				expectState(1, 2, banner_model.StatusDraft, "editor", "")
+				expectTransition(1, 2, banner_model.StatusReview, banner_model.ActionSubmit, "editor")
+				dbMock.ExpectCommit()
+			},
+			check: func(t *testing.T) {
+				require.True(t, cacheLRU.Contains(key))
+			},
+		},
+		{
+			name:   "submit twice",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/2/submit",
+			token:  "editor_token",
+
+			statusCode: http.StatusConflict,
+			err:        banner_model.ErrBadTransition,
+
+			mockFunc: func() {
+				expectState(1, 2, banner_model.StatusReview, "editor", "editor")
+				dbMock.ExpectRollback()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "approve by editor",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/2/approve",
+			token:  "editor_token",
+
+			statusCode: http.StatusForbidden,
+
+			mockFunc: func() {},
+			check:    func(_ *testing.T) {},
+		},
+		{
+			name:   "approve own version",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/3/approve",
+			token:  "admin_token",
+
+			statusCode: http.StatusForbidden,
+			err:        banner_model.ErrSelfApproval,
+
+			mockFunc: func() {
+				expectState(1, 3, banner_model.StatusReview, "admin", "editor")
+				dbMock.ExpectRollback()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "approve submitted by approver",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/3/approve",
+			token:  "admin_token",
+
+			statusCode: http.StatusForbidden,
+			err:        banner_model.ErrSelfApproval,
+
+			mockFunc: func() {
+				expectState(1, 3, banner_model.StatusReview, "editor", "admin")
+				dbMock.ExpectRollback()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "approve",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/2/approve",
+			token:  "admin_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				expectState(1, 2, banner_model.StatusReview, "editor", "editor")
+				expectTransition(1, 2, banner_model.StatusApproved, banner_model.ActionApprove, "admin")
+				dbMock.ExpectCommit()
+			},
+			check: func(t *testing.T) {
+				require.True(t, cacheLRU.Contains(key))
+			},
+		},
+		{
+			name:   "publish",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/2/publish",
+			token:  "publisher_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				expectState(1, 2, banner_model.StatusApproved, "editor", "editor")
+				expectTransition(1, 2, banner_model.StatusPublished, banner_model.ActionPublish, "publisher")
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(2, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+			check: func(t *testing.T) {
+				require.False(t, cacheLRU.Contains(key))
+			},
+		},
+		{
+			name:   "publish without approval",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/3/publish",
+			token:  "admin_token",
+
+			statusCode: http.StatusConflict,
+			err:        banner_model.ErrBadTransition,
+
+			mockFunc: func() {
+				expectState(1, 3, banner_model.StatusReview, "editor", "editor")
+				dbMock.ExpectRollback()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "version not found",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/9/submit",
+			token:  "admin_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("SELECT v.status, v.author").
+					WithArgs(1, 9).
+					WillReturnError(pgx.ErrNoRows)
+				dbMock.ExpectRollback()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "bad version",
+			method: http.MethodPost,
+			path:   "/banner/1/versions/draft/submit",
+			token:  "admin_token",
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf(`strconv.Atoi: parsing "draft": invalid syntax`),
+
+			mockFunc: func() {},
+			check:    func(_ *testing.T) {},
+		},
+		{
+			name:   "approvals",
+			method: http.MethodGet,
+			path:   "/banner/1/approvals",
+			token:  "viewer_token",
+
+			statusCode: http.StatusOK,
+			resp: []banner_model.BannerApproval{
+				{Version: 2, Action: banner_model.ActionPublish, Actor: "publisher", CreatedAt: created.Add(time.Hour)},
+				{Version: 2, Action: banner_model.ActionApprove, Actor: "admin", CreatedAt: created.Add(time.Minute)},
+				{Version: 2, Action: banner_model.ActionSubmit, Actor: "editor", CreatedAt: created},
+			},
+
+			mockFunc: func() {
+				row := pgxmock.NewRows([]string{"version", "action", "actor", "created_at"})
+				row.AddRow(2, banner_model.ActionPublish, "publisher", created.Add(time.Hour))
+				row.AddRow(2, banner_model.ActionApprove, "admin", created.Add(time.Minute))
+				row.AddRow(2, banner_model.ActionSubmit, "editor", created)
+
+				dbMock.ExpectQuery("SELECT version, action, actor, created_at FROM banner_approvals").
+					WithArgs(1).
+					WillReturnRows(row)
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "approvals forbidden",
+			method: http.MethodGet,
+			path:   "/banner/1/approvals",
+			token:  "user_token",
+
+			statusCode: http.StatusForbidden,
+
+			mockFunc: func() {},
+			check:    func(_ *testing.T) {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheLRU.Purge()
+
+			if _, err := cache.Add(context.Background(), key, &banner_model.Banner{
+				ID:       1,
+				Version:  1,
+				Content:  map[string]interface{}{"title": "published"},
+				IsActive: true,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			testCase.mockFunc()
+
+			var body []byte
+			if testCase.body != nil {
+				var err error
+				body, err = json.Marshal(testCase.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			testCase.check(t)
+
+			var expected []byte
+
+			switch {
+			case testCase.resp != nil:
+				expected, err = json.Marshal(testCase.resp)
+			case testCase.err != nil:
+				expected, err = json.Marshal(struct {
+					Err string `json:"error"`
+				}{
+					Err: testCase.err.Error(),
+				})
+			default:
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, string(expected), string(data))
+		})
+	}
+}
+
+func TestBannerReviewAnonymous(t *testing.T) {
+	f := newFixture(t, withTokenProvider(simpletoken.NewSimpleTokenProvider()))
+	dbMock, router := f.dbMock, f.router
+
+	// общий токен роли не указывает на человека, поэтому согласование с ним не проверить
+	for _, action := range []string{"submit", "approve", "publish"} {
+		t.Run(action, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/banner/1/versions/2/"+action, nil)
+			r.Header.Set("token", "admin_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusForbidden, w.Code)
+			require.JSONEq(t, fmt.Sprintf(`{"error": %q}`, banner_model.ErrAnonymousReview.Error()),
+				w.Body.String())
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBannerRollout(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+	newContent := map[string]interface{}{"title": "new"}
+	percent := 20
+
+	expectKeys := func() {
+		dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+			WithArgs(1).
+			WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+		dbMock.ExpectExec("SELECT pg_notify").
+			WithArgs("banner_cache", `[{"tag_id":"1","feature_id":"1"}]`).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	}
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+
+		statusCode int
+		err        error
+		evicted    bool
+
+		mockFunc func()
+	}{
+		{
+			name:   "start rollout with new content",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "editor_token",
+			body:   banner_model.BannerUpdate{Content: newContent, RolloutPercent: &percent},
+
+			statusCode: http.StatusOK,
+			evicted:    true,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET updated_at").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, newContent, "editor", banner_model.StatusDraft).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(2))
+				dbMock.ExpectExec("UPDATE banners SET rollout_version").
+					WithArgs(1, 2, percent).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectKeys()
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "start rollout while another is in progress",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "editor_token",
+			body:   banner_model.BannerUpdate{Content: newContent, RolloutPercent: &percent},
+
+			statusCode: http.StatusConflict,
+			err:        banner_model.ErrRolloutInProgress,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET updated_at").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, newContent, "editor", banner_model.StatusDraft).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(3))
+				dbMock.ExpectExec(`UPDATE banners SET rollout_version = \$2, rollout_percent = \$3 WHERE id = \$1 AND rollout_version IS NULL`).
+					WithArgs(1, 3, percent).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "rollout without content",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "editor_token",
+			body:   banner_model.BannerUpdate{RolloutPercent: &percent},
+
+			statusCode: http.StatusBadRequest,
+			err:        banner_model.ErrRolloutWithoutContent,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "change percent",
+			method: http.MethodPatch,
+			path:   "/banner/1/rollout",
+			token:  "publisher_token",
+			body:   banner_model.RolloutUpdate{Percent: 50},
+
+			statusCode: http.StatusOK,
+			evicted:    true,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET rollout_percent").
+					WithArgs(1, 50).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectKeys()
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "change percent without rollout",
+			method: http.MethodPatch,
+			path:   "/banner/1/rollout",
+			token:  "publisher_token",
+			body:   banner_model.RolloutUpdate{Percent: 50},
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET rollout_percent").
+					WithArgs(1, 50).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "percent out of range",
+			method: http.MethodPatch,
+			path:   "/banner/1/rollout",
+			token:  "publisher_token",
+			body:   banner_model.RolloutUpdate{Percent: 101},
+
+			statusCode: http.StatusBadRequest,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "editor cannot change percent",
+			method: http.MethodPatch,
+			path:   "/banner/1/rollout",
+			token:  "editor_token",
+			body:   banner_model.RolloutUpdate{Percent: 50},
+
+			statusCode: http.StatusForbidden,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "complete rollout",
+			method: http.MethodPost,
+			path:   "/banner/1/rollout/complete",
+			token:  "publisher_token",
+
+			statusCode: http.StatusOK,
+			evicted:    true,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET active_version = rollout_version").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectKeys()
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "complete unpublished rollout",
+			method: http.MethodPost,
+			path:   "/banner/1/rollout/complete",
+			token:  "admin_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET active_version = rollout_version").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "abort rollout",
+			method: http.MethodDelete,
+			path:   "/banner/1/rollout",
+			token:  "publisher_token",
+
+			statusCode: http.StatusNoContent,
+			evicted:    true,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET rollout_version = NULL").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectKeys()
+				dbMock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheLRU.Purge()
+			cacheLRU.Add(key, &banner_model.Banner{ID: 1, Content: "cached", IsActive: true})
+
+			testCase.mockFunc()
+
+			var body []byte
+			if testCase.body != nil {
+				var err error
+				if body, err = json.Marshal(testCase.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+			require.Equal(t, testCase.evicted, !cacheLRU.Contains(key))
+
+			if testCase.err == nil {
+				return
+			}
+
+			expected, err := json.Marshal(struct {
+				Err string `json:"error"`
+			}{
+				Err: testCase.err.Error(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, string(expected), string(data))
+		})
+	}
+}
+
+func TestUserBannerRollout(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+
+	expectRollout := func(percent int) {
+		row := pgxmock.NewRows(userBannerColumns)
+		row.AddRow(1, 1, map[string]interface{}{"title": "old"}, true, nil, nil, nil,
+			Int(2), map[string]interface{}{"title": "new"}, percent, nil, nil, nil, 0, nil)
+
+		ExpectNoVariants(dbMock, key.FeatureID, key.TagID)
+		dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule,
+			r.version, r.content, b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+			WithArgs(key.FeatureID, key.TagID, 0).
+			WillReturnRows(row)
+	}
+
+	get := func(t *testing.T, userID string) string {
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=1&feature_id=1&user_id="+userID, nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var content map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &content))
+
+		require.Eventually(t, func() bool {
+			return cacheLRU.Contains(key)
+		}, time.Second, 5*time.Millisecond)
+
+		return content["title"].(string)
+	}
+
+	t.Run("part of users see new version", func(t *testing.T) {
+		cacheLRU.Purge()
+		expectRollout(30)
+
+		first := map[string]string{}
+		seen := map[string]int{}
+
+		for i := 0; i < 100; i++ {
+			userID := "user-" + strconv.Itoa(i)
+
+			first[userID] = get(t, userID)
+			seen[first[userID]]++
+		}
+
+		require.NoError(t, dbMock.ExpectationsWereMet())
+		require.NotZero(t, seen["new"])
+		require.Greater(t, seen["old"], seen["new"])
+
+		for userID, title := range first {
+			require.Equal(t, title, get(t, userID))
+		}
+	})
+
+	t.Run("full rollout", func(t *testing.T) {
+		cacheLRU.Purge()
+		expectRollout(100)
+
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "new", get(t, "user-"+strconv.Itoa(i)))
+		}
+
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
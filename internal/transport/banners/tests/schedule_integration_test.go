@@ -0,0 +1,341 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func Time(t time.Time) *time.Time { return &t }
+
+func TestBannerSchedule(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, cache, router := f.dbMock, f.cacheLRU, f.cache, f.router
+
+	content := map[string]interface{}{"title": "scheduled"}
+	featureID := Int(1)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	future := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+		cached map[banner_model.BannerKey]*banner_model.Banner
+
+		statusCode int
+		err        error
+
+		mockFunc func()
+	}{
+		{
+			name:   "insert with window",
+			method: http.MethodPost,
+			path:   "/banner",
+			token:  "admin_token",
+			body: banner_model.BannerInsert{
+				TagsID:      []int{1},
+				FeatureID:   1,
+				Content:     content,
+				IsActive:    true,
+				ActiveFrom:  Time(past),
+				ActiveUntil: Time(future),
+			},
+
+			statusCode: http.StatusCreated,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("INSERT INTO banners").
+					WithArgs(true, Time(past), Time(future), (*banner_model.Schedule)(nil),
+						(*banner_model.FrequencyCap)(nil), (*int64)(nil),
+						(*banner_model.Targeting)(nil), (*banner_model.RegionFilter)(nil), 0).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(1, 1, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "insert with empty window",
+			method: http.MethodPost,
+			path:   "/banner",
+			token:  "admin_token",
+			body: banner_model.BannerInsert{
+				TagsID:      []int{1},
+				FeatureID:   1,
+				Content:     content,
+				ActiveFrom:  Time(future),
+				ActiveUntil: Time(past),
+			},
+
+			statusCode: http.StatusBadRequest,
+			err:        banner_model.ErrBadWindow,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "update window end",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body: banner_model.BannerUpdate{
+				ActiveUntil: Time(future),
+			},
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET active_until = \$1, updated_at = now\(\) WHERE id = \$2`).
+					WithArgs(future, 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "update window start after stored end",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body: banner_model.BannerUpdate{
+				ActiveFrom: Time(future),
+			},
+
+			statusCode: http.StatusBadRequest,
+			err:        banner_model.ErrBadWindow,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET active_from = \$1, updated_at = now\(\) WHERE id = \$2`).
+					WithArgs(future, 1).
+					WillReturnError(&pgconn.PgError{Code: "23514", ConstraintName: "banners_window_check"})
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "clear window end",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body:   map[string]interface{}{"active_until": nil},
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET active_until = NULL, updated_at = now\(\) WHERE id = \$1`).
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "cached banner expired for user",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=2&feature_id=2",
+			token:  "user_token",
+			cached: map[banner_model.BannerKey]*banner_model.Banner{
+				{TagID: "2", FeatureID: "2"}: {ID: 2, Content: content, IsActive: true, ActiveUntil: Time(past)},
+			},
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				ExpectNoDefaults(dbMock, "2")
+			},
+		},
+		{
+			name:   "cached banner expired for admin",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=2&feature_id=2",
+			token:  "admin_token",
+			cached: map[banner_model.BannerKey]*banner_model.Banner{
+				{TagID: "2", FeatureID: "2"}: {ID: 2, Content: content, IsActive: true, ActiveUntil: Time(past)},
+			},
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "cached banner upcoming",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=3&feature_id=3",
+			token:  "user_token",
+			cached: map[banner_model.BannerKey]*banner_model.Banner{
+				{TagID: "3", FeatureID: "3"}: {ID: 3, Content: content, IsActive: true, ActiveFrom: Time(future)},
+			},
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				ExpectNoDefaults(dbMock, "3")
+			},
+		},
+		{
+			name:   "loaded banner inside window",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=4&feature_id=4",
+			token:  "user_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				row := pgxmock.NewRows(userBannerColumns)
+				row.AddRow(4, 1, content, true, Time(past), Time(future), nil, nil, nil, 0, nil, nil, nil, 0, nil)
+
+				ExpectNoVariants(dbMock, "4", "4")
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs("4", "4", 0).
+					WillReturnRows(row)
+			},
+		},
+		{
+			name:   "live filter",
+			method: http.MethodGet,
+			path:   "/banner?status=live",
+			token:  "admin_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery(`FROM banners b JOIN banner_versions v ON v.banner_id = b.id AND v.version = b.active_version
+					WHERE b.is_active AND \(b.active_from IS NULL OR b.active_from <= now\(\)\)
+					AND \(b.active_until IS NULL OR b.active_until > now\(\)\) ORDER BY`).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+						"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions"}))
+			},
+		},
+		{
+			name:   "upcoming filter",
+			method: http.MethodGet,
+			path:   "/banner?status=upcoming&feature_id=1",
+			token:  "admin_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery(`ftb.banner_id = b.id WHERE b.active_from > now\(\) ORDER BY`).
+					WithArgs(&featureID).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+						"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions"}))
+			},
+		},
+		{
+			name:   "expired filter",
+			method: http.MethodGet,
+			path:   "/banner?status=expired",
+			token:  "admin_token",
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery(`WHERE b.active_until <= now\(\) ORDER BY`).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "version", "content", "is_active",
+						"created_at", "updated_at", "active_from", "active_until", "schedule", "frequency_cap", "targeting", "regions"}))
+			},
+		},
+		{
+			name:   "unknown filter",
+			method: http.MethodGet,
+			path:   "/banner?status=soon",
+			token:  "admin_token",
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf(`unknown status "soon"`),
+
+			mockFunc: func() {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheLRU.Purge()
+
+			for key, banner := range testCase.cached {
+				if _, err := cache.Add(context.Background(), key, banner); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			testCase.mockFunc()
+
+			var body []byte
+			if testCase.body != nil {
+				var err error
+				body, err = json.Marshal(testCase.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			if testCase.err != nil {
+				expected, err := json.Marshal(struct {
+					Err string `json:"error"`
+				}{
+					Err: testCase.err.Error(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				require.Equal(t, string(expected), string(data))
+			}
+		})
+	}
+}
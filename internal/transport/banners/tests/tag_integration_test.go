@@ -0,0 +1,312 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+var tagColumns = []string{"id", "name", "parent_id"}
+
+// tagRows - дерево russia(1) -> moscow(2) -> center(3) и корневой тег spb(4)
+func tagRows() *pgxmock.Rows {
+	return pgxmock.NewRows(tagColumns).
+		AddRow(1, "russia", nil).
+		AddRow(2, "moscow", Int(1)).
+		AddRow(3, "center", Int(2)).
+		AddRow(4, "spb", nil)
+}
+
+func TestTagInheritance(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}),
+		withMissingCache(time.Minute), withTagTree(tagRows()))
+	dbMock, cacheLRU, missingLRU, router := f.dbMock, f.cacheLRU, f.missingLRU, f.router
+
+	bannerRow := func(id int) *pgxmock.Rows {
+		return pgxmock.NewRows(userBannerColumns).AddRow(id, 1, map[string]interface{}{"id": id}, true, nil, nil,
+			nil, nil, nil, 0, nil, nil, nil, 0, nil)
+	}
+
+	expectSlot := func(featureID, tagID string, rows *pgxmock.Rows) {
+		ExpectNoVariants(dbMock, featureID, tagID)
+		dbMock.ExpectQuery("FROM banners b JOIN features_tags_to_banners ftb").
+			WithArgs(featureID, tagID, 0).
+			WillReturnRows(rows)
+	}
+
+	get := func(query string) (int, string, string) {
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?"+query, nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w.Code, w.Header().Get(banner_model.MatchHeader), w.Header().Get(banner_model.BannerIDHeader)
+	}
+
+	// у center и moscow баннеров нет, показывается баннер russia
+	expectSlot("1", "3", pgxmock.NewRows(userBannerColumns))
+	expectSlot("1", "2", pgxmock.NewRows(userBannerColumns))
+	expectSlot("1", "1", bannerRow(7))
+
+	status, match, id := get("tag_id=3&feature_id=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "tag", match)
+	require.Equal(t, "7", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// слоты кэшируются под собственными тегами, повторный подъем к базе не обращается
+	require.Eventually(t, func() bool {
+		return missingLRU.Contains(banner_model.BannerKey{TagID: "3", FeatureID: "1"}) &&
+			missingLRU.Contains(banner_model.BannerKey{TagID: "2", FeatureID: "1"}) &&
+			cacheLRU.Contains(banner_model.BannerKey{TagID: "1", FeatureID: "1"})
+	}, time.Second, 5*time.Millisecond)
+
+	status, _, id = get("tag_id=2&feature_id=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "7", id)
+
+	// собственный баннер тега закрывает баннеры предков, к ним запрос не идет
+	expectSlot("2", "2", bannerRow(8))
+
+	status, _, id = get("tag_id=2&feature_id=2")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "8", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// теги запроса с общим предком поднимаются к нему одним обращением
+	dbMock.ExpectQuery(`FROM slot_variants sv .* UNION ALL .* WHERE ftb.feature_id = \$1 AND ftb.tag_id = ANY\(\$2\)`).
+		WithArgs("3", []int{2, 3}).
+		WillReturnRows(pgxmock.NewRows(userSlotsColumns))
+	expectSlot("3", "1", bannerRow(9))
+
+	status, _, id = get("tag_id=2,3&feature_id=3")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "9", id)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// ни у тега, ни у предков баннера нет
+	expectSlot("4", "3", pgxmock.NewRows(userBannerColumns))
+	expectSlot("4", "2", pgxmock.NewRows(userBannerColumns))
+	expectSlot("4", "1", pgxmock.NewRows(userBannerColumns))
+	ExpectNoDefaults(dbMock, "4")
+
+	status, _, _ = get("tag_id=3&feature_id=4")
+	require.Equal(t, http.StatusNotFound, status)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	// запрос конкретной версии баннеры предков не ищет
+	dbMock.ExpectQuery("FROM banners b JOIN features_tags_to_banners ftb").
+		WithArgs("5", "3", 1).
+		WillReturnRows(pgxmock.NewRows(userBannerColumns))
+
+	status, _, _ = get("tag_id=3&feature_id=5&version=1")
+	require.Equal(t, http.StatusNotFound, status)
+	require.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestTagParent(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}),
+		withMissingCache(time.Minute), withTagTree(tagRows()))
+	dbMock, tagTree, router := f.dbMock, f.tags, f.router
+
+	expectCycleCheck := func(id, parentID int, cycle bool) {
+		dbMock.ExpectBeginTx(pgx.TxOptions{})
+		dbMock.ExpectExec("LOCK TABLE tags").
+			WillReturnResult(pgxmock.NewResult("LOCK TABLE", 0))
+		dbMock.ExpectQuery("WITH RECURSIVE ancestors").
+			WithArgs(id, parentID).
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(cycle))
+	}
+
+	expectCommit := func(id string, rows *pgxmock.Rows) {
+		dbMock.ExpectExec("SELECT pg_notify").
+			WithArgs("tag_tree", id).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		dbMock.ExpectCommit()
+		dbMock.ExpectQuery("SELECT id, COALESCE\\(name, ''\\), parent_id FROM tags").
+			WillReturnRows(rows)
+	}
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       interface{}
+		statusCode int
+		response   string
+		tag        string
+		parent     string
+		mockFunc   func()
+	}{
+		{
+			name:   "get tree",
+			method: http.MethodGet,
+			path:   "/tag/tree",
+			token:  "viewer_token",
+
+			statusCode: http.StatusOK,
+			response: `[{"id": 1, "name": "russia", "children": [{"id": 2, "name": "moscow",
+				"children": [{"id": 3, "name": "center"}]}]}, {"id": 4, "name": "spb"}]`,
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT id, COALESCE\\(name, ''\\), parent_id FROM tags").
+					WillReturnRows(tagRows())
+			},
+		},
+		{
+			name:   "set parent",
+			method: http.MethodPut,
+			path:   "/tag/4/parent",
+			token:  "editor_token",
+			body:   banner_model.TagParent{ParentID: 1},
+
+			statusCode: http.StatusOK,
+			tag:        "4",
+			parent:     "1",
+			mockFunc: func() {
+				expectCycleCheck(4, 1, false)
+				dbMock.ExpectExec("UPDATE tags SET parent_id").
+					WithArgs(4, Int(1)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectCommit("4", pgxmock.NewRows(tagColumns).
+					AddRow(1, "russia", nil).
+					AddRow(2, "moscow", Int(1)).
+					AddRow(3, "center", Int(2)).
+					AddRow(4, "spb", Int(1)))
+			},
+		},
+		{
+			name:   "descendant as parent",
+			method: http.MethodPut,
+			path:   "/tag/1/parent",
+			token:  "admin_token",
+			body:   banner_model.TagParent{ParentID: 3},
+
+			statusCode: http.StatusConflict,
+			mockFunc: func() {
+				expectCycleCheck(1, 3, true)
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "unknown parent",
+			method: http.MethodPut,
+			path:   "/tag/2/parent",
+			token:  "admin_token",
+			body:   banner_model.TagParent{ParentID: 100},
+
+			statusCode: http.StatusBadRequest,
+			mockFunc: func() {
+				expectCycleCheck(2, 100, false)
+				dbMock.ExpectExec("UPDATE tags SET parent_id").
+					WithArgs(2, Int(100)).
+					WillReturnError(&pgconn.PgError{Code: "23503"})
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "unknown tag",
+			method: http.MethodPut,
+			path:   "/tag/100/parent",
+			token:  "admin_token",
+			body:   banner_model.TagParent{ParentID: 1},
+
+			statusCode: http.StatusNotFound,
+			mockFunc: func() {
+				expectCycleCheck(100, 1, false)
+				dbMock.ExpectExec("UPDATE tags SET parent_id").
+					WithArgs(100, Int(1)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "bad parent",
+			method: http.MethodPut,
+			path:   "/tag/2/parent",
+			token:  "admin_token",
+			body:   banner_model.TagParent{ParentID: 0},
+
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "viewer can not set parent",
+			method: http.MethodPut,
+			path:   "/tag/2/parent",
+			token:  "viewer_token",
+			body:   banner_model.TagParent{ParentID: 1},
+
+			statusCode: http.StatusForbidden,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "delete parent",
+			method: http.MethodDelete,
+			path:   "/tag/2/parent",
+			token:  "admin_token",
+
+			statusCode: http.StatusNoContent,
+			tag:        "3",
+			parent:     "2",
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("LOCK TABLE tags").
+					WillReturnResult(pgxmock.NewResult("LOCK TABLE", 0))
+				dbMock.ExpectExec("UPDATE tags SET parent_id").
+					WithArgs(2, (*int)(nil)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectCommit("2", pgxmock.NewRows(tagColumns).
+					AddRow(1, "russia", nil).
+					AddRow(2, "moscow", nil).
+					AddRow(3, "center", Int(2)).
+					AddRow(4, "spb", Int(1)))
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			var body bytes.Buffer
+
+			if testCase.body != nil {
+				require.NoError(t, json.NewEncoder(&body).Encode(testCase.body))
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, &body)
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code)
+
+			if testCase.response != "" {
+				require.JSONEq(t, testCase.response, w.Body.String())
+			}
+
+			if testCase.tag != "" {
+				parent, ok := tagTree.Tree().Parent(testCase.tag)
+				require.True(t, ok)
+				require.Equal(t, testCase.parent, parent)
+			}
+
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+
+	_, ok := tagTree.Tree().Parent("2")
+	require.False(t, ok)
+}
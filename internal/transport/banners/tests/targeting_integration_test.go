@@ -0,0 +1,317 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetedUserBanner(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	f := newFixture(t, withClock(clock))
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	ios := &banner_model.Targeting{Rule: banner_model.Rule{Platform: []string{"ios"}}}
+	newIOS := &banner_model.Targeting{Rule: banner_model.Rule{All: []banner_model.Rule{
+		{Platform: []string{"ios"}},
+		{AppVersion: &banner_model.VersionRange{From: "5.0"}},
+	}}}
+	android := &banner_model.Targeting{Rule: banner_model.Rule{Platform: []string{"android"}}}
+
+	// слот загружается из базы один раз, остальные запросы проверяют правила из кэша
+	row := pgxmock.NewRows(userBannerColumns)
+	row.AddRow(1, 1, map[string]interface{}{"title": "default"}, true, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
+	row.AddRow(2, 1, map[string]interface{}{"title": "ios"}, true, nil, nil, nil, nil, nil, 0, nil, ios, nil, 0, nil)
+	row.AddRow(3, 1, map[string]interface{}{"title": "ios5"}, true, nil, nil, nil, nil, nil, 0, nil, newIOS, nil, 0, nil)
+	row.AddRow(4, 1, map[string]interface{}{"title": "android"}, false, nil, nil, nil, nil, nil, 0, nil, android, nil, 0, nil)
+
+	ExpectNoVariants(dbMock, "1", "1")
+	dbMock.ExpectQuery(`b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b
+		JOIN features_tags_to_banners ftb`).
+		WithArgs("1", "1", 0).
+		WillReturnRows(row)
+
+	testTable := []struct {
+		name    string
+		token   string
+		query   string
+		headers map[string]string
+		title   string
+	}{
+		{name: "no attributes", token: "user_token", title: "default"},
+		{name: "platform", token: "user_token", query: "&platform=ios", title: "ios"},
+		{name: "most specific rule wins", token: "user_token", query: "&platform=IOS&app_version=5.10",
+			title: "ios5"},
+		{name: "attributes from headers", token: "user_token",
+			headers: map[string]string{"X-Platform": "ios", "X-App-Version": "4.9"}, title: "ios"},
+		{name: "query param overrides header", token: "user_token", query: "&platform=web",
+			headers: map[string]string{"X-Platform": "ios"}, title: "default"},
+		{name: "inactive banner is skipped", token: "user_token", query: "&platform=android", title: "default"},
+		{name: "admin sees inactive banner", token: "admin_token", query: "&platform=android", title: "android"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=1&feature_id=1"+testCase.query, nil)
+			r.Header.Set("token", testCase.token)
+
+			for header, value := range testCase.headers {
+				r.Header.Set(header, value)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			require.JSONEq(t, `{"title": "`+testCase.title+`"}`, w.Body.String())
+
+			require.Eventually(t, func() bool {
+				return cacheLRU.Contains(banner_model.BannerKey{TagID: "1", FeatureID: "1"})
+			}, time.Second, 5*time.Millisecond)
+		})
+	}
+
+	require.NoError(t, dbMock.ExpectationsWereMet())
+
+	t.Run("no default banner", func(t *testing.T) {
+		cacheLRU.Add(banner_model.BannerKey{TagID: "2", FeatureID: "1"}, &banner_model.Banner{
+			Targeted: []banner_model.Banner{{ID: 2, Content: map[string]interface{}{"title": "ios"}, IsActive: true,
+				Targeting: &banner_model.Targeting{Rule: banner_model.Rule{Platform: []string{"ios"}}}}},
+		})
+
+		ExpectNoDefaults(dbMock, "1")
+
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=2&feature_id=1&platform=web", nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
+func TestBannerTargeting(t *testing.T) {
+	f := newFixture(t, withClock(&fakeClock{}))
+	dbMock, router := f.dbMock, f.router
+
+	content := map[string]interface{}{"title": "promo"}
+	slotTaken := &pgconn.PgError{Code: "23505", ConstraintName: "features_tags_to_banners_default_idx"}
+
+	testTable := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		statusCode int
+		mockFunc   func()
+	}{
+		{
+			name:   "insert with rule",
+			method: http.MethodPost,
+			path:   "/banner",
+			body: banner_model.BannerInsert{
+				Content:   content,
+				TagsID:    []int{1},
+				FeatureID: 1,
+				Targeting: &banner_model.Targeting{Rule: banner_model.Rule{Any: []banner_model.Rule{
+					{Region: []string{"RU-MOW"}},
+					{Not: &banner_model.Rule{AppVersion: &banner_model.VersionRange{To: "3.0"}}},
+				}}},
+			},
+			statusCode: http.StatusCreated,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("INSERT INTO banners").
+					WithArgs(false, (*time.Time)(nil), (*time.Time)(nil), (*banner_model.Schedule)(nil),
+						(*banner_model.FrequencyCap)(nil), (*int64)(nil), pgxmock.AnyArg(),
+						(*banner_model.RegionFilter)(nil), 0).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(2, content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, 2).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec(`INSERT INTO features_tags_to_banners \(feature_id, tag_id, banner_id, targeted\)
+					SELECT \$1, \$2, \$3, targeting IS NOT NULL FROM banners WHERE id = \$3`).
+					WithArgs(1, 1, 2).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "second default banner in slot",
+			method: http.MethodPost,
+			path:   "/banner",
+			body: banner_model.BannerInsert{
+				Content:   content,
+				TagsID:    []int{1},
+				FeatureID: 1,
+			},
+			statusCode: http.StatusConflict,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectQuery("INSERT INTO banners").
+					WithArgs(false, (*time.Time)(nil), (*time.Time)(nil), (*banner_model.Schedule)(nil),
+						(*banner_model.FrequencyCap)(nil), (*int64)(nil),
+						(*banner_model.Targeting)(nil), (*banner_model.RegionFilter)(nil), 0).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(3))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(3, content, "admin", banner_model.StatusPublished).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1))
+				dbMock.ExpectExec("UPDATE banners SET active_version").
+					WithArgs(1, 3).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
+					WithArgs(1, 1, 3).
+					WillReturnError(slotTaken)
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "node with two conditions",
+			method: http.MethodPost,
+			path:   "/banner",
+			body: map[string]interface{}{
+				"content": content, "tag_id": []int{1}, "feature_id": 1,
+				"targeting": map[string]interface{}{"platform": []string{"ios"}, "region": []string{"RU-MOW"}},
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "empty version range",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body: map[string]interface{}{
+				"targeting": map[string]interface{}{"app_version": map[string]interface{}{"from": "6.0", "to": "5.9"}},
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "malformed version",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body: map[string]interface{}{
+				"targeting": map[string]interface{}{"not": map[string]interface{}{"app_version": map[string]interface{}{
+					"from": "5.x"}}},
+			},
+			statusCode: http.StatusBadRequest,
+			mockFunc:   func() {},
+		},
+		{
+			name:   "add rule to banner",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			body: map[string]interface{}{
+				"targeting": map[string]interface{}{"region": []string{"RU-SPE"}},
+			},
+			statusCode: http.StatusOK,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET targeting = \$1, updated_at = now\(\) WHERE id = \$2`).
+					WithArgs(pgxmock.AnyArg(), 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec(`UPDATE features_tags_to_banners SET targeted = \$2 WHERE banner_id = \$1`).
+					WithArgs(1, true).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:       "delete rule",
+			method:     http.MethodDelete,
+			path:       "/banner/1/targeting",
+			statusCode: http.StatusNoContent,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec(`UPDATE banners SET targeting = NULL, updated_at = now\(\) WHERE id = \$1`).
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("UPDATE features_tags_to_banners SET targeted").
+					WithArgs(1, false).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:       "delete rule in taken slot",
+			method:     http.MethodDelete,
+			path:       "/banner/2/targeting",
+			statusCode: http.StatusConflict,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET targeting = NULL").
+					WithArgs(2).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectExec("UPDATE features_tags_to_banners SET targeted").
+					WithArgs(2, false).
+					WillReturnError(slotTaken)
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:       "delete rule of unknown banner",
+			method:     http.MethodDelete,
+			path:       "/banner/5/targeting",
+			statusCode: http.StatusNotFound,
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners SET targeting = NULL").
+					WithArgs(5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			var body bytes.Buffer
+			if testCase.body != nil {
+				if err := json.NewEncoder(&body).Encode(testCase.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, &body)
+			r.Header.Set("token", "admin_token")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.statusCode, w.Code, w.Body.String())
+			require.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
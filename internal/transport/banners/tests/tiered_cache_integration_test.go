@@ -0,0 +1,178 @@
+package banner_handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
+	rediscache "github.com/Heatdog/Avito/pkg/cache/redis"
+	tieredcache "github.com/Heatdog/Avito/pkg/cache/tiered"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredCache(t *testing.T) {
+	dbMock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbMock.Close()
+
+	redisServer := miniredis.RunT(t)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	defer redisClient.Close()
+
+	remote := rediscache.NewRedisCache[banner_model.BannerKey, *banner_model.Banner](slog.Default(), redisClient,
+		"banner:", time.Minute*time.Duration(5))
+
+	// два пода со своими локальными кэшами и общим Redis
+	newPod := func() (*mux.Router, *expirable.LRU[banner_model.BannerKey, *banner_model.Banner]) {
+		cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil,
+			time.Minute*time.Duration(5))
+		cache := tieredcache.NewTieredCache(slog.Default(), hashicorp_lru.NewLRU(slog.Default(), cacheLRU), remote)
+
+		return newFixture(t, withDB(dbMock), withCache(cache)).router, cacheLRU
+	}
+
+	firstPod, firstLRU := newPod()
+	secondPod, secondLRU := newPod()
+
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+	redisKey := `banner:{"tag_id":"1","feature_id":"1"}`
+	content := map[string]interface{}{"title": "banner"}
+
+	expectUserBanner := func() {
+		row := pgxmock.NewRows(userBannerColumns)
+		row.AddRow(1, 1, content, true, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
+
+		ExpectNoVariants(dbMock, key.FeatureID, key.TagID)
+		dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+			b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+			WithArgs(key.FeatureID, key.TagID, 0).
+			WillReturnRows(row)
+	}
+
+	testTable := []struct {
+		name   string
+		router *mux.Router
+
+		mockFunc func()
+		check    func(t *testing.T)
+	}{
+		{
+			name:   "miss in both tiers",
+			router: firstPod,
+
+			mockFunc: expectUserBanner,
+			check: func(t *testing.T) {
+				require.Eventually(t, func() bool {
+					return redisServer.Exists(redisKey) && firstLRU.Contains(key)
+				}, time.Second, 10*time.Millisecond)
+			},
+		},
+		{
+			name:   "other pod reads redis",
+			router: secondPod,
+
+			mockFunc: func() {},
+			check: func(t *testing.T) {
+				require.True(t, secondLRU.Contains(key))
+			},
+		},
+		{
+			name:   "local tier hit",
+			router: secondPod,
+
+			mockFunc: func() {
+				redisServer.FlushAll()
+			},
+			check: func(t *testing.T) {
+				require.False(t, redisServer.Exists(redisKey))
+			},
+		},
+		{
+			name:   "redis unavailable",
+			router: firstPod,
+
+			mockFunc: func() {
+				firstLRU.Purge()
+				redisServer.SetError("LOADING")
+				expectUserBanner()
+			},
+			check: func(t *testing.T) {
+				redisServer.SetError("")
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=1&feature_id=1", nil)
+			r.Header.Set("token", "user_token")
+
+			w := httptest.NewRecorder()
+			testCase.router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := json.Marshal(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, string(expected), string(data))
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			testCase.check(t)
+		})
+	}
+}
+
+func TestRedisCachePurge(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	defer redisClient.Close()
+
+	cache := rediscache.NewRedisCache[banner_model.BannerKey, *banner_model.Banner](slog.Default(), redisClient,
+		"banner:", time.Minute)
+
+	ctx := context.Background()
+
+	for i := 0; i < 1200; i++ {
+		key := banner_model.BannerKey{TagID: strconv.Itoa(i), FeatureID: "1"}
+
+		_, err := cache.Add(ctx, key, &banner_model.Banner{ID: i})
+		require.NoError(t, err)
+	}
+
+	// счетчики показов и ключи с похожим на шаблон префиксом живут в той же базе
+	require.NoError(t, redisServer.Set("frequency:1", "3"))
+	require.NoError(t, redisServer.Set("banner*other", "1"))
+
+	require.NoError(t, cache.Purge(ctx))
+
+	require.ElementsMatch(t, []string{"frequency:1", "banner*other"}, redisServer.Keys())
+}
@@ -5,56 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
-	"time"
 
 	banner_model "github.com/Heatdog/Avito/internal/models/banner"
-	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
-	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
-	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
-	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
-	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
-	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
-	"github.com/gorilla/mux"
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/require"
 )
 
 func TestUpdateBanner(t *testing.T) {
-	dbMock, err := pgxmock.NewPool()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbMock.Close()
-
-	opt := &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelError,
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
-	slog.SetDefault(logger)
-
-	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil,
-		time.Minute*time.Duration(5))
-	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
-
-	tokenProvider := simpletoken.NewSimpleTokenProvider()
-
-	logger.Debug("register middlewre")
-	middleware := middleware_transport.NewMiddleware(logger, tokenProvider)
-
-	bannerRepo := banner_postgre.NewBannerRepository(logger, dbMock)
-	bannerService := banner_service.NewBannerService(logger, bannerRepo, cache, tokenProvider)
-	bannerHandler := banners_transport.NewBannersHandler(logger, bannerService, middleware)
-	router := mux.NewRouter()
-
-	bannerHandler.Register(router)
+	f := newFixture(t)
+	dbMock, router := f.dbMock, f.router
 
 	type RespID struct {
 		ID int `json:"banner_id"`
@@ -101,9 +64,13 @@ func TestUpdateBanner(t *testing.T) {
 				defer dbMock.ExpectCommit()
 
 				dbMock.ExpectExec("UPDATE banners").
-					WithArgs(banner.Content, *banner.IsActive, banner.ID).
+					WithArgs(*banner.IsActive, banner.ID).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(banner.ID, banner.Content, "admin", banner_model.StatusDraft).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(2))
+
 				row := pgxmock.NewRows([]string{"feature_id", "tag_id"})
 				row.AddRow(1, 2)
 
@@ -120,6 +87,10 @@ func TestUpdateBanner(t *testing.T) {
 						WithArgs(*banner.FeatureID, tagID, banner.ID).
 						WillReturnResult(pgxmock.NewResult("INSERT", 1))
 				}
+
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
 			},
 		},
 		{
@@ -168,6 +139,17 @@ func TestUpdateBanner(t *testing.T) {
 				dbMock.ExpectExec("UPDATE banners").
 					WithArgs(*banner.IsActive, banner.ID).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+				row := pgxmock.NewRows([]string{"feature_id", "tag_id"})
+				row.AddRow(1, 2)
+
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(banner.ID).
+					WillReturnRows(row)
+
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
 			},
 		},
 		{
@@ -209,6 +191,10 @@ func TestUpdateBanner(t *testing.T) {
 						WithArgs(1, tagID, banner.ID).
 						WillReturnResult(pgxmock.NewResult("INSERT", 1))
 				}
+
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
 			},
 		},
 		{
@@ -248,6 +234,10 @@ func TestUpdateBanner(t *testing.T) {
 				dbMock.ExpectExec("INSERT INTO features_tags_to_banners").
 					WithArgs(*banner.FeatureID, 2, banner.ID).
 					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
 			},
 		},
 		{
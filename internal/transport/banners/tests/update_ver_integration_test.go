@@ -4,57 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
-	"time"
-
-	banner_model "github.com/Heatdog/Avito/internal/models/banner"
-	banner_postgre "github.com/Heatdog/Avito/internal/repository/banner/postgre"
-	banner_service "github.com/Heatdog/Avito/internal/service/bannerservice"
-	banners_transport "github.com/Heatdog/Avito/internal/transport/banners"
-	middleware_transport "github.com/Heatdog/Avito/internal/transport/middleware"
-	hashicorp_lru "github.com/Heatdog/Avito/pkg/cache/hashi_corp"
-	simpletoken "github.com/Heatdog/Avito/pkg/token/simple_token"
-	"github.com/gorilla/mux"
-	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/require"
 )
 
 func TestUpdateVersionBanner(t *testing.T) {
-	dbMock, err := pgxmock.NewPool()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbMock.Close()
-
-	opt := &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelError,
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, opt))
-	slog.SetDefault(logger)
-
-	cacheLRU := expirable.NewLRU[banner_model.BannerKey, *banner_model.Banner](0, nil,
-		time.Minute*time.Duration(5))
-	cache := hashicorp_lru.NewLRU(logger, cacheLRU)
-
-	tokenProvider := simpletoken.NewSimpleTokenProvider()
-
-	logger.Debug("register middlewre")
-	middleware := middleware_transport.NewMiddleware(logger, tokenProvider)
-
-	bannerRepo := banner_postgre.NewBannerRepository(logger, dbMock)
-	bannerService := banner_service.NewBannerService(logger, bannerRepo, cache, tokenProvider)
-	bannerHandler := banners_transport.NewBannersHandler(logger, bannerService, middleware)
-	router := mux.NewRouter()
+	f := newFixture(t)
+	dbMock, router := f.dbMock, f.router
 
-	bannerHandler.Register(router)
-
-	type mockBehavior func(id int, err error)
+	type mockBehavior func(id, version int)
 
 	testTable := []struct {
 		name  string
@@ -79,10 +42,23 @@ func TestUpdateVersionBanner(t *testing.T) {
 			statusCode: http.StatusOK,
 			err:        nil,
 
-			mockFunc: func(id int, _ error) {
+			mockFunc: func(id, version int) {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
 				dbMock.ExpectExec("UPDATE banners").
-					WithArgs(id).
+					WithArgs(id, version).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+				row := pgxmock.NewRows([]string{"feature_id", "tag_id"})
+				row.AddRow(1, 2)
+
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(id).
+					WillReturnRows(row)
+
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
 			},
 		},
 		{
@@ -95,7 +71,7 @@ func TestUpdateVersionBanner(t *testing.T) {
 			statusCode: http.StatusForbidden,
 			err:        nil,
 
-			mockFunc: func(_ int, _ error) {},
+			mockFunc: func(_, _ int) {},
 		},
 		{
 			name:     "Unauthorized",
@@ -107,19 +83,19 @@ func TestUpdateVersionBanner(t *testing.T) {
 			statusCode: http.StatusUnauthorized,
 			err:        nil,
 
-			mockFunc: func(_ int, _ error) {},
+			mockFunc: func(_, _ int) {},
 		},
 		{
 			name:     "bad version",
-			path:     "/banner/1/3123123",
+			path:     "/banner/1/0",
 			token:    "admin_token",
 			bannerID: 1,
-			version:  3123123,
+			version:  0,
 
 			statusCode: http.StatusBadRequest,
 			err:        fmt.Errorf("bad version"),
 
-			mockFunc: func(_ int, _ error) {},
+			mockFunc: func(_, _ int) {},
 		},
 		{
 			name:     "not found",
@@ -131,10 +107,12 @@ func TestUpdateVersionBanner(t *testing.T) {
 			statusCode: http.StatusNotFound,
 			err:        nil,
 
-			mockFunc: func(id int, _ error) {
+			mockFunc: func(id, version int) {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
 				dbMock.ExpectExec("UPDATE banners").
-					WithArgs(id).
+					WithArgs(id, version).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				dbMock.ExpectRollback()
 			},
 		},
 	}
@@ -145,7 +123,7 @@ func TestUpdateVersionBanner(t *testing.T) {
 
 			r.Header.Set("token", testCase.token)
 
-			testCase.mockFunc(testCase.bannerID, testCase.err)
+			testCase.mockFunc(testCase.bannerID, testCase.version)
 
 			w := httptest.NewRecorder()
 
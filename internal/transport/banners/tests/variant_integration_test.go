@@ -0,0 +1,434 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+var variantColumns = []string{"id", "version", "content", "is_active", "active_from", "active_until", "schedule",
+	"weight", "strategy", "epsilon", "seed", "frequency_cap", "regions", "priority", "updated_at"}
+
+var slotVariantColumns = []string{"banner_id", "weight", "strategy", "epsilon", "seed"}
+
+// ExpectNoVariants ожидает проверку эксперимента в слоте, которого нет
+func ExpectNoVariants(dbMock pgxmock.PgxPoolIface, featureID, tagID interface{}) {
+	dbMock.ExpectQuery("FROM slot_variants sv").
+		WithArgs(featureID, tagID).
+		WillReturnRows(pgxmock.NewRows(variantColumns))
+}
+
+func TestSlotVariants(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+	variants := banner_model.SlotVariants{Variants: []banner_model.VariantWeight{
+		{BannerID: 2, Weight: 70},
+		{BannerID: 3, Weight: 30},
+	}}
+
+	expectNotify := func() {
+		dbMock.ExpectExec("SELECT pg_notify").
+			WithArgs("banner_cache", `[{"tag_id":"1","feature_id":"1"}]`).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	}
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+
+		statusCode int
+		resp       interface{}
+		err        error
+		evicted    bool
+
+		mockFunc func()
+	}{
+		{
+			name:   "set variants",
+			method: http.MethodPut,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "editor_token",
+			body:   variants,
+
+			statusCode: http.StatusOK,
+			evicted:    true,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM slot_variants").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectExec("INSERT INTO slot_variants").
+					WithArgs(1, 1, 2, 70).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				dbMock.ExpectExec("INSERT INTO slot_variants").
+					WithArgs(1, 1, 3, 30).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectNotify()
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "set unknown banner",
+			method: http.MethodPut,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "admin_token",
+			body: banner_model.SlotVariants{Variants: []banner_model.VariantWeight{
+				{BannerID: 9, Weight: 1},
+			}},
+
+			statusCode: http.StatusBadRequest,
+			err:        banner_model.ErrUnknownVariant,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM slot_variants").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("DELETE", 2))
+				dbMock.ExpectExec("INSERT INTO slot_variants").
+					WithArgs(1, 1, 9, 1).
+					WillReturnError(&pgconn.PgError{Code: "23503"})
+				dbMock.ExpectRollback()
+			},
+		},
+		{
+			name:   "set duplicate banner",
+			method: http.MethodPut,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "admin_token",
+			body: banner_model.SlotVariants{Variants: []banner_model.VariantWeight{
+				{BannerID: 2, Weight: 1},
+				{BannerID: 2, Weight: 2},
+			}},
+
+			statusCode: http.StatusBadRequest,
+			err: fmt.Errorf("Key: 'SlotVariants.Variants' Error:Field validation for 'Variants' " +
+				"failed on the 'unique' tag"),
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "set zero weight",
+			method: http.MethodPut,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "admin_token",
+			body: banner_model.SlotVariants{Variants: []banner_model.VariantWeight{
+				{BannerID: 2, Weight: 0},
+			}},
+
+			statusCode: http.StatusBadRequest,
+			err: fmt.Errorf("Key: 'SlotVariants.Variants[0].Weight' Error:Field validation for 'Weight' " +
+				"failed on the 'required' tag"),
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "set without slot",
+			method: http.MethodPut,
+			path:   "/variants?tag_id=1",
+			token:  "admin_token",
+			body:   variants,
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf(`strconv.Atoi: parsing "": invalid syntax`),
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "set forbidden",
+			method: http.MethodPut,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "viewer_token",
+			body:   variants,
+
+			statusCode: http.StatusForbidden,
+
+			mockFunc: func() {},
+		},
+		{
+			name:   "get variants",
+			method: http.MethodGet,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "viewer_token",
+
+			statusCode: http.StatusOK,
+			resp:       variants,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT sv.banner_id, sv.weight, st.strategy, st.epsilon, st.seed FROM slot_variants").
+					WithArgs(1, 1).
+					WillReturnRows(pgxmock.NewRows(slotVariantColumns).
+						AddRow(2, 70, nil, nil, nil).
+						AddRow(3, 30, nil, nil, nil))
+			},
+		},
+		{
+			name:   "get variants without experiment",
+			method: http.MethodGet,
+			path:   "/variants?tag_id=2&feature_id=1",
+			token:  "viewer_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT sv.banner_id, sv.weight, st.strategy, st.epsilon, st.seed FROM slot_variants").
+					WithArgs(1, 2).
+					WillReturnRows(pgxmock.NewRows(slotVariantColumns))
+			},
+		},
+		{
+			name:   "delete variants",
+			method: http.MethodDelete,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "editor_token",
+
+			statusCode: http.StatusNoContent,
+			evicted:    true,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM slot_variants").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("DELETE", 2))
+				expectNotify()
+				dbMock.ExpectCommit()
+			},
+		},
+		{
+			name:   "delete variants without experiment",
+			method: http.MethodDelete,
+			path:   "/variants?tag_id=1&feature_id=1",
+			token:  "editor_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("DELETE FROM slot_variants").
+					WithArgs(1, 1).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheLRU.Purge()
+			cacheLRU.Add(key, &banner_model.Banner{ID: 1, Content: "cached", IsActive: true})
+
+			testCase.mockFunc()
+
+			var body []byte
+			if testCase.body != nil {
+				var err error
+				if body, err = json.Marshal(testCase.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+			require.Equal(t, testCase.evicted, !cacheLRU.Contains(key))
+
+			var expected []byte
+
+			switch {
+			case testCase.resp != nil:
+				expected, err = json.Marshal(testCase.resp)
+			case testCase.err != nil:
+				expected, err = json.Marshal(struct {
+					Err string `json:"error"`
+				}{
+					Err: testCase.err.Error(),
+				})
+			default:
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, string(expected), string(data))
+		})
+	}
+}
+
+func TestUserBannerVariants(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+
+	expectVariants := func(activeB bool) {
+		row := pgxmock.NewRows(variantColumns)
+		row.AddRow(2, 1, map[string]interface{}{"variant": "2"}, true, nil, nil, nil, 1, nil, nil, nil, nil, nil, 0, nil)
+		row.AddRow(3, 4, map[string]interface{}{"variant": "3"}, activeB, nil, nil, nil, 1, nil, nil, nil, nil, nil, 0, nil)
+
+		dbMock.ExpectQuery("FROM slot_variants sv").
+			WithArgs(key.FeatureID, key.TagID).
+			WillReturnRows(row)
+	}
+
+	get := func(t *testing.T, userID string) (int, string, map[string]interface{}) {
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=1&feature_id=1&user_id="+userID, nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		var content map[string]interface{}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &content))
+		}
+
+		return w.Code, w.Header().Get(banner_model.VariantHeader), content
+	}
+
+	t.Run("variant is stable per user and served from slot cache", func(t *testing.T) {
+		cacheLRU.Purge()
+		expectVariants(true)
+
+		first := map[string]string{}
+
+		for i := 0; i < 50; i++ {
+			userID := "user-" + strconv.Itoa(i)
+
+			code, variant, content := get(t, userID)
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, variant, content["variant"])
+
+			first[userID] = variant
+
+			require.Eventually(t, func() bool {
+				return cacheLRU.Contains(key)
+			}, time.Second, 5*time.Millisecond)
+		}
+
+		require.NoError(t, dbMock.ExpectationsWereMet())
+
+		seen := map[string]bool{}
+
+		for userID, variant := range first {
+			code, again, _ := get(t, userID)
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, variant, again)
+
+			seen[again] = true
+		}
+
+		require.Equal(t, map[string]bool{"2": true, "3": true}, seen)
+	})
+
+	t.Run("inactive variant gives its traffic to the others", func(t *testing.T) {
+		cacheLRU.Purge()
+		expectVariants(false)
+
+		for i := 0; i < 50; i++ {
+			code, variant, _ := get(t, "user-"+strconv.Itoa(i))
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, "2", variant)
+
+			require.Eventually(t, func() bool {
+				return cacheLRU.Contains(key)
+			}, time.Second, 5*time.Millisecond)
+		}
+
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("no live variants", func(t *testing.T) {
+		cacheLRU.Purge()
+
+		cacheLRU.Add(key, &banner_model.Banner{Variants: []banner_model.Variant{
+			{Banner: banner_model.Banner{ID: 2, Content: map[string]interface{}{"variant": "2"}}, Weight: 1},
+			{Banner: banner_model.Banner{ID: 3, Content: map[string]interface{}{"variant": "3"}}, Weight: 1},
+		}})
+
+		// баннеры по умолчанию тоже выключены, поэтому слот ничем не заменяется
+		for _, defaultKey := range []banner_model.BannerKey{banner_model.DefaultKey(key.FeatureID),
+			banner_model.DefaultKey("")} {
+			cacheLRU.Add(defaultKey, &banner_model.Banner{ID: 9, Content: map[string]interface{}{}})
+		}
+
+		code, _, _ := get(t, "user-1")
+		require.Equal(t, http.StatusNotFound, code)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("anonymous users are spread over variants", func(t *testing.T) {
+		cacheLRU.Purge()
+		expectVariants(true)
+
+		seen := map[string]bool{}
+
+		for i := 0; i < 50; i++ {
+			code, variant, _ := get(t, "")
+			require.Equal(t, http.StatusOK, code)
+
+			seen[variant] = true
+
+			require.Eventually(t, func() bool {
+				return cacheLRU.Contains(key)
+			}, time.Second, 5*time.Millisecond)
+		}
+
+		require.Equal(t, map[string]bool{"2": true, "3": true}, seen)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("explicit version ignores experiment", func(t *testing.T) {
+		cacheLRU.Purge()
+
+		row := pgxmock.NewRows(userBannerColumns)
+		row.AddRow(1, 2, map[string]interface{}{"variant": "owner"}, true, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
+
+		dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+			b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+			WithArgs(key.FeatureID, key.TagID, 2).
+			WillReturnRows(row)
+
+		r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id=1&feature_id=1&version=2&user_id=u", nil)
+		r.Header.Set("token", "user_token")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Empty(t, w.Header().Get(banner_model.VariantHeader))
+		require.JSONEq(t, `{"variant":"owner"}`, w.Body.String())
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
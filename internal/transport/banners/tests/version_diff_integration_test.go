@@ -0,0 +1,230 @@
+package banner_handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBannerVersionsAndDiff(t *testing.T) {
+	f := newFixture(t)
+	dbMock, router := f.dbMock, f.router
+
+	created := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	expectVersion := func(id, version int, content interface{}) {
+		row := pgxmock.NewRows([]string{"id", "version", "content", "is_active", "created_at", "updated_at"})
+		row.AddRow(id, version, content, true, created, created)
+
+		dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, v.created_at, b.updated_at
+			FROM banners b JOIN banner_versions v ON v.banner_id = b.id
+			WHERE b.id = \$1 AND v.version = \$2`).
+			WithArgs(id, version).
+			WillReturnRows(row)
+	}
+
+	testTable := []struct {
+		name  string
+		path  string
+		token string
+
+		statusCode int
+		resp       interface{}
+		err        error
+
+		mockFunc func()
+	}{
+		{
+			name:  "versions ok",
+			path:  "/banner/1/versions",
+			token: "admin_token",
+
+			statusCode: http.StatusOK,
+			resp: []banner_model.BannerVersion{
+				{Version: 2, Author: "admin", Status: banner_model.StatusDraft, CreatedAt: created},
+				{Version: 1, Author: "editor", Status: banner_model.StatusPublished, CreatedAt: created,
+					IsActive: true},
+			},
+
+			mockFunc: func() {
+				row := pgxmock.NewRows([]string{"version", "author", "status", "created_at", "is_active"})
+				row.AddRow(2, "admin", banner_model.StatusDraft, created, false)
+				row.AddRow(1, "editor", banner_model.StatusPublished, created, true)
+
+				dbMock.ExpectQuery("SELECT v.version, v.author, v.status, v.created_at").
+					WithArgs(1).
+					WillReturnRows(row)
+			},
+		},
+		{
+			name:  "versions not found",
+			path:  "/banner/2/versions",
+			token: "admin_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery("SELECT v.version, v.author, v.status, v.created_at").
+					WithArgs(2).
+					WillReturnRows(pgxmock.NewRows([]string{"version", "author", "status", "created_at", "is_active"}))
+			},
+		},
+		{
+			name:  "versions forbidden",
+			path:  "/banner/1/versions",
+			token: "user_token",
+
+			statusCode: http.StatusForbidden,
+
+			mockFunc: func() {},
+		},
+		{
+			name:  "diff ok",
+			path:  "/banner/1/diff?from=1&to=2",
+			token: "admin_token",
+
+			statusCode: http.StatusOK,
+			resp: banner_model.BannerDiff{
+				ID:   1,
+				From: 1,
+				To:   2,
+				Added: []banner_model.DiffValue{
+					{Path: "/tags/2", Value: "new"},
+					{Path: "/url", Value: "https://example.com"},
+				},
+				Removed: []banner_model.DiffValue{
+					{Path: "/style~1color", Value: "red"},
+				},
+				Changed: []banner_model.DiffChange{
+					{Path: "/meta/width", From: 100.0, To: 200.0},
+					{Path: "/title", From: "old", To: "new"},
+				},
+			},
+
+			mockFunc: func() {
+				expectVersion(1, 1, map[string]interface{}{
+					"title":       "old",
+					"style/color": "red",
+					"meta":        map[string]interface{}{"width": 100, "height": 50},
+					"tags":        []interface{}{"a", "b"},
+				})
+				expectVersion(1, 2, map[string]interface{}{
+					"title": "new",
+					"url":   "https://example.com",
+					"meta":  map[string]interface{}{"width": 200, "height": 50},
+					"tags":  []interface{}{"a", "b", "new"},
+				})
+			},
+		},
+		{
+			name:  "diff same version",
+			path:  "/banner/1/diff?from=2&to=2",
+			token: "admin_token",
+
+			statusCode: http.StatusOK,
+			resp: banner_model.BannerDiff{
+				ID:      1,
+				From:    2,
+				To:      2,
+				Added:   []banner_model.DiffValue{},
+				Removed: []banner_model.DiffValue{},
+				Changed: []banner_model.DiffChange{},
+			},
+
+			mockFunc: func() {
+				expectVersion(1, 2, map[string]interface{}{"title": "new"})
+				expectVersion(1, 2, map[string]interface{}{"title": "new"})
+			},
+		},
+		{
+			name:  "diff version not found",
+			path:  "/banner/1/diff?from=1&to=7",
+			token: "admin_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				expectVersion(1, 1, map[string]interface{}{"title": "old"})
+				dbMock.ExpectQuery("SELECT b.id, v.version, v.content").
+					WithArgs(1, 7).
+					WillReturnError(pgx.ErrNoRows)
+			},
+		},
+		{
+			name:  "diff bad version",
+			path:  "/banner/1/diff?from=0&to=2",
+			token: "admin_token",
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf("bad from version"),
+
+			mockFunc: func() {},
+		},
+		{
+			name:  "diff missing to",
+			path:  "/banner/1/diff?from=1",
+			token: "admin_token",
+
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf("bad to version"),
+
+			mockFunc: func() {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			r := httptest.NewRequest(http.MethodGet, testCase.path, nil)
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			var expected []byte
+
+			switch {
+			case testCase.resp != nil:
+				expected, err = json.Marshal(testCase.resp)
+			case testCase.err != nil:
+				expected, err = json.Marshal(struct {
+					Err string `json:"error"`
+				}{
+					Err: testCase.err.Error(),
+				})
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected == nil {
+				require.Empty(t, data)
+				return
+			}
+
+			require.JSONEq(t, string(expected), string(data))
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package banner_handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBannerVersionHistory(t *testing.T) {
+	f := newFixture(t, withRetention(3))
+	dbMock, cacheLRU, router := f.dbMock, f.cacheLRU, f.router
+
+	key := banner_model.BannerKey{TagID: "1", FeatureID: "1"}
+	oldContent := map[string]interface{}{"title": "old"}
+	newContent := map[string]interface{}{"title": "new"}
+
+	expectUserBanner := func(version, rowVersion int, content interface{}) {
+		row := pgxmock.NewRows(userBannerColumns)
+		row.AddRow(1, rowVersion, content, true, nil, nil, nil, nil, nil, 0, nil, nil, nil, 0, nil)
+
+		if version == 0 {
+			ExpectNoVariants(dbMock, key.FeatureID, key.TagID)
+		}
+
+		dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+			b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+			WithArgs(key.FeatureID, key.TagID, version).
+			WillReturnRows(row)
+	}
+
+	// за пределами хранения удаляются только опубликованные версии, черновики на согласовании
+	// и их одобрения остаются
+	pruneQuery := `DELETE FROM banner_versions WHERE banner_id = \$1 AND version <= \$2 AND status = 'published'`
+
+	testTable := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+
+		statusCode int
+		content    interface{}
+
+		mockFunc func()
+		check    func(t *testing.T)
+	}{
+		{
+			name:   "update prunes old versions",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body:   banner_model.BannerUpdate{Content: newContent},
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, newContent, "admin", banner_model.StatusDraft).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(5))
+				dbMock.ExpectExec(pruneQuery).
+					WithArgs(1, 2).
+					WillReturnResult(pgxmock.NewResult("DELETE", 2))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			// версии 3 и 5 ждут согласования, удалять за пределами хранения нечего
+			name:   "retention keeps pending drafts",
+			method: http.MethodPatch,
+			path:   "/banner/1",
+			token:  "admin_token",
+			body:   banner_model.BannerUpdate{Content: newContent},
+
+			statusCode: http.StatusOK,
+
+			mockFunc: func() {
+				dbMock.ExpectBeginTx(pgx.TxOptions{})
+				dbMock.ExpectExec("UPDATE banners").
+					WithArgs(1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				dbMock.ExpectQuery("INSERT INTO banner_versions").
+					WithArgs(1, newContent, "admin", banner_model.StatusDraft).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(6))
+				dbMock.ExpectExec(pruneQuery).
+					WithArgs(1, 3).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				dbMock.ExpectQuery("SELECT feature_id, tag_id FROM features_tags_to_banners").
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"feature_id", "tag_id"}).AddRow(1, 1))
+				dbMock.ExpectExec("SELECT pg_notify").
+					WithArgs("banner_cache", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("SELECT", 1))
+				dbMock.ExpectCommit()
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "draft is not shown until published",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1",
+			token:  "user_token",
+
+			statusCode: http.StatusOK,
+			content:    oldContent,
+
+			mockFunc: func() {
+				expectUserBanner(0, 4, oldContent)
+			},
+			check: func(t *testing.T) {
+				require.Eventually(t, func() bool {
+					return cacheLRU.Contains(key)
+				}, time.Second, 5*time.Millisecond)
+			},
+		},
+		{
+			name:   "retained version bypasses cache",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1&version=3",
+			token:  "user_token",
+
+			statusCode: http.StatusOK,
+			content:    oldContent,
+
+			mockFunc: func() {
+				expectUserBanner(3, 3, oldContent)
+			},
+			check: func(t *testing.T) {
+				banner, ok := cacheLRU.Get(key)
+				require.True(t, ok)
+				require.Equal(t, 4, banner.Version)
+			},
+		},
+		{
+			name:   "active version number is served from cache",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1&version=4",
+			token:  "user_token",
+
+			statusCode: http.StatusOK,
+			content:    oldContent,
+
+			mockFunc: func() {},
+			check:    func(_ *testing.T) {},
+		},
+		{
+			name:   "draft version",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1&version=5",
+			token:  "user_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs(key.FeatureID, key.TagID, 5).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			check: func(_ *testing.T) {},
+		},
+		{
+			name:   "pruned version",
+			method: http.MethodGet,
+			path:   "/user_banner?tag_id=1&feature_id=1&version=2",
+			token:  "user_token",
+
+			statusCode: http.StatusNotFound,
+
+			mockFunc: func() {
+				dbMock.ExpectQuery(`SELECT b.id, v.version, v.content, b.is_active, b.active_from, b.active_until, b.schedule, r.version, r.content,
+					b.rollout_percent, b.frequency_cap, b.targeting, b.regions, b.priority, b.updated_at FROM banners b JOIN features_tags_to_banners ftb`).
+					WithArgs(key.FeatureID, key.TagID, 2).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			check: func(_ *testing.T) {},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mockFunc()
+
+			var body []byte
+			if testCase.body != nil {
+				var err error
+				body, err = json.Marshal(testCase.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBuffer(body))
+			r.Header.Set("token", testCase.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			require.Equal(t, testCase.statusCode, w.Code)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			if testCase.content != nil {
+				expected, err := json.Marshal(testCase.content)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				require.JSONEq(t, string(expected), string(data))
+			}
+
+			testCase.check(t)
+		})
+	}
+}
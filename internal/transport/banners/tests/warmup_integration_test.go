@@ -0,0 +1,125 @@
+package banner_handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	probe_transport "github.com/Heatdog/Avito/internal/transport/probe"
+	"github.com/gorilla/mux"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheWarmUp(t *testing.T) {
+	f := newFixture(t)
+	dbMock, cacheLRU, router, logger, bannerService := f.dbMock, f.cacheLRU, f.router, f.logger, f.service
+
+	probeHandler := probe_transport.NewProbeHandler(logger)
+	probeRouter := mux.NewRouter()
+
+	probeHandler.Register(probeRouter)
+
+	columns := []string{"tag_id", "feature_id", "id", "version", "content", "is_active", "active_from", "active_until",
+		"schedule", "frequency_cap", "regions", "priority", "updated_at"}
+	content := map[string]interface{}{"title": "banner"}
+
+	testTable := []struct {
+		name  string
+		limit int
+
+		count  int
+		cached []banner_model.BannerKey
+		missed []banner_model.BannerKey
+
+		mockFunc func()
+	}{
+		{
+			name:  "all active banners",
+			limit: 0,
+
+			count: 3,
+			cached: []banner_model.BannerKey{
+				{TagID: "1", FeatureID: "1"},
+				{TagID: "2", FeatureID: "1"},
+				{TagID: "3", FeatureID: "2"},
+			},
+
+			mockFunc: func() {
+				row := pgxmock.NewRows(columns)
+				row.AddRow(1, 1, 1, 1, content, true, nil, nil, nil, nil, nil, 0, nil)
+				row.AddRow(2, 1, 1, 1, content, true, nil, nil, nil, nil, nil, 0, nil)
+				row.AddRow(3, 2, 2, 1, content, true, nil, nil, nil, nil, nil, 0, nil)
+
+				dbMock.ExpectQuery("SELECT ftb.tag_id, ftb.feature_id, b.id").
+					WillReturnRows(row)
+			},
+		},
+		{
+			name:  "limited by cache size",
+			limit: 2,
+
+			count: 2,
+			cached: []banner_model.BannerKey{
+				{TagID: "1", FeatureID: "1"},
+				{TagID: "2", FeatureID: "1"},
+			},
+			missed: []banner_model.BannerKey{
+				{TagID: "3", FeatureID: "2"},
+			},
+
+			mockFunc: func() {
+				row := pgxmock.NewRows(columns)
+				row.AddRow(1, 1, 1, 1, content, true, nil, nil, nil, nil, nil, 0, nil)
+				row.AddRow(2, 1, 1, 1, content, true, nil, nil, nil, nil, nil, 0, nil)
+				row.AddRow(3, 2, 2, 1, content, true, nil, nil, nil, nil, nil, 0, nil)
+
+				dbMock.ExpectQuery("SELECT ftb.tag_id, ftb.feature_id, b.id").
+					WillReturnRows(row)
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheLRU.Purge()
+
+			w := httptest.NewRecorder()
+			probeRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+			testCase.mockFunc()
+
+			count, err := bannerService.WarmUp(context.Background(), testCase.limit)
+			require.NoError(t, err)
+			require.Equal(t, testCase.count, count)
+			require.NoError(t, dbMock.ExpectationsWereMet())
+
+			for _, key := range testCase.cached {
+				require.True(t, cacheLRU.Contains(key))
+
+				// баннер отдается из кэша без обращения к базе
+				r := httptest.NewRequest(http.MethodGet, "/user_banner?tag_id="+key.TagID+
+					"&feature_id="+key.FeatureID, nil)
+				r.Header.Set("token", "user_token")
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+
+				require.Equal(t, http.StatusOK, w.Code)
+			}
+
+			for _, key := range testCase.missed {
+				require.False(t, cacheLRU.Contains(key))
+			}
+		})
+	}
+
+	probeHandler.SetReady()
+
+	w := httptest.NewRecorder()
+	probeRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
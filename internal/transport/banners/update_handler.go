@@ -2,6 +2,7 @@ package bannerstransport
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -18,17 +19,18 @@ import (
 // Обновление содержимого баннера
 // @Summary UpdateBanner
 // @Security ApiKeyAuth
-// @Description Обновление содержимого баннера
+// @Description Обновление содержимого баннера. Явный null в active_from или active_until снимает границу окна показа
 // @ID update-banner
 // @Tags banner
 // @Produce json
 // @Param id path integer true "id"
 // @Param input body banner_model.BannerUpdate true "banner info"
 // @Success 200 {object} nil OK
-// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 400 {object} transport.RespWriterError Некорректные данные, окно показа, которое закончится раньше, чем начнется, или неполный слот баннера без слотов
 // @Failure 401 {object} nil Пользователь не авторизован
 // @Failure 403 {object} nil Пользователь не имеет доступа
 // @Failure 404 {object} nil Баннер не найден
+// @Failure 409 {object} transport.RespWriterError В слоте уже есть баннер без правил таргетинга или идет раскатка
 // @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
 // @Router /banner/{id} [patch]
 func (handler *bannersHandler) updateBanner(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +63,23 @@ func (handler *bannersHandler) updateBanner(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// явный null снимает границу окна показа, отсутствующая граница не меняется
+	var window struct {
+		ActiveFrom  json.RawMessage `json:"active_from"`
+		ActiveUntil json.RawMessage `json:"active_until"`
+	}
+
+	if err := json.Unmarshal(body, &window); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
 	banner.ID = id
+	banner.Author = subject(r)
+	banner.ClearActiveFrom = string(window.ActiveFrom) == "null"
+	banner.ClearActiveUntil = string(window.ActiveUntil) == "null"
 
 	handler.logger.Debug("validate request body", slog.Any("banner", banner))
 
@@ -81,6 +99,48 @@ func (handler *bannersHandler) updateBanner(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if err = banner_model.ValidWindow(banner.ActiveFrom, banner.ActiveUntil); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	if banner.Schedule != nil {
+		if err = banner.Schedule.Validate(); err != nil {
+			handler.logger.Debug(err.Error())
+			transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+			return
+		}
+	}
+
+	if banner.Targeting != nil {
+		if err = banner.Targeting.Compile(); err != nil {
+			handler.logger.Debug(err.Error())
+			transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+			return
+		}
+	}
+
+	if banner.Regions != nil {
+		if err = banner.Regions.Validate(); err != nil {
+			handler.logger.Debug(err.Error())
+			transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+			return
+		}
+	}
+
+	if banner.RolloutPercent != nil && banner.Content == nil {
+		err = banner_model.ErrRolloutWithoutContent
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
 	handler.logger.Debug("valid successful")
 
 	err = handler.service.UpdateBanner(r.Context(), &banner)
@@ -91,6 +151,27 @@ func (handler *bannersHandler) updateBanner(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if errors.Is(err, banner_model.ErrSlotTaken) {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusConflict, err.Error(), handler.logger)
+
+		return
+	}
+
+	if errors.Is(err, banner_model.ErrRolloutInProgress) {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusConflict, err.Error(), handler.logger)
+
+		return
+	}
+
+	if errors.Is(err, banner_model.ErrBadWindow) || errors.Is(err, banner_model.ErrNoSlot) {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
 	if err != nil {
 		handler.logger.Debug(err.Error())
 		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
@@ -102,10 +183,10 @@ func (handler *bannersHandler) updateBanner(w http.ResponseWriter, r *http.Reque
 	handler.logger.Debug("update OK")
 }
 
-// Обновление последней версии баннера
+// Выбор активной версии баннера
 // @Summary UpdateBannerVersion
 // @Security ApiKeyAuth
-// @Description Обновление последней версии баннера
+// @Description Делает активной одну из сохраненных версий баннера
 // @ID update-banner-version
 // @Tags banner
 // @Produce json
@@ -135,7 +216,7 @@ func (handler *bannersHandler) updateBannerVersion(w http.ResponseWriter, r *htt
 		return
 	}
 
-	if version < 1 || version > 3 {
+	if version < 1 {
 		err = fmt.Errorf("bad version")
 		handler.logger.Debug(err.Error())
 		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
@@ -0,0 +1,230 @@
+package bannerstransport
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	banner_model "github.com/Heatdog/Avito/internal/models/banner"
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+)
+
+// Получение вариантов эксперимента слота
+// @Summary GetSlotVariants
+// @Security ApiKeyAuth
+// @Description Получение баннеров, участвующих в эксперименте слота (тег, фича), и их весов
+// @ID get-slot-variants
+// @Tags variants
+// @Produce json
+// @Param tag_id query integer true "tag_id"
+// @Param feature_id query integer true "feature_id"
+// @Success 200 {object} banner_model.SlotVariants Варианты слота
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil В слоте нет эксперимента
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /variants [get]
+func (handler *bannersHandler) getSlotVariants(w http.ResponseWriter, r *http.Request) {
+	featureID, tagID, err := slotParams(r)
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("get slot variants handler", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	variants, err := handler.service.GetSlotVariants(r.Context(), featureID, tagID)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, variants, handler.logger)
+}
+
+// Запуск или изменение эксперимента в слоте
+// @Summary SetSlotVariants
+// @Security ApiKeyAuth
+// @Description Заменяет варианты эксперимента слота (тег, фича). Пока эксперимент идет, /user_banner
+// @Description выбирает для пользователя один из баннеров-вариантов пропорционально весу
+// @Description или по кликам, если задана стратегия epsilon_greedy или thompson
+// @ID set-slot-variants
+// @Tags variants
+// @Param tag_id query integer true "tag_id"
+// @Param feature_id query integer true "feature_id"
+// @Param input body banner_model.SlotVariants true "variants"
+// @Success 200 {object} nil OK
+// @Failure 400 {object} transport.RespWriterError Некорректные данные или несуществующий баннер
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /variants [put]
+func (handler *bannersHandler) setSlotVariants(w http.ResponseWriter, r *http.Request) {
+	featureID, tagID, err := slotParams(r)
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	defer r.Body.Close()
+
+	var variants banner_model.SlotVariants
+
+	if err = json.NewDecoder(r.Body).Decode(&variants); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("set slot variants handler", slog.Int("feature", featureID), slog.Int("tag", tagID),
+		slog.Any("variants", variants))
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err = validate.Struct(variants); err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	err = handler.service.SetSlotVariants(r.Context(), featureID, tagID, variants)
+	if errors.Is(err, banner_model.ErrUnknownVariant) {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Завершение эксперимента в слоте
+// @Summary DeleteSlotVariants
+// @Security ApiKeyAuth
+// @Description Удаляет варианты слота, после чего /user_banner снова отдает баннер, привязанный к слоту
+// @ID delete-slot-variants
+// @Tags variants
+// @Param tag_id query integer true "tag_id"
+// @Param feature_id query integer true "feature_id"
+// @Success 204 {object} nil Эксперимент завершен
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil В слоте нет эксперимента
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /variants [delete]
+func (handler *bannersHandler) deleteSlotVariants(w http.ResponseWriter, r *http.Request) {
+	featureID, tagID, err := slotParams(r)
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("delete slot variants handler", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	err = handler.service.DeleteSlotVariants(r.Context(), featureID, tagID)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Текущее распределение трафика между вариантами слота
+// @Summary GetSlotAllocation
+// @Security ApiKeyAuth
+// @Description Показы, клики и доля трафика каждого варианта слота. Статистика собирается
+// @Description каждым подом отдельно, поэтому ответ отражает пода, принявшего запрос
+// @ID get-slot-allocation
+// @Tags variants
+// @Produce json
+// @Param tag_id query integer true "tag_id"
+// @Param feature_id query integer true "feature_id"
+// @Success 200 {object} banner_model.SlotAllocation Распределение трафика
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil В слоте нет эксперимента
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /variants/allocation [get]
+func (handler *bannersHandler) getSlotAllocation(w http.ResponseWriter, r *http.Request) {
+	featureID, tagID, err := slotParams(r)
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("get slot allocation handler", slog.Int("feature", featureID), slog.Int("tag", tagID))
+
+	allocation, err := handler.service.GetSlotAllocation(r.Context(), featureID, tagID)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, allocation, handler.logger)
+}
+
+// slotParams разбирает обязательные параметры слота feature_id и tag_id
+func slotParams(r *http.Request) (int, int, error) {
+	featureID, err := strconv.Atoi(r.URL.Query().Get("feature_id"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tagID, err := strconv.Atoi(r.URL.Query().Get("tag_id"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return featureID, tagID, nil
+}
@@ -0,0 +1,121 @@
+package bannerstransport
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Heatdog/Avito/internal/transport"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Получение списка сохраненных версий баннера
+// @Summary GetBannerVersions
+// @Security ApiKeyAuth
+// @Description Получение списка сохраненных версий баннера, начиная с новой
+// @ID get-banner-versions
+// @Tags banner
+// @Produce json
+// @Param id path integer true "id"
+// @Success 200 {object} []banner_model.BannerVersion Список версий
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер не найден
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/versions [get]
+func (handler *bannersHandler) getBannerVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("get banner versions handler", slog.Int("id", id))
+
+	versions, err := handler.service.GetBannerVersions(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, versions, handler.logger)
+}
+
+// Сравнение содержимого двух версий баннера
+// @Summary DiffBannerVersions
+// @Security ApiKeyAuth
+// @Description Возвращает добавленные, удаленные и измененные пути содержимого версии to относительно версии from
+// @ID diff-banner-versions
+// @Tags banner
+// @Produce json
+// @Param id path integer true "id"
+// @Param from query integer true "исходная версия"
+// @Param to query integer true "новая версия"
+// @Success 200 {object} banner_model.BannerDiff Разница версий
+// @Failure 400 {object} transport.RespWriterError Некорректные данные
+// @Failure 401 {object} nil Пользователь не авторизован
+// @Failure 403 {object} nil Пользователь не имеет доступа
+// @Failure 404 {object} nil Баннер или версия не найдены
+// @Failure 500 {object} transport.RespWriterError Внутренняя ошибка сервера
+// @Router /banner/{id}/diff [get]
+func (handler *bannersHandler) diffBannerVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 1 {
+		err = fmt.Errorf("bad from version")
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil || to < 1 {
+		err = fmt.Errorf("bad to version")
+		handler.logger.Debug(err.Error())
+		transport.ResponseWriteError(w, http.StatusBadRequest, err.Error(), handler.logger)
+
+		return
+	}
+
+	handler.logger.Debug("diff banner versions handler", slog.Int("id", id), slog.Int("from", from),
+		slog.Int("to", to))
+
+	diff, err := handler.service.DiffBannerVersions(r.Context(), id, from, to)
+	if err == pgx.ErrNoRows {
+		handler.logger.Debug(err.Error())
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		handler.logger.Warn(err.Error())
+		transport.ResponseWriteError(w, http.StatusInternalServerError, err.Error(), handler.logger)
+
+		return
+	}
+
+	transport.ResponseWriteJSON(w, http.StatusOK, diff, handler.logger)
+}
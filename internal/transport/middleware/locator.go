@@ -0,0 +1,90 @@
+package middlewaretransport
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/Heatdog/Avito/pkg/geo"
+)
+
+// Locator определяет IP-адрес клиента и его регион и кладет их в контекст запроса
+// под ключами "ip" и "region". X-Forwarded-For учитывается, только пока запрос
+// приходит от доверенных прокси trusted. Без базы регионов определяется только адрес
+type Locator struct {
+	logger  *slog.Logger
+	db      geo.Database
+	trusted []netip.Prefix
+}
+
+func NewLocator(logger *slog.Logger, db geo.Database, trusted []netip.Prefix) *Locator {
+	return &Locator{
+		logger:  logger,
+		db:      db,
+		trusted: trusted,
+	}
+}
+
+func (locator *Locator) Locate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := locator.clientIP(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ContextKey{Key: "ip"}, addr)
+
+		if locator.db != nil {
+			if region, ok := locator.db.Region(addr); ok {
+				ctx = context.WithValue(ctx, ContextKey{Key: "region"}, region)
+			}
+		}
+
+		locator.logger.Debug("client located", slog.String("ip", addr.String()),
+			slog.Any("region", ctx.Value(ContextKey{Key: "region"})))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP идет по X-Forwarded-For справа налево, пока адреса принадлежат доверенным прокси.
+// Первый недоверенный адрес и есть клиент: адреса левее него мог подставить сам клиент
+func (locator *Locator) clientIP(r *http.Request) (netip.Addr, bool) {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		locator.logger.Debug(err.Error())
+		return netip.Addr{}, false
+	}
+
+	addr := remote.Addr().Unmap()
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0 && locator.isTrusted(addr); i-- {
+		next, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			locator.logger.Debug(err.Error())
+			break
+		}
+
+		addr = next.Unmap()
+	}
+
+	return addr, true
+}
+
+func (locator *Locator) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range locator.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
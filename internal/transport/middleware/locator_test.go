@@ -0,0 +1,113 @@
+package middlewaretransport
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	csvgeo "github.com/Heatdog/Avito/pkg/geo/csv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocatorClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("192.168.0.0/16"),
+		netip.MustParsePrefix("172.16.0.1/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	testTable := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		ip         string
+	}{
+		{name: "direct client", remoteAddr: "10.1.0.5:1234", ip: "10.1.0.5"},
+		{name: "ipv4-mapped peer", remoteAddr: "[::ffff:10.1.0.5]:1234", ip: "10.1.0.5"},
+		{name: "ipv6 peer", remoteAddr: "[2001:db8::1]:1234", ip: "2001:db8::1"},
+		{name: "header from untrusted peer", remoteAddr: "10.2.0.1:1234", forwarded: []string{"10.1.0.5"},
+			ip: "10.2.0.1"},
+		{name: "trusted proxy", remoteAddr: "192.168.1.1:1234", forwarded: []string{"10.1.0.5"}, ip: "10.1.0.5"},
+		{name: "trusted single address", remoteAddr: "172.16.0.1:1234", forwarded: []string{"10.1.0.5"},
+			ip: "10.1.0.5"},
+		{name: "neighbour of trusted address", remoteAddr: "172.16.0.2:1234", forwarded: []string{"10.1.0.5"},
+			ip: "172.16.0.2"},
+		{name: "trusted proxy without header", remoteAddr: "192.168.1.1:1234", ip: "192.168.1.1"},
+		{name: "chain of trusted proxies", remoteAddr: "192.168.1.1:1234",
+			forwarded: []string{"10.1.0.5, 172.16.0.1, 192.168.2.2"}, ip: "10.1.0.5"},
+		{name: "spoofed address before client", remoteAddr: "192.168.1.1:1234",
+			forwarded: []string{"10.9.9.9, 10.1.0.5"}, ip: "10.1.0.5"},
+		{name: "untrusted address in the middle", remoteAddr: "192.168.1.1:1234",
+			forwarded: []string{"10.1.0.5, 10.2.0.1, 192.168.2.2"}, ip: "10.2.0.1"},
+		{name: "several header lines", remoteAddr: "192.168.1.1:1234",
+			forwarded: []string{"10.9.9.9", "10.1.0.5,192.168.2.2"}, ip: "10.1.0.5"},
+		{name: "only trusted proxies", remoteAddr: "192.168.1.1:1234", forwarded: []string{"192.168.3.3"},
+			ip: "192.168.3.3"},
+		{name: "garbage stops at last trusted proxy", remoteAddr: "192.168.1.1:1234",
+			forwarded: []string{"10.1.0.5, unknown"}, ip: "192.168.1.1"},
+		{name: "ipv6 chain", remoteAddr: "[fd00::1]:1234", forwarded: []string{"2001:db8::5, fd00::2"},
+			ip: "2001:db8::5"},
+		{name: "ipv4-mapped client in header", remoteAddr: "192.168.1.1:1234",
+			forwarded: []string{"::ffff:10.1.0.5"}, ip: "10.1.0.5"},
+		{name: "bad remote address", remoteAddr: "pipe", forwarded: []string{"10.1.0.5"}},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			locator := NewLocator(slog.Default(), nil, trusted)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = testCase.remoteAddr
+
+			for _, header := range testCase.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+
+			addr, ok := locator.clientIP(r)
+			require.Equal(t, testCase.ip != "", ok)
+
+			if ok {
+				require.Equal(t, netip.MustParseAddr(testCase.ip), addr)
+			}
+		})
+	}
+}
+
+func TestLocatorLocate(t *testing.T) {
+	db, err := csvgeo.NewCSVDatabase(strings.NewReader("10.1.0.0/16,RU-MOW\n"))
+	require.NoError(t, err)
+
+	testTable := []struct {
+		name       string
+		remoteAddr string
+		ip         interface{}
+		region     interface{}
+	}{
+		{name: "known region", remoteAddr: "10.1.0.5:1234", ip: netip.MustParseAddr("10.1.0.5"), region: "RU-MOW"},
+		{name: "unknown region", remoteAddr: "10.2.0.5:1234", ip: netip.MustParseAddr("10.2.0.5")},
+		{name: "bad remote address", remoteAddr: "pipe"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var ip, region interface{}
+
+			handler := NewLocator(slog.Default(), db, nil).Locate(http.HandlerFunc(
+				func(_ http.ResponseWriter, r *http.Request) {
+					ip = r.Context().Value(ContextKey{Key: "ip"})
+					region = r.Context().Value(ContextKey{Key: "region"})
+				}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = testCase.remoteAddr
+
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			require.Equal(t, testCase.ip, ip)
+			require.Equal(t, testCase.region, region)
+		})
+	}
+}
@@ -27,43 +27,46 @@ type ContextKey struct {
 
 func (mid *Middleware) Auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("token")
+		tokenStr := r.Header.Get("token")
 
-		mid.logger.Debug("verify token", slog.String("token", token))
+		mid.logger.Debug("verify token", slog.String("token", tokenStr))
 
-		if token == "" {
+		if tokenStr == "" {
 			mid.logger.Debug("token is empty")
 			w.WriteHeader(http.StatusUnauthorized)
 
 			return
 		}
 
-		if !mid.tokenProvider.VerifyToken(token) {
+		identity, ok := mid.tokenProvider.VerifyToken(tokenStr)
+		if !ok {
 			mid.logger.Debug("token incorrect")
 			w.WriteHeader(http.StatusUnauthorized)
 
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), ContextKey{Key: "token"}, token)
+		ctx := context.WithValue(r.Context(), ContextKey{Key: "token"}, tokenStr)
+		ctx = context.WithValue(ctx, ContextKey{Key: "role"}, identity.Role)
+		ctx = context.WithValue(ctx, ContextKey{Key: "subject"}, identity.Subject)
 		next(w, r.WithContext(ctx))
 	}
 }
 
-func (mid *Middleware) AdminAuth(next http.HandlerFunc) http.HandlerFunc {
+func (mid *Middleware) Permission(permission token.Permission, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Context().Value(ContextKey{Key: "token"})
-		if token == nil {
-			mid.logger.Debug("empty token")
+		role, ok := r.Context().Value(ContextKey{Key: "role"}).(token.Role)
+		if !ok {
+			mid.logger.Debug("empty role")
 			w.WriteHeader(http.StatusUnauthorized)
 
 			return
 		}
 
-		mid.logger.Debug("token", token)
+		mid.logger.Debug("check permission", slog.Any("role", role), slog.Any("permission", permission))
 
-		if !mid.tokenProvider.VerifyOnAdmin(token.(string)) {
-			mid.logger.Debug("not admin token")
+		if !role.HasPermission(permission) {
+			mid.logger.Debug("permission denied")
 			w.WriteHeader(http.StatusForbidden)
 
 			return
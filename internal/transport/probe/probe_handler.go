@@ -0,0 +1,56 @@
+package probetransport
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+)
+
+// ProbeHandler отвечает на проверки оркестратора. Сервис считается готовым
+// принимать трафик только после вызова SetReady
+type ProbeHandler struct {
+	logger *slog.Logger
+	ready  atomic.Bool
+}
+
+func NewProbeHandler(logger *slog.Logger) *ProbeHandler {
+	return &ProbeHandler{
+		logger: logger,
+	}
+}
+
+const (
+	live  = "/live"
+	ready = "/ready"
+)
+
+func (handler *ProbeHandler) Register(router *mux.Router) {
+	router.HandleFunc(live, handler.live).Methods(http.MethodGet)
+	router.HandleFunc(ready, handler.readiness).Methods(http.MethodGet)
+}
+
+func (handler *ProbeHandler) SetReady() {
+	handler.logger.Info("service is ready")
+	handler.ready.Store(true)
+}
+
+// SetNotReady снимает под с балансировки на время остановки
+func (handler *ProbeHandler) SetNotReady() {
+	handler.logger.Info("service is not ready")
+	handler.ready.Store(false)
+}
+
+func (handler *ProbeHandler) live(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (handler *ProbeHandler) readiness(w http.ResponseWriter, _ *http.Request) {
+	if !handler.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
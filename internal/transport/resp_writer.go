@@ -55,3 +55,23 @@ func ResponseWriteBannerCreated(w http.ResponseWriter, id int, logger *slog.Logg
 
 	logger.Debug("response banner created", slog.Int("id", id))
 }
+
+func ResponseWriteJSON(w http.ResponseWriter, statusCode int, value interface{}, logger *slog.Logger) {
+	resp, err := json.Marshal(value)
+	if err != nil {
+		logger.Warn(err.Error())
+		ResponseWriteError(w, http.StatusInternalServerError, err.Error(), logger)
+
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(resp); err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	logger.Debug("response write", slog.String("body", string(resp)), slog.Int("satus code", statusCode))
+}
@@ -0,0 +1,41 @@
+-- Перенос версий баннеров из колонок content_v1..content_v3 в таблицу banner_versions.
+-- Самая старая сохраненная версия получает номер 1, content_v1 становится активной.
+-- Миграцию можно запускать повторно
+
+CREATE TABLE IF NOT EXISTS banner_versions(
+    banner_id INTEGER NOT NULL REFERENCES banners(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    content json NOT NULL,
+    author VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT now(),
+    CONSTRAINT banner_versions_pk PRIMARY KEY(banner_id, version)
+);
+
+ALTER TABLE banners ADD COLUMN IF NOT EXISTS active_version INTEGER NOT NULL DEFAULT 1;
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'banners' AND column_name = 'content_v1'
+    ) THEN
+        INSERT INTO banner_versions (banner_id, version, content, author, created_at)
+        SELECT id, row_number() OVER (PARTITION BY id ORDER BY ord), content, 'migration', updated_at
+        FROM (
+            SELECT id, 1 AS ord, content_v3 AS content, updated_at FROM banners WHERE content_v3 IS NOT NULL
+            UNION ALL
+            SELECT id, 2, content_v2, updated_at FROM banners WHERE content_v2 IS NOT NULL
+            UNION ALL
+            SELECT id, 3, content_v1, updated_at FROM banners
+        ) old_versions
+        ON CONFLICT DO NOTHING;
+
+        UPDATE banners b
+        SET active_version = (SELECT MAX(version) FROM banner_versions v WHERE v.banner_id = b.id);
+
+        ALTER TABLE banners
+            DROP COLUMN content_v1,
+            DROP COLUMN content_v2,
+            DROP COLUMN content_v3;
+    END IF;
+END $$;
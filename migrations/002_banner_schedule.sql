@@ -0,0 +1,16 @@
+-- Окно показа баннеров: active_from и active_until.
+-- Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS active_from TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS active_until TIMESTAMPTZ DEFAULT NULL;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint WHERE conname = 'banners_window_check'
+    ) THEN
+        ALTER TABLE banners
+            ADD CONSTRAINT banners_window_check CHECK (active_from < active_until);
+    END IF;
+END $$;
@@ -0,0 +1,5 @@
+-- Повторяющееся расписание показа баннеров (дни недели, интервалы времени, часовой пояс).
+-- Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS schedule JSONB DEFAULT NULL;
@@ -0,0 +1,32 @@
+-- Согласование версий баннера: черновик -> review -> approved -> published.
+-- Существующие версии считаются опубликованными. История согласования ссылается на баннер,
+-- а не на версию, чтобы чистка старых версий ее не удаляла. Миграцию можно запускать повторно
+
+ALTER TABLE banner_versions
+    ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'published';
+
+CREATE TABLE IF NOT EXISTS banner_approvals(
+    banner_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    CONSTRAINT banner_approvals_banner_fk FOREIGN KEY(banner_id)
+        REFERENCES banners(id) ON DELETE CASCADE
+);
+
+-- ранняя версия миграции ссылалась на версию баннера и теряла историю вместе с ней
+ALTER TABLE banner_approvals DROP CONSTRAINT IF EXISTS banner_approvals_version_fk;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint WHERE conname = 'banner_approvals_banner_fk'
+    ) THEN
+        ALTER TABLE banner_approvals
+            ADD CONSTRAINT banner_approvals_banner_fk FOREIGN KEY(banner_id)
+                REFERENCES banners(id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS banner_approvals_idx ON banner_approvals(banner_id);
@@ -0,0 +1,9 @@
+-- Варианты A/B эксперимента для слота (тег, фича). Миграцию можно запускать повторно
+
+CREATE TABLE IF NOT EXISTS slot_variants(
+    feature_id INTEGER NOT NULL REFERENCES features(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    banner_id INTEGER NOT NULL REFERENCES banners(id) ON DELETE CASCADE,
+    weight INTEGER NOT NULL CHECK (weight > 0),
+    CONSTRAINT slot_variants_pk PRIMARY KEY(feature_id, tag_id, banner_id)
+);
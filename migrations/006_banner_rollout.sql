@@ -0,0 +1,5 @@
+-- Постепенная публикация версии баннера. Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS rollout_version INTEGER DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS rollout_percent SMALLINT NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Стратегия распределения трафика между вариантами слота. Миграцию можно запускать повторно
+
+CREATE TABLE IF NOT EXISTS slot_strategies(
+    feature_id INTEGER NOT NULL REFERENCES features(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    strategy VARCHAR(32) NOT NULL,
+    epsilon DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (epsilon BETWEEN 0 AND 1),
+    seed BIGINT DEFAULT NULL,
+    CONSTRAINT slot_strategies_pk PRIMARY KEY(feature_id, tag_id)
+);
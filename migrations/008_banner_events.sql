@@ -0,0 +1,20 @@
+-- Показы и клики баннеров. Ссылки на баннер нет, чтобы статистика удаленных баннеров
+-- сохранялась, а запись событий не проверяла внешние ключи. Миграцию можно запускать повторно
+
+CREATE TABLE IF NOT EXISTS banner_events(
+    banner_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    feature_id INTEGER NOT NULL,
+    user_id VARCHAR(255) DEFAULT NULL,
+    type VARCHAR(16) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS banner_events_banner_idx ON banner_events(banner_id, created_at);
+
+-- восстановление статистики вариантов слота после перезапуска пода
+CREATE INDEX IF NOT EXISTS banner_events_slot_idx ON banner_events(feature_id, tag_id, created_at);
+
+-- подсчет показов баннера при проверке бюджета
+CREATE INDEX IF NOT EXISTS banner_events_type_idx ON banner_events(banner_id, type, created_at);
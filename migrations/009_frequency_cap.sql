@@ -0,0 +1,4 @@
+-- Ограничение числа показов баннера одному пользователю. Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS frequency_cap JSONB DEFAULT NULL;
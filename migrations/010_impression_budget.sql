@@ -0,0 +1,6 @@
+-- Бюджет показов баннера. budget_from - момент, с которого считаются показы.
+-- Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS impression_budget BIGINT DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS budget_from TIMESTAMPTZ DEFAULT NULL;
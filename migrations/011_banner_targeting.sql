@@ -0,0 +1,28 @@
+-- Правила таргетинга баннеров. В слоте (тег, фича) может быть сколько угодно баннеров
+-- с правилами и не больше одного баннера без них. Первичный ключ (фича, тег) заменяется
+-- ключом (фича, тег, баннер), чтобы в слоте помещалось несколько баннеров.
+-- Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS targeting JSONB DEFAULT NULL;
+
+ALTER TABLE features_tags_to_banners
+    ADD COLUMN IF NOT EXISTS targeted BOOLEAN NOT NULL DEFAULT false;
+
+CREATE UNIQUE INDEX IF NOT EXISTS features_tags_to_banners_default_idx
+    ON features_tags_to_banners(feature_id, tag_id) WHERE NOT targeted;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conname = 'features_tags_to_banners_pk'
+            AND pg_get_constraintdef(oid) = 'PRIMARY KEY (feature_id, tag_id, banner_id)'
+    ) THEN
+        ALTER TABLE features_tags_to_banners
+            DROP CONSTRAINT IF EXISTS features_tags_to_banners_pk;
+
+        ALTER TABLE features_tags_to_banners
+            ADD CONSTRAINT features_tags_to_banners_pk PRIMARY KEY(feature_id, tag_id, banner_id);
+    END IF;
+END $$;
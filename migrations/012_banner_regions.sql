@@ -0,0 +1,5 @@
+-- Разрешенные и запрещенные регионы баннера, регион определяется по IP-адресу клиента.
+-- Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS regions JSONB DEFAULT NULL;
@@ -0,0 +1,5 @@
+-- Приоритет баннера при выборе из баннеров нескольких тегов пользователя.
+-- Миграцию можно запускать повторно
+
+ALTER TABLE banners
+    ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- Баннеры по умолчанию: фичи (feature_id) и общий (feature_id IS NULL).
+-- На каждый уровень приходится не больше одного баннера. Миграцию можно запускать повторно
+
+CREATE TABLE IF NOT EXISTS default_banners(
+    feature_id INTEGER REFERENCES features(id) ON DELETE CASCADE,
+    banner_id INTEGER NOT NULL REFERENCES banners(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS default_banners_level_idx ON default_banners((COALESCE(feature_id, 0)));
+
+CREATE INDEX IF NOT EXISTS default_banners_banner_idx ON default_banners(banner_id);
@@ -0,0 +1,6 @@
+-- Родитель тега. Тег без собственного баннера получает баннер ближайшего предка.
+-- При удалении родителя его потомки становятся корневыми. Миграцию можно запускать повторно
+
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS parent_id INTEGER DEFAULT NULL REFERENCES tags(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS tags_parent_idx ON tags(parent_id);
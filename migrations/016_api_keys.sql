@@ -0,0 +1,13 @@
+-- API ключи провайдера токенов api_key. Хранится только SHA-256 хэш секрета.
+-- Миграцию можно запускать повторно
+
+CREATE TABLE IF NOT EXISTS api_keys(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    secret_hash CHAR(64) NOT NULL UNIQUE,
+    role VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMP DEFAULT NULL,
+    revoked_at TIMESTAMP DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
@@ -1,8 +1,11 @@
 CREATE TABLE IF NOT EXISTS tags(
     id SERIAL PRIMARY KEY,
-    name VARCHAR(255) UNIQUE
+    name VARCHAR(255) UNIQUE,
+    parent_id INTEGER DEFAULT NULL REFERENCES tags(id) ON DELETE SET NULL
 );
 
+CREATE INDEX IF NOT EXISTS tags_parent_idx ON tags(parent_id);
+
 CREATE TABLE IF NOT EXISTS features(
     id SERIAL PRIMARY KEY,
     name VARCHAR(255) UNIQUE
@@ -10,20 +13,108 @@ CREATE TABLE IF NOT EXISTS features(
 
 CREATE TABLE IF NOT EXISTS banners(
     id SERIAL PRIMARY KEY,
-    content_v1 json NOT NULL,
-    content_v2 json DEFAULT NULL,
-    content_v3 json DEFAULT NULL,
+    active_version INTEGER NOT NULL DEFAULT 1,
+    rollout_version INTEGER DEFAULT NULL,
+    rollout_percent SMALLINT NOT NULL DEFAULT 0,
     is_active BOOLEAN DEFAULT true,
+    active_from TIMESTAMPTZ DEFAULT NULL,
+    active_until TIMESTAMPTZ DEFAULT NULL,
+    schedule JSONB DEFAULT NULL,
+    frequency_cap JSONB DEFAULT NULL,
+    impression_budget BIGINT DEFAULT NULL,
+    budget_from TIMESTAMPTZ DEFAULT NULL,
+    targeting JSONB DEFAULT NULL,
+    regions JSONB DEFAULT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
     created_at TIMESTAMP DEFAULT now(),
-    updated_at TIMESTAMP DEFAULT now()
+    updated_at TIMESTAMP DEFAULT now(),
+    CONSTRAINT banners_window_check CHECK (active_from < active_until)
 );
 
+CREATE TABLE IF NOT EXISTS banner_versions(
+    banner_id INTEGER NOT NULL REFERENCES banners(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    content json NOT NULL,
+    author VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'published',
+    created_at TIMESTAMP DEFAULT now(),
+    CONSTRAINT banner_versions_pk PRIMARY KEY(banner_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS banner_approvals(
+    banner_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    CONSTRAINT banner_approvals_banner_fk FOREIGN KEY(banner_id)
+        REFERENCES banners(id) ON DELETE CASCADE
+);
+
+CREATE INDEX banner_approvals_idx ON banner_approvals(banner_id);
+
 CREATE TABLE IF NOT EXISTS features_tags_to_banners(
     feature_id INTEGER NOT NULL REFERENCES features(id) ON DELETE CASCADE,
     tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
     banner_id INTEGER NOT NULL REFERENCES banners(id) ON DELETE CASCADE,
-    CONSTRAINT features_tags_to_banners_pk PRIMARY KEY(feature_id,tag_id)
+    targeted BOOLEAN NOT NULL DEFAULT false,
+    CONSTRAINT features_tags_to_banners_pk PRIMARY KEY(feature_id,tag_id,banner_id)
 );
 
+CREATE UNIQUE INDEX features_tags_to_banners_default_idx ON features_tags_to_banners(feature_id, tag_id)
+    WHERE NOT targeted;
+
 CREATE INDEX banners_idx ON features_tags_to_banners(banner_id);
 
+CREATE TABLE IF NOT EXISTS slot_variants(
+    feature_id INTEGER NOT NULL REFERENCES features(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    banner_id INTEGER NOT NULL REFERENCES banners(id) ON DELETE CASCADE,
+    weight INTEGER NOT NULL CHECK (weight > 0),
+    CONSTRAINT slot_variants_pk PRIMARY KEY(feature_id, tag_id, banner_id)
+);
+
+CREATE TABLE IF NOT EXISTS slot_strategies(
+    feature_id INTEGER NOT NULL REFERENCES features(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    strategy VARCHAR(32) NOT NULL,
+    epsilon DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (epsilon BETWEEN 0 AND 1),
+    seed BIGINT DEFAULT NULL,
+    CONSTRAINT slot_strategies_pk PRIMARY KEY(feature_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS default_banners(
+    feature_id INTEGER REFERENCES features(id) ON DELETE CASCADE,
+    banner_id INTEGER NOT NULL REFERENCES banners(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX default_banners_level_idx ON default_banners((COALESCE(feature_id, 0)));
+
+CREATE INDEX default_banners_banner_idx ON default_banners(banner_id);
+
+CREATE TABLE IF NOT EXISTS banner_events(
+    banner_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    feature_id INTEGER NOT NULL,
+    user_id VARCHAR(255) DEFAULT NULL,
+    type VARCHAR(16) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS banner_events_banner_idx ON banner_events(banner_id, created_at);
+CREATE INDEX IF NOT EXISTS banner_events_slot_idx ON banner_events(feature_id, tag_id, created_at);
+CREATE INDEX IF NOT EXISTS banner_events_type_idx ON banner_events(banner_id, type, created_at);
+
+
+
+CREATE TABLE IF NOT EXISTS api_keys(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    secret_hash CHAR(64) NOT NULL UNIQUE,
+    role VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMP DEFAULT NULL,
+    revoked_at TIMESTAMP DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
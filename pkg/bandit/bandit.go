@@ -0,0 +1,130 @@
+package bandit
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Arm - накопленная статистика одного варианта
+type Arm struct {
+	Impressions int64
+	Clicks      int64
+}
+
+// CTR возвращает долю кликов среди показов варианта
+func (arm Arm) CTR() float64 {
+	if arm.Impressions == 0 {
+		return 0
+	}
+
+	return float64(arm.Clicks) / float64(arm.Impressions)
+}
+
+// Selector выбирает индекс варианта по статистике arms.
+// Все случайные числа берутся из rng, поэтому при одинаковом seed выбор воспроизводим
+type Selector interface {
+	Select(rng *rand.Rand, arms []Arm) int
+}
+
+type epsilonGreedy struct {
+	epsilon float64
+}
+
+// NewEpsilonGreedy с вероятностью epsilon выбирает случайный вариант,
+// иначе вариант с лучшим CTR. Варианты без показов выбираются в первую очередь
+func NewEpsilonGreedy(epsilon float64) Selector {
+	return epsilonGreedy{epsilon: epsilon}
+}
+
+func (selector epsilonGreedy) Select(rng *rand.Rand, arms []Arm) int {
+	if rng.Float64() < selector.epsilon {
+		return rng.Intn(len(arms))
+	}
+
+	best := 0
+
+	for i, arm := range arms {
+		if arm.Impressions == 0 {
+			return i
+		}
+
+		if arm.CTR() > arms[best].CTR() {
+			best = i
+		}
+	}
+
+	return best
+}
+
+type thompson struct{}
+
+// NewThompson выбирает вариант с наибольшим значением, сэмплированным
+// из апостериорного Beta(клики + 1, показы без клика + 1)
+func NewThompson() Selector {
+	return thompson{}
+}
+
+func (thompson) Select(rng *rand.Rand, arms []Arm) int {
+	best, bestSample := 0, -1.0
+
+	for i, arm := range arms {
+		misses := arm.Impressions - arm.Clicks
+		if misses < 0 {
+			misses = 0
+		}
+
+		sample := betaSample(rng, float64(arm.Clicks+1), float64(misses+1))
+		if sample > bestSample {
+			best, bestSample = i, sample
+		}
+	}
+
+	return best
+}
+
+// Shares оценивает долю трафика каждого варианта, повторяя выбор samples раз
+func Shares(selector Selector, rng *rand.Rand, arms []Arm, samples int) []float64 {
+	res := make([]float64, len(arms))
+	if len(arms) == 0 || samples <= 0 {
+		return res
+	}
+
+	for i := 0; i < samples; i++ {
+		res[selector.Select(rng, arms)]++
+	}
+
+	for i := range res {
+		res[i] /= float64(samples)
+	}
+
+	return res
+}
+
+func betaSample(rng *rand.Rand, alpha, beta float64) float64 {
+	x := gammaSample(rng, alpha)
+	y := gammaSample(rng, beta)
+
+	return x / (x + y)
+}
+
+// gammaSample - метод Марсальи-Цанга, параметр формы shape >= 1
+func gammaSample(rng *rand.Rand, shape float64) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+
+	for {
+		x := rng.NormFloat64()
+
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+
+		v = v * v * v
+		u := rng.Float64()
+
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
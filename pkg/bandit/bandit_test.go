@@ -0,0 +1,165 @@
+package bandit
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGammaSample(t *testing.T) {
+	// у Gamma(k, 1) среднее и дисперсия равны k
+	for _, shape := range []float64{1, 2.5, 10, 100} {
+		rng := rand.New(rand.NewSource(1))
+
+		const samples = 50000
+
+		var sum, sumSq float64
+
+		for i := 0; i < samples; i++ {
+			x := gammaSample(rng, shape)
+			require.Greater(t, x, 0.0)
+
+			sum += x
+			sumSq += x * x
+		}
+
+		mean := sum / samples
+		variance := sumSq/samples - mean*mean
+
+		require.InDelta(t, shape, mean, 0.03*shape, "shape %v", shape)
+		require.InDelta(t, shape, variance, 0.1*shape, "shape %v", shape)
+	}
+}
+
+func TestBetaSample(t *testing.T) {
+	testTable := []struct {
+		name        string
+		alpha, beta float64
+	}{
+		{name: "uniform", alpha: 1, beta: 1},
+		{name: "few clicks", alpha: 3, beta: 48},
+		{name: "many clicks", alpha: 21, beta: 31},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(2))
+
+			const samples = 20000
+
+			sum := 0.0
+
+			for i := 0; i < samples; i++ {
+				x := betaSample(rng, testCase.alpha, testCase.beta)
+				require.True(t, x > 0 && x < 1)
+
+				sum += x
+			}
+
+			expected := testCase.alpha / (testCase.alpha + testCase.beta)
+			require.InDelta(t, expected, sum/samples, 0.01)
+		})
+	}
+}
+
+func TestSelectIsReproducible(t *testing.T) {
+	arms := []Arm{{Impressions: 50, Clicks: 2}, {Impressions: 50, Clicks: 20}, {Impressions: 10, Clicks: 1}}
+
+	for _, selector := range []Selector{NewThompson(), NewEpsilonGreedy(0.3)} {
+		run := func() []int {
+			rng := rand.New(rand.NewSource(7))
+
+			res := make([]int, 100)
+			for i := range res {
+				res[i] = selector.Select(rng, arms)
+			}
+
+			return res
+		}
+
+		require.Equal(t, run(), run())
+	}
+}
+
+func TestEpsilonGreedy(t *testing.T) {
+	testTable := []struct {
+		name     string
+		epsilon  float64
+		arms     []Arm
+		expected int
+	}{
+		{
+			name:     "arm without impressions first",
+			arms:     []Arm{{Impressions: 10, Clicks: 9}, {}, {}},
+			expected: 1,
+		},
+		{
+			name:     "best click-through",
+			arms:     []Arm{{Impressions: 10, Clicks: 1}, {Impressions: 10, Clicks: 5}, {Impressions: 10, Clicks: 3}},
+			expected: 1,
+		},
+		{
+			name:     "tie keeps first",
+			arms:     []Arm{{Impressions: 10, Clicks: 2}, {Impressions: 20, Clicks: 4}},
+			expected: 0,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(3))
+
+			for i := 0; i < 10; i++ {
+				require.Equal(t, testCase.expected, NewEpsilonGreedy(testCase.epsilon).Select(rng, testCase.arms))
+			}
+		})
+	}
+
+	t.Run("epsilon explores", func(t *testing.T) {
+		arms := []Arm{{Impressions: 10, Clicks: 9}, {Impressions: 10, Clicks: 1}}
+
+		// с вероятностью 0.5 выбирается случайный вариант, то есть худший - в четверти случаев
+		shares := Shares(NewEpsilonGreedy(0.5), rand.New(rand.NewSource(4)), arms, 20000)
+		require.InDelta(t, 0.75, shares[0], 0.02)
+		require.InDelta(t, 0.25, shares[1], 0.02)
+	})
+}
+
+func TestThompson(t *testing.T) {
+	t.Run("prefers higher click-through", func(t *testing.T) {
+		arms := []Arm{{Impressions: 200, Clicks: 10}, {Impressions: 200, Clicks: 40}}
+
+		shares := Shares(NewThompson(), rand.New(rand.NewSource(5)), arms, 5000)
+		require.Greater(t, shares[1], 0.99)
+	})
+
+	t.Run("equal arms share traffic", func(t *testing.T) {
+		arms := []Arm{{Impressions: 100, Clicks: 10}, {Impressions: 100, Clicks: 10}}
+
+		shares := Shares(NewThompson(), rand.New(rand.NewSource(6)), arms, 20000)
+		require.InDelta(t, 0.5, shares[0], 0.02)
+	})
+
+	t.Run("clicks above impressions", func(t *testing.T) {
+		arms := []Arm{{Impressions: 1, Clicks: 5}}
+
+		require.Equal(t, 0, NewThompson().Select(rand.New(rand.NewSource(7)), arms))
+	})
+}
+
+func TestShares(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+
+	require.Empty(t, Shares(NewThompson(), rng, nil, 100))
+	require.Equal(t, []float64{0, 0}, Shares(NewThompson(), rng, []Arm{{}, {}}, 0))
+
+	shares := Shares(NewThompson(), rng, []Arm{{Impressions: 5, Clicks: 1}, {}, {Impressions: 30, Clicks: 2}}, 1000)
+
+	sum := 0.0
+	for _, share := range shares {
+		sum += share
+	}
+
+	require.InDelta(t, 1, sum, 1e-9)
+}
@@ -39,3 +39,10 @@ func (lru LRU[K, V]) Remove(_ context.Context, key K) (bool, error) {
 	lru.logger.Debug("delete", slog.Any("key", key))
 	return lru.cache.Remove(key), nil
 }
+
+func (lru LRU[K, V]) Purge(_ context.Context) error {
+	lru.logger.Debug("purge")
+	lru.cache.Purge()
+
+	return nil
+}
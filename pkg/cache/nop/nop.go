@@ -0,0 +1,30 @@
+package nopcache
+
+import (
+	"context"
+
+	"github.com/Heatdog/Avito/pkg/cache"
+)
+
+// nopCache ничего не хранит, каждый запрос уходит в репозиторий
+type nopCache[K comparable, V any] struct{}
+
+func NewNopCache[K comparable, V any]() cache.Cache[K, V] {
+	return nopCache[K, V]{}
+}
+
+func (nopCache[K, V]) Get(_ context.Context, _ K) (value V, ok bool, err error) {
+	return value, false, nil
+}
+
+func (nopCache[K, V]) Add(_ context.Context, _ K, _ V) (bool, error) {
+	return false, nil
+}
+
+func (nopCache[K, V]) Remove(_ context.Context, _ K) (bool, error) {
+	return false, nil
+}
+
+func (nopCache[K, V]) Purge(_ context.Context) error {
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/Heatdog/Avito/internal/config"
@@ -15,11 +16,21 @@ import (
 type redisCache[K comparable, V any] struct {
 	client *redis.Client
 	logger *slog.Logger
+	prefix string
 	expire time.Duration
 }
 
+func (cache redisCache[K, V]) key(key K) (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+
+	return cache.prefix + string(data), nil
+}
+
 func (cache redisCache[K, V]) Add(ctx context.Context, key K, value V) (evicated bool, err error) {
-	keyStr, err := json.Marshal(key)
+	keyStr, err := cache.key(key)
 	if err != nil {
 		cache.logger.Warn(err.Error())
 		return false, err
@@ -31,9 +42,9 @@ func (cache redisCache[K, V]) Add(ctx context.Context, key K, value V) (evicated
 		return false, err
 	}
 
-	cache.logger.Debug("add", slog.String("key", string(keyStr)), slog.String("value", string(valStr)))
+	cache.logger.Debug("add", slog.String("key", keyStr), slog.String("value", string(valStr)))
 
-	if err := cache.client.Set(ctx, string(keyStr), string(valStr), cache.expire).Err(); err != nil {
+	if err := cache.client.Set(ctx, keyStr, string(valStr), cache.expire).Err(); err != nil {
 		cache.logger.Warn(err.Error())
 		return false, err
 	}
@@ -42,15 +53,15 @@ func (cache redisCache[K, V]) Add(ctx context.Context, key K, value V) (evicated
 }
 
 func (cache redisCache[K, V]) Get(ctx context.Context, key K) (value V, ok bool, err error) {
-	strKey, err := json.Marshal(key)
+	strKey, err := cache.key(key)
 	if err != nil {
 		cache.logger.Warn(err.Error())
 		return value, false, err
 	}
 
-	cache.logger.Debug("get", slog.String("key", string(strKey)))
+	cache.logger.Debug("get", slog.String("key", strKey))
 
-	val, err := cache.client.Get(ctx, string(strKey)).Result()
+	val, err := cache.client.Get(ctx, strKey).Result()
 	if err == redis.Nil {
 		return value, false, nil
 	}
@@ -70,15 +81,15 @@ func (cache redisCache[K, V]) Get(ctx context.Context, key K) (value V, ok bool,
 }
 
 func (cache redisCache[K, V]) Remove(ctx context.Context, key K) (bool, error) {
-	strKey, err := json.Marshal(key)
+	strKey, err := cache.key(key)
 	if err != nil {
 		cache.logger.Warn(err.Error())
 		return false, err
 	}
 
-	cache.logger.Debug("delete", slog.String("key", string(strKey)))
+	cache.logger.Debug("delete", slog.String("key", strKey))
 
-	num, err := cache.client.Del(ctx, string(strKey)).Result()
+	num, err := cache.client.Del(ctx, strKey).Result()
 	if err != nil {
 		cache.logger.Warn(err.Error())
 		return false, err
@@ -87,23 +98,88 @@ func (cache redisCache[K, V]) Remove(ctx context.Context, key K) (bool, error) {
 	return num > 0, nil
 }
 
-func NewRedisClient[K comparable, V any](ctx context.Context, redisCfg *config.RedisSettings,
-	cacheCfg *config.CacheSettings, logger *slog.Logger) (cache.Cache[K, V], error) {
+// purgeBatchSize - сколько ключей Purge запрашивает за один SCAN и удаляет за один UNLINK
+const purgeBatchSize = 500
+
+// Purge удаляет только ключи своего префикса, остальные данные в базе Redis не затрагиваются
+func (cache redisCache[K, V]) Purge(ctx context.Context) error {
+	cache.logger.Debug("purge", slog.String("prefix", cache.prefix))
+
+	iter := cache.client.Scan(ctx, 0, escapePattern(cache.prefix)+"*", purgeBatchSize).Iterator()
+	keys := make([]string, 0, purgeBatchSize)
+
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+
+		if len(keys) < purgeBatchSize {
+			continue
+		}
+
+		if err := cache.client.Unlink(ctx, keys...).Err(); err != nil {
+			cache.logger.Warn(err.Error())
+			return err
+		}
+
+		keys = keys[:0]
+	}
+
+	if err := iter.Err(); err != nil {
+		cache.logger.Warn(err.Error())
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := cache.client.Unlink(ctx, keys...).Err(); err != nil {
+		cache.logger.Warn(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// escapePattern экранирует спецсимволы шаблона SCAN, чтобы префикс сравнивался буквально
+func escapePattern(prefix string) string {
+	var res strings.Builder
+
+	for _, r := range prefix {
+		if strings.ContainsRune(`\*?[]`, r) {
+			res.WriteRune('\\')
+		}
+
+		res.WriteRune(r)
+	}
+
+	return res.String()
+}
+
+// NewRedisClient подключается к базе db
+func NewRedisClient(ctx context.Context, redisCfg *config.RedisSettings, db int) (*redis.Client, error) {
 	time.Sleep(time.Duration(redisCfg.TimePrepare) * time.Second)
 	host := fmt.Sprintf("%s:%d", redisCfg.Host, redisCfg.Port)
 	client := redis.NewClient(&redis.Options{
 		Addr:     host,
 		Password: redisCfg.Password,
-		DB:       0,
+		DB:       db,
 	})
 
 	if _, err := client.Ping(ctx).Result(); err != nil {
 		return nil, err
 	}
 
+	return client, nil
+}
+
+// NewRedisCache создает кэш поверх общего клиента. prefix разделяет ключи
+// разных кэшей в одной базе Redis
+func NewRedisCache[K comparable, V any](logger *slog.Logger, client *redis.Client, prefix string,
+	expire time.Duration) cache.Cache[K, V] {
 	return redisCache[K, V]{
 		client: client,
 		logger: logger,
-		expire: time.Minute * time.Duration(cacheCfg.TTL),
-	}, nil
+		prefix: prefix,
+		expire: expire,
+	}
 }
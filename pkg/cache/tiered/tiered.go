@@ -0,0 +1,89 @@
+package tieredcache
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Heatdog/Avito/pkg/cache"
+)
+
+// tieredCache сначала обращается к локальному кэшу пода, затем к общему (Redis).
+// Значение, найденное в общем кэше, записывается в локальный
+type tieredCache[K comparable, V any] struct {
+	logger *slog.Logger
+	local  cache.Cache[K, V]
+	remote cache.Cache[K, V]
+}
+
+func NewTieredCache[K comparable, V any](logger *slog.Logger, local, remote cache.Cache[K, V]) cache.Cache[K, V] {
+	return &tieredCache[K, V]{
+		logger: logger,
+		local:  local,
+		remote: remote,
+	}
+}
+
+func (tiered *tieredCache[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	value, ok, err := tiered.local.Get(ctx, key)
+	if err != nil {
+		tiered.logger.Warn(err.Error())
+	}
+
+	if ok {
+		return value, true, nil
+	}
+
+	// недоступность общего кэша не должна ломать выдачу, поэтому ошибка считается промахом
+	value, ok, err = tiered.remote.Get(ctx, key)
+	if err != nil {
+		tiered.logger.Warn(err.Error())
+		return value, false, nil
+	}
+
+	if !ok {
+		return value, false, nil
+	}
+
+	tiered.logger.Debug("remote hit", slog.Any("key", key))
+
+	if _, err = tiered.local.Add(ctx, key, value); err != nil {
+		tiered.logger.Warn(err.Error())
+	}
+
+	return value, true, nil
+}
+
+func (tiered *tieredCache[K, V]) Add(ctx context.Context, key K, value V) (bool, error) {
+	evicated, err := tiered.local.Add(ctx, key, value)
+	if err != nil {
+		tiered.logger.Warn(err.Error())
+	}
+
+	if _, err := tiered.remote.Add(ctx, key, value); err != nil {
+		return evicated, err
+	}
+
+	return evicated, nil
+}
+
+func (tiered *tieredCache[K, V]) Remove(ctx context.Context, key K) (bool, error) {
+	localOk, err := tiered.local.Remove(ctx, key)
+	if err != nil {
+		tiered.logger.Warn(err.Error())
+	}
+
+	remoteOk, err := tiered.remote.Remove(ctx, key)
+	if err != nil {
+		return localOk, err
+	}
+
+	return localOk || remoteOk, nil
+}
+
+func (tiered *tieredCache[K, V]) Purge(ctx context.Context) error {
+	if err := tiered.local.Purge(ctx); err != nil {
+		tiered.logger.Warn(err.Error())
+	}
+
+	return tiered.remote.Purge(ctx)
+}
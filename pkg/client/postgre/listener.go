@@ -0,0 +1,93 @@
+package postgre
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Heatdog/Avito/internal/config"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	listenerMinBackoff = time.Second
+	listenerMaxBackoff = 30 * time.Second
+)
+
+// Listener держит отдельное соединение с PostgreSQL, подписанное на канал LISTEN,
+// и переподключается при его потере
+type Listener struct {
+	logger  *slog.Logger
+	cfg     config.PostgreSettings
+	channel string
+}
+
+func NewListener(logger *slog.Logger, cfg config.PostgreSettings, channel string) *Listener {
+	return &Listener{
+		logger:  logger,
+		cfg:     cfg,
+		channel: channel,
+	}
+}
+
+// Listen блокируется до отмены ctx. onNotify вызывается на каждое уведомление,
+// onReconnect - после восстановления подписки, если уведомления могли быть пропущены
+func (listener *Listener) Listen(ctx context.Context, onNotify func(payload string), onReconnect func()) {
+	backoff := listenerMinBackoff
+	missed := false
+
+	for {
+		err := listener.listen(ctx, onNotify, func() {
+			backoff = listenerMinBackoff
+
+			if missed {
+				onReconnect()
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		missed = true
+
+		listener.logger.Warn("listener connection lost", slog.String("channel", listener.channel),
+			slog.Any("error", err), slog.Duration("retry", backoff))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, listenerMaxBackoff)
+	}
+}
+
+func (listener *Listener) listen(ctx context.Context, onNotify func(payload string), onListen func()) error {
+	conn, err := pgx.Connect(ctx, dsn(listener.cfg))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := conn.Close(context.Background()); err != nil {
+			listener.logger.Debug(err.Error())
+		}
+	}()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{listener.channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	listener.logger.Info("listening", slog.String("channel", listener.channel))
+	onListen()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		onNotify(notification.Payload)
+	}
+}
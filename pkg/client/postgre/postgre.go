@@ -10,14 +10,16 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+func dsn(cfg config.PostgreSettings) string {
+	return fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
+}
+
 func NewPostgreClient(ctx context.Context, cfg config.PostgreSettings) (client.Client, error) {
 	time.Sleep(time.Duration(cfg.TimePrepare) * time.Second)
-	dsn := fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
-
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.TimeWait)*time.Second)
 	defer cancel()
 
-	conn, err := pgxpool.New(ctx, dsn)
+	conn, err := pgxpool.New(ctx, dsn(cfg))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,19 @@
+package clock
+
+import "time"
+
+// Clock возвращает текущее время. Сервисы получают его через конструктор,
+// чтобы в тестах время можно было подменить
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,16 @@
+package counter
+
+import (
+	"context"
+	"time"
+)
+
+// Counter считает события по ключу в окнах. Окно открывается вызовом Start и длится window,
+// по его истечении счет начинается заново со следующего Start
+type Counter interface {
+	// Start открывает окно ключа, если его нет, и возвращает число событий в текущем окне
+	Start(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Incr учитывает событие в открытом окне ключа и возвращает число событий в нем.
+	// Если окно не открыто, событие не учитывается и возвращается 0
+	Incr(ctx context.Context, key string) (int64, error)
+}
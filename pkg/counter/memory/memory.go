@@ -0,0 +1,84 @@
+package memorycounter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Heatdog/Avito/pkg/clock"
+	"github.com/Heatdog/Avito/pkg/counter"
+)
+
+// sweepInterval - как часто из памяти удаляются счетчики с истекшим окном
+const sweepInterval = time.Minute
+
+type entry struct {
+	count   int64
+	expires time.Time
+}
+
+// memoryCounter хранит счетчики в памяти пода, поэтому у каждого пода свой счет.
+// Подходит только для сервиса из одного пода
+type memoryCounter struct {
+	mu        sync.Mutex
+	clock     clock.Clock
+	entries   map[string]*entry
+	nextSweep time.Time
+}
+
+func NewMemoryCounter(clock clock.Clock) counter.Counter {
+	return &memoryCounter{
+		clock:   clock,
+		entries: map[string]*entry{},
+	}
+}
+
+func (counter *memoryCounter) Start(_ context.Context, key string, window time.Duration) (int64, error) {
+	now := counter.clock.Now()
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	counter.sweep(now)
+
+	e, ok := counter.entries[key]
+	if !ok || !now.Before(e.expires) {
+		e = &entry{expires: now.Add(window)}
+		counter.entries[key] = e
+	}
+
+	return e.count, nil
+}
+
+func (counter *memoryCounter) Incr(_ context.Context, key string) (int64, error) {
+	now := counter.clock.Now()
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	counter.sweep(now)
+
+	e, ok := counter.entries[key]
+	if !ok || !now.Before(e.expires) {
+		return 0, nil
+	}
+
+	e.count++
+
+	return e.count, nil
+}
+
+// sweep удаляет счетчики с истекшим окном не чаще раза в sweepInterval. Вызывается под mu
+func (counter *memoryCounter) sweep(now time.Time) {
+	if now.Before(counter.nextSweep) {
+		return
+	}
+
+	for key, e := range counter.entries {
+		if !now.Before(e.expires) {
+			delete(counter.entries, key)
+		}
+	}
+
+	counter.nextSweep = now.Add(sweepInterval)
+}
@@ -0,0 +1,71 @@
+package rediscounter
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Heatdog/Avito/pkg/counter"
+	"github.com/redis/go-redis/v9"
+)
+
+// start открывает окно ключа с нулевым счетом, если его нет, и возвращает текущий счет.
+// Скрипт выполняется атомарно, поэтому ключ не может остаться без времени жизни
+var start = redis.NewScript(`
+redis.call("SET", KEYS[1], 0, "PX", ARGV[1], "NX")
+return tonumber(redis.call("GET", KEYS[1]))
+`)
+
+// incr увеличивает счетчик открытого окна, INCR сохраняет время жизни ключа.
+// Ключ без окна не создается, чтобы он не остался без времени жизни
+var incr = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+return redis.call("INCR", KEYS[1])
+`)
+
+// redisCounter хранит счетчики в Redis, общий счет для всех подов
+type redisCounter struct {
+	client *redis.Client
+	logger *slog.Logger
+	prefix string
+}
+
+// NewRedisCounter создает счетчик поверх клиента. prefix отделяет ключи счетчика
+// от других данных в базе Redis
+func NewRedisCounter(logger *slog.Logger, client *redis.Client, prefix string) counter.Counter {
+	return redisCounter{
+		client: client,
+		logger: logger,
+		prefix: prefix,
+	}
+}
+
+func (counter redisCounter) Start(ctx context.Context, key string, window time.Duration) (int64, error) {
+	key = counter.prefix + key
+
+	counter.logger.Debug("start", slog.String("key", key))
+
+	count, err := start.Run(ctx, counter.client, []string{key}, window.Milliseconds()).Int64()
+	if err != nil {
+		counter.logger.Warn(err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (counter redisCounter) Incr(ctx context.Context, key string) (int64, error) {
+	key = counter.prefix + key
+
+	counter.logger.Debug("incr", slog.String("key", key))
+
+	count, err := incr.Run(ctx, counter.client, []string{key}).Int64()
+	if err != nil {
+		counter.logger.Warn(err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,115 @@
+package csvgeo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/Heatdog/Avito/pkg/geo"
+)
+
+// csvDatabase хранит сети по длине префикса. lengths - встречающиеся длины от большей
+// к меньшей, поэтому для адреса находится самая узкая сеть, в которую он входит
+type csvDatabase struct {
+	networks map[int]map[netip.Prefix]string
+	lengths  []int
+}
+
+// header - необязательная первая строка файла, имена колонок сравниваются без учета регистра
+var header = []string{"network", "region"}
+
+// NewCSVDatabase читает строки "CIDR,регион", например "10.0.0.0/8,RU-MOW". Первая строка
+// может быть заголовком "network,region", строки, начинающиеся с #, пропускаются.
+// Любая другая строка, которая не разбирается, - ошибка с номером строки
+func NewCSVDatabase(r io.Reader) (geo.Database, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	db := &csvDatabase{
+		networks: map[int]map[netip.Prefix]string{},
+	}
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if first && isHeader(record) {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		region := strings.TrimSpace(record[1])
+		if region == "" {
+			return nil, fmt.Errorf("line %d: empty region", line)
+		}
+
+		// сеть IPv4 в записи IPv6 (::ffff:10.0.0.0/104) хранится как IPv4, так же как адреса при поиске
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+
+		prefix = prefix.Masked()
+
+		networks, ok := db.networks[prefix.Bits()]
+		if !ok {
+			networks = map[netip.Prefix]string{}
+			db.networks[prefix.Bits()] = networks
+			db.lengths = append(db.lengths, prefix.Bits())
+		}
+
+		networks[prefix] = region
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(db.lengths)))
+
+	return db, nil
+}
+
+func isHeader(record []string) bool {
+	for i, name := range header {
+		if !strings.EqualFold(strings.TrimSpace(record[i]), name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (db *csvDatabase) Region(addr netip.Addr) (string, bool) {
+	addr = addr.Unmap()
+
+	for _, bits := range db.lengths {
+		if bits > addr.BitLen() {
+			continue
+		}
+
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+
+		if region, ok := db.networks[bits][prefix]; ok {
+			return region, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,92 @@
+package csvgeo
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const regions = `network,region
+# Санкт-Петербург целиком, кроме выделенной московской сети
+10.0.0.0/8,RU-SPE
+10.1.0.0/16, RU-MOW
+10.1.2.3/32,RU-TVE
+192.168.1.77/24,RU-KDA
+2001:db8::/32,DE
+2001:db8:1::/48,FR
+::ffff:172.16.0.0/108,RU-NVS
+`
+
+func TestRegion(t *testing.T) {
+	db, err := NewCSVDatabase(strings.NewReader(regions))
+	require.NoError(t, err)
+
+	testTable := []struct {
+		name   string
+		addr   string
+		region string
+		found  bool
+	}{
+		{name: "wide network", addr: "10.200.0.1", region: "RU-SPE", found: true},
+		{name: "narrowest network wins", addr: "10.1.0.1", region: "RU-MOW", found: true},
+		{name: "single address", addr: "10.1.2.3", region: "RU-TVE", found: true},
+		{name: "neighbour of single address", addr: "10.1.2.4", region: "RU-MOW", found: true},
+		{name: "network with host bits", addr: "192.168.1.1", region: "RU-KDA", found: true},
+		{name: "ipv4-mapped address", addr: "::ffff:10.1.0.1", region: "RU-MOW", found: true},
+		{name: "ipv4-mapped network", addr: "172.16.0.1", region: "RU-NVS", found: true},
+		{name: "ipv6 network", addr: "2001:db8::1", region: "DE", found: true},
+		{name: "narrow ipv6 network", addr: "2001:db8:1::1", region: "FR", found: true},
+		{name: "unknown ipv4", addr: "192.0.2.1", found: false},
+		{name: "unknown ipv6", addr: "2001:db9::1", found: false},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			region, found := db.Region(netip.MustParseAddr(testCase.addr))
+			require.Equal(t, testCase.found, found)
+			require.Equal(t, testCase.region, region)
+		})
+	}
+}
+
+func TestNewCSVDatabase(t *testing.T) {
+	testTable := []struct {
+		name    string
+		content string
+		addr    string
+		region  string
+		err     string
+	}{
+		{name: "without header", content: "10.0.0.0/8,RU-MOW\n", addr: "10.0.0.1", region: "RU-MOW"},
+		{name: "header in any case", content: "Network, REGION\n10.0.0.0/8,RU-MOW\n", addr: "10.0.0.1", region: "RU-MOW"},
+		{name: "comments before header", content: "# regions\nnetwork,region\n10.0.0.0/8,RU-MOW\n",
+			addr: "10.0.0.1", region: "RU-MOW"},
+		{name: "empty file", content: "", addr: "10.0.0.1"},
+		{name: "unknown header", content: "cidr,region\n10.0.0.0/8,RU-MOW\n", err: "line 1"},
+		{name: "bad first line", content: "10.0.0/8,RU-MOW\n", err: "line 1"},
+		{name: "header after first line", content: "10.0.0.0/8,RU-MOW\nnetwork,region\n", err: "line 2"},
+		{name: "bad network", content: "network,region\n# comment\n10.0.0.0/8,RU-MOW\n10.0.0.0/33,RU-SPE\n",
+			err: "line 4"},
+		{name: "address without prefix length", content: "10.0.0.1,RU-MOW\n", err: "line 1"},
+		{name: "empty region", content: "10.0.0.0/8, \n", err: "line 1: empty region"},
+		{name: "wrong number of fields", content: "10.0.0.0/8,RU,MOW\n", err: "wrong number of fields"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			db, err := NewCSVDatabase(strings.NewReader(testCase.content))
+			if testCase.err != "" {
+				require.ErrorContains(t, err, testCase.err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			region, found := db.Region(netip.MustParseAddr(testCase.addr))
+			require.Equal(t, testCase.region != "", found)
+			require.Equal(t, testCase.region, region)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package filegeo
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Heatdog/Avito/pkg/geo"
+	csvgeo "github.com/Heatdog/Avito/pkg/geo/csv"
+	mmdbgeo "github.com/Heatdog/Avito/pkg/geo/mmdb"
+)
+
+type snapshot struct {
+	db      geo.Database
+	modTime time.Time
+	size    int64
+}
+
+// FileDatabase - база регионов из файла path, которая перечитывается, когда у файла меняется
+// время изменения или размер. Формат определяется расширением: .mmdb - MaxMind DB, остальные - CSV.
+// Если новый файл не читается, остается предыдущая версия базы
+type FileDatabase struct {
+	logger   *slog.Logger
+	path     string
+	interval time.Duration
+	current  atomic.Pointer[snapshot]
+}
+
+// NewFileDatabase читает файл и возвращает ошибку, если его не удалось загрузить
+func NewFileDatabase(logger *slog.Logger, path string, interval time.Duration) (*FileDatabase, error) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	db := &FileDatabase{
+		logger:   logger,
+		path:     path,
+		interval: interval,
+	}
+
+	if err := db.reload(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (db *FileDatabase) Region(addr netip.Addr) (string, bool) {
+	return db.current.Load().db.Region(addr)
+}
+
+// Run проверяет файл раз в interval, пока не отменен ctx
+func (db *FileDatabase) Run(ctx context.Context) {
+	ticker := time.NewTicker(db.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := db.reload(); err != nil {
+				db.logger.Warn("geo database reload failed", slog.String("path", db.path), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func (db *FileDatabase) reload() error {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+
+	if current := db.current.Load(); current != nil && current.modTime.Equal(info.ModTime()) &&
+		current.size == info.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+
+	var loaded geo.Database
+
+	if strings.EqualFold(filepath.Ext(db.path), ".mmdb") {
+		loaded, err = mmdbgeo.NewMMDBDatabase(data)
+	} else {
+		loaded, err = csvgeo.NewCSVDatabase(bytes.NewReader(data))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	db.current.Store(&snapshot{
+		db:      loaded,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	})
+
+	db.logger.Info("geo database loaded", slog.String("path", db.path))
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package filegeo
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regions.csv")
+	modTime := time.Now().Add(-time.Hour)
+	addr := netip.MustParseAddr("10.1.0.1")
+
+	writeFile(t, path, "10.0.0.0/8,RU-MOW\n", modTime)
+
+	db, err := NewFileDatabase(slog.Default(), path, time.Minute)
+	require.NoError(t, err)
+
+	// шаги выполняются по порядку над одним файлом
+	testTable := []struct {
+		name    string
+		content string
+		modTime time.Time
+		remove  bool
+		err     bool
+		region  string
+	}{
+		{name: "new content", content: "10.0.0.0/8,RU-SPE\n", modTime: modTime.Add(time.Minute),
+			region: "RU-SPE"},
+		{name: "same time and size are not reread", content: "10.0.0.0/8,RU-KDA\n",
+			modTime: modTime.Add(time.Minute), region: "RU-SPE"},
+		{name: "same time and other size", content: "10.1.0.0/16,RU-KDA\n",
+			modTime: modTime.Add(time.Minute), region: "RU-KDA"},
+		{name: "broken file keeps previous database", content: "10.0.0.0/33,RU-MOW\n",
+			modTime: modTime.Add(2 * time.Minute), err: true, region: "RU-KDA"},
+		{name: "fixed file", content: "network,region\n10.0.0.0/8,RU-TVE\n",
+			modTime: modTime.Add(3 * time.Minute), region: "RU-TVE"},
+		{name: "removed file keeps previous database", remove: true, err: true, region: "RU-TVE"},
+		{name: "file is back with older time", content: "10.0.0.0/8,RU-MOW\n", modTime: modTime,
+			region: "RU-MOW"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.remove {
+				require.NoError(t, os.Remove(path))
+			} else {
+				writeFile(t, path, testCase.content, testCase.modTime)
+			}
+
+			err := db.reload()
+			if testCase.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			region, ok := db.Region(addr)
+			require.True(t, ok)
+			require.Equal(t, testCase.region, region)
+		})
+	}
+}
+
+func TestNewFileDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "regions.txt"), "10.0.0.0/8,RU-MOW\n", time.Now())
+	writeFile(t, filepath.Join(dir, "regions.MMDB"), "10.0.0.0/8,RU-MOW\n", time.Now())
+	writeFile(t, filepath.Join(dir, "broken.csv"), "network,region\n10.0.0.0,RU-MOW\n", time.Now())
+
+	testTable := []struct {
+		name string
+		file string
+		err  bool
+	}{
+		{name: "any extension except mmdb is csv", file: "regions.txt"},
+		{name: "mmdb extension in any case", file: "regions.MMDB", err: true},
+		{name: "broken csv", file: "broken.csv", err: true},
+		{name: "missing file", file: "missing.csv", err: true},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			db, err := NewFileDatabase(slog.Default(), filepath.Join(dir, testCase.file), time.Minute)
+			if testCase.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			region, ok := db.Region(netip.MustParseAddr("10.0.0.1"))
+			require.True(t, ok)
+			require.Equal(t, "RU-MOW", region)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regions.csv")
+	modTime := time.Now().Add(-time.Hour)
+	addr := netip.MustParseAddr("10.0.0.1")
+
+	writeFile(t, path, "10.0.0.0/8,RU-MOW\n", modTime)
+
+	db, err := NewFileDatabase(slog.Default(), path, 5*time.Millisecond)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		db.Run(ctx)
+		close(done)
+	}()
+
+	writeFile(t, path, "10.0.0.0/8,RU-SPE\n", modTime.Add(time.Minute))
+
+	require.Eventually(t, func() bool {
+		region, ok := db.Region(addr)
+		return ok && region == "RU-SPE"
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop after cancel")
+	}
+}
@@ -0,0 +1,10 @@
+package geo
+
+import "net/netip"
+
+// Database сопоставляет IP-адресу регион. Регион - строка из базы, например
+// код страны (RU) или субъекта (RU-MOW)
+type Database interface {
+	// Region возвращает регион адреса и false, если адреса нет в базе
+	Region(addr netip.Addr) (string, bool)
+}
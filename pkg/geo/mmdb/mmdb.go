@@ -0,0 +1,56 @@
+package mmdbgeo
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/Heatdog/Avito/pkg/geo"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// record - поля записи, из которых берется регион: собственное поле region
+// или коды страны и субъекта в формате баз GeoIP2/GeoLite2 City
+type record struct {
+	Region  string `maxminddb:"region"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+type mmdbDatabase struct {
+	reader *maxminddb.Reader
+}
+
+// NewMMDBDatabase открывает базу в формате MaxMind DB. Регион записи - поле region,
+// а если его нет - код страны и первого субъекта (RU-MOW) или только код страны
+func NewMMDBDatabase(data []byte) (geo.Database, error) {
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mmdbDatabase{
+		reader: reader,
+	}, nil
+}
+
+func (db *mmdbDatabase) Region(addr netip.Addr) (string, bool) {
+	var res record
+	if err := db.reader.Lookup(net.IP(addr.Unmap().AsSlice()), &res); err != nil {
+		return "", false
+	}
+
+	switch {
+	case res.Region != "":
+		return res.Region, true
+	case res.Country.ISOCode == "":
+		return "", false
+	case len(res.Subdivisions) != 0 && res.Subdivisions[0].ISOCode != "":
+		return res.Country.ISOCode + "-" + res.Subdivisions[0].ISOCode, true
+	default:
+		return res.Country.ISOCode, true
+	}
+}
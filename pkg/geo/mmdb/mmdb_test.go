@@ -0,0 +1,166 @@
+package mmdbgeo
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Типы данных формата MaxMind DB, которые нужны тестовой базе
+const (
+	typeString = 2
+	typeUint16 = 5
+	typeUint32 = 6
+	typeMap    = 7
+	typeArray  = 11
+)
+
+func encode(typ int, size int, payload ...byte) []byte {
+	if typ <= typeMap {
+		return append([]byte{byte(typ<<5 | size)}, payload...)
+	}
+
+	// расширенный тип: нулевой тип в управляющем байте и номер типа минус 7 в следующем
+	return append([]byte{byte(size), byte(typ - typeMap)}, payload...)
+}
+
+func str(s string) []byte {
+	return encode(typeString, len(s), []byte(s)...)
+}
+
+func uint16Value(v uint16) []byte {
+	return encode(typeUint16, 2, byte(v>>8), byte(v))
+}
+
+func uint32Value(v uint32) []byte {
+	return encode(typeUint32, 4, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// object кодирует map из пар ключ-значение, ключи идут через один начиная с первого элемента
+func object(pairs ...[]byte) []byte {
+	res := encode(typeMap, len(pairs)/2)
+	for _, pair := range pairs {
+		res = append(res, pair...)
+	}
+
+	return res
+}
+
+func array(items ...[]byte) []byte {
+	res := encode(typeArray, len(items))
+	for _, item := range items {
+		res = append(res, item...)
+	}
+
+	return res
+}
+
+// buildDatabase собирает базу IPv4 с размером записи 24 бита. Сети не должны пересекаться
+func buildDatabase(networks map[string][]byte) []byte {
+	// nodes[i] - левая и правая записи узла: 0 - адреса нет в базе
+	// (корень не бывает потомком), отрицательное число - смещение данных, сдвинутое на единицу
+	nodes := [][2]int{{}}
+
+	var data []byte
+
+	for network, record := range networks {
+		prefix := netip.MustParsePrefix(network)
+		addr := prefix.Addr().As4()
+
+		node := 0
+
+		for i := 0; i < prefix.Bits(); i++ {
+			bit := int(addr[i/8]>>(7-i%8)) & 1
+
+			if i == prefix.Bits()-1 {
+				nodes[node][bit] = -(len(data) + 1)
+				break
+			}
+
+			if nodes[node][bit] == 0 {
+				nodes = append(nodes, [2]int{})
+				nodes[node][bit] = len(nodes) - 1
+			}
+
+			node = nodes[node][bit]
+		}
+
+		data = append(data, record...)
+	}
+
+	var res []byte
+
+	for _, node := range nodes {
+		for _, value := range node {
+			switch {
+			case value == 0:
+				value = len(nodes)
+			case value < 0:
+				value = len(nodes) + 16 - value - 1
+			}
+
+			res = append(res, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+
+	res = append(res, make([]byte, 16)...)
+	res = append(res, data...)
+	res = append(res, "\xAB\xCD\xEFMaxMind.com"...)
+	res = append(res, object(
+		str("node_count"), uint32Value(uint32(len(nodes))),
+		str("record_size"), uint16Value(24),
+		str("ip_version"), uint16Value(4),
+		str("binary_format_major_version"), uint16Value(2),
+	)...)
+
+	return res
+}
+
+func TestRegion(t *testing.T) {
+	data := buildDatabase(map[string][]byte{
+		"10.0.0.0/8": object(str("region"), str("RU-SPE"),
+			str("country"), object(str("iso_code"), str("RU"))),
+		"20.1.0.0/16": object(str("country"), object(str("iso_code"), str("RU")),
+			str("subdivisions"), array(object(str("iso_code"), str("MOW")), object(str("iso_code"), str("X")))),
+		"30.0.0.0/8": object(str("country"), object(str("iso_code"), str("DE"))),
+		"40.0.0.0/8": object(str("country"), object(str("iso_code"), str("FR")),
+			str("subdivisions"), array(object(str("names"), str("Paris")))),
+		"50.0.0.0/8": object(str("city"), str("unknown")),
+	})
+
+	db, err := NewMMDBDatabase(data)
+	require.NoError(t, err)
+
+	testTable := []struct {
+		name   string
+		addr   string
+		region string
+		found  bool
+	}{
+		{name: "own region field", addr: "10.1.2.3", region: "RU-SPE", found: true},
+		{name: "country and first subdivision", addr: "20.1.0.1", region: "RU-MOW", found: true},
+		{name: "country only", addr: "30.0.0.1", region: "DE", found: true},
+		{name: "subdivision without code", addr: "40.0.0.1", region: "FR", found: true},
+		{name: "record without country", addr: "50.0.0.1", found: false},
+		{name: "ipv4-mapped address", addr: "::ffff:30.0.0.1", region: "DE", found: true},
+		{name: "address outside networks", addr: "20.2.0.1", found: false},
+		{name: "ipv6 address in ipv4 database", addr: "2001:db8::1", found: false},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			region, found := db.Region(netip.MustParseAddr(testCase.addr))
+			require.Equal(t, testCase.found, found)
+			require.Equal(t, testCase.region, region)
+		})
+	}
+}
+
+func TestNewMMDBDatabase(t *testing.T) {
+	_, err := NewMMDBDatabase([]byte("10.0.0.0/8,RU-MOW\n"))
+	require.Error(t, err)
+
+	_, err = NewMMDBDatabase(nil)
+	require.Error(t, err)
+}
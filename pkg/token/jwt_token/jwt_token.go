@@ -0,0 +1,84 @@
+package jwttoken
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/Heatdog/Avito/pkg/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Provider struct {
+	logger    *slog.Logger
+	key       []byte
+	roleClaim string
+}
+
+// MinKeyLength - минимальная длина ключа подписи в байтах. Проверка HS256 принимает и пустой ключ,
+// а токены, подписанные коротким ключом, можно подделать перебором
+const MinKeyLength = 32
+
+var ErrWeakKey = errors.New("jwt signing key must be at least 32 bytes")
+
+func NewJWTTokenProvider(logger *slog.Logger, key, roleClaim string) (token.Provider, error) {
+	if len(key) < MinKeyLength {
+		return nil, ErrWeakKey
+	}
+
+	return &Provider{
+		logger:    logger,
+		key:       []byte(key),
+		roleClaim: roleClaim,
+	}, nil
+}
+
+func (provider Provider) VerifyToken(tokenStr string) (token.Identity, bool) {
+	claims, ok := provider.parse(tokenStr)
+	if !ok {
+		return token.Identity{}, false
+	}
+
+	roleStr, ok := claims[provider.roleClaim].(string)
+	if !ok {
+		provider.logger.Debug("role claim not found", slog.String("claim", provider.roleClaim))
+		return token.Identity{}, false
+	}
+
+	role, ok := token.ParseRole(roleStr)
+	if !ok {
+		provider.logger.Debug("unknown role", slog.String("role", roleStr))
+		return token.Identity{}, false
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil {
+		provider.logger.Debug("bad subject claim", slog.Any("error", err))
+		return token.Identity{}, false
+	}
+
+	// субъект - автор изменений и участник согласования, без него токен не принимается
+	if subject == "" {
+		provider.logger.Debug("subject claim not found")
+		return token.Identity{}, false
+	}
+
+	return token.Identity{
+		Subject: subject,
+		Role:    role,
+	}, true
+}
+
+// parse проверяет подпись HS256 и временные ограничения exp/nbf
+func (provider Provider) parse(tokenStr string) (jwt.MapClaims, bool) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(_ *jwt.Token) (interface{}, error) {
+		return provider.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		provider.logger.Debug("jwt verification failed", slog.Any("error", err))
+		return nil, false
+	}
+
+	return claims, true
+}
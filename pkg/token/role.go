@@ -0,0 +1,54 @@
+package token
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleViewer    Role = "viewer"
+	RoleEditor    Role = "editor"
+	RolePublisher Role = "publisher"
+	RoleAdmin     Role = "admin"
+	// RoleTracker - сборщик показов и кликов, другие действия ему недоступны
+	RoleTracker Role = "tracker"
+)
+
+type Permission string
+
+const (
+	PermissionReadBanner    Permission = "banner:read"
+	PermissionEditBanner    Permission = "banner:edit"
+	PermissionDeleteBanner  Permission = "banner:delete"
+	PermissionSwitchVersion Permission = "banner:switch_version"
+	PermissionApproveBanner Permission = "banner:approve"
+	PermissionManageAPIKeys Permission = "api_key:manage"
+	PermissionRecordEvent   Permission = "event:record"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:   {},
+	RoleViewer: {PermissionReadBanner},
+	RoleEditor: {PermissionReadBanner, PermissionEditBanner},
+	RolePublisher: {PermissionReadBanner, PermissionEditBanner,
+		PermissionSwitchVersion},
+	RoleAdmin: {PermissionReadBanner, PermissionEditBanner,
+		PermissionSwitchVersion, PermissionDeleteBanner, PermissionManageAPIKeys, PermissionApproveBanner,
+		PermissionRecordEvent},
+	RoleTracker: {PermissionRecordEvent},
+}
+
+func ParseRole(role string) (Role, bool) {
+	res := Role(role)
+	_, ok := rolePermissions[res]
+
+	return res, ok
+}
+
+func (role Role) HasPermission(permission Permission) bool {
+	for _, rolePermission := range rolePermissions[role] {
+		if rolePermission == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,21 +2,29 @@ package simpletoken
 
 import "github.com/Heatdog/Avito/pkg/token"
 
-const (
-	userToken  = "user_token"
-	adminToken = "admin_token"
-)
+var tokens = map[string]token.Role{
+	"user_token":      token.RoleUser,
+	"viewer_token":    token.RoleViewer,
+	"editor_token":    token.RoleEditor,
+	"publisher_token": token.RolePublisher,
+	"admin_token":     token.RoleAdmin,
+	"tracker_token":   token.RoleTracker,
+}
 
+// Provider принимает общие для роли токены из tokens. Он нужен тестам и локальной разработке,
+// сервис включает его только с настройкой allow_dev_tokens
 type Provider struct{}
 
 func NewSimpleTokenProvider() token.Provider {
 	return &Provider{}
 }
 
-func (provider Provider) VerifyToken(token string) bool {
-	return token == userToken || token == adminToken
-}
+// VerifyToken возвращает только роль: токен общий для всех пользователей роли,
+// поэтому субъекта у него нет и действия согласования с ним недоступны
+func (provider Provider) VerifyToken(tokenStr string) (token.Identity, bool) {
+	role, ok := tokens[tokenStr]
 
-func (provider Provider) VerifyOnAdmin(token string) bool {
-	return token == adminToken
+	return token.Identity{
+		Role: role,
+	}, ok
 }
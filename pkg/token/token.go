@@ -1,6 +1,12 @@
 package token
 
+// Identity - владелец проверенного токена. Subject используется как автор изменений
+// и участник согласования, пустой Subject означает, что токен не указывает на владельца
+type Identity struct {
+	Subject string
+	Role    Role
+}
+
 type Provider interface {
-	VerifyToken(token string) bool
-	VerifyOnAdmin(token string) bool
+	VerifyToken(token string) (Identity, bool)
 }